@@ -0,0 +1,319 @@
+package business
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+const (
+	// APIKeyHeader carries an API key instead of a bearer token
+	APIKeyHeader = "X-API-Key"
+
+	// apiKeyPrefix starts every API key so they can't be confused with JWTs
+	apiKeyPrefix = "ik_"
+	// apiKeyRecords is where keys are kept under the system prefix
+	apiKeyRecords = "apikeys/"
+)
+
+// Scopes an API key can be granted
+const (
+	ScopeUpload = "upload"
+	ScopeRead   = "read"
+	ScopeDelete = "delete"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned for unknown or malformed key IDs
+	ErrAPIKeyNotFound = foundation.NewError(foundation.NotFound, "api key not found")
+	// ErrInvalidAPIKey is returned when a key does not verify or was revoked
+	ErrInvalidAPIKey = foundation.NewError(foundation.Unauthenticated, "invalid api key")
+	// ErrInvalidScope is returned when a key is created without scopes or with unknown ones
+	ErrInvalidScope = foundation.NewError(foundation.InvalidRequest, "scopes must be one or more of upload, read, delete")
+	// ErrMissingTenant is returned when a key is created without a tenant to act as
+	ErrMissingTenant = foundation.NewError(foundation.InvalidRequest, "api key needs a tenant")
+	// ErrAPIKeyBusy is returned when the key kept changing while it was updated
+	ErrAPIKeyBusy = foundation.NewError(foundation.Conflict, "api key is being updated, retry")
+
+	// errAPIKeyUnchanged leaves the key as is in update
+	errAPIKeyUnchanged = errors.New("api key unchanged")
+
+	validScopes = []string{ScopeUpload, ScopeRead, ScopeDelete}
+)
+
+// APIKey describes a service key, the secret itself is only returned when
+// the key is created or rotated
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Tenant    string     `json:"tenant"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// apiKeyRecord is what is persisted, only the hash of the secret is kept
+type apiKeyRecord struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+/*
+APIKeys manages API keys for callers without a user, such as batch pipelines
+  - Keys look like ik_<id>_<secret>, the ID is used to find the key
+  - Only the SHA-256 of the key is stored, under SystemPrefix in the bucket
+  - Requests made with a key act as its tenant and are limited to its scopes
+*/
+type APIKeys struct {
+	bu *BucketUpload
+}
+
+func NewAPIKeys(bu *BucketUpload) *APIKeys {
+	return &APIKeys{bu: bu}
+}
+
+// Create issues a new key, the returned secret can't be recovered later
+func (k *APIKeys) Create(ctx context.Context, name, tenant string, scopes []string) (*APIKey, string, error) {
+	if tenant == "" {
+		return nil, "", ErrMissingTenant
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(validScopes, scope) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	rec := &apiKeyRecord{APIKey: APIKey{
+		ID:        id,
+		Name:      name,
+		Tenant:    tenant,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		CreatedAt: time.Now().UTC(),
+	}}
+	secret, err := issueAPIKey(rec)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := k.bu.createRecord(ctx, apiKeyRecords+rec.ID, rec); err != nil {
+		return nil, "", err
+	}
+
+	return &rec.APIKey, secret, nil
+}
+
+// List returns every key, including revoked ones, oldest first
+func (k *APIKeys) List(ctx context.Context) ([]*APIKey, error) {
+	ids, err := k.bu.recordKeys(ctx, apiKeyRecords)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*APIKey, 0, len(ids))
+	for _, id := range ids {
+		rec, err := k.get(ctx, strings.TrimPrefix(id, apiKeyRecords))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &rec.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// Rotate replaces the secret of a key, the old secret stops working straight away.
+// A key revoked while it is rotated stays revoked
+func (k *APIKeys) Rotate(ctx context.Context, id string) (*APIKey, string, error) {
+	var secret string
+	rec, err := k.update(ctx, id, func(rec *apiKeyRecord) error {
+		if rec.RevokedAt != nil {
+			return ErrInvalidAPIKey
+		}
+		now := time.Now().UTC()
+		rec.RotatedAt = &now
+		var err error
+		secret, err = issueAPIKey(rec)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &rec.APIKey, secret, nil
+}
+
+// Revoke stops a key from being used, it is kept so it still shows up in listings
+func (k *APIKeys) Revoke(ctx context.Context, id string) error {
+	_, err := k.update(ctx, id, func(rec *apiKeyRecord) error {
+		if rec.RevokedAt != nil {
+			return errAPIKeyUnchanged
+		}
+		now := time.Now().UTC()
+		rec.RevokedAt = &now
+		return nil
+	})
+	if errors.Is(err, errAPIKeyUnchanged) {
+		return nil
+	}
+
+	return err
+}
+
+// Verify returns the principal acting for the key
+func (k *APIKeys) Verify(ctx context.Context, key string) (*Principal, error) {
+	id, ok := apiKeyID(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	rec, err := k.get(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rec.RevokedAt != nil || subtle.ConstantTimeCompare([]byte(rec.Hash), []byte(hashAPIKey(key))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return &Principal{
+		UserID:      rec.Tenant,
+		APIKeyID:    rec.ID,
+		Scopes:      rec.Scopes,
+		Permissions: scopesPermissions(rec.Scopes),
+	}, nil
+}
+
+// issueAPIKey generates a new secret for the record and returns the key, only its hash is kept
+func issueAPIKey(rec *apiKeyRecord) (string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	key := apiKeyPrefix + rec.ID + "_" + secret
+	rec.Hash = hashAPIKey(key)
+
+	return key, nil
+}
+
+/*
+update applies change to the key and writes it with If-Match on its etag
+  - The key is read again and change retried when another request changed it,
+    so a rotation can not undo a revocation done at the same time
+  - An error from change is returned as is and nothing is written
+*/
+func (k *APIKeys) update(ctx context.Context, id string, change func(*apiKeyRecord) error) (*apiKeyRecord, error) {
+	if len(id) != 16 || !isHex(id) {
+		return nil, ErrAPIKeyNotFound
+	}
+	for range recordAttempts {
+		rec := &apiKeyRecord{}
+		etag, err := k.bu.getRecordETag(ctx, apiKeyRecords+id, rec)
+		switch {
+		case errors.Is(err, errRecordNotFound):
+			return nil, ErrAPIKeyNotFound
+		case errors.Is(err, errRecordChanged):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if err := change(rec); err != nil {
+			return nil, err
+		}
+		err = k.bu.updateRecord(ctx, apiKeyRecords+id, rec, etag)
+		switch {
+		case errors.Is(err, errRecordNotFound):
+			return nil, ErrAPIKeyNotFound
+		case !errors.Is(err, errRecordChanged):
+			return rec, err
+		}
+	}
+
+	return nil, ErrAPIKeyBusy
+}
+
+func (k *APIKeys) get(ctx context.Context, id string) (*apiKeyRecord, error) {
+	// IDs end up in object keys, only accept what we generate
+	if len(id) != 16 || !isHex(id) {
+		return nil, ErrAPIKeyNotFound
+	}
+	rec := &apiKeyRecord{}
+	err := k.bu.getRecord(ctx, apiKeyRecords+id, rec)
+	if errors.Is(err, errRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// APIKeyAuthenticator accepts API keys and hands every other token to Authenticator
+type APIKeyAuthenticator struct {
+	Authenticator
+	Keys *APIKeys
+}
+
+func NewAPIKeyAuthenticator(auth Authenticator, keys *APIKeys) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{Authenticator: auth, Keys: keys}
+}
+
+// Authenticate verifies API keys locally and delegates bearer tokens
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if IsAPIKey(token) {
+		return a.Keys.Verify(ctx, token)
+	}
+
+	return a.Authenticator.Authenticate(ctx, token)
+}
+
+// IsAPIKey reports whether the token looks like an API key rather than a bearer token
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// apiKeyID returns the ID part of ik_<id>_<secret>
+func apiKeyID(key string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(parts) != 2 {
+		return "", false
+	}
+
+	return parts[0], true
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,119 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	bu := NewBucketUpload(store, "test")
+	keys := NewAPIKeys(bu)
+
+	key, secret, err := keys.Create(ctx, "nightly import", "pipeline", []string{ScopeUpload, ScopeRead, ScopeUpload})
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeRead, ScopeUpload}, key.Scopes)
+	assert.True(t, IsAPIKey(secret))
+
+	p, err := keys.Verify(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, "pipeline", p.UserID)
+	assert.True(t, p.Can(PermissionUpload))
+	assert.False(t, p.Can(PermissionDeleteOwn))
+
+	// only the hash is stored and the records are hidden from users
+	rec := &apiKeyRecord{}
+	require.NoError(t, bu.getRecord(ctx, apiKeyRecords+key.ID, rec))
+	assert.Equal(t, hashAPIKey(secret), rec.Hash)
+	files, err := bu.ListFiles(ctx, "pipeline", FileFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	_, err = bu.StatFile(ctx, "", SystemPrefix+apiKeyRecords+key.ID)
+	assert.ErrorIs(t, err, ErrFileNotFound)
+
+	rotated, newSecret, err := keys.Rotate(ctx, key.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, rotated.RotatedAt)
+	_, err = keys.Verify(ctx, secret)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = keys.Verify(ctx, newSecret)
+	require.NoError(t, err)
+
+	require.NoError(t, keys.Revoke(ctx, key.ID))
+	_, err = keys.Verify(ctx, newSecret)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	listed, err := keys.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.NotNil(t, listed[0].RevokedAt)
+}
+
+func TestAPIKeysErrors(t *testing.T) {
+	ctx := context.Background()
+	keys := NewAPIKeys(NewBucketUpload(storagetest.NewMemory(), "test"))
+	scenarios := []struct {
+		name   string
+		tenant string
+		scopes []string
+		err    error
+	}{
+		{name: "missing tenant", scopes: []string{ScopeRead}, err: ErrMissingTenant},
+		{name: "missing scopes", tenant: "pipeline", err: ErrInvalidScope},
+		{name: "unknown scope", tenant: "pipeline", scopes: []string{"admin"}, err: ErrInvalidScope},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			_, _, err := keys.Create(ctx, "", scenario.tenant, scenario.scopes)
+			assert.ErrorIs(t, err, scenario.err)
+		})
+	}
+
+	for _, key := range []string{"", "ik_", "ik_0123456789abcdef_secret", "ik_../../etc_secret", "Bearer x"} {
+		_, err := keys.Verify(ctx, key)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey, key)
+	}
+	assert.ErrorIs(t, keys.Revoke(ctx, "../x"), ErrAPIKeyNotFound)
+}
+
+func TestAPIKeysRotateWhileRevoked(t *testing.T) {
+	ctx := context.Background()
+	keys := NewAPIKeys(NewBucketUpload(storagetest.NewMemory(), "test"))
+
+	for range 20 {
+		key, _, err := keys.Create(ctx, "nightly import", "pipeline", []string{ScopeUpload})
+		require.NoError(t, err)
+		var (
+			wg      sync.WaitGroup
+			secrets = make(chan string, 3)
+		)
+		// fewer rotations than attempts, so the revocation can not lose every race
+		for range 3 {
+			wg.Go(func() {
+				_, secret, err := keys.Rotate(ctx, key.ID)
+				if err != nil {
+					assert.True(t, errors.Is(err, ErrInvalidAPIKey) || errors.Is(err, ErrAPIKeyBusy), err)
+					return
+				}
+				secrets <- secret
+			})
+		}
+		wg.Go(func() {
+			assert.NoError(t, keys.Revoke(ctx, key.ID))
+		})
+		wg.Wait()
+		close(secrets)
+
+		for secret := range secrets {
+			_, err := keys.Verify(ctx, secret)
+			assert.ErrorIs(t, err, ErrInvalidAPIKey, "a rotation undid the revocation")
+		}
+	}
+}
@@ -0,0 +1,477 @@
+package business
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestInfoContextKey holds the *RequestInfo of a request
+const RequestInfoContextKey contextKey = "requestInfo"
+
+// Actions recorded in the audit log
+const (
+	AuditUpload           = "upload"
+	AuditDownload         = "download"
+	AuditPresignDownload  = "download.presign"
+	AuditDelete           = "delete"
+	AuditShare            = "share"
+	AuditShareRevoke      = "share.revoke"
+	AuditShareDownload    = "share.download"
+	AuditUploadLink       = "upload_link.create"
+	AuditUploadLinkRevoke = "upload_link.revoke"
+	AuditMetadataUpdate   = "metadata.update"
+	AuditMove             = "move"
+	AuditFolderCreate     = "folder.create"
+	AuditFolderRename     = "folder.rename"
+	AuditFolderDelete     = "folder.delete"
+	AuditExport           = "export"
+)
+
+const (
+	// AuditSuccess is the outcome of operations which succeeded
+	AuditSuccess = "success"
+	// AuditFailure is the outcome of operations which failed, Detail holds the error
+	AuditFailure = "failure"
+
+	auditRecords = "audit/"
+	// maxAuditQuery bounds the entries returned by one query
+	maxAuditQuery = 1000
+	// auditRetries is how often a batch is chained again when another replica appended first
+	auditRetries = 10
+	// maxAuditBatch bounds the entries stored together
+	maxAuditBatch = 100
+	// auditQueueSize is how many entries wait for the writer before Record drops them
+	auditQueueSize = 1024
+)
+
+// ErrAuditTampered is returned by Verify when the chain is broken
+var ErrAuditTampered = errors.New("audit log was tampered with")
+
+// RequestInfo describes the request an operation is done for
+type RequestInfo struct {
+	ID       string
+	ClientIP string
+	// UserID is set once the caller authenticated
+	UserID string
+}
+
+// WithRequestInfo stores info for the audit log of the operations done with ctx
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, RequestInfoContextKey, info)
+}
+
+// RequestInfoFromContext returns the info stored by WithRequestInfo
+func RequestInfoFromContext(ctx context.Context) (*RequestInfo, bool) {
+	info, ok := ctx.Value(RequestInfoContextKey).(*RequestInfo)
+	return info, ok && info != nil
+}
+
+// setRequestUser records the authenticated caller on the request info of ctx
+func setRequestUser(ctx context.Context, userID string) {
+	if info, ok := RequestInfoFromContext(ctx); ok {
+		info.UserID = userID
+	}
+}
+
+/*
+AuditEntry is one operation on a file
+  - UserID is the authenticated caller, empty for share and upload links
+  - Hash is the SHA-256 of the entry with PrevHash, the hash of the entry before it,
+    so changing or removing an entry breaks every hash after it
+*/
+type AuditEntry struct {
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	UserID    string    `json:"userID,omitempty"`
+	RequestID string    `json:"requestID,omitempty"`
+	ClientIP  string    `json:"clientIP,omitempty"`
+	ObjectID  string    `json:"objectID,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Detail    string    `json:"detail,omitempty"`
+	PrevHash  string    `json:"prevHash"`
+	Hash      string    `json:"hash"`
+}
+
+// computeHash hashes every field but Hash
+func (e *AuditEntry) computeHash() string {
+	entry := *e
+	entry.Hash = ""
+	data, _ := json.Marshal(&entry)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter selects entries, empty fields match every entry
+type AuditFilter struct {
+	UserID   string
+	ObjectID string
+	Action   string
+	Since    time.Time
+	Until    time.Time
+	// Before only returns entries numbered lower, it pages through the log
+	Before int64
+	// Limit defaults to 100 and is at most 1000
+	Limit int
+}
+
+func (f AuditFilter) match(e *AuditEntry) bool {
+	return (f.UserID == "" || e.UserID == f.UserID) &&
+		(f.ObjectID == "" || e.ObjectID == f.ObjectID) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+/*
+Audit keeps a hash chained log of file operations under SystemPrefix
+  - Record queues entries for a background writer, which stores the entries
+    queued together as one batch so busy replicas do not write per operation
+  - Record never blocks, entries are dropped, counted and logged when the
+    writer is auditQueueSize entries behind
+  - Batches are stored under the number of their first entry and created only
+    if that number is free, a replica which lost the race chains its batch
+    again after the new tail, so replicas can not fork the chain
+  - Failing to record an entry is logged, the operation is not undone
+*/
+type Audit struct {
+	bu     *BucketUpload
+	Logger *logrus.Logger
+
+	queue chan auditItem
+	start sync.Once
+
+	// mu serialises appends within a replica, tail is the last entry seen
+	mu   sync.Mutex
+	tail *AuditEntry
+}
+
+// auditItem is an entry to store, or a flush waiting for the entries queued before it
+type auditItem struct {
+	entry   *AuditEntry
+	flushed chan struct{}
+}
+
+func NewAudit(bu *BucketUpload, logger *logrus.Logger) *Audit {
+	return &Audit{
+		bu:     bu,
+		Logger: logger,
+		queue:  make(chan auditItem, auditQueueSize),
+	}
+}
+
+// Record queues an entry for the operation, the request details come from ctx
+func (a *Audit) Record(ctx context.Context, action, objectID string, opErr error) {
+	entry := &AuditEntry{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		ObjectID: objectID,
+		Outcome:  AuditSuccess,
+	}
+	if info, ok := RequestInfoFromContext(ctx); ok {
+		entry.UserID, entry.RequestID, entry.ClientIP = info.UserID, info.ID, info.ClientIP
+	}
+	if entry.UserID == "" {
+		if p, ok := PrincipalFromContext(ctx); ok {
+			entry.UserID = p.UserID
+		}
+	}
+	if opErr != nil {
+		entry.Outcome = AuditFailure
+		entry.Detail = opErr.Error()
+	}
+	a.start.Do(func() {
+		go a.write()
+	})
+	select {
+	case a.queue <- auditItem{entry: entry}:
+	default:
+		auditEntriesDropped.Inc()
+		a.Logger.WithFields(logrus.Fields{
+			"action": entry.Action,
+			"object": entry.ObjectID,
+			"user":   entry.UserID,
+		}).Warn("audit queue is full, the entry is dropped")
+	}
+}
+
+// Flush waits until the entries recorded so far are stored, or ctx is done
+func (a *Audit) Flush(ctx context.Context) error {
+	a.start.Do(func() {
+		go a.write()
+	})
+	flushed := make(chan struct{})
+	select {
+	case a.queue <- auditItem{flushed: flushed}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write stores the queued entries, taking whatever else is queued into the same batch
+func (a *Audit) write() {
+	for item := range a.queue {
+		items := []auditItem{item}
+	collect:
+		for len(items) < maxAuditBatch {
+			select {
+			case item := <-a.queue:
+				items = append(items, item)
+			default:
+				break collect
+			}
+		}
+		entries := make([]*AuditEntry, 0, len(items))
+		for _, item := range items {
+			if item.entry != nil {
+				entries = append(entries, item.entry)
+			}
+		}
+		// entries are kept even when the requests recording them were cancelled
+		if err := a.Append(context.Background(), entries...); err != nil {
+			a.Logger.WithField("entries", len(entries)).Errorf("failed to record audit entries: %v", err)
+		}
+		for _, item := range items {
+			if item.flushed != nil {
+				close(item.flushed)
+			}
+		}
+	}
+}
+
+// Append chains the entries after the last one and stores them as one batch,
+// Seq, PrevHash and Hash are set
+func (a *Audit) Append(ctx context.Context, entries ...*AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tail == nil {
+		tail, err := a.last(ctx)
+		if err != nil {
+			return err
+		}
+		a.tail = tail
+	}
+	for range auditRetries {
+		prev := a.tail
+		for _, entry := range entries {
+			entry.Seq, entry.PrevHash = prev.Seq+1, prev.Hash
+			entry.Hash = entry.computeHash()
+			prev = entry
+		}
+		err := a.bu.createRecord(ctx, auditKey(entries[0].Seq), entries)
+		if err == nil {
+			a.tail = prev
+			return nil
+		}
+		if !errors.Is(err, errRecordExists) {
+			return err
+		}
+		// another replica appended, follow the chain to its new tail
+		if err := a.advance(ctx); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("failed to append audit entries after %d attempts", auditRetries)
+}
+
+/*
+Verify checks every entry in order and returns how many there are and the
+hash of the last one
+  - ErrAuditTampered is returned for the first entry which was changed, removed
+    or inserted
+  - Removing the newest entries can only be noticed by comparing the returned
+    hash with one kept elsewhere
+  - Entries queued on this replica are stored first
+*/
+func (a *Audit) Verify(ctx context.Context) (int64, string, error) {
+	if err := a.Flush(ctx); err != nil {
+		return 0, "", err
+	}
+	keys, err := a.keys(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	prev := &AuditEntry{}
+	for _, key := range keys {
+		batch, err := a.batch(ctx, key)
+		if err != nil {
+			return prev.Seq, prev.Hash, err
+		}
+		if auditKey(batch[0].Seq) != key {
+			return prev.Seq, prev.Hash, fmt.Errorf("%w: %s holds entry %d", ErrAuditTampered, key, batch[0].Seq)
+		}
+		for _, entry := range batch {
+			switch {
+			case entry.Seq != prev.Seq+1:
+				return prev.Seq, prev.Hash, fmt.Errorf("%w: entry %d is missing", ErrAuditTampered, prev.Seq+1)
+			case entry.PrevHash != prev.Hash:
+				return prev.Seq, prev.Hash, fmt.Errorf("%w: entry %d does not follow entry %d", ErrAuditTampered, entry.Seq, prev.Seq)
+			case entry.Hash != entry.computeHash():
+				return prev.Seq, prev.Hash, fmt.Errorf("%w: entry %d was changed", ErrAuditTampered, entry.Seq)
+			}
+			prev = entry
+		}
+	}
+
+	return prev.Seq, prev.Hash, nil
+}
+
+/*
+Query returns the entries matching the filter, newest first
+  - Batches are found by their keys, Before skips the newer ones without reading
+    them and Until is found with a binary search, so a page only reads the batches
+    it returns entries from and the ones filtered out in between
+  - Entries queued on this replica are stored first
+*/
+func (a *Audit) Query(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	filter.Limit = min(filter.Limit, maxAuditQuery)
+	if err := a.Flush(ctx); err != nil {
+		return nil, err
+	}
+	keys, err := a.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Before > 0 {
+		keys = keys[:sort.SearchStrings(keys, auditKey(filter.Before))]
+	}
+	if !filter.Until.IsZero() {
+		var searchErr error
+		end := sort.Search(len(keys), func(i int) bool {
+			batch, err := a.batch(ctx, keys[i])
+			if err != nil {
+				searchErr = err
+				return true
+			}
+			return !batch[0].Time.Before(filter.Until)
+		})
+		if searchErr != nil {
+			return nil, searchErr
+		}
+		keys = keys[:end]
+	}
+	entries := make([]*AuditEntry, 0)
+	for _, key := range slices.Backward(keys) {
+		batch, err := a.batch(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range slices.Backward(batch) {
+			if filter.Before > 0 && entry.Seq >= filter.Before {
+				continue
+			}
+			if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+				return entries, nil
+			}
+			if filter.match(entry) {
+				entries = append(entries, entry)
+			}
+			if len(entries) == filter.Limit {
+				return entries, nil
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// last returns the newest entry, or an empty one to chain the first entry after
+func (a *Audit) last(ctx context.Context) (*AuditEntry, error) {
+	keys, err := a.keys(ctx)
+	if err != nil || len(keys) == 0 {
+		return &AuditEntry{}, err
+	}
+	batch, err := a.batch(ctx, keys[len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return batch[len(batch)-1], nil
+}
+
+// advance moves tail to the newest entry following it
+func (a *Audit) advance(ctx context.Context) error {
+	for {
+		batch, err := a.batch(ctx, auditKey(a.tail.Seq+1))
+		if errors.Is(err, errRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		a.tail = batch[len(batch)-1]
+	}
+}
+
+// batch reads the entries stored under key
+func (a *Audit) batch(ctx context.Context, key string) ([]*AuditEntry, error) {
+	var batch []*AuditEntry
+	if err := a.bu.getRecord(ctx, key, &batch); err != nil {
+		return nil, err
+	}
+	if len(batch) == 0 || slices.Contains(batch, nil) {
+		return nil, fmt.Errorf("%w: %s holds no entries", ErrAuditTampered, key)
+	}
+
+	return batch, nil
+}
+
+// keys lists the batch keys in order, the zero padded numbers sort as strings
+func (a *Audit) keys(ctx context.Context) ([]string, error) {
+	keys, err := a.bu.recordKeys(ctx, auditRecords)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(keys)
+
+	return keys, nil
+}
+
+func auditKey(seq int64) string {
+	return auditRecords + fmt.Sprintf("%020d", seq)
+}
+
+// audit records the operation when the audit log is enabled
+func (bu *BucketUpload) audit(ctx context.Context, action, objectID string, err error) {
+	if bu.Audit != nil {
+		bu.Audit.Record(ctx, action, objectID, err)
+	}
+}
+
+// ParseAuditTime accepts RFC 3339 times and unix seconds in queries
+func ParseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+
+	return time.Parse(time.RFC3339, strings.TrimSpace(value))
+}
@@ -0,0 +1,284 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAuditLog returns a bucket with the audit log enabled and three entries
+func newAuditLog(t *testing.T) *BucketUpload {
+	t.Helper()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	bu.Audit = NewAudit(bu, logrus.New())
+	ctx := WithRequestInfo(context.Background(), &RequestInfo{ID: "req-1", ClientIP: "10.0.0.1", UserID: "alice"})
+	// flushing after each entry stores them in batches of one
+	bu.Audit.Record(ctx, AuditUpload, "a.pdf", nil)
+	require.NoError(t, bu.Audit.Flush(ctx))
+	bu.Audit.Record(ctx, AuditDownload, "a.pdf", nil)
+	require.NoError(t, bu.Audit.Flush(ctx))
+	bu.Audit.Record(ctx, AuditDelete, "b.pdf", errors.New("not found"))
+	require.NoError(t, bu.Audit.Flush(ctx))
+
+	return bu
+}
+
+// editEntry rewrites the entry stored alone under its number
+func editEntry(t *testing.T, bu *BucketUpload, seq int64, edit func(entry *AuditEntry)) {
+	var batch []*AuditEntry
+	require.NoError(t, bu.getRecord(context.Background(), auditKey(seq), &batch))
+	require.Len(t, batch, 1)
+	edit(batch[0])
+	require.NoError(t, bu.putRecord(context.Background(), auditKey(seq), batch))
+}
+
+func TestAuditRecord(t *testing.T) {
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	bu.Audit = NewAudit(bu, logrus.New())
+	ctx := WithRequestInfo(context.Background(), &RequestInfo{ID: "req-1", ClientIP: "10.0.0.1"})
+	ctx = WithPrincipal(ctx, &Principal{UserID: "alice"})
+
+	fu := newIdempotentUpload("alice", "hello")
+	require.NoError(t, bu.Upload(ctx, fu))
+	_, file, err := bu.GetFile(ctx, "alice", fu.ID)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Error(t, bu.DeleteFile(ctx, "bob", fu.ID))
+
+	entries, err := bu.Audit.Query(context.Background(), AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, []string{AuditDelete, AuditDownload, AuditUpload},
+		[]string{entries[0].Action, entries[1].Action, entries[2].Action})
+	for _, entry := range entries {
+		assert.Equal(t, "alice", entry.UserID)
+		assert.Equal(t, "req-1", entry.RequestID)
+		assert.Equal(t, "10.0.0.1", entry.ClientIP)
+		assert.Equal(t, fu.ID, entry.ObjectID)
+	}
+	assert.Equal(t, AuditFailure, entries[0].Outcome)
+	assert.NotEmpty(t, entries[0].Detail)
+	assert.Equal(t, AuditSuccess, entries[1].Outcome)
+	assert.Equal(t, entries[2].Hash, entries[1].PrevHash)
+	assert.Equal(t, entries[1].Hash, entries[0].PrevHash)
+}
+
+func TestAuditVerify(t *testing.T) {
+	scenarios := []struct {
+		name    string
+		tamper  func(t *testing.T, bu *BucketUpload)
+		entries int64
+		err     error
+	}{
+		{
+			name:    "untouched",
+			tamper:  func(*testing.T, *BucketUpload) {},
+			entries: 3,
+		},
+		{
+			name: "changed entry",
+			tamper: func(t *testing.T, bu *BucketUpload) {
+				editEntry(t, bu, 2, func(entry *AuditEntry) {
+					entry.UserID = "mallory"
+				})
+			},
+			entries: 1,
+			err:     ErrAuditTampered,
+		},
+		{
+			name: "changed entry with its hash",
+			tamper: func(t *testing.T, bu *BucketUpload) {
+				editEntry(t, bu, 2, func(entry *AuditEntry) {
+					entry.UserID = "mallory"
+					entry.Hash = entry.computeHash()
+				})
+			},
+			entries: 2,
+			err:     ErrAuditTampered,
+		},
+		{
+			name: "removed entry",
+			tamper: func(t *testing.T, bu *BucketUpload) {
+				require.NoError(t, bu.removeRecord(context.Background(), auditKey(2)))
+			},
+			entries: 1,
+			err:     ErrAuditTampered,
+		},
+		{
+			name: "moved entry",
+			tamper: func(t *testing.T, bu *BucketUpload) {
+				var batch []*AuditEntry
+				require.NoError(t, bu.getRecord(context.Background(), auditKey(3), &batch))
+				require.NoError(t, bu.putRecord(context.Background(), auditKey(4), batch))
+			},
+			entries: 3,
+			err:     ErrAuditTampered,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			bu := newAuditLog(t)
+			scenario.tamper(t, bu)
+			entries, head, err := bu.Audit.Verify(context.Background())
+			assert.ErrorIs(t, err, scenario.err)
+			assert.Equal(t, scenario.entries, entries)
+			assert.Len(t, head, 64)
+		})
+	}
+}
+
+func TestAuditReplicas(t *testing.T) {
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	replicas := []*Audit{NewAudit(bu, logrus.New()), NewAudit(bu, logrus.New())}
+
+	var wg sync.WaitGroup
+	for _, audit := range replicas {
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, audit.Append(context.Background(), &AuditEntry{Action: AuditUpload}))
+			}()
+		}
+	}
+	wg.Wait()
+
+	entries, _, err := replicas[0].Verify(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), entries)
+}
+
+func TestAuditBatches(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	replicas := []*Audit{
+		NewAudit(NewBucketUpload(store, "test"), logrus.New()),
+		NewAudit(NewBucketUpload(store, "test"), logrus.New()),
+	}
+	var wg sync.WaitGroup
+	for _, audit := range replicas {
+		for range 200 {
+			wg.Go(func() {
+				audit.Record(ctx, AuditUpload, "a.pdf", nil)
+			})
+		}
+	}
+	wg.Wait()
+	for _, audit := range replicas {
+		require.NoError(t, audit.Flush(ctx))
+	}
+
+	entries, _, err := replicas[0].Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(400), entries)
+	keys, err := replicas[0].keys(ctx)
+	require.NoError(t, err)
+	assert.Less(t, len(keys), 400, "queued entries are stored together")
+
+	// pages follow each other without gaps
+	seen := 0
+	filter := AuditFilter{Limit: 150}
+	for {
+		page, err := replicas[1].Query(ctx, filter)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		assert.Equal(t, entries-int64(seen), page[0].Seq)
+		seen += len(page)
+		filter.Before = page[len(page)-1].Seq
+	}
+	assert.Equal(t, 400, seen)
+}
+
+func TestAuditQueueFull(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	audit := NewAudit(bu, logrus.New())
+	// a queue of one entry with the writer not started yet
+	audit.queue = make(chan auditItem, 1)
+	audit.start.Do(func() {})
+	dropped := testutil.ToFloat64(auditEntriesDropped)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		audit.Record(ctx, AuditUpload, "a.pdf", nil)
+		audit.Record(ctx, AuditUpload, "b.pdf", nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record blocked on a full queue")
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(auditEntriesDropped)-dropped)
+
+	go audit.write()
+	entries, err := audit.Query(ctx, AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a.pdf", entries[0].ObjectID)
+}
+
+func TestAuditQuery(t *testing.T) {
+	bu := newAuditLog(t)
+	scenarios := []struct {
+		name    string
+		filter  AuditFilter
+		actions []string
+	}{
+		{name: "all", actions: []string{AuditDelete, AuditDownload, AuditUpload}},
+		{name: "object", filter: AuditFilter{ObjectID: "a.pdf"}, actions: []string{AuditDownload, AuditUpload}},
+		{name: "action", filter: AuditFilter{Action: AuditDelete}, actions: []string{AuditDelete}},
+		{name: "other user", filter: AuditFilter{UserID: "bob"}, actions: []string{}},
+		{name: "limit", filter: AuditFilter{Limit: 1}, actions: []string{AuditDelete}},
+		{name: "until", filter: AuditFilter{Until: time.Now().Add(-time.Hour)}, actions: []string{}},
+		{name: "since", filter: AuditFilter{Since: time.Now().Add(-time.Hour)}, actions: []string{AuditDelete, AuditDownload, AuditUpload}},
+		{name: "until now", filter: AuditFilter{Until: time.Now().Add(time.Hour)}, actions: []string{AuditDelete, AuditDownload, AuditUpload}},
+		{name: "before", filter: AuditFilter{Before: 3}, actions: []string{AuditDownload, AuditUpload}},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			entries, err := bu.Audit.Query(context.Background(), scenario.filter)
+			require.NoError(t, err)
+			actions := make([]string, 0)
+			for _, entry := range entries {
+				actions = append(actions, entry.Action)
+			}
+			assert.Equal(t, scenario.actions, actions)
+		})
+	}
+}
+
+func TestParseAuditTime(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		value    string
+		expected time.Time
+		fails    bool
+	}{
+		{name: "empty"},
+		{name: "unix seconds", value: "1700000000", expected: time.Unix(1700000000, 0).UTC()},
+		{name: "RFC 3339", value: "2024-01-02T03:04:05Z", expected: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{name: "invalid", value: "yesterday", fails: true},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			parsed, err := ParseAuditTime(scenario.value)
+			if scenario.fails {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, scenario.expected.Equal(parsed))
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/riyadennis/identity-server/app/proto/identity"
+)
+
+// PrincipalContextKey holds the *Principal of an authenticated request
+const PrincipalContextKey contextKey = "principal"
+
+var errUnknownAuthMode = errors.New("unknown AUTH_MODE, expected identity or jwt")
+
+// Principal is the authenticated caller
+type Principal struct {
+	UserID string
+	Roles  []string
+	// APIKeyID and Scopes are set when the caller used an API key
+	APIKeyID string
+	Scopes   []string
+	// Permissions are granted by the Policy
+	Permissions []Permission
+}
+
+// Can reports whether the caller was granted the permission or admin
+func (p *Principal) Can(perm Permission) bool {
+	return slices.Contains(p.Permissions, perm) || slices.Contains(p.Permissions, PermissionAdmin)
+}
+
+// Authenticator resolves a bearer token to the caller it was issued to
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// IdentityAuthenticator asks the identity server who a token belongs to,
+// the identity server does not return roles
+type IdentityAuthenticator struct {
+	Client identity.IdentityClient
+}
+
+func NewIdentityAuthenticator(client identity.IdentityClient) *IdentityAuthenticator {
+	return &IdentityAuthenticator{Client: client}
+}
+
+// Authenticate calls Me on the identity server
+func (a *IdentityAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	userID, err := UserIDFromBearer(ctx, a.Client, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{UserID: userID}, nil
+}
+
+/*
+NewEnvAuthenticator picks the authenticator from AUTH_MODE
+  - identity, the default, uses the identity server returned by newClient
+  - jwt verifies tokens locally, see NewEnvJWTConfig
+*/
+func NewEnvAuthenticator(newClient func() (identity.IdentityClient, error)) (Authenticator, error) {
+	switch os.Getenv("AUTH_MODE") {
+	case "", "identity":
+		client, err := newClient()
+		if err != nil {
+			return nil, err
+		}
+		return NewIdentityAuthenticator(client), nil
+	case "jwt":
+		cfg, err := NewEnvJWTConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewJWTAuthenticator(cfg)
+	default:
+		return nil, errUnknownAuthMode
+	}
+}
+
+// PrincipalFromRequest authenticates the API key or bearer token of the request,
+// the caller is added to the request info for the audit log
+func PrincipalFromRequest(ctx context.Context, r *http.Request, auth Authenticator) (*Principal, error) {
+	credential := r.Header.Get(APIKeyHeader)
+	if credential != "" && !IsAPIKey(credential) {
+		return nil, ErrInvalidAPIKey
+	}
+	if credential == "" {
+		token, err := BearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			return nil, err
+		}
+		credential = token
+	}
+	principal, err := auth.Authenticate(ctx, credential)
+	if err != nil {
+		return nil, err
+	}
+	setRequestUser(ctx, principal.UserID)
+
+	return principal, nil
+}
+
+// WithPrincipal stores the principal and its user ID in the context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	setRequestUser(ctx, p.UserID)
+	ctx = context.WithValue(ctx, PrincipalContextKey, p)
+	return context.WithValue(ctx, UserIDContextKey, p.UserID)
+}
+
+// PrincipalFromContext returns the principal stored by WithPrincipal
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(PrincipalContextKey).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,220 @@
+package business
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/riyadennis/identity-server/app/proto/identity"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// identityLookupTimeout bounds a lookup shared by concurrent callers, it does
+// not end when the caller which started it gives up
+const identityLookupTimeout = 10 * time.Second
+
+// CacheConfig bounds the identity cache
+type CacheConfig struct {
+	// TTL is how long a user is cached for a token
+	TTL time.Duration
+	// NegativeTTL is how long a rejected token is remembered
+	NegativeTTL time.Duration
+	// MaxEntries is the number of tokens kept, least recently used go first
+	MaxEntries int
+}
+
+// NewEnvCacheConfig reads the cache settings from the environment
+func NewEnvCacheConfig() CacheConfig {
+	return CacheConfig{
+		TTL:         envDuration("IDENTITY_CACHE_TTL", time.Minute),
+		NegativeTTL: envDuration("IDENTITY_CACHE_NEGATIVE_TTL", 10*time.Second),
+		MaxEntries:  envInt("IDENTITY_CACHE_SIZE", 10000),
+	}
+}
+
+// CacheStats counts how the cache was used
+type CacheStats struct {
+	Hits         int64
+	NegativeHits int64
+	Misses       int64
+	Evictions    int64
+}
+
+/*
+CachedIdentityClient caches Me responses per token
+  - Entries are keyed on the SHA-256 of the token, the raw token is never stored
+  - Tokens the identity server rejected as unauthenticated are cached for NegativeTTL
+    and replace any user cached for that token
+  - Concurrent lookups for the same token share one call to the identity server,
+    each caller stops waiting for it when its own context is done
+  - Hits, negative hits, misses and evictions are exported as Prometheus counters
+  - Other errors, such as the identity server being unavailable, are not cached
+*/
+type CachedIdentityClient struct {
+	identity.IdentityClient
+	config CacheConfig
+	group  singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits         atomic.Int64
+	negativeHits atomic.Int64
+	misses       atomic.Int64
+	evictions    atomic.Int64
+}
+
+type cacheEntry struct {
+	key     string
+	user    *identity.UserResponse
+	err     error
+	expires time.Time
+}
+
+// NewCachedIdentityClient wraps client with a token to user cache
+func NewCachedIdentityClient(client identity.IdentityClient, cfg CacheConfig) *CachedIdentityClient {
+	return &CachedIdentityClient{
+		IdentityClient: client,
+		config:         cfg,
+		entries:        make(map[string]*list.Element),
+		lru:            list.New(),
+	}
+}
+
+// Me returns the cached user for the token in the outgoing metadata
+func (c *CachedIdentityClient) Me(ctx context.Context, in *identity.UserRequest, opts ...grpc.CallOption) (*identity.UserResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	tokens := md.Get("authorization")
+	if len(tokens) == 0 {
+		return c.IdentityClient.Me(ctx, in, opts...)
+	}
+	key := tokenKey(tokens[0])
+
+	if entry, ok := c.get(key); ok {
+		if entry.err != nil {
+			c.negativeHits.Add(1)
+			identityCacheLookups.WithLabelValues("negative_hit").Inc()
+			return nil, entry.err
+		}
+		c.hits.Add(1)
+		identityCacheLookups.WithLabelValues("hit").Inc()
+		return proto.Clone(entry.user).(*identity.UserResponse), nil
+	}
+	c.misses.Add(1)
+	identityCacheLookups.WithLabelValues("miss").Inc()
+
+	lookup := c.group.DoChan(key, func() (any, error) {
+		// one caller giving up should not fail the others waiting on this lookup
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), identityLookupTimeout)
+		defer cancel()
+		user, err := c.IdentityClient.Me(ctx, in, opts...)
+		switch {
+		case status.Code(err) == codes.Unauthenticated:
+			c.set(key, nil, err, c.config.NegativeTTL)
+		case err == nil && user != nil:
+			c.set(key, user, nil, c.config.TTL)
+		}
+		return user, err
+	})
+	var res singleflight.Result
+	select {
+	case res = <-lookup:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	user, _ := res.Val.(*identity.UserResponse)
+	if user == nil {
+		return nil, nil
+	}
+
+	return proto.Clone(user).(*identity.UserResponse), nil
+}
+
+// Stats returns the cache counters
+func (c *CachedIdentityClient) Stats() CacheStats {
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		Evictions:    c.evictions.Load(),
+	}
+}
+
+func (c *CachedIdentityClient) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+
+	return entry, true
+}
+
+func (c *CachedIdentityClient) set(key string, user *identity.UserResponse, err error, ttl time.Duration) {
+	if ttl <= 0 || c.config.MaxEntries <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &cacheEntry{
+		key:     key,
+		user:    user,
+		err:     err,
+		expires: time.Now().Add(ttl),
+	}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.config.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.evictions.Add(1)
+		identityCacheEvictions.Inc()
+	}
+}
+
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if i, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return i
+	}
+	return fallback
+}
@@ -0,0 +1,194 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/riyadennis/identity-server/app/proto/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// countingIdentity counts calls to Me and resolves "Bearer <id>" to <id>
+type countingIdentity struct {
+	calls   atomic.Int32
+	err     error
+	release chan struct{}
+}
+
+func (c *countingIdentity) Login(_ context.Context, _ *identity.LoginRequest, _ ...grpc.CallOption) (*identity.LoginResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *countingIdentity) Me(ctx context.Context, _ *identity.UserRequest, _ ...grpc.CallOption) (*identity.UserResponse, error) {
+	c.calls.Add(1)
+	if c.release != nil {
+		<-c.release
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	id := strings.TrimPrefix(md.Get("authorization")[0], "Bearer ")
+	return &identity.UserResponse{ID: &id}, nil
+}
+
+func me(c identity.IdentityClient, token string) (string, error) {
+	return UserIDFromBearer(context.Background(), c, token)
+}
+
+func TestCachedIdentityClient(t *testing.T) {
+	errUnauthenticated := status.Error(codes.Unauthenticated, "invalid token")
+	errUnavailable := status.Error(codes.Unavailable, "connection refused")
+	scenarios := []struct {
+		name          string
+		err           error
+		config        CacheConfig
+		lookups       int
+		expectedCalls int32
+		expectedStats CacheStats
+	}{
+		{
+			name:          "repeated lookups hit the cache",
+			config:        CacheConfig{TTL: time.Minute, MaxEntries: 10},
+			lookups:       3,
+			expectedCalls: 1,
+			expectedStats: CacheStats{Hits: 2, Misses: 1},
+		},
+		{
+			name:          "expired entries are looked up again",
+			config:        CacheConfig{TTL: time.Nanosecond, MaxEntries: 10},
+			lookups:       3,
+			expectedCalls: 3,
+			expectedStats: CacheStats{Misses: 3},
+		},
+		{
+			name:          "rejected tokens are cached",
+			err:           errUnauthenticated,
+			config:        CacheConfig{TTL: time.Minute, NegativeTTL: time.Minute, MaxEntries: 10},
+			lookups:       3,
+			expectedCalls: 1,
+			expectedStats: CacheStats{NegativeHits: 2, Misses: 1},
+		},
+		{
+			name:          "unavailable identity server is not cached",
+			err:           errUnavailable,
+			config:        CacheConfig{TTL: time.Minute, NegativeTTL: time.Minute, MaxEntries: 10},
+			lookups:       3,
+			expectedCalls: 3,
+			expectedStats: CacheStats{Misses: 3},
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			backend := &countingIdentity{err: scenario.err}
+			c := NewCachedIdentityClient(backend, scenario.config)
+			lookups := func(result string) int64 {
+				return int64(testutil.ToFloat64(identityCacheLookups.WithLabelValues(result)))
+			}
+			hits, negativeHits, misses := lookups("hit"), lookups("negative_hit"), lookups("miss")
+			for i := 0; i < scenario.lookups; i++ {
+				userID, err := me(c, "alice")
+				if scenario.err != nil {
+					assert.Equal(t, status.Code(scenario.err), status.Code(err))
+					continue
+				}
+				require.NoError(t, err)
+				assert.Equal(t, "alice", userID)
+			}
+			assert.Equal(t, scenario.expectedCalls, backend.calls.Load())
+			assert.Equal(t, scenario.expectedStats, c.Stats())
+			assert.Equal(t, scenario.expectedStats, CacheStats{
+				Hits:         lookups("hit") - hits,
+				NegativeHits: lookups("negative_hit") - negativeHits,
+				Misses:       lookups("miss") - misses,
+			})
+		})
+	}
+}
+
+func TestCachedIdentityClientInvalidation(t *testing.T) {
+	backend := &countingIdentity{}
+	c := NewCachedIdentityClient(backend, CacheConfig{TTL: time.Nanosecond, NegativeTTL: time.Minute, MaxEntries: 10})
+	_, err := me(c, "alice")
+	require.NoError(t, err)
+
+	// the token is revoked, the next lookup replaces the user with a rejection
+	backend.err = status.Error(codes.Unauthenticated, "revoked")
+	_, err = me(c, "alice")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = me(c, "alice")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, int32(2), backend.calls.Load())
+}
+
+func TestCachedIdentityClientEviction(t *testing.T) {
+	backend := &countingIdentity{}
+	c := NewCachedIdentityClient(backend, CacheConfig{TTL: time.Minute, MaxEntries: 2})
+	evictions := testutil.ToFloat64(identityCacheEvictions)
+	for _, token := range []string{"alice", "bob", "carol", "alice"} {
+		_, err := me(c, token)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(4), backend.calls.Load())
+	assert.Equal(t, int64(2), c.Stats().Evictions)
+	assert.Equal(t, evictions+2, testutil.ToFloat64(identityCacheEvictions))
+	for key := range c.entries {
+		assert.NotContains(t, key, "alice", "raw tokens must not be stored")
+	}
+}
+
+func TestCachedIdentityClientCoalescesLookups(t *testing.T) {
+	backend := &countingIdentity{release: make(chan struct{})}
+	c := NewCachedIdentityClient(backend, CacheConfig{TTL: time.Minute, MaxEntries: 10})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			userID, err := me(c, "alice")
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", userID)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return c.Stats().Misses == 10
+	}, time.Second, time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), backend.calls.Load())
+}
+
+func TestCachedIdentityClientCallerGivesUp(t *testing.T) {
+	backend := &countingIdentity{release: make(chan struct{})}
+	c := NewCachedIdentityClient(backend, CacheConfig{TTL: time.Minute, MaxEntries: 10})
+
+	// the caller which started the lookup stops waiting once its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := UserIDFromBearer(ctx, c, "alice")
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// the lookup carries on and caches the user
+	close(backend.release)
+	assert.Eventually(t, func() bool {
+		_, ok := c.get(tokenKey("Bearer alice"))
+		return ok
+	}, time.Second, time.Millisecond)
+	userID, err := me(c, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+	assert.Equal(t, int32(1), backend.calls.Load())
+}
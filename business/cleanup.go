@@ -0,0 +1,37 @@
+package business
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Cleaner removes records the service no longer needs
+type Cleaner interface {
+	// Cleanup returns how many records were removed
+	Cleanup(ctx context.Context) (int, error)
+}
+
+// CleanupEvery runs every cleaner at every interval until ctx is done
+func CleanupEvery(ctx context.Context, interval time.Duration, logger *logrus.Logger, cleaners ...Cleaner) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, cleaner := range cleaners {
+				removed, err := cleaner.Cleanup(ctx)
+				if err != nil {
+					logger.Errorf("failed to clean up %T: %v", cleaner, err)
+					continue
+				}
+				if removed > 0 {
+					logger.Infof("%T removed %d expired records", cleaner, removed)
+				}
+			}
+		}
+	}
+}
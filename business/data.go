@@ -12,7 +12,9 @@ import (
 var errInvalidRequest = errors.New("invalid request")
 
 func HandleFormData(w http.ResponseWriter, r *http.Request) (*FileUpload, error) {
+	_, span := startSpan(r.Context(), "HandleFormData")
 	err := r.ParseMultipartForm(MaxFileSize)
+	endSpan(span, err)
 	if err != nil {
 		return nil, errInvalidRequest
 	}
@@ -25,34 +27,54 @@ func HandleFormData(w http.ResponseWriter, r *http.Request) (*FileUpload, error)
 	defer func() {
 		_ = formFile.Close()
 	}()
+	metadata, tags := MetadataFromHeader(r.Header)
+	for k, v := range r.MultipartForm.Value {
+		if key, ok := strings.CutPrefix(k, MetadataFieldPrefix); ok && len(v) > 0 {
+			metadata[key] = v[0]
+		}
+	}
+	for _, v := range r.MultipartForm.Value[TagsField] {
+		tags = append(tags, ParseTags(v)...)
+	}
 
 	return &FileUpload{
-		RealName:    header.Filename,
-		FileName:    SanitizeFilename(header.Filename),
-		Size:        header.Size,
-		ContentType: header.Header.Get("Content-Type"),
-		File:        formFile,
+		RealName:       header.Filename,
+		FileName:       SanitizeFilename(header.Filename),
+		Size:           header.Size,
+		ContentType:    header.Header.Get("Content-Type"),
+		File:           formFile,
+		Checksum:       r.Header.Get(ChecksumHeader),
+		ClientMetadata: metadata,
+		Tags:           tags,
 	}, nil
 }
 
-func HandleBinaryData(r *http.Request) (*FileUpload, error) {
+func HandleBinaryData(w http.ResponseWriter, r *http.Request) (*FileUpload, error) {
 	if !AllowedTypes[r.Header.Get("Content-Type")] {
-		return nil, errUnsupportedFileType
+		return nil, ErrUnsupportedFileType
 	}
 
+	r.Body = http.MaxBytesReader(w, r.Body, MaxFileSize)
+	_, span := startSpan(r.Context(), "HandleBinaryData")
 	var requestBody bytes.Buffer
 	_, err := io.Copy(&requestBody, r.Body)
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
 
+	metadata, tags := MetadataFromHeader(r.Header)
+
 	return &FileUpload{
 		// get the file name from the header which should be X-Filename
-		RealName:    r.Header.Get("X-Filename"),
-		FileName:    SanitizeFilename(r.Header.Get("X-Filename")),
-		Size:        int64(requestBody.Len()),
-		ContentType: r.Header.Get("Content-Type"),
-		File:        bytes.NewReader(requestBody.Bytes()),
+		RealName:       r.Header.Get("X-Filename"),
+		FileName:       SanitizeFilename(r.Header.Get("X-Filename")),
+		Size:           int64(requestBody.Len()),
+		ContentType:    r.Header.Get("Content-Type"),
+		File:           bytes.NewReader(requestBody.Bytes()),
+		Checksum:       r.Header.Get(ChecksumHeader),
+		ClientMetadata: metadata,
+		Tags:           tags,
 	}, nil
 }
 
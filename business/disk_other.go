@@ -0,0 +1,7 @@
+//go:build !unix
+
+package business
+
+func freeDiskSpace(string) (uint64, error) {
+	return 0, errDiskSpaceUnsupported
+}
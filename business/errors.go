@@ -0,0 +1,36 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+var (
+	// ErrStorageUnavailable is reported when the object storage could not be reached
+	ErrStorageUnavailable = foundation.NewError(foundation.StorageUnavailable, "storage is unavailable, try again later")
+	// ErrUnauthenticated is reported when the credentials of a request are not accepted
+	ErrUnauthenticated = foundation.NewError(foundation.Unauthenticated, "failed to authenticate the user")
+)
+
+// IsStorageUnavailable reports whether err means the storage could not answer,
+// rather than that it rejected the request
+func IsStorageUnavailable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	switch minio.ToErrorResponse(err).StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
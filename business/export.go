@@ -0,0 +1,484 @@
+package business
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxExportFiles is the most files an export can hold
+	MaxExportFiles = 10_000
+	// MaxSyncExportSize is the most content streamed back directly, larger exports must be async
+	MaxSyncExportSize = 1 << 30
+	// MaxExportSize is the most content an async export can hold
+	MaxExportSize = 10 << 30
+	// ExportExpiry is how long async archives and their links are kept
+	ExportExpiry = 24 * time.Hour
+
+	// Export statuses
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+
+	exportKind    = "export"
+	exportRecords = "exports/"
+	// exportArchives is not under exportRecords so listing records skips the archives
+	exportArchives = "export-archives/"
+)
+
+var (
+	// ErrInvalidExport is returned when an export does not pick files the right way
+	ErrInvalidExport = foundation.NewError(foundation.InvalidRequest,
+		"exports take either ids or a folder and or a filter, of up to 10000 files")
+	// ErrNothingToExport is returned when no file matches the export
+	ErrNothingToExport = foundation.NewError(foundation.NotFound, "no files to export")
+	// ErrExportTooLarge is returned when the files are too large to stream, or to export at all
+	ErrExportTooLarge = foundation.NewError(foundation.TooLarge,
+		"exports over 1GB must be async and async exports can not exceed 10GB")
+	// ErrExportNotFound is returned for unknown, tampered or unfinished exports
+	ErrExportNotFound = foundation.NewError(foundation.NotFound, "export not found")
+	// ErrExportExpired is returned once the archive of an export expired
+	ErrExportExpired = foundation.NewError(foundation.Expired, "export expired")
+	// ErrAsyncExportDisabled is returned for async exports when no link secret is configured
+	ErrAsyncExportDisabled = foundation.NewError(foundation.NotImplemented, "async exports are disabled")
+)
+
+/*
+ExportRequest picks the files of an export
+  - IDs exports the files given, they are put at the root of the archive
+  - Folder exports the files in the folder, and in its subfolders when Recursive,
+    keeping the folders inside the archive. Empty is the root
+  - Metadata and Tags only keep the files having every key, value and tag,
+    a filter alone exports every matching file
+  - Async stores the archive instead of streaming it back
+*/
+type ExportRequest struct {
+	IDs       []string          `json:"ids"`
+	Folder    *string           `json:"folder"`
+	Recursive bool              `json:"recursive"`
+	Metadata  map[string]string `json:"metadata"`
+	Tags      []string          `json:"tags"`
+	Async     bool              `json:"async"`
+}
+
+// ExportEntry is a file and the name it has in the archive
+type ExportEntry struct {
+	Name string
+	File *FileInfo
+}
+
+/*
+ExportFiles returns the files of the user picked by the request and their names in the archive
+  - Names are the names the files were uploaded with, clashing names
+    get a counter like report (1).pdf
+  - Sync exports fail with ErrExportTooLarge over MaxSyncExportSize
+*/
+func (bu *BucketUpload) ExportFiles(ctx context.Context, userID string, req ExportRequest) ([]*ExportEntry, error) {
+	filter := FileFilter{Metadata: req.Metadata, Tags: req.Tags}
+	if (len(req.IDs) > 0 && req.Folder != nil) || len(req.IDs) > MaxExportFiles ||
+		(len(req.IDs) == 0 && req.Folder == nil && len(filter.Metadata) == 0 && len(filter.Tags) == 0) {
+		return nil, ErrInvalidExport
+	}
+
+	var (
+		files  []*FileInfo
+		folder string
+		err    error
+	)
+	if len(req.IDs) > 0 {
+		files, err = bu.exportByID(ctx, userID, req.IDs)
+	} else {
+		files, folder, err = bu.exportFolder(ctx, userID, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	files = filterFiles(files, filter)
+	if len(files) == 0 {
+		return nil, ErrNothingToExport
+	}
+	if len(files) > MaxExportFiles {
+		return nil, ErrInvalidExport
+	}
+	entries := exportEntries(files, folder, len(req.IDs) == 0)
+	size := ExportSize(entries)
+	if size > MaxExportSize || (!req.Async && size > MaxSyncExportSize) {
+		return nil, ErrExportTooLarge
+	}
+
+	return entries, nil
+}
+
+// exportByID stats the files given in order, skipping repeated IDs
+func (bu *BucketUpload) exportByID(ctx context.Context, userID string, ids []string) ([]*FileInfo, error) {
+	seen := make(map[string]bool, len(ids))
+	files := make([]*FileInfo, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		info, err := bu.StatFile(ctx, userID, id)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info)
+	}
+
+	return files, nil
+}
+
+// exportFolder lists the files of the folder by path, a filter alone searches every folder
+func (bu *BucketUpload) exportFolder(ctx context.Context, userID string, req ExportRequest) ([]*FileInfo, string, error) {
+	folder, recursive := "", true
+	if req.Folder != nil {
+		var ok bool
+		if folder, ok = cleanFolder(*req.Folder); !ok {
+			return nil, "", ErrInvalidFolder
+		}
+		recursive = req.Recursive
+		if _, err := bu.folder(ctx, userID, folder); err != nil {
+			return nil, "", err
+		}
+	}
+	files, err := bu.folderFiles(ctx, userID, folder, recursive)
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Folder != files[j].Folder {
+			return files[i].Folder < files[j].Folder
+		}
+		return files[i].CreatedAt.Before(files[j].CreatedAt)
+	})
+
+	return files, folder, nil
+}
+
+func filterFiles(files []*FileInfo, filter FileFilter) []*FileInfo {
+	kept := files[:0]
+	for _, info := range files {
+		if filter.matches(info) {
+			kept = append(kept, info)
+		}
+	}
+
+	return kept
+}
+
+// exportEntries names the files in the archive, under their folder relative to
+// the exported one when keepFolders is set
+func exportEntries(files []*FileInfo, folder string, keepFolders bool) []*ExportEntry {
+	taken := make(map[string]bool, len(files))
+	entries := make([]*ExportEntry, 0, len(files))
+	for _, info := range files {
+		dir := ""
+		if keepFolders {
+			dir = strings.TrimPrefix(strings.TrimPrefix(info.Folder, folder), "/")
+		}
+		entries = append(entries, &ExportEntry{
+			Name: uniqueEntryName(taken, dir, entryName(info.Name)),
+			File: info,
+		})
+	}
+
+	return entries
+}
+
+// entryName keeps the last element of the uploaded name so entries can not leave the archive
+func entryName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" || strings.ContainsRune(name, 0) {
+		return "file"
+	}
+
+	return name
+}
+
+// uniqueEntryName adds a counter before the extension of names already taken,
+// names are compared ignoring case as most file systems do
+func uniqueEntryName(taken map[string]bool, dir, name string) string {
+	candidate := path.Join(dir, name)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 1; taken[strings.ToLower(candidate)]; n++ {
+		candidate = path.Join(dir, fmt.Sprintf("%s (%d)%s", stem, n, ext))
+	}
+	taken[strings.ToLower(candidate)] = true
+
+	return candidate
+}
+
+// ExportSize is the content of the entries in bytes
+func ExportSize(entries []*ExportEntry) int64 {
+	var size int64
+	for _, entry := range entries {
+		size += entry.File.Size
+	}
+
+	return size
+}
+
+/*
+WriteZip writes a ZIP archive of the entries to w as the files are read,
+the archive is never held in memory
+  - Files are streamed from storage when it implements ObjectOpener
+  - Images are stored as is, they do not compress, anything else is deflated
+  - Every file is recorded in the audit log
+*/
+func (bu *BucketUpload) WriteZip(ctx context.Context, w io.Writer, entries []*ExportEntry) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		if err := bu.writeZipEntry(ctx, zw, entry); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (bu *BucketUpload) writeZipEntry(ctx context.Context, zw *zip.Writer, entry *ExportEntry) (err error) {
+	defer func() {
+		bu.audit(ctx, AuditExport, entry.File.ID, err)
+	}()
+	_, file, err := bu.openFile(ctx, entry.File)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	method := zip.Deflate
+	if strings.HasPrefix(entry.File.ContentType, "image/") {
+		method = zip.Store
+	}
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     entry.Name,
+		Method:   method,
+		Modified: entry.File.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, file)
+
+	return err
+}
+
+// Export describes an async export, URL is only set once the archive is ready
+type Export struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userID"`
+	Status    string    `json:"status"`
+	Files     int       `json:"files"`
+	Size      int64     `json:"size"`
+	Error     string    `json:"error,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+/*
+Exports builds archives in the background for exports too large to stream
+  - Archives are stored under SystemPrefix and served through signed links
+    which work without an account until the export expires
+  - Exports still pending when the service stops stay pending until they expire
+*/
+type Exports struct {
+	bu     *BucketUpload
+	links  *Links
+	Logger *logrus.Logger
+
+	// builds tracks the archives being built
+	builds sync.WaitGroup
+}
+
+// NewExports returns async exports, links may be nil when only cleaning up
+func NewExports(bu *BucketUpload, links *Links, logger *logrus.Logger) *Exports {
+	return &Exports{
+		bu:     bu,
+		links:  links,
+		Logger: logger,
+	}
+}
+
+// Start records the export and builds its archive in the background
+func (e *Exports) Start(ctx context.Context, userID string, entries []*ExportEntry) (*Export, error) {
+	if e.links == nil {
+		return nil, ErrAsyncExportDisabled
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	export := &Export{
+		ID:        id,
+		UserID:    userID,
+		Status:    ExportPending,
+		Files:     len(entries),
+		Size:      ExportSize(entries),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ExportExpiry).Truncate(time.Second),
+	}
+	if err := e.bu.putRecord(ctx, exportRecords+id, export); err != nil {
+		return nil, err
+	}
+	// the build outlives the request which started it
+	buildCtx := context.WithoutCancel(ctx)
+	e.builds.Go(func() {
+		e.build(buildCtx, *export, entries)
+	})
+
+	return export, nil
+}
+
+// Wait blocks until the archives being built are stored
+func (e *Exports) Wait() {
+	e.builds.Wait()
+}
+
+func (e *Exports) build(ctx context.Context, export Export, entries []*ExportEntry) {
+	logger := e.Logger.WithField("export", export.ID)
+	export.Status = ExportReady
+	if err := e.store(ctx, export.ID, entries); err != nil {
+		logger.Errorf("failed to build export: %v", err)
+		export.Status = ExportFailed
+		export.Error = "failed to build the archive"
+	}
+	if err := e.bu.putRecord(ctx, exportRecords+export.ID, &export); err != nil {
+		logger.Errorf("failed to save export: %v", err)
+	}
+}
+
+// store writes the archive to a temporary file and uploads it
+func (e *Exports) store(ctx context.Context, id string, entries []*ExportEntry) error {
+	tmp, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	err = e.bu.WriteZip(ctx, tmp, entries)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = e.bu.Storage.FPutObject(ctx, e.bu.BucketName, exportArchiveKey(id), tmp.Name(),
+		minio.PutObjectOptions{ContentType: "application/zip"})
+
+	return err
+}
+
+// Get returns an export started by the user with its download link once ready
+func (e *Exports) Get(ctx context.Context, userID, id string) (*Export, error) {
+	export, err := e.export(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if export.UserID != userID {
+		return nil, ErrExportNotFound
+	}
+	if time.Now().After(export.ExpiresAt) {
+		return nil, ErrExportExpired
+	}
+	if export.Status == ExportReady {
+		export.URL = e.links.BaseURL + "/exports/download/" + e.links.sign(exportKind, id, export.ExpiresAt)
+	}
+
+	return export, nil
+}
+
+// Open checks the token of a download link and returns the archive, the caller must close it
+func (e *Exports) Open(ctx context.Context, token string) (*FileInfo, io.ReadCloser, error) {
+	id, expires, err := e.links.verify(exportKind, token)
+	if err != nil {
+		return nil, nil, ErrExportNotFound
+	}
+	if time.Now().After(expires) {
+		return nil, nil, ErrExportExpired
+	}
+	export, err := e.export(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if export.Status != ExportReady {
+		return nil, nil, ErrExportNotFound
+	}
+	obj, err := e.bu.Storage.StatObject(ctx, e.bu.BucketName, exportArchiveKey(id), minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil, ErrExportNotFound
+		}
+		return nil, nil, err
+	}
+
+	return e.bu.openFile(ctx, &FileInfo{
+		ID:          obj.Key,
+		Name:        "export-" + id + ".zip",
+		Size:        obj.Size,
+		ContentType: "application/zip",
+		UserID:      export.UserID,
+		CreatedAt:   export.CreatedAt,
+	})
+}
+
+// Cleanup removes expired exports and their archives, it returns how many exports were removed
+func (e *Exports) Cleanup(ctx context.Context) (int, error) {
+	keys, err := e.bu.recordKeys(ctx, exportRecords)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, key := range keys {
+		export, err := e.export(ctx, strings.TrimPrefix(key, exportRecords))
+		if err != nil {
+			return removed, err
+		}
+		if time.Now().Before(export.ExpiresAt) {
+			continue
+		}
+		err = e.bu.Storage.RemoveObject(ctx, e.bu.BucketName, exportArchiveKey(export.ID), minio.RemoveObjectOptions{})
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			return removed, err
+		}
+		if err := e.bu.removeRecord(ctx, key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (e *Exports) export(ctx context.Context, id string) (*Export, error) {
+	export := &Export{}
+	if err := e.bu.getRecord(ctx, exportRecords+id, export); err != nil {
+		if errors.Is(err, errRecordNotFound) {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func exportArchiveKey(id string) string {
+	return SystemPrefix + exportArchives + id + ".zip"
+}
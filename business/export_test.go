@@ -0,0 +1,218 @@
+package business
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniqueEntryName(t *testing.T) {
+	taken := map[string]bool{}
+	scenarios := []struct {
+		dir      string
+		name     string
+		expected string
+	}{
+		{name: entryName("report.pdf"), expected: "report.pdf"},
+		{name: entryName("REPORT.pdf"), expected: "REPORT (1).pdf"},
+		{name: entryName("report.pdf"), expected: "report (2).pdf"},
+		{dir: "2026", name: entryName("report.pdf"), expected: "2026/report.pdf"},
+		{name: entryName("README"), expected: "README"},
+		{name: entryName("README"), expected: "README (1)"},
+		{name: entryName("../../etc/passwd"), expected: "passwd"},
+		{name: entryName(`..\..\boot.ini`), expected: "boot.ini"},
+		{name: entryName(".."), expected: "file"},
+		{name: entryName(""), expected: "file (1)"},
+	}
+	for _, scenario := range scenarios {
+		assert.Equal(t, scenario.expected, uniqueEntryName(taken, scenario.dir, scenario.name))
+	}
+}
+
+func TestExportFiles(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	root := uploadTo(t, bu, "", "a.pdf")
+	invoice := uploadTo(t, bu, "invoices", "a.pdf")
+	uploadTo(t, bu, "invoices/2026", "a.pdf")
+	_, err := bu.UpdateMetadata(ctx, "alice", invoice.ID, MetadataUpdate{Tags: []string{"paid"}})
+	require.NoError(t, err)
+
+	folder := func(f string) *string {
+		return &f
+	}
+	names := func(entries []*ExportEntry) []string {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+	scenarios := []struct {
+		name     string
+		userID   string
+		req      ExportRequest
+		expected []string
+		err      error
+	}{
+		{
+			name:     "ids keep their order and get unique names",
+			req:      ExportRequest{IDs: []string{invoice.ID, root.ID, invoice.ID}},
+			expected: []string{"a.pdf", "a (1).pdf"},
+		},
+		{
+			name:     "folder",
+			req:      ExportRequest{Folder: folder("invoices")},
+			expected: []string{"a.pdf"},
+		},
+		{
+			name:     "folder keeps subfolders",
+			req:      ExportRequest{Folder: folder("/invoices/"), Recursive: true},
+			expected: []string{"a.pdf", "2026/a.pdf"},
+		},
+		{
+			name:     "root",
+			req:      ExportRequest{Folder: folder(""), Recursive: true},
+			expected: []string{"a.pdf", "invoices/a.pdf", "invoices/2026/a.pdf"},
+		},
+		{
+			name:     "filter alone searches every folder",
+			req:      ExportRequest{Tags: []string{"PAID"}},
+			expected: []string{"invoices/a.pdf"},
+		},
+		{name: "ids and folder", req: ExportRequest{IDs: []string{root.ID}, Folder: folder("")}, err: ErrInvalidExport},
+		{name: "nothing picked", err: ErrInvalidExport},
+		{name: "missing file", req: ExportRequest{IDs: []string{"missing.pdf"}}, err: ErrFileNotFound},
+		{name: "other user's files", userID: "bob", req: ExportRequest{IDs: []string{root.ID}}, err: ErrFileNotFound},
+		{name: "missing folder", req: ExportRequest{Folder: folder("receipts")}, err: ErrFolderNotFound},
+		{name: "invalid folder", req: ExportRequest{Folder: folder("../receipts")}, err: ErrInvalidFolder},
+		{name: "no match", req: ExportRequest{Folder: folder("invoices"), Tags: []string{"draft"}}, err: ErrNothingToExport},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			userID := scenario.userID
+			if userID == "" {
+				userID = "alice"
+			}
+			entries, err := bu.ExportFiles(ctx, userID, scenario.req)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expected, names(entries))
+		})
+	}
+}
+
+// readZip returns the content of every entry of the archive by name
+func readZip(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		files[f.Name] = string(content)
+	}
+
+	return files
+}
+
+// streamOnly fails reads through temporary files
+type streamOnly struct {
+	*storagetest.Memory
+}
+
+func (streamOnly) FGetObject(context.Context, string, string, string, minio.GetObjectOptions) error {
+	return errors.New("objects must be streamed")
+}
+
+func TestWriteZip(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(streamOnly{Memory: storagetest.NewMemory()}, "test")
+	uploadTo(t, bu, "", "a.pdf")
+	uploadTo(t, bu, "docs", "a.pdf")
+	entries, err := bu.ExportFiles(ctx, "alice", ExportRequest{Folder: new(string), Recursive: true})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, bu.WriteZip(ctx, &buf, entries))
+	assert.Equal(t, map[string]string{"a.pdf": "hello", "docs/a.pdf": "hello"}, readZip(t, buf.Bytes()))
+
+	// a file removed after it was picked fails the export
+	require.NoError(t, bu.Storage.RemoveObject(ctx, "test", entries[0].File.ID, minio.RemoveObjectOptions{}))
+	assert.Error(t, bu.WriteZip(ctx, io.Discard, entries))
+}
+
+func TestExports(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	links := NewLinks(bu, []byte("secret"), "https://files.example.com")
+	exports := NewExports(bu, links, logrus.New())
+	uploadTo(t, bu, "", "a.pdf")
+	entries, err := bu.ExportFiles(ctx, "alice", ExportRequest{Folder: new(string), Async: true})
+	require.NoError(t, err)
+
+	_, err = NewExports(bu, nil, logrus.New()).Start(ctx, "alice", entries)
+	assert.ErrorIs(t, err, ErrAsyncExportDisabled)
+
+	export, err := exports.Start(ctx, "alice", entries)
+	require.NoError(t, err)
+	assert.Equal(t, 1, export.Files)
+	exports.Wait()
+
+	_, err = exports.Get(ctx, "bob", export.ID)
+	assert.ErrorIs(t, err, ErrExportNotFound)
+	export, err = exports.Get(ctx, "alice", export.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ExportReady, export.Status)
+	require.True(t, strings.HasPrefix(export.URL, "https://files.example.com/exports/download/"))
+	token := strings.TrimPrefix(export.URL, "https://files.example.com/exports/download/")
+
+	info, file, err := exports.Open(ctx, token)
+	require.NoError(t, err)
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Equal(t, "export-"+export.ID+".zip", info.Name)
+	assert.Equal(t, map[string]string{"a.pdf": "hello"}, readZip(t, data))
+
+	_, _, err = exports.Open(ctx, token+"x")
+	assert.ErrorIs(t, err, ErrExportNotFound)
+	_, _, err = exports.Open(ctx, links.sign(exportKind, export.ID, time.Now().Add(-time.Minute)))
+	assert.ErrorIs(t, err, ErrExportExpired)
+
+	// archives are not listed as files
+	files, err := bu.ListFiles(ctx, "alice", FileFilter{})
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	removed, err := exports.Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+	export.ExpiresAt = time.Now().Add(-time.Minute)
+	export.URL = ""
+	require.NoError(t, bu.putRecord(ctx, exportRecords+export.ID, export))
+	removed, err = exports.Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = exports.Get(ctx, "alice", export.ID)
+	assert.ErrorIs(t, err, ErrExportNotFound)
+	_, err = bu.Storage.StatObject(ctx, "test", exportArchiveKey(export.ID), minio.StatObjectOptions{})
+	assert.Error(t, err)
+}
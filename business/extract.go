@@ -0,0 +1,191 @@
+package business
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxExtractSize bounds the files read to extract text, larger ones
+	// are only searchable by name, metadata and tags
+	maxExtractSize = 10 * 1024 * 1024
+	// maxExtractedText bounds the text kept per file
+	maxExtractedText = 1024 * 1024
+)
+
+// extractable reports whether text can be extracted from files of the content type
+func extractable(contentType string, size int64) bool {
+	return size > 0 && size <= maxExtractSize &&
+		(contentType == "application/pdf" || contentType == "application/octet-stream")
+}
+
+/*
+extractText returns the text of PDF and plain text files, empty for anything else
+  - Files sent as application/octet-stream are text when they sniff as text/*
+    and are valid UTF-8
+  - PDF text is read from the literal strings shown in uncompressed and
+    FlateDecode content streams, text in hex strings or fonts with custom
+    encodings is not found
+*/
+func extractText(contentType string, r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxExtractSize))
+	if err != nil {
+		return "", err
+	}
+	var text string
+	switch {
+	case contentType == "application/pdf":
+		text = pdfText(data)
+	case contentType == "application/octet-stream" &&
+		strings.HasPrefix(http.DetectContentType(data), "text/") && utf8.Valid(data):
+		text = string(data)
+	}
+	if len(text) > maxExtractedText {
+		text = strings.ToValidUTF8(text[:maxExtractedText], "")
+	}
+
+	return text, nil
+}
+
+// pdfText joins the text of every content stream of the PDF
+func pdfText(data []byte) string {
+	var text strings.Builder
+	for {
+		start := bytes.Index(data, []byte("stream"))
+		if start < 0 {
+			break
+		}
+		// the dictionary of the stream follows the obj keyword
+		dict := data[:start]
+		if obj := bytes.LastIndex(dict, []byte(" obj")); obj >= 0 {
+			dict = dict[obj:]
+		}
+		body := data[start+len("stream"):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		data = body[end+len("endstream"):]
+		content := body[:end]
+		switch {
+		case bytes.Contains(dict, []byte("/FlateDecode")):
+			zr, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			// a truncated stream still yields the text before the damage
+			content, _ = io.ReadAll(io.LimitReader(zr, maxExtractSize))
+		case bytes.Contains(dict, []byte("/Filter")):
+			// images and other encodings hold no text
+			continue
+		}
+		if text.Len() > 0 {
+			text.WriteByte(' ')
+		}
+		text.WriteString(pdfContentText(content))
+		if text.Len() > maxExtractedText {
+			break
+		}
+	}
+
+	return text.String()
+}
+
+// pdfContentText reads the strings shown between BT and ET in a content stream
+func pdfContentText(content []byte) string {
+	var (
+		text   strings.Builder
+		inText bool
+	)
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, n := pdfString(content[i:])
+			if inText {
+				text.WriteString(s)
+			}
+			i += n - 1
+		case c == '<':
+			// hex strings and dictionaries are skipped
+			for i < len(content) && content[i] != '>' {
+				i++
+			}
+		case isPDFOperator(c):
+			j := i
+			for j < len(content) && isPDFOperator(content[j]) {
+				j++
+			}
+			switch string(content[i:j]) {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				text.WriteByte(' ')
+			case "Tj", "TJ", "'", "\"", "T*", "Td", "TD":
+				text.WriteByte(' ')
+			}
+			i = j - 1
+		}
+	}
+
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+func isPDFOperator(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*' || c == '\'' || c == '"'
+}
+
+// pdfString decodes the literal string as Latin-1 at the start of data and returns how many bytes it took
+func pdfString(data []byte) (string, int) {
+	var (
+		s     strings.Builder
+		depth int
+	)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\\' && i+1 < len(data):
+			i++
+			switch e := data[i]; e {
+			case 'n', 'r', 't':
+				s.WriteByte(' ')
+			case 'b', 'f', '\n', '\r':
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				octal := int(e - '0')
+				for k := 0; k < 2 && i+1 < len(data) && data[i+1] >= '0' && data[i+1] <= '7'; k++ {
+					i++
+					octal = octal*8 + int(data[i]-'0')
+				}
+				s.WriteRune(rune(byte(octal)))
+			default:
+				s.WriteRune(rune(e))
+			}
+		case c == '(':
+			if depth > 0 {
+				s.WriteByte(c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s.String(), i + 1
+			}
+			s.WriteByte(c)
+		default:
+			// strings of standard fonts are close to Latin-1
+			s.WriteRune(rune(c))
+		}
+	}
+
+	return s.String(), len(data)
+}
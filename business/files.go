@@ -0,0 +1,302 @@
+package business
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+// ErrFileNotFound is returned when a file does not exist or is not owned by the caller
+var ErrFileNotFound = foundation.NewError(foundation.NotFound, "file not found")
+
+// FileInfo describes a file stored in the bucket on behalf of a user
+type FileInfo struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	UserID      string    `json:"userID"`
+	Checksum    string    `json:"checksum,omitempty"`
+	Folder      string    `json:"folder,omitempty"`
+	Guest       bool      `json:"guest,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Metadata and Tags are set by the client
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+}
+
+// FileFilter narrows listings down, files must have every key, value and tag given
+type FileFilter struct {
+	Metadata map[string]string
+	Tags     []string
+}
+
+func (f FileFilter) matches(info *FileInfo) bool {
+	for k, v := range f.Metadata {
+		if info.Metadata[strings.ToLower(k)] != v {
+			return false
+		}
+	}
+	for _, tag := range f.Tags {
+		if !slices.Contains(info.Tags, strings.ToLower(tag)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ListFiles returns the files uploaded by the user matching the filter, newest first
+func (bu *BucketUpload) ListFiles(ctx context.Context, userID string, filter FileFilter) ([]*FileInfo, error) {
+	return bu.listFiles(ctx, ownedBy(userID), filter)
+}
+
+// ListAllFiles returns the files of every user matching the filter, newest first,
+// callers must check the principal was granted PermissionReadAll
+func (bu *BucketUpload) ListAllFiles(ctx context.Context, filter FileFilter) ([]*FileInfo, error) {
+	return bu.listFiles(ctx, anyOwner, filter)
+}
+
+func (bu *BucketUpload) listFiles(ctx context.Context, match func(owner string) bool, filter FileFilter) ([]*FileInfo, error) {
+	files := make([]*FileInfo, 0)
+	for obj := range bu.Storage.ListObjects(ctx, bu.BucketName, minio.ListObjectsOptions{
+		Recursive:    true,
+		WithMetadata: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if isSystemKey(obj.Key) {
+			continue
+		}
+		// metadata is only returned in listings by MinIO, fall back to stat for others
+		if metadataValue(obj.UserMetadata, "userID") == "" {
+			info, err := bu.Storage.StatObject(ctx, bu.BucketName, obj.Key, minio.StatObjectOptions{})
+			if err != nil {
+				return nil, err
+			}
+			obj = info
+		}
+		if !match(metadataValue(obj.UserMetadata, "userID")) {
+			continue
+		}
+		if info := newFileInfo(obj); filter.matches(info) {
+			files = append(files, info)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+
+	return files, nil
+}
+
+// StatFile returns details of a file owned by the user
+func (bu *BucketUpload) StatFile(ctx context.Context, userID, id string) (*FileInfo, error) {
+	return bu.statFile(ctx, id, ownedBy(userID))
+}
+
+// StatAnyFile returns details of a file whoever owns it
+func (bu *BucketUpload) StatAnyFile(ctx context.Context, id string) (*FileInfo, error) {
+	return bu.statFile(ctx, id, anyOwner)
+}
+
+func (bu *BucketUpload) statFile(ctx context.Context, id string, match func(owner string) bool) (*FileInfo, error) {
+	obj, err := bu.statObject(ctx, id, match)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFileInfo(obj), nil
+}
+
+func (bu *BucketUpload) statObject(ctx context.Context, id string, match func(owner string) bool) (minio.ObjectInfo, error) {
+	if isSystemKey(id) {
+		return minio.ObjectInfo{}, ErrFileNotFound
+	}
+	obj, err := bu.Storage.StatObject(ctx, bu.BucketName, id, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return minio.ObjectInfo{}, ErrFileNotFound
+		}
+		return minio.ObjectInfo{}, err
+	}
+	// do not leak the existence of files uploaded by other users
+	if !match(metadataValue(obj.UserMetadata, "userID")) {
+		return minio.ObjectInfo{}, ErrFileNotFound
+	}
+
+	return obj, nil
+}
+
+/*
+GetFile fetches a file owned by the user
+  - Downloads the object to a temporary file
+  - Returns a reader which removes the temporary file when closed
+*/
+func (bu *BucketUpload) GetFile(ctx context.Context, userID, id string) (_ *FileInfo, _ io.ReadCloser, err error) {
+	defer func() {
+		bu.audit(ctx, AuditDownload, id, err)
+	}()
+	info, err := bu.StatFile(ctx, userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bu.getFile(ctx, info)
+}
+
+// GetAnyFile fetches a file whoever owns it
+func (bu *BucketUpload) GetAnyFile(ctx context.Context, id string) (_ *FileInfo, _ io.ReadCloser, err error) {
+	defer func() {
+		bu.audit(ctx, AuditDownload, id, err)
+	}()
+	info, err := bu.StatAnyFile(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bu.getFile(ctx, info)
+}
+
+func (bu *BucketUpload) getFile(ctx context.Context, info *FileInfo) (*FileInfo, io.ReadCloser, error) {
+	tmp, err := os.CreateTemp("", "download-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	_ = tmp.Close()
+
+	err = bu.Storage.FGetObject(ctx, bu.BucketName, info.ID, tmp.Name(), minio.GetObjectOptions{})
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, nil, err
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, nil, err
+	}
+
+	return info, &tempFile{File: f}, nil
+}
+
+// ObjectOpener streams objects, storage without it is read through a temporary file
+type ObjectOpener interface {
+	OpenObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error)
+}
+
+// openFile streams the object when the storage can, it falls back to getFile
+func (bu *BucketUpload) openFile(ctx context.Context, info *FileInfo) (*FileInfo, io.ReadCloser, error) {
+	opener, ok := bu.Storage.(ObjectOpener)
+	if !ok {
+		return bu.getFile(ctx, info)
+	}
+	file, err := opener.OpenObject(ctx, bu.BucketName, info.ID, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return info, file, nil
+}
+
+// DeleteFile removes a file owned by the user
+func (bu *BucketUpload) DeleteFile(ctx context.Context, userID, id string) (err error) {
+	defer func() {
+		bu.audit(ctx, AuditDelete, id, err)
+	}()
+	if _, err := bu.StatFile(ctx, userID, id); err != nil {
+		return err
+	}
+
+	return bu.removeFile(ctx, id)
+}
+
+// DeleteAnyFile removes a file whoever owns it
+func (bu *BucketUpload) DeleteAnyFile(ctx context.Context, id string) (err error) {
+	defer func() {
+		bu.audit(ctx, AuditDelete, id, err)
+	}()
+	if _, err := bu.StatAnyFile(ctx, id); err != nil {
+		return err
+	}
+
+	return bu.removeFile(ctx, id)
+}
+
+// removeFile deletes the object and drops it from the search index
+func (bu *BucketUpload) removeFile(ctx context.Context, id string) error {
+	if err := bu.Storage.RemoveObject(ctx, bu.BucketName, id, minio.RemoveObjectOptions{}); err != nil {
+		return err
+	}
+	bu.unindexFile(id)
+
+	return nil
+}
+
+func ownedBy(userID string) func(owner string) bool {
+	return func(owner string) bool {
+		return owner == userID
+	}
+}
+
+func anyOwner(string) bool {
+	return true
+}
+
+func newFileInfo(obj minio.ObjectInfo) *FileInfo {
+	metadata, tags := userMetadata(obj.UserMetadata)
+	return &FileInfo{
+		ID:          obj.Key,
+		Name:        metadataValue(obj.UserMetadata, "fileName"),
+		Size:        obj.Size,
+		ContentType: obj.ContentType,
+		UserID:      metadataValue(obj.UserMetadata, "userID"),
+		Checksum:    metadataValue(obj.UserMetadata, "checksum"),
+		Folder:      cmp.Or(folderOf(obj.Key), metadataValue(obj.UserMetadata, "folder")),
+		Guest:       metadataValue(obj.UserMetadata, "guest") == "true",
+		CreatedAt:   obj.LastModified,
+		Metadata:    metadata,
+		Tags:        tags,
+	}
+}
+
+// metadataValue looks up user metadata regardless of how the storage
+// client canonicalised the key, listings return X-Amz-Meta-Userid while
+// stat returns Userid
+func metadataValue(metadata map[string]string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(metadataKey(k), key) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// metadataKey drops the prefix listings return user metadata keys with and lower cases them
+func metadataKey(k string) string {
+	return strings.TrimPrefix(strings.ToLower(k), "x-amz-meta-")
+}
+
+// tempFile deletes the underlying file once the reader is closed
+type tempFile struct {
+	*os.File
+}
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	if rErr := os.Remove(t.Name()); rErr != nil && !errors.Is(rErr, os.ErrNotExist) {
+		return rErr
+	}
+
+	return err
+}
@@ -0,0 +1,451 @@
+package business
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+const (
+	folderRecords = "folders/"
+	// maxFolderLength bounds folder paths, they are part of object keys
+	maxFolderLength = 512
+)
+
+var (
+	// ErrInvalidFolder is returned for folders leaving the root or clashing with the system prefix
+	ErrInvalidFolder = foundation.NewError(foundation.InvalidRequest, "folders are paths like a/b of up to 512 characters")
+	// ErrFolderNotFound is returned when the user has no such folder
+	ErrFolderNotFound = foundation.NewError(foundation.NotFound, "folder not found")
+	// ErrFolderExists is returned when creating or renaming onto an existing folder
+	ErrFolderExists = foundation.NewError(foundation.Conflict, "folder already exists")
+	// ErrFolderNotEmpty is returned when deleting a folder with files or folders without recursive
+	ErrFolderNotEmpty = foundation.NewError(foundation.Conflict, "folder is not empty")
+	// ErrMoveUnsupported is returned when the storage can not copy objects
+	ErrMoveUnsupported = foundation.NewError(foundation.NotImplemented, "storage does not support moving files")
+)
+
+/*
+Folder groups the files of a user under a key prefix
+  - Path is empty for the root, which always exists
+  - Files and Children are only set by ListFolder, direct entries only
+*/
+type Folder struct {
+	Path      string      `json:"path"`
+	Name      string      `json:"name"`
+	CreatedAt time.Time   `json:"createdAt,omitzero"`
+	Files     []*FileInfo `json:"files,omitempty"`
+	Children  []*Folder   `json:"children,omitempty"`
+}
+
+// MoveOptions tells MoveFile where a file goes
+type MoveOptions struct {
+	// Folder is the folder to move the file to, nil keeps it and empty is the root
+	Folder *string `json:"folder"`
+	// Name renames the file when set
+	Name string `json:"name"`
+}
+
+// folderRecord keeps a folder which exists without files
+type folderRecord struct {
+	UserID    string    `json:"userID"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// cleanFolder normalises a folder to a/b, folders can not leave the root
+// or hide files under the system prefix
+func cleanFolder(folder string) (string, bool) {
+	folder = strings.Trim(folder, "/")
+	if folder == "" {
+		return "", true
+	}
+	cleaned := path.Clean(folder)
+	if cleaned != folder || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") ||
+		strings.ContainsAny(cleaned, "\\\x00") || len(cleaned) > maxFolderLength ||
+		isSystemKey(cleaned+"/") {
+		return "", false
+	}
+
+	return cleaned, true
+}
+
+// objectKey puts the generated name of a file under its folder
+func objectKey(folder, name string) string {
+	if folder == "" {
+		return name
+	}
+
+	return folder + "/" + name
+}
+
+// folderOf returns the folder of an object key, empty for the root
+func folderOf(key string) string {
+	if dir := path.Dir(key); dir != "." {
+		return dir
+	}
+
+	return ""
+}
+
+// folderRecordKey scopes folders to the user, user IDs can hold any character
+func folderRecordKey(userID, folder string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return folderRecords + hex.EncodeToString(sum[:]) + "/" + folder
+}
+
+// CreateFolder creates the folder and its parents, it fails when the folder exists
+func (bu *BucketUpload) CreateFolder(ctx context.Context, userID, folder string) (_ *Folder, err error) {
+	defer func() {
+		bu.audit(ctx, AuditFolderCreate, folder, err)
+	}()
+	folder, ok := cleanFolder(folder)
+	if !ok || folder == "" {
+		return nil, ErrInvalidFolder
+	}
+	if _, err := bu.folder(ctx, userID, folder); err == nil {
+		return nil, ErrFolderExists
+	} else if !errors.Is(err, ErrFolderNotFound) {
+		return nil, err
+	}
+	if err := bu.ensureFolder(ctx, userID, folder); err != nil {
+		return nil, err
+	}
+
+	return bu.folder(ctx, userID, folder)
+}
+
+// ensureFolder creates the folder and its parents unless they exist
+func (bu *BucketUpload) ensureFolder(ctx context.Context, userID, folder string) error {
+	for ; folder != ""; folder = folderOf(folder) {
+		err := bu.createRecord(ctx, folderRecordKey(userID, folder), &folderRecord{
+			UserID:    userID,
+			Path:      folder,
+			CreatedAt: time.Now().UTC(),
+		})
+		if errors.Is(err, errRecordExists) {
+			// the parents were created with it
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// folder returns the folder without its entries
+func (bu *BucketUpload) folder(ctx context.Context, userID, folder string) (*Folder, error) {
+	if folder == "" {
+		return &Folder{}, nil
+	}
+	rec := &folderRecord{}
+	err := bu.getRecord(ctx, folderRecordKey(userID, folder), rec)
+	if errors.Is(err, errRecordNotFound) {
+		return nil, ErrFolderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Folder{Path: rec.Path, Name: path.Base(rec.Path), CreatedAt: rec.CreatedAt}, nil
+}
+
+// StatFolder returns the folder without its files and folders, an empty folder is the root
+func (bu *BucketUpload) StatFolder(ctx context.Context, userID, folder string) (*Folder, error) {
+	folder, ok := cleanFolder(folder)
+	if !ok {
+		return nil, ErrInvalidFolder
+	}
+
+	return bu.folder(ctx, userID, folder)
+}
+
+// ListFolder returns the folder with the files and folders directly in it,
+// an empty folder is the root
+func (bu *BucketUpload) ListFolder(ctx context.Context, userID, folder string) (*Folder, error) {
+	f, err := bu.StatFolder(ctx, userID, folder)
+	if err != nil {
+		return nil, err
+	}
+	if f.Files, err = bu.FolderFiles(ctx, userID, f.Path); err != nil {
+		return nil, err
+	}
+	if f.Children, err = bu.Subfolders(ctx, userID, f.Path); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// FolderFiles returns the files of the user directly in the folder, newest first
+func (bu *BucketUpload) FolderFiles(ctx context.Context, userID, folder string) ([]*FileInfo, error) {
+	files, err := bu.folderFiles(ctx, userID, folder, false)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreatedAt.After(files[j].CreatedAt)
+	})
+
+	return files, nil
+}
+
+// folderFiles lists the files of the user in the folder, and in its subfolders when recursive
+func (bu *BucketUpload) folderFiles(ctx context.Context, userID, folder string, recursive bool) ([]*FileInfo, error) {
+	prefix := ""
+	if folder != "" {
+		prefix = folder + "/"
+	}
+	files := make([]*FileInfo, 0)
+	for obj := range bu.Storage.ListObjects(ctx, bu.BucketName, minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithMetadata: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if isSystemKey(obj.Key) || (!recursive && folderOf(obj.Key) != folder) {
+			continue
+		}
+		if metadataValue(obj.UserMetadata, "userID") == "" {
+			info, err := bu.Storage.StatObject(ctx, bu.BucketName, obj.Key, minio.StatObjectOptions{})
+			if err != nil {
+				return nil, err
+			}
+			obj = info
+		}
+		if metadataValue(obj.UserMetadata, "userID") == userID {
+			files = append(files, newFileInfo(obj))
+		}
+	}
+
+	return files, nil
+}
+
+// Subfolders returns the folders of the user directly in the folder, by name
+func (bu *BucketUpload) Subfolders(ctx context.Context, userID, folder string) ([]*Folder, error) {
+	records, err := bu.folderRecords(ctx, userID, folder)
+	if err != nil {
+		return nil, err
+	}
+	children := make([]*Folder, 0)
+	for _, rec := range records {
+		if folderOf(rec.Path) == folder {
+			children = append(children, &Folder{Path: rec.Path, Name: path.Base(rec.Path), CreatedAt: rec.CreatedAt})
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+
+	return children, nil
+}
+
+// folderRecords returns the records of every folder below the folder
+func (bu *BucketUpload) folderRecords(ctx context.Context, userID, folder string) ([]*folderRecord, error) {
+	prefix := folderRecordKey(userID, "")
+	if folder != "" {
+		prefix = folderRecordKey(userID, folder+"/")
+	}
+	keys, err := bu.recordKeys(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*folderRecord, 0, len(keys))
+	for _, key := range keys {
+		rec := &folderRecord{}
+		if err := bu.getRecord(ctx, key, rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+/*
+RenameFolder moves the folder with its files and folders to another path
+  - The target must not exist, its parents are created
+  - Files are copied to their new key and then deleted, so their IDs change
+*/
+func (bu *BucketUpload) RenameFolder(ctx context.Context, userID, from, to string) (_ *Folder, err error) {
+	defer func() {
+		bu.audit(ctx, AuditFolderRename, from, err)
+	}()
+	from, okFrom := cleanFolder(from)
+	to, okTo := cleanFolder(to)
+	if !okFrom || !okTo || from == "" || to == "" || to == from || strings.HasPrefix(to, from+"/") {
+		return nil, ErrInvalidFolder
+	}
+	if _, err := bu.folder(ctx, userID, from); err != nil {
+		return nil, err
+	}
+	if _, err := bu.folder(ctx, userID, to); err == nil {
+		return nil, ErrFolderExists
+	} else if !errors.Is(err, ErrFolderNotFound) {
+		return nil, err
+	}
+
+	files, err := bu.folderFiles(ctx, userID, from, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		folder := to + strings.TrimPrefix(folderOf(f.ID), from)
+		if _, err := bu.moveFile(ctx, userID, f.ID, MoveOptions{Folder: &folder}); err != nil {
+			return nil, err
+		}
+	}
+	records, err := bu.folderRecords(ctx, userID, from)
+	if err != nil {
+		return nil, err
+	}
+	records = append(records, &folderRecord{Path: from})
+	if err := bu.ensureFolder(ctx, userID, folderOf(to)); err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		renamed := to + strings.TrimPrefix(rec.Path, from)
+		err := bu.createRecord(ctx, folderRecordKey(userID, renamed), &folderRecord{
+			UserID:    userID,
+			Path:      renamed,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil && !errors.Is(err, errRecordExists) {
+			return nil, err
+		}
+	}
+	for _, rec := range records {
+		if err := bu.removeRecord(ctx, folderRecordKey(userID, rec.Path)); err != nil {
+			return nil, err
+		}
+	}
+
+	return bu.folder(ctx, userID, to)
+}
+
+// DeleteFolder removes an empty folder, or with recursive the folder with its files and folders
+func (bu *BucketUpload) DeleteFolder(ctx context.Context, userID, folder string, recursive bool) (err error) {
+	defer func() {
+		bu.audit(ctx, AuditFolderDelete, folder, err)
+	}()
+	folder, ok := cleanFolder(folder)
+	if !ok || folder == "" {
+		return ErrInvalidFolder
+	}
+	if _, err := bu.folder(ctx, userID, folder); err != nil {
+		return err
+	}
+	files, err := bu.folderFiles(ctx, userID, folder, true)
+	if err != nil {
+		return err
+	}
+	records, err := bu.folderRecords(ctx, userID, folder)
+	if err != nil {
+		return err
+	}
+	if !recursive && (len(files) > 0 || len(records) > 0) {
+		return ErrFolderNotEmpty
+	}
+	for _, f := range files {
+		if err := bu.DeleteFile(ctx, userID, f.ID); err != nil {
+			return err
+		}
+	}
+	// children first so a failed delete leaves no orphans
+	slices.SortFunc(records, func(a, b *folderRecord) int {
+		return len(b.Path) - len(a.Path)
+	})
+	for _, rec := range append(records, &folderRecord{Path: folder}) {
+		if err := bu.removeRecord(ctx, folderRecordKey(userID, rec.Path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+MoveFile moves a file owned by the user to another folder and or renames it
+  - The object is copied to its new key and the old one deleted, the ID
+    changes with the folder while the generated name is kept
+  - Share links to the old ID stop working
+*/
+func (bu *BucketUpload) MoveFile(ctx context.Context, userID, id string, opts MoveOptions) (_ *FileInfo, err error) {
+	defer func() {
+		bu.audit(ctx, AuditMove, id, err)
+	}()
+	if opts.Folder != nil {
+		folder, ok := cleanFolder(*opts.Folder)
+		if !ok {
+			return nil, ErrInvalidFolder
+		}
+		if err := bu.ensureFolder(ctx, userID, folder); err != nil {
+			return nil, err
+		}
+	}
+
+	return bu.moveFile(ctx, userID, id, opts)
+}
+
+// moveFile is MoveFile without creating the folder
+func (bu *BucketUpload) moveFile(ctx context.Context, userID, id string, opts MoveOptions) (*FileInfo, error) {
+	copier, ok := bu.Storage.(ObjectCopier)
+	if !ok {
+		return nil, ErrMoveUnsupported
+	}
+	folder := folderOf(id)
+	if opts.Folder != nil {
+		if folder, ok = cleanFolder(*opts.Folder); !ok {
+			return nil, ErrInvalidFolder
+		}
+	}
+	obj, err := bu.statObject(ctx, id, ownedBy(userID))
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]string{}
+	for k, v := range obj.UserMetadata {
+		metadata[metadataKey(k)] = v
+	}
+	if opts.Name != "" {
+		metadata["filename"] = opts.Name
+	}
+	key := objectKey(folder, path.Base(id))
+	_, err = copier.CopyObject(ctx, minio.CopyDestOptions{
+		Bucket:          bu.BucketName,
+		Object:          key,
+		UserMetadata:    metadata,
+		ReplaceMetadata: true,
+		ContentType:     obj.ContentType,
+	}, minio.CopySrcOptions{Bucket: bu.BucketName, Object: id, MatchETag: obj.ETag})
+	if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+		return nil, errors.Join(ErrMetadataConflict, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key != id {
+		if err := bu.Storage.RemoveObject(ctx, bu.BucketName, id, minio.RemoveObjectOptions{}); err != nil {
+			return nil, err
+		}
+	}
+	if bu.Index != nil {
+		bu.Index.Move(id, key)
+	}
+
+	return bu.StatFile(ctx, userID, key)
+}
@@ -0,0 +1,148 @@
+package business
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanFolder(t *testing.T) {
+	scenarios := []struct {
+		folder   string
+		expected string
+		ok       bool
+	}{
+		{folder: "", expected: "", ok: true},
+		{folder: "/invoices/2026/", expected: "invoices/2026", ok: true},
+		{folder: "../secrets"},
+		{folder: "a/../b"},
+		{folder: "a//b"},
+		{folder: "_system/audit"},
+		{folder: strings.Repeat("a", maxFolderLength+1)},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.folder, func(t *testing.T) {
+			folder, ok := cleanFolder(scenario.folder)
+			assert.Equal(t, scenario.ok, ok)
+			assert.Equal(t, scenario.expected, folder)
+		})
+	}
+}
+
+// uploadTo uploads a file of alice into the folder
+func uploadTo(t *testing.T, bu *BucketUpload, folder, name string) *FileUpload {
+	fu := &FileUpload{
+		RealName:    name,
+		FileName:    name,
+		File:        strings.NewReader("hello"),
+		Size:        5,
+		ContentType: "application/pdf",
+		UserID:      "alice",
+		Folder:      folder,
+	}
+	require.NoError(t, bu.Upload(context.Background(), fu))
+	return fu
+}
+
+func TestFolders(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+
+	fu := uploadTo(t, bu, "invoices/2026", "a.pdf")
+	assert.True(t, strings.HasPrefix(fu.ID, "invoices/2026/"))
+	uploadTo(t, bu, "", "b.pdf")
+
+	_, err := bu.CreateFolder(ctx, "alice", "invoices")
+	assert.ErrorIs(t, err, ErrFolderExists, "uploads create the folder and its parents")
+	_, err = bu.CreateFolder(ctx, "alice", "../invoices")
+	assert.ErrorIs(t, err, ErrInvalidFolder)
+	created, err := bu.CreateFolder(ctx, "alice", "archive")
+	require.NoError(t, err)
+	assert.Equal(t, "archive", created.Name)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	root, err := bu.ListFolder(ctx, "alice", "")
+	require.NoError(t, err)
+	require.Len(t, root.Files, 1)
+	assert.Equal(t, "b.pdf", root.Files[0].Name)
+	require.Len(t, root.Children, 2)
+	assert.Equal(t, "archive", root.Children[0].Path)
+	assert.Equal(t, "invoices", root.Children[1].Path)
+
+	_, err = bu.ListFolder(ctx, "bob", "invoices")
+	assert.ErrorIs(t, err, ErrFolderNotFound, "folders belong to a user")
+
+	info, err := bu.StatFile(ctx, "alice", fu.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "invoices/2026", info.Folder)
+
+	assert.ErrorIs(t, bu.DeleteFolder(ctx, "alice", "invoices", false), ErrFolderNotEmpty)
+
+	_, err = bu.RenameFolder(ctx, "alice", "invoices", "invoices/old")
+	assert.ErrorIs(t, err, ErrInvalidFolder, "folders can not move into themselves")
+	_, err = bu.RenameFolder(ctx, "alice", "invoices", "archive")
+	assert.ErrorIs(t, err, ErrFolderExists)
+	renamed, err := bu.RenameFolder(ctx, "alice", "invoices", "archive/invoices")
+	require.NoError(t, err)
+	assert.Equal(t, "archive/invoices", renamed.Path)
+
+	_, err = bu.ListFolder(ctx, "alice", "invoices")
+	assert.ErrorIs(t, err, ErrFolderNotFound)
+	moved, err := bu.ListFolder(ctx, "alice", "archive/invoices/2026")
+	require.NoError(t, err)
+	require.Len(t, moved.Files, 1)
+	assert.Equal(t, "archive/invoices/2026/"+path.Base(fu.ID), moved.Files[0].ID)
+	_, err = bu.StatFile(ctx, "alice", fu.ID)
+	assert.ErrorIs(t, err, ErrFileNotFound, "the old ID is gone")
+
+	require.NoError(t, bu.DeleteFolder(ctx, "alice", "archive", true))
+	root, err = bu.ListFolder(ctx, "alice", "")
+	require.NoError(t, err)
+	assert.Empty(t, root.Children)
+	assert.Len(t, root.Files, 1)
+}
+
+func TestMoveFile(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	fu := uploadTo(t, bu, "", "scan.pdf")
+	folder, root := "inbox", ""
+
+	scenarios := []struct {
+		name           string
+		userID         string
+		opts           MoveOptions
+		expectedFolder string
+		expectedName   string
+		err            error
+	}{
+		{name: "into a new folder", userID: "alice", opts: MoveOptions{Folder: &folder}, expectedFolder: "inbox", expectedName: "scan.pdf"},
+		{name: "rename in place", userID: "alice", opts: MoveOptions{Name: "invoice.pdf"}, expectedFolder: "inbox", expectedName: "invoice.pdf"},
+		{name: "back to the root", userID: "alice", opts: MoveOptions{Folder: &root}, expectedName: "invoice.pdf"},
+		{name: "someone else's file", userID: "bob", opts: MoveOptions{Folder: &folder}, err: ErrFileNotFound},
+	}
+	id := fu.ID
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			info, err := bu.MoveFile(ctx, scenario.userID, id, scenario.opts)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expectedFolder, info.Folder)
+			assert.Equal(t, scenario.expectedName, info.Name)
+			assert.Equal(t, fu.Checksum, info.Checksum)
+			id = info.ID
+		})
+	}
+
+	_, err := NewBucketUpload(storageOnly{storagetest.NewMemory()}, "test").
+		MoveFile(ctx, "alice", id, MoveOptions{Folder: &folder})
+	assert.ErrorIs(t, err, ErrMoveUnsupported)
+}
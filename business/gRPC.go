@@ -5,12 +5,24 @@ import (
 	"time"
 
 	"github.com/riyadennis/identity-server/app/proto/identity"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
 )
 
 func IdentityClient(url string) (identity.IdentityClient, error) {
+	conn, err := IdentityConn(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity.NewIdentityClient(conn), nil
+}
+
+// IdentityConn connects to the identity server, the connection is
+// what GRPCConnCheck watches
+func IdentityConn(url string) (*grpc.ClientConn, error) {
 	if url == "" {
 		return nil, errors.New("empty url for identity gRPC client")
 	}
@@ -21,14 +33,10 @@ func IdentityClient(url string) (identity.IdentityClient, error) {
 			PermitWithoutStream: true,
 		}),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// propagates the W3C trace context of the request to the identity server
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 	}
 
 	// Create gRPC connection to identity server
-	conn, err := grpc.NewClient(url, opts...)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return identity.NewIdentityClient(conn), nil
+	return grpc.NewClient(url, opts...)
 }
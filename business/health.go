@@ -0,0 +1,224 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	// HealthOK is the status of a passing check and of a report where all checks pass
+	HealthOK = "ok"
+	// HealthUnavailable is the status of a failing check and of a report with any failing check
+	HealthUnavailable = "unavailable"
+)
+
+var (
+	errBucketMissing        = errors.New("bucket does not exist")
+	errDiskSpaceUnsupported = errors.New("disk space can not be checked on this platform")
+)
+
+// HealthCheck returns an error when the dependency it checks can not be used
+type HealthCheck func(ctx context.Context) error
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+// HealthReport is the outcome of every registered check
+type HealthReport struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]CheckResult `json:"checks"`
+	CheckedAt time.Time              `json:"checkedAt"`
+}
+
+// Healthy reports whether every check passed
+func (r *HealthReport) Healthy() bool {
+	return r.Status == HealthOK
+}
+
+/*
+Health runs the checks components registered
+  - Checks run concurrently, each for at most Timeout
+  - Reports are cached for CacheTTL so probes do not hammer the dependencies,
+    concurrent probes share one run
+*/
+type Health struct {
+	Timeout  time.Duration
+	CacheTTL time.Duration
+
+	mu     sync.Mutex
+	checks map[string]HealthCheck
+	report *HealthReport
+	group  singleflight.Group
+}
+
+// DefaultHealth holds the checks served at /readiness, the timeout and cache are
+// set with HEALTH_CHECK_TIMEOUT and HEALTH_CACHE_TTL
+var DefaultHealth = NewHealth(envDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+	envDuration("HEALTH_CACHE_TTL", 5*time.Second))
+
+func NewHealth(timeout, cacheTTL time.Duration) *Health {
+	return &Health{
+		Timeout:  timeout,
+		CacheTTL: cacheTTL,
+		checks:   make(map[string]HealthCheck),
+	}
+}
+
+// Register adds a check, registering a name again replaces its check
+func (h *Health) Register(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+	h.report = nil
+}
+
+// Check returns the cached report or runs the checks, without checks the report is ok
+func (h *Health) Check(ctx context.Context) *HealthReport {
+	h.mu.Lock()
+	report := h.report
+	h.mu.Unlock()
+	if report != nil && time.Since(report.CheckedAt) < h.CacheTTL {
+		return report
+	}
+
+	res, _, _ := h.group.Do("check", func() (any, error) {
+		// a probe giving up should not fail the others waiting on this run
+		report := h.run(context.WithoutCancel(ctx))
+		h.mu.Lock()
+		h.report = report
+		h.mu.Unlock()
+		return report, nil
+	})
+
+	return res.(*HealthReport)
+}
+
+func (h *Health) run(ctx context.Context) *HealthReport {
+	h.mu.Lock()
+	checks := make(map[string]HealthCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.Unlock()
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	report := &HealthReport{Status: HealthOK, Checks: make(map[string]CheckResult, len(checks))}
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := h.runCheck(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != HealthOK {
+				report.Status = HealthUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+	report.CheckedAt = time.Now()
+
+	return report
+}
+
+// runCheck stops waiting for a check once it timed out, even when it ignores ctx
+func (h *Health) runCheck(ctx context.Context, check HealthCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out after %s", h.Timeout)
+	}
+	result := CheckResult{Status: HealthOK, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = HealthUnavailable
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// BucketChecker is the part of the minio client which checks buckets
+type BucketChecker interface {
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+}
+
+// BucketCheck fails when the storage is unreachable or the bucket is missing
+func BucketCheck(storage BucketChecker, bucketName string) HealthCheck {
+	return func(ctx context.Context) error {
+		exists, err := storage.BucketExists(ctx, bucketName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errBucketMissing
+		}
+		return nil
+	}
+}
+
+// ConnState is the part of a gRPC client connection reporting its state
+type ConnState interface {
+	GetState() connectivity.State
+	Connect()
+}
+
+// GRPCConnCheck fails while the connection is failing or shut down, idle
+// connections are asked to connect so that a broken server is noticed
+func GRPCConnCheck(conn ConnState) HealthCheck {
+	return func(context.Context) error {
+		switch state := conn.GetState(); state {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("connection is %s", state)
+		case connectivity.Idle:
+			conn.Connect()
+		}
+		return nil
+	}
+}
+
+// DiskSpaceCheck fails when any of dirs has less than minFree bytes available
+func DiskSpaceCheck(minFree uint64, dirs ...string) HealthCheck {
+	return func(context.Context) error {
+		for _, dir := range dirs {
+			free, err := freeDiskSpace(dir)
+			if errors.Is(err, errDiskSpaceUnsupported) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if free < minFree {
+				return fmt.Errorf("%s has %d bytes free, %d needed", dir, free, minFree)
+			}
+		}
+		return nil
+	}
+}
+
+// NewEnvDiskSpaceCheck needs HEALTH_MIN_FREE_DISK bytes in dirs, room for two
+// of the largest uploads by default
+func NewEnvDiskSpaceCheck(dirs ...string) HealthCheck {
+	return DiskSpaceCheck(uint64(envInt("HEALTH_MIN_FREE_DISK", 2*MaxFileSize)), dirs...)
+}
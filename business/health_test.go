@@ -0,0 +1,120 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/connectivity"
+)
+
+type missingBucket struct{}
+
+func (missingBucket) BucketExists(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+type mockConn struct {
+	state     connectivity.State
+	connected bool
+}
+
+func (m *mockConn) GetState() connectivity.State {
+	return m.state
+}
+
+func (m *mockConn) Connect() {
+	m.connected = true
+}
+
+func TestHealth(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("down") }
+	passing := func(context.Context) error { return nil }
+	hanging := func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+
+	scenarios := []struct {
+		name     string
+		checks   map[string]HealthCheck
+		status   string
+		failures []string
+	}{
+		{name: "without checks", status: HealthOK},
+		{name: "passing", checks: map[string]HealthCheck{"a": passing, "b": passing}, status: HealthOK},
+		{name: "failing", checks: map[string]HealthCheck{"a": passing, "b": failing}, status: HealthUnavailable, failures: []string{"b"}},
+		{name: "timed out", checks: map[string]HealthCheck{"a": hanging}, status: HealthUnavailable, failures: []string{"a"}},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			h := NewHealth(20*time.Millisecond, time.Minute)
+			for name, check := range scenario.checks {
+				h.Register(name, check)
+			}
+			report := h.Check(context.Background())
+			assert.Equal(t, scenario.status, report.Status)
+			assert.Len(t, report.Checks, len(scenario.checks))
+			for _, name := range scenario.failures {
+				assert.Equal(t, HealthUnavailable, report.Checks[name].Status)
+				assert.NotEmpty(t, report.Checks[name].Error)
+			}
+		})
+	}
+}
+
+func TestHealthCache(t *testing.T) {
+	var runs atomic.Int32
+	h := NewHealth(time.Second, time.Minute)
+	h.Register("counted", func(context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	h.Check(context.Background())
+	h.Check(context.Background())
+	assert.EqualValues(t, 1, runs.Load())
+
+	// registering a check drops the cached report
+	h.Register("other", func(context.Context) error { return nil })
+	report := h.Check(context.Background())
+	assert.EqualValues(t, 2, runs.Load())
+	assert.Len(t, report.Checks, 2)
+}
+
+func TestHealthChecks(t *testing.T) {
+	scenarios := []struct {
+		name      string
+		check     HealthCheck
+		expectErr bool
+	}{
+		{name: "bucket", check: BucketCheck(storagetest.NewMemory(), "test")},
+		{name: "missing bucket", check: BucketCheck(missingBucket{}, "test"), expectErr: true},
+		{name: "connection ready", check: GRPCConnCheck(&mockConn{state: connectivity.Ready})},
+		{name: "connection failing", check: GRPCConnCheck(&mockConn{state: connectivity.TransientFailure}), expectErr: true},
+		{name: "connection shut down", check: GRPCConnCheck(&mockConn{state: connectivity.Shutdown}), expectErr: true},
+		{name: "enough disk", check: DiskSpaceCheck(1, t.TempDir())},
+		{name: "not enough disk", check: DiskSpaceCheck(1<<62, t.TempDir()), expectErr: true},
+		{name: "missing directory", check: DiskSpaceCheck(1, "/does/not/exist"), expectErr: true},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			err := scenario.check(context.Background())
+			if scenario.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestGRPCConnCheckConnectsIdle(t *testing.T) {
+	conn := &mockConn{state: connectivity.Idle}
+	require.NoError(t, GRPCConnCheck(conn)(context.Background()))
+	assert.True(t, conn.connected)
+}
@@ -0,0 +1,190 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+const (
+	// IdempotencyKeyHeader carries the key clients reuse when retrying an upload
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses to retried requests
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength bounds the keys clients can send
+	maxIdempotencyKeyLength = 255
+	// abandonedAfter is when an upload that never finished stops blocking its key
+	abandonedAfter = 5 * time.Minute
+
+	idempotencyRecords = "idempotency/"
+)
+
+var (
+	// ErrInvalidIdempotencyKey is returned for keys longer than 255 characters
+	ErrInvalidIdempotencyKey = foundation.NewError(foundation.InvalidRequest, "idempotency keys are at most 255 characters")
+	// ErrIdempotencyConflict is returned when a key is reused for a different file
+	ErrIdempotencyConflict = foundation.NewError(foundation.IdempotencyConflict, "idempotency key was used for a different file")
+	// ErrIdempotencyInProgress is returned while the first request with the key is running
+	ErrIdempotencyInProgress = foundation.NewError(foundation.Conflict, "a request with the idempotency key is in progress")
+)
+
+// idempotencyRecord remembers the upload made with a key
+type idempotencyRecord struct {
+	UserID    string    `json:"userID"`
+	Key       string    `json:"key"`
+	Checksum  string    `json:"checksum"`
+	FileID    string    `json:"fileID,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+/*
+IdempotentUploads stores a file once per user and idempotency key
+  - Keys are kept in the bucket for Window so retries reaching another replica
+    get the same result, claims are conditional writes so replicas never both upload
+  - A retry with the same key and content returns the original file,
+    different content is a conflict
+*/
+type IdempotentUploads struct {
+	bu     *BucketUpload
+	Window time.Duration
+}
+
+// NewEnvIdempotentUploads keeps keys for IDEMPOTENCY_WINDOW, a day by default
+func NewEnvIdempotentUploads(bu *BucketUpload) *IdempotentUploads {
+	return &IdempotentUploads{
+		bu:     bu,
+		Window: envDuration("IDEMPOTENCY_WINDOW", 24*time.Hour),
+	}
+}
+
+/*
+Upload stores the file unless the user already uploaded it with the key
+  - Without a key the file is always stored
+  - replayed is set when the original file is returned, fu.ID and fu.Checksum
+    are set either way
+*/
+func (u *IdempotentUploads) Upload(ctx context.Context, key string, fu *FileUpload) (replayed bool, err error) {
+	if key == "" {
+		return false, u.bu.Upload(ctx, fu)
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return false, ErrInvalidIdempotencyKey
+	}
+	data := make([]byte, fu.Size)
+	if _, err := io.ReadFull(fu.File, data); err != nil {
+		return false, err
+	}
+	fu.File = bytes.NewReader(data)
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	recordKey := idempotencyRecords + idempotencyHash(fu.UserID, key)
+	rec, err := u.claim(ctx, recordKey, &idempotencyRecord{
+		UserID:    fu.UserID,
+		Key:       key,
+		Checksum:  checksum,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+	if rec != nil {
+		fu.ID, fu.Checksum = rec.FileID, rec.Checksum
+		return true, nil
+	}
+
+	if err := u.bu.Upload(ctx, fu); err != nil {
+		// free the key so the client can retry
+		return false, errors.Join(err, u.bu.removeRecord(ctx, recordKey))
+	}
+	err = u.bu.putRecord(ctx, recordKey, &idempotencyRecord{
+		UserID:    fu.UserID,
+		Key:       key,
+		Checksum:  fu.Checksum,
+		FileID:    fu.ID,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	return false, err
+}
+
+/*
+claim creates pending unless the key is in use, it returns the finished
+record of an earlier request with the same content
+  - The record is created with If-None-Match so only one replica claims a key
+  - Expired and abandoned records are taken over with If-Match on their etag,
+    a replica losing the race sees the record of the winner on the next attempt
+*/
+func (u *IdempotentUploads) claim(ctx context.Context, recordKey string, pending *idempotencyRecord) (*idempotencyRecord, error) {
+	for range recordAttempts {
+		err := u.bu.createRecord(ctx, recordKey, pending)
+		if !errors.Is(err, errRecordExists) {
+			return nil, err
+		}
+		rec := &idempotencyRecord{}
+		etag, err := u.bu.getRecordETag(ctx, recordKey, rec)
+		switch {
+		case errors.Is(err, errRecordNotFound), errors.Is(err, errRecordChanged):
+			continue
+		case err != nil:
+			return nil, err
+		case time.Since(rec.CreatedAt) > u.Window:
+		case rec.FileID == "" && time.Since(rec.CreatedAt) > abandonedAfter:
+		case rec.Checksum != pending.Checksum:
+			return nil, ErrIdempotencyConflict
+		case rec.FileID == "":
+			return nil, ErrIdempotencyInProgress
+		default:
+			return rec, nil
+		}
+		err = u.bu.updateRecord(ctx, recordKey, pending, etag)
+		if !errors.Is(err, errRecordChanged) && !errors.Is(err, errRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	// other requests with the key keep changing the record
+	return nil, ErrIdempotencyInProgress
+}
+
+// Cleanup removes keys older than Window, it returns how many were removed
+func (u *IdempotentUploads) Cleanup(ctx context.Context) (int, error) {
+	keys, err := u.bu.recordKeys(ctx, idempotencyRecords)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, key := range keys {
+		rec := &idempotencyRecord{}
+		err := u.bu.getRecord(ctx, key, rec)
+		if errors.Is(err, errRecordNotFound) {
+			// removed by another replica since it was listed
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		if time.Since(rec.CreatedAt) <= u.Window {
+			continue
+		}
+		if err := u.bu.removeRecord(ctx, key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// idempotencyHash scopes keys to the user, clients pick keys freely
+func idempotencyHash(userID, key string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
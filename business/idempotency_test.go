@@ -0,0 +1,185 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIdempotentUpload(userID, content string) *FileUpload {
+	return &FileUpload{
+		RealName:    "a.pdf",
+		FileName:    "a.pdf",
+		File:        strings.NewReader(content),
+		Size:        int64(len(content)),
+		ContentType: "application/pdf",
+		UserID:      userID,
+	}
+}
+
+func TestIdempotentUploads(t *testing.T) {
+	scenarios := []struct {
+		name         string
+		firstUser    string
+		firstKey     string
+		firstContent string
+		user         string
+		key          string
+		content      string
+		replayed     bool
+		files        int
+		err          error
+	}{
+		{
+			name: "without key", firstUser: "alice", firstContent: "hello",
+			user: "alice", content: "hello", files: 2,
+		},
+		{
+			name: "retry", firstUser: "alice", firstKey: "k1", firstContent: "hello",
+			user: "alice", key: "k1", content: "hello", replayed: true, files: 1,
+		},
+		{
+			name: "different key", firstUser: "alice", firstKey: "k1", firstContent: "hello",
+			user: "alice", key: "k2", content: "hello", files: 2,
+		},
+		{
+			name: "key of another user", firstUser: "bob", firstKey: "k1", firstContent: "hello",
+			user: "alice", key: "k1", content: "hello", files: 2,
+		},
+		{
+			name: "different content", firstUser: "alice", firstKey: "k1", firstContent: "hello",
+			user: "alice", key: "k1", content: "world", files: 1, err: ErrIdempotencyConflict,
+		},
+		{
+			name: "key too long", firstUser: "alice", firstKey: "k1", firstContent: "hello",
+			user: "alice", key: strings.Repeat("k", 256), content: "hello", files: 1, err: ErrInvalidIdempotencyKey,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			ctx := context.Background()
+			u := NewEnvIdempotentUploads(NewBucketUpload(storagetest.NewMemory(), "test"))
+			first := newIdempotentUpload(scenario.firstUser, scenario.firstContent)
+			replayed, err := u.Upload(ctx, scenario.firstKey, first)
+			require.NoError(t, err)
+			assert.False(t, replayed)
+
+			fu := newIdempotentUpload(scenario.user, scenario.content)
+			replayed, err = u.Upload(ctx, scenario.key, fu)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, scenario.replayed, replayed)
+			}
+			if scenario.replayed {
+				assert.Equal(t, first.ID, fu.ID)
+				assert.Equal(t, first.Checksum, fu.Checksum)
+			}
+			files, err := u.bu.ListAllFiles(ctx, FileFilter{})
+			require.NoError(t, err)
+			assert.Len(t, files, scenario.files)
+		})
+	}
+}
+
+func TestIdempotentUploadsInProgress(t *testing.T) {
+	ctx := context.Background()
+	u := NewEnvIdempotentUploads(NewBucketUpload(storagetest.NewMemory(), "test"))
+	fu := newIdempotentUpload("alice", "hello")
+	rec, err := u.claim(ctx, idempotencyRecords+idempotencyHash("alice", "k1"), &idempotencyRecord{
+		UserID:    "alice",
+		Key:       "k1",
+		Checksum:  "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		CreatedAt: time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+
+	_, err = u.Upload(ctx, "k1", fu)
+	assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+
+	// an abandoned claim no longer blocks the key
+	require.NoError(t, u.bu.putRecord(ctx, idempotencyRecords+idempotencyHash("alice", "k1"), &idempotencyRecord{
+		UserID:    "alice",
+		Key:       "k1",
+		Checksum:  "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		CreatedAt: time.Now().Add(-abandonedAfter - time.Minute),
+	}))
+	replayed, err := u.Upload(ctx, "k1", newIdempotentUpload("alice", "hello"))
+	require.NoError(t, err)
+	assert.False(t, replayed)
+}
+
+func TestIdempotentUploadsAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	replicas := []*IdempotentUploads{
+		NewEnvIdempotentUploads(NewBucketUpload(store, "test")),
+		NewEnvIdempotentUploads(NewBucketUpload(store, "test")),
+	}
+	for _, abandoned := range []bool{false, true} {
+		key := fmt.Sprintf("abandoned-%t", abandoned)
+		if abandoned {
+			require.NoError(t, replicas[0].bu.putRecord(ctx, idempotencyRecords+idempotencyHash("alice", key), &idempotencyRecord{
+				UserID:    "alice",
+				Key:       key,
+				Checksum:  "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+				CreatedAt: time.Now().Add(-abandonedAfter - time.Minute),
+			}))
+		}
+		var (
+			wg       sync.WaitGroup
+			uploaded atomic.Int32
+		)
+		for range 10 {
+			for _, u := range replicas {
+				wg.Go(func() {
+					replayed, err := u.Upload(ctx, key, newIdempotentUpload("alice", "hello"))
+					if err == nil && !replayed {
+						uploaded.Add(1)
+					}
+					if err != nil {
+						assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+					}
+				})
+			}
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), uploaded.Load(), "abandoned %t", abandoned)
+	}
+	files, err := replicas[0].bu.ListFiles(ctx, "alice", FileFilter{})
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestIdempotentUploadsWindow(t *testing.T) {
+	ctx := context.Background()
+	// a record removed by another replica while cleaning up is skipped
+	store := removedRecord{storagetest.NewMemory(), idempotencyRecords + "removed"}
+	u := NewEnvIdempotentUploads(NewBucketUpload(store, "test"))
+	_, err := u.Upload(ctx, "k1", newIdempotentUpload("alice", "hello"))
+	require.NoError(t, err)
+
+	removed, err := u.Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	// once the window passed the key stores the file again
+	u.Window = 0
+	replayed, err := u.Upload(ctx, "k1", newIdempotentUpload("alice", "world"))
+	require.NoError(t, err)
+	assert.False(t, replayed)
+
+	removed, err = u.Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+}
@@ -0,0 +1,400 @@
+package business
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// minJWKSRefresh limits how often unknown key IDs fetch the keys
+const minJWKSRefresh = 30 * time.Second
+
+var (
+	errMissingJWKS    = errors.New("JWKS_URL or JWKS_FILE must be set when AUTH_MODE is jwt")
+	errNoUsableKeys   = errors.New("JWKS does not contain any usable signing keys")
+	errUnknownKey     = errors.New("token signed with an unknown key")
+	errMissingSubject = errors.New("token does not identify the user")
+)
+
+// JWTConfig configures local verification of bearer JWTs
+type JWTConfig struct {
+	// JWKSURL or JWKSFile is where the signing keys are loaded from
+	JWKSURL  string
+	JWKSFile string
+	// Issuer and Audience must match the iss and aud claims when set
+	Issuer   string
+	Audience string
+	// UserClaim holds the user ID, RolesClaim the roles of the user
+	UserClaim  string
+	RolesClaim string
+	// RefreshInterval is how often RefreshEvery loads the keys again
+	RefreshInterval time.Duration
+	// Leeway allows for clock skew when checking exp and nbf
+	Leeway time.Duration
+}
+
+// NewEnvJWTConfig reads the JWT settings from the environment
+func NewEnvJWTConfig() (JWTConfig, error) {
+	cfg := JWTConfig{
+		JWKSURL:         os.Getenv("JWKS_URL"),
+		JWKSFile:        os.Getenv("JWKS_FILE"),
+		Issuer:          os.Getenv("JWT_ISSUER"),
+		Audience:        os.Getenv("JWT_AUDIENCE"),
+		UserClaim:       envString("JWT_USER_CLAIM", "sub"),
+		RolesClaim:      envString("JWT_ROLES_CLAIM", "roles"),
+		RefreshInterval: envDuration("JWKS_REFRESH_INTERVAL", 10*time.Minute),
+		Leeway:          envDuration("JWT_LEEWAY", 30*time.Second),
+	}
+	if cfg.JWKSURL == "" && cfg.JWKSFile == "" {
+		return cfg, errMissingJWKS
+	}
+
+	return cfg, nil
+}
+
+/*
+JWTAuthenticator verifies bearer JWTs without calling the identity server
+  - RS256, ES256 and EdDSA signatures are accepted, the key is picked by kid
+  - exp is required, nbf, iss and aud are checked when present or configured
+  - RefreshEvery loads the keys again every RefreshInterval, a token naming a key
+    we don't know also loads them so rotated keys are picked up straight away
+  - Keys are fetched at most once per minRefresh for unknown kids, the fetch runs in
+    the background and every request naming an unknown kid waits for the same fetch,
+    for no longer than its own context allows
+  - A failed refresh keeps the keys loaded last
+*/
+type JWTAuthenticator struct {
+	config     JWTConfig
+	parser     *jwt.Parser
+	httpClient *http.Client
+	minRefresh time.Duration
+
+	// refreshMu serialises fetching the keys
+	refreshMu sync.Mutex
+	// stateMu guards attempted, when the keys were last fetched, and refreshing,
+	// closed once the fetch started for an unknown kid finished
+	stateMu    sync.Mutex
+	attempted  time.Time
+	refreshing chan struct{}
+
+	mu   sync.RWMutex
+	keys map[string]any
+}
+
+// NewJWTAuthenticator loads the keys and fails when none can be used
+func NewJWTAuthenticator(cfg JWTConfig) (*JWTAuthenticator, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	if cfg.UserClaim == "" {
+		cfg.UserClaim = "sub"
+	}
+	a := &JWTAuthenticator{
+		config:     cfg,
+		parser:     jwt.NewParser(opts...),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		minRefresh: minJWKSRefresh,
+	}
+	if err := a.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Authenticate verifies the token and reads the user ID and roles from its claims
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		return a.key(ctx, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := claims[a.config.UserClaim].(string)
+	if userID == "" {
+		return nil, errMissingSubject
+	}
+
+	return &Principal{
+		UserID: userID,
+		Roles:  claimStrings(claims[a.config.RolesClaim]),
+	}, nil
+}
+
+func (a *JWTAuthenticator) key(ctx context.Context, t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := a.lookup(kid)
+	if !ok && a.awaitRefresh(ctx) {
+		key, ok = a.lookup(kid)
+	}
+	if !ok {
+		return nil, errUnknownKey
+	}
+
+	return key, nil
+}
+
+// lookup returns the key with the kid, a token without kid can only
+// be verified when the set has a single key
+func (a *JWTAuthenticator) lookup(kid string) (any, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, true
+		}
+	}
+	key, ok := a.keys[kid]
+
+	return key, ok
+}
+
+// awaitRefresh starts loading the keys in the background unless they were fetched
+// within minRefresh, joins a fetch already started and waits for it until ctx is done.
+// It reports whether a fetch finished, so the keys are worth looking up again
+func (a *JWTAuthenticator) awaitRefresh(ctx context.Context) bool {
+	a.stateMu.Lock()
+	done := a.refreshing
+	if done == nil {
+		if time.Since(a.attempted) < a.minRefresh {
+			a.stateMu.Unlock()
+			return false
+		}
+		done = make(chan struct{})
+		a.refreshing = done
+		// the fetch outlives the request starting it, the HTTP client bounds it
+		go func() {
+			_ = a.Refresh(context.Background())
+			a.stateMu.Lock()
+			a.refreshing = nil
+			a.stateMu.Unlock()
+			close(done)
+		}()
+	}
+	a.stateMu.Unlock()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Refresh loads the keys, a failure keeps the keys loaded last
+func (a *JWTAuthenticator) Refresh(ctx context.Context) error {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+	return a.load(ctx)
+}
+
+// RefreshEvery loads the keys every RefreshInterval until ctx is done
+func (a *JWTAuthenticator) RefreshEvery(ctx context.Context, logger *logrus.Logger) {
+	if a.config.RefreshInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(a.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Refresh(ctx); err != nil {
+				logger.Errorf("failed to refresh JWKS, keeping the keys loaded last: %v", err)
+			}
+		}
+	}
+}
+
+// load must be called with refreshMu held
+func (a *JWTAuthenticator) load(ctx context.Context) error {
+	a.stateMu.Lock()
+	a.attempted = time.Now()
+	a.stateMu.Unlock()
+	data, err := a.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.keys = keys
+	a.mu.Unlock()
+
+	return nil
+}
+
+func (a *JWTAuthenticator) fetch(ctx context.Context) ([]byte, error) {
+	if a.config.JWKSFile != "" {
+		return os.ReadFile(a.config.JWKSFile)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.config.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s", res.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// jsonWebKey is a public key of a JWKS, RFC 7517
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the signing keys by kid, keys we can't use are skipped
+func parseJWKS(data []byte) (map[string]any, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errNoUsableKeys
+	}
+
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC point")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// claimStrings reads a claim holding a list of strings or a space separated string
+func claimStrings(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,351 @@
+package business
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+func newSigningKeys(t *testing.T) []signingKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return []signingKey{
+		{kid: "rsa", method: jwt.SigningMethodRS256, key: rsaKey},
+		{kid: "ec", method: jwt.SigningMethodES256, key: ecKey},
+		{kid: "ed", method: jwt.SigningMethodEdDSA, key: edKey},
+	}
+}
+
+func jwks(t *testing.T, keys ...signingKey) []byte {
+	t.Helper()
+	enc := base64.RawURLEncoding.EncodeToString
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for _, k := range keys {
+		switch pub := k.key.Public().(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "RSA", "kid": k.kid, "use": "sig",
+				"n": enc(pub.N.Bytes()), "e": enc(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			point, err := pub.Bytes()
+			require.NoError(t, err)
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "EC", "kid": k.kid, "crv": "P-256",
+				"x": enc(point[1:33]), "y": enc(point[33:]),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, map[string]string{
+				"kty": "OKP", "kid": k.kid, "crv": "Ed25519", "x": enc(pub),
+			})
+		}
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	return data
+}
+
+func sign(t *testing.T, k signingKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   "https://identity.example.com",
+		"aud":   "ingestion",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"admin", "uploader"},
+	}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	keys := newSigningKeys(t)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, jwks(t, keys...), 0o600))
+	auth, err := NewJWTAuthenticator(JWTConfig{
+		JWKSFile:        file,
+		Issuer:          "https://identity.example.com",
+		Audience:        "ingestion",
+		UserClaim:       "sub",
+		RolesClaim:      "roles",
+		RefreshInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	for _, k := range keys {
+		t.Run(k.method.Alg(), func(t *testing.T) {
+			p, err := auth.Authenticate(context.Background(), sign(t, k, validClaims()))
+			require.NoError(t, err)
+			assert.Equal(t, &Principal{UserID: "alice", Roles: []string{"admin", "uploader"}}, p)
+		})
+	}
+
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	hmacToken, err := hmac.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	unknown := newSigningKeys(t)[0]
+	unknown.kid = "rotated"
+
+	scenarios := []struct {
+		name   string
+		token  string
+		claims func(jwt.MapClaims)
+	}{
+		{
+			name:   "expired",
+			claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		},
+		{
+			name:   "missing expiry",
+			claims: func(c jwt.MapClaims) { delete(c, "exp") },
+		},
+		{
+			name:   "not valid yet",
+			claims: func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+		},
+		{
+			name:   "wrong audience",
+			claims: func(c jwt.MapClaims) { c["aud"] = "billing" },
+		},
+		{
+			name:   "wrong issuer",
+			claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		},
+		{
+			name:   "missing subject",
+			claims: func(c jwt.MapClaims) { delete(c, "sub") },
+		},
+		{
+			name:  "symmetric algorithm",
+			token: hmacToken,
+		},
+		{
+			name:  "unknown key",
+			token: sign(t, unknown, validClaims()),
+		},
+		{
+			name:  "malformed",
+			token: "not.a.jwt",
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			token := scenario.token
+			if scenario.claims != nil {
+				claims := validClaims()
+				scenario.claims(claims)
+				token = sign(t, keys[0], claims)
+			}
+			p, err := auth.Authenticate(context.Background(), token)
+			assert.Error(t, err)
+			assert.Nil(t, p)
+		})
+	}
+}
+
+func TestJWTAuthenticatorRefreshesRotatedKeys(t *testing.T) {
+	keys := newSigningKeys(t)
+	var (
+		current  atomic.Value
+		requests atomic.Int32
+	)
+	current.Store(jwks(t, keys[0]))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write(current.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	auth, err := NewJWTAuthenticator(JWTConfig{JWKSURL: srv.URL, RefreshInterval: time.Hour})
+	require.NoError(t, err)
+	auth.minRefresh = 0
+
+	_, err = auth.Authenticate(context.Background(), sign(t, keys[0], validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// the issuer rotates to a new key, tokens signed with it are accepted
+	// once the unknown kid makes us load the keys again
+	current.Store(jwks(t, keys[1]))
+	p, err := auth.Authenticate(context.Background(), sign(t, keys[1], validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", p.UserID)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// the JWKS endpoint failing keeps the keys loaded last
+	current.Store([]byte("{"))
+	_, err = auth.Authenticate(context.Background(), sign(t, keys[0], validClaims()))
+	assert.Error(t, err)
+	_, err = auth.Authenticate(context.Background(), sign(t, keys[1], validClaims()))
+	assert.NoError(t, err)
+}
+
+func TestJWTAuthenticatorLimitsRefreshes(t *testing.T) {
+	keys := newSigningKeys(t)
+	var (
+		requests atomic.Int32
+		down     atomic.Bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(jwks(t, keys[0]))
+	}))
+	defer srv.Close()
+
+	auth, err := NewJWTAuthenticator(JWTConfig{JWKSURL: srv.URL, RefreshInterval: time.Hour})
+	require.NoError(t, err)
+	down.Store(true)
+	auth.minRefresh = time.Hour
+	auth.attempted = time.Time{}
+
+	// tokens with made up kids fetch the keys once, requests with known kids never wait for it
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			unknown := keys[1]
+			unknown.kid = fmt.Sprintf("made-up-%d", i)
+			_, err := auth.Authenticate(context.Background(), sign(t, unknown, validClaims()))
+			assert.Error(t, err)
+		})
+	}
+	start := time.Now()
+	_, err = auth.Authenticate(context.Background(), sign(t, keys[0], validClaims()))
+	assert.NoError(t, err, "the keys loaded last are used while the JWKS endpoint fails")
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	wg.Wait()
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestJWTAuthenticatorWaitsForRotatedKeys(t *testing.T) {
+	keys := newSigningKeys(t)
+	var (
+		current  atomic.Value
+		requests atomic.Int32
+		release  = make(chan struct{})
+	)
+	current.Store(jwks(t, keys[0]))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		_, _ = w.Write(current.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	auth, err := NewJWTAuthenticator(JWTConfig{JWKSURL: srv.URL, RefreshInterval: time.Hour})
+	require.NoError(t, err)
+	auth.minRefresh = 0
+	current.Store(jwks(t, keys[0], keys[1]))
+	token := sign(t, keys[1], validClaims())
+
+	// a request giving up does not stop the fetch the others wait for
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = auth.Authenticate(ctx, token)
+	assert.Error(t, err)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			p, err := auth.Authenticate(context.Background(), token)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "alice", p.UserID)
+			}
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(2), requests.Load(), "requests waiting together share one fetch")
+}
+
+func TestJWTAuthenticatorRefreshEvery(t *testing.T) {
+	keys := newSigningKeys(t)
+	var current atomic.Value
+	current.Store(jwks(t, keys[0]))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(current.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	auth, err := NewJWTAuthenticator(JWTConfig{JWKSURL: srv.URL, RefreshInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	auth.minRefresh = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go auth.RefreshEvery(ctx, logrus.New())
+
+	current.Store(jwks(t, keys[1]))
+	assert.Eventually(t, func() bool {
+		_, ok := auth.lookup(keys[1].kid)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewJWTAuthenticatorErrors(t *testing.T) {
+	dir := t.TempDir()
+	noKeys := filepath.Join(dir, "empty.json")
+	require.NoError(t, os.WriteFile(noKeys, []byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`), 0o600))
+
+	scenarios := []struct {
+		name   string
+		config JWTConfig
+	}{
+		{name: "missing file", config: JWTConfig{JWKSFile: filepath.Join(dir, "missing.json")}},
+		{name: "no usable keys", config: JWTConfig{JWKSFile: noKeys}},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			_, err := NewJWTAuthenticator(scenario.config)
+			assert.Error(t, err)
+		})
+	}
+}
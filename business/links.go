@@ -0,0 +1,106 @@
+package business
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// passwordIterations is the PBKDF2 work factor for link passwords
+const passwordIterations = 100_000
+
+var errInvalidToken = errors.New("invalid link token")
+
+/*
+Links issues signed links which work without an account
+  - Tokens look like <id>.<expiry>.<signature>, the HMAC-SHA256 signature covers
+    the kind of link, its ID and expiry so forged or tampered tokens are rejected
+    without reading the bucket
+  - Link records are kept under SystemPrefix, they hold the limits and usage
+  - BaseURL is the public URL of the REST server links are built on
+*/
+type Links struct {
+	bu      *BucketUpload
+	secret  []byte
+	BaseURL string
+}
+
+func NewLinks(bu *BucketUpload, secret []byte, baseURL string) *Links {
+	return &Links{
+		bu:      bu,
+		secret:  secret,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// sign returns the token for a link of the kind
+func (l *Links) sign(kind, id string, expires time.Time) string {
+	payload := id + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + l.signature(kind, payload)
+}
+
+// verify checks the signature of the token and returns the link ID and expiry
+func (l *Links) verify(kind, token string) (string, time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}, errInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(l.signature(kind, payload))) {
+		return "", time.Time{}, errInvalidToken
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, errInvalidToken
+	}
+
+	return parts[0], time.Unix(exp, 0), nil
+}
+
+func (l *Links) signature(kind, payload string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(kind + "." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hashPassword returns salt$key, empty passwords are not hashed
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(salt) + "$" + hex.EncodeToString(key), nil
+}
+
+func checkPassword(hash, password string) bool {
+	salt, want, ok := strings.Cut(hash, "$")
+	if !ok {
+		return false
+	}
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, saltBytes, passwordIterations, 32)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(key)), []byte(want)) == 1
+}
@@ -0,0 +1,263 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+const (
+	// MetadataHeaderPrefix starts the headers carrying user metadata, X-Meta-Project: apollo
+	MetadataHeaderPrefix = "X-Meta-"
+	// MetadataFieldPrefix starts the multipart fields carrying user metadata, meta.project=apollo
+	MetadataFieldPrefix = "meta."
+	// TagsHeader carries the comma separated tags of a file
+	TagsHeader = "X-Tags"
+	// TagsField carries the comma separated tags of a file in multipart requests
+	TagsField = "tags"
+
+	// user metadata is stored next to the system keys under this prefix
+	userMetadataPrefix = "meta-"
+	tagsMetadataKey    = "tags"
+
+	maxMetadataKeys   = 32
+	maxMetadataSize   = 2048
+	maxMetadataKey    = 64
+	maxMetadataValue  = 256
+	maxTags           = 10
+	maxTagLength      = 64
+	metadataKeyFormat = `^[a-z0-9][a-z0-9-]*$`
+	tagFormat         = `^[a-z0-9][a-z0-9._:-]*$`
+)
+
+var (
+	// ErrInvalidMetadata is returned for keys or values which can not be stored
+	ErrInvalidMetadata = foundation.NewError(foundation.InvalidRequest,
+		"metadata keys are letters, digits and hyphens up to 64 characters, values are printable ASCII up to 256 characters")
+	// ErrMetadataTooLarge is returned when a file would have more than 32 keys or 2KB of metadata
+	ErrMetadataTooLarge = foundation.NewError(foundation.InvalidRequest, "metadata is limited to 32 keys and 2KB")
+	// ErrInvalidTags is returned for more than 10 tags or tags which are not letters, digits and ._:-
+	ErrInvalidTags = foundation.NewError(foundation.InvalidRequest,
+		"files have at most 10 tags of letters, digits and ._:- up to 64 characters")
+	// ErrMetadataUnsupported is returned when the storage can not rewrite metadata in place
+	ErrMetadataUnsupported = foundation.NewError(foundation.NotImplemented, "storage does not support updating metadata")
+	// ErrMetadataConflict is returned when the file changed while its metadata was rewritten
+	ErrMetadataConflict = foundation.NewError(foundation.Conflict, "file changed while it was updated, try again")
+
+	metadataKeyPattern = regexp.MustCompile(metadataKeyFormat)
+	tagPattern         = regexp.MustCompile(tagFormat)
+)
+
+// ObjectCopier is the part of the minio client which rewrites the metadata of an object
+type ObjectCopier interface {
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
+}
+
+// MetadataUpdate changes the metadata and tags of a file
+type MetadataUpdate struct {
+	// Metadata is merged into the metadata of the file, empty values remove keys
+	Metadata map[string]string `json:"metadata"`
+	// Tags replace the tags of the file, nil keeps them
+	Tags []string `json:"tags"`
+}
+
+/*
+NormalizeMetadata lower cases keys and tags and checks they can be stored
+  - Keys are letters, digits and hyphens, headers lose their case on the way
+  - Values are printable ASCII, the storage sends them as HTTP headers
+  - Tags are deduplicated and sorted
+*/
+func NormalizeMetadata(metadata map[string]string, tags []string) (map[string]string, []string, error) {
+	normalized := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if len(k) > maxMetadataKey || !metadataKeyPattern.MatchString(k) || !validMetadataValue(v) {
+			return nil, nil, ErrInvalidMetadata
+		}
+		normalized[k] = v
+	}
+	normalizedTags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, nil, ErrInvalidTags
+		}
+		normalizedTags = append(normalizedTags, tag)
+	}
+	slices.Sort(normalizedTags)
+	normalizedTags = slices.Compact(normalizedTags)
+	if len(normalizedTags) > maxTags {
+		return nil, nil, ErrInvalidTags
+	}
+	if err := checkMetadataSize(normalized); err != nil {
+		return nil, nil, err
+	}
+
+	return normalized, normalizedTags, nil
+}
+
+// ParseTags splits a comma separated list of tags
+func ParseTags(value string) []string {
+	var tags []string
+	for tag := range strings.SplitSeq(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// MetadataFromHeader reads the X-Meta-* and X-Tags headers of a request
+func MetadataFromHeader(header http.Header) (map[string]string, []string) {
+	metadata := map[string]string{}
+	for k, v := range header {
+		if key, ok := strings.CutPrefix(http.CanonicalHeaderKey(k), MetadataHeaderPrefix); ok && len(v) > 0 {
+			metadata[key] = v[0]
+		}
+	}
+
+	return metadata, ParseTags(header.Get(TagsHeader))
+}
+
+func validMetadataValue(v string) bool {
+	if v == "" || len(v) > maxMetadataValue {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < ' ' || v[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func checkMetadataSize(metadata map[string]string) error {
+	if len(metadata) > maxMetadataKeys {
+		return ErrMetadataTooLarge
+	}
+	size := 0
+	for k, v := range metadata {
+		size += len(userMetadataPrefix) + len(k) + len(v)
+	}
+	if size > maxMetadataSize {
+		return ErrMetadataTooLarge
+	}
+
+	return nil
+}
+
+// setUserMetadata adds the metadata and tags of the client to the object metadata
+func setUserMetadata(objectMetadata, metadata map[string]string, tags []string) {
+	for k, v := range metadata {
+		objectMetadata[userMetadataPrefix+k] = v
+	}
+	if len(tags) > 0 {
+		objectMetadata[tagsMetadataKey] = strings.Join(tags, ",")
+	}
+}
+
+// userMetadata splits the metadata and tags of the client from the object metadata
+func userMetadata(objectMetadata map[string]string) (map[string]string, []string) {
+	var metadata map[string]string
+	for k, v := range objectMetadata {
+		if key, ok := strings.CutPrefix(metadataKey(k), userMetadataPrefix); ok {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+			metadata[key] = v
+		}
+	}
+
+	return metadata, ParseTags(metadataValue(objectMetadata, tagsMetadataKey))
+}
+
+// UpdateMetadata changes the metadata and tags of a file owned by the user
+func (bu *BucketUpload) UpdateMetadata(ctx context.Context, userID, id string, update MetadataUpdate) (*FileInfo, error) {
+	return bu.updateMetadata(ctx, id, ownedBy(userID), update)
+}
+
+// UpdateAnyMetadata changes the metadata and tags of a file whoever owns it
+func (bu *BucketUpload) UpdateAnyMetadata(ctx context.Context, id string, update MetadataUpdate) (*FileInfo, error) {
+	return bu.updateMetadata(ctx, id, anyOwner, update)
+}
+
+/*
+updateMetadata rewrites the metadata of the object by copying it onto itself
+  - The copy only happens if the object was not replaced since it was read
+  - Name, owner, checksum and the other system keys are kept
+*/
+func (bu *BucketUpload) updateMetadata(ctx context.Context, id string, match func(owner string) bool, update MetadataUpdate) (_ *FileInfo, err error) {
+	defer func() {
+		bu.audit(ctx, AuditMetadataUpdate, id, err)
+	}()
+	copier, ok := bu.Storage.(ObjectCopier)
+	if !ok {
+		return nil, ErrMetadataUnsupported
+	}
+	set := map[string]string{}
+	var remove []string
+	for k, v := range update.Metadata {
+		if v == "" {
+			remove = append(remove, strings.ToLower(k))
+			continue
+		}
+		set[k] = v
+	}
+	set, tags, err := NormalizeMetadata(set, update.Tags)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := bu.statObject(ctx, id, match)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, currentTags := userMetadata(obj.UserMetadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	for _, k := range remove {
+		delete(metadata, k)
+	}
+	for k, v := range set {
+		metadata[k] = v
+	}
+	if err := checkMetadataSize(metadata); err != nil {
+		return nil, err
+	}
+	if update.Tags == nil {
+		tags = currentTags
+	}
+	objectMetadata := map[string]string{}
+	for k, v := range obj.UserMetadata {
+		if k = metadataKey(k); k != tagsMetadataKey && !strings.HasPrefix(k, userMetadataPrefix) {
+			objectMetadata[k] = v
+		}
+	}
+	setUserMetadata(objectMetadata, metadata, tags)
+
+	_, err = copier.CopyObject(ctx, minio.CopyDestOptions{
+		Bucket:          bu.BucketName,
+		Object:          id,
+		UserMetadata:    objectMetadata,
+		ReplaceMetadata: true,
+		ContentType:     obj.ContentType,
+	}, minio.CopySrcOptions{Bucket: bu.BucketName, Object: id, MatchETag: obj.ETag})
+	if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+		return nil, errors.Join(ErrMetadataConflict, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bu.indexFile(id)
+
+	return bu.statFile(ctx, id, match)
+}
@@ -0,0 +1,171 @@
+package business
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeMetadata(t *testing.T) {
+	tooMany := map[string]string{}
+	for _, k := range strings.Split("abcdefghijklmnopqrstuvwxyz0123456789", "") {
+		tooMany[k] = "v"
+	}
+	scenarios := []struct {
+		name             string
+		metadata         map[string]string
+		tags             []string
+		expectedMetadata map[string]string
+		expectedTags     []string
+		err              error
+	}{
+		{
+			name:             "header keys are lower cased",
+			metadata:         map[string]string{"Project": "apollo", "cost-centre": "42"},
+			tags:             []string{"Invoice", "2026", "invoice"},
+			expectedMetadata: map[string]string{"project": "apollo", "cost-centre": "42"},
+			expectedTags:     []string{"2026", "invoice"},
+		},
+		{name: "key with underscore", metadata: map[string]string{"cost_centre": "42"}, err: ErrInvalidMetadata},
+		{name: "empty value", metadata: map[string]string{"project": ""}, err: ErrInvalidMetadata},
+		{name: "non ASCII value", metadata: map[string]string{"project": "café"}, err: ErrInvalidMetadata},
+		{name: "long value", metadata: map[string]string{"project": strings.Repeat("a", 257)}, err: ErrInvalidMetadata},
+		{name: "too many keys", metadata: tooMany, err: ErrMetadataTooLarge},
+		{name: "invalid tag", tags: []string{"two words"}, err: ErrInvalidTags},
+		{name: "too many tags", tags: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), err: ErrInvalidTags},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			metadata, tags, err := NormalizeMetadata(scenario.metadata, scenario.tags)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expectedMetadata, metadata)
+			assert.Equal(t, scenario.expectedTags, tags)
+		})
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	fu := &FileUpload{
+		RealName:       "scan.pdf",
+		FileName:       "scan.pdf",
+		File:           strings.NewReader("hello"),
+		Size:           5,
+		ContentType:    "application/pdf",
+		UserID:         "alice",
+		ClientMetadata: map[string]string{"Project": "apollo", "stage": "draft"},
+		Tags:           []string{"invoice"},
+	}
+	require.NoError(t, bu.Upload(ctx, fu))
+
+	info, err := bu.StatFile(ctx, "alice", fu.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"project": "apollo", "stage": "draft"}, info.Metadata)
+	assert.Equal(t, []string{"invoice"}, info.Tags)
+
+	scenarios := []struct {
+		name             string
+		userID           string
+		update           MetadataUpdate
+		expectedMetadata map[string]string
+		expectedTags     []string
+		err              error
+	}{
+		{
+			name:             "merge and remove keys",
+			userID:           "alice",
+			update:           MetadataUpdate{Metadata: map[string]string{"stage": "", "owner": "finance"}},
+			expectedMetadata: map[string]string{"project": "apollo", "owner": "finance"},
+			expectedTags:     []string{"invoice"},
+		},
+		{
+			name:             "replace tags",
+			userID:           "alice",
+			update:           MetadataUpdate{Tags: []string{"paid", "2026"}},
+			expectedMetadata: map[string]string{"project": "apollo", "owner": "finance"},
+			expectedTags:     []string{"2026", "paid"},
+		},
+		{
+			name:             "remove tags",
+			userID:           "alice",
+			update:           MetadataUpdate{Tags: []string{}},
+			expectedMetadata: map[string]string{"project": "apollo", "owner": "finance"},
+		},
+		{
+			name:   "invalid key",
+			userID: "alice",
+			update: MetadataUpdate{Metadata: map[string]string{"bad key": "x"}},
+			err:    ErrInvalidMetadata,
+		},
+		{
+			name:   "someone else's file",
+			userID: "bob",
+			update: MetadataUpdate{Tags: []string{"mine"}},
+			err:    ErrFileNotFound,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			info, err := bu.UpdateMetadata(ctx, scenario.userID, fu.ID, scenario.update)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expectedMetadata, info.Metadata)
+			assert.Equal(t, scenario.expectedTags, info.Tags)
+			// the system keys are kept
+			assert.Equal(t, "scan.pdf", info.Name)
+			assert.Equal(t, "alice", info.UserID)
+			assert.Equal(t, fu.Checksum, info.Checksum)
+		})
+	}
+
+	_, err = NewBucketUpload(storageOnly{storagetest.NewMemory()}, "test").
+		UpdateMetadata(ctx, "alice", fu.ID, MetadataUpdate{})
+	assert.ErrorIs(t, err, ErrMetadataUnsupported)
+}
+
+func TestListFilesFilter(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	for _, fu := range []*FileUpload{
+		{RealName: "a.pdf", ClientMetadata: map[string]string{"project": "apollo"}, Tags: []string{"invoice", "paid"}},
+		{RealName: "b.pdf", ClientMetadata: map[string]string{"project": "apollo"}, Tags: []string{"invoice"}},
+		{RealName: "c.pdf", ClientMetadata: map[string]string{"project": "gemini"}},
+	} {
+		fu.File, fu.Size, fu.ContentType, fu.UserID = strings.NewReader("hello"), 5, "application/pdf", "alice"
+		require.NoError(t, bu.Upload(ctx, fu))
+	}
+
+	scenarios := []struct {
+		name     string
+		filter   FileFilter
+		expected []string
+	}{
+		{name: "no filter", expected: []string{"a.pdf", "b.pdf", "c.pdf"}},
+		{name: "metadata", filter: FileFilter{Metadata: map[string]string{"Project": "apollo"}}, expected: []string{"a.pdf", "b.pdf"}},
+		{name: "tags", filter: FileFilter{Tags: []string{"invoice", "paid"}}, expected: []string{"a.pdf"}},
+		{name: "no match", filter: FileFilter{Tags: []string{"overdue"}}},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			files, err := bu.ListFiles(ctx, "alice", scenario.filter)
+			require.NoError(t, err)
+			var names []string
+			for _, f := range files {
+				names = append(names, f.Name)
+			}
+			assert.ElementsMatch(t, scenario.expected, names)
+		})
+	}
+}
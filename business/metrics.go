@@ -0,0 +1,164 @@
+package business
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/riyadennis/identity-server/app/proto/identity"
+	"google.golang.org/grpc"
+)
+
+// MetricsEndpoint serves the Prometheus metrics on the admin port
+const MetricsEndpoint = "/metrics"
+
+// metricsRegistry holds the service metrics next to the Go runtime and process ones
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingestion_http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ingestion_http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	uploadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingestion_upload_bytes_total",
+		Help: "Bytes of files stored by content type.",
+	}, []string{"content_type"})
+	uploadSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "ingestion_upload_size_bytes",
+		Help: "Size of files stored by content type.",
+		// 1KB to 16GB
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 13),
+	}, []string{"content_type"})
+	uploadsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ingestion_uploads_in_flight",
+		Help: "Files being stored right now.",
+	})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ingestion_storage_request_duration_seconds",
+		Help:    "Object storage call latency by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+	storageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingestion_storage_errors_total",
+		Help: "Failed object storage calls by operation.",
+	}, []string{"operation"})
+
+	identityDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ingestion_identity_me_duration_seconds",
+		Help:    "Latency of Me calls to the identity server.",
+		Buckets: prometheus.DefBuckets,
+	})
+	identityErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ingestion_identity_me_errors_total",
+		Help: "Failed Me calls to the identity server.",
+	})
+
+	identityCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingestion_identity_cache_lookups_total",
+		Help: "Identity cache lookups by result, hit, negative_hit or miss.",
+	}, []string{"result"})
+	identityCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ingestion_identity_cache_evictions_total",
+		Help: "Tokens evicted from the identity cache to stay within its size.",
+	})
+
+	auditEntriesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ingestion_audit_entries_dropped_total",
+		Help: "Audit entries dropped because the audit writer fell behind.",
+	})
+
+	graphQLOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingestion_graphql_operations_total",
+		Help: "GraphQL operations by operation name.",
+	}, []string{"operation"})
+	graphQLErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingestion_graphql_operation_errors_total",
+		Help: "GraphQL operations which returned errors by operation name.",
+	}, []string{"operation"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		uploadBytes, uploadSize, uploadsInFlight,
+		storageDuration, storageErrors,
+		identityDuration, identityErrors,
+		identityCacheLookups, identityCacheEvictions,
+		auditEntriesDropped,
+		graphQLOperations, graphQLErrors,
+	)
+}
+
+// MetricsHandler serves the metrics in the Prometheus exposition format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request, route is the route pattern
+// so that IDs in paths do not create a series each
+func ObserveRequest(route, method string, status int, took time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(took.Seconds())
+}
+
+// ObserveGraphQLOperation records an executed GraphQL operation
+func ObserveGraphQLOperation(operation string, failed bool) {
+	if operation == "" {
+		operation = "anonymous"
+	}
+	graphQLOperations.WithLabelValues(operation).Inc()
+	if failed {
+		graphQLErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// observeUpload records a stored file
+func observeUpload(contentType string, size int64) {
+	uploadBytes.WithLabelValues(contentType).Add(float64(size))
+	uploadSize.WithLabelValues(contentType).Observe(float64(size))
+}
+
+// observeStorage records a call to the object storage started at start
+func observeStorage(operation string, start time.Time, err error) {
+	storageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		storageErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// InstrumentedIdentityClient records the latency and failures of Me calls
+type InstrumentedIdentityClient struct {
+	identity.IdentityClient
+}
+
+// NewInstrumentedIdentityClient wraps client, wrap it before caching so only
+// calls reaching the identity server are recorded
+func NewInstrumentedIdentityClient(client identity.IdentityClient) *InstrumentedIdentityClient {
+	return &InstrumentedIdentityClient{IdentityClient: client}
+}
+
+func (c *InstrumentedIdentityClient) Me(ctx context.Context, in *identity.UserRequest, opts ...grpc.CallOption) (*identity.UserResponse, error) {
+	start := time.Now()
+	user, err := c.IdentityClient.Me(ctx, in, opts...)
+	identityDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		identityErrors.Inc()
+	}
+
+	return user, err
+}
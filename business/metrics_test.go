@@ -0,0 +1,95 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/riyadennis/identity-server/app/proto/identity"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type failingStorage struct {
+	*storagetest.Memory
+}
+
+func (f failingStorage) FPutObject(context.Context, string, string, string, minio.PutObjectOptions) (minio.UploadInfo, error) {
+	return minio.UploadInfo{}, errors.New("storage is down")
+}
+
+type failingIdentity struct {
+	identity.IdentityClient
+}
+
+func (failingIdentity) Me(context.Context, *identity.UserRequest, ...grpc.CallOption) (*identity.UserResponse, error) {
+	return nil, errors.New("identity is down")
+}
+
+func TestUploadMetrics(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		storage       Storage
+		contentType   string
+		storageErrors float64
+		uploadBytes   float64
+	}{
+		{name: "stored", storage: storagetest.NewMemory(), contentType: "image/png", uploadBytes: 5},
+		{name: "storage failed", storage: failingStorage{storagetest.NewMemory()}, contentType: "image/jpeg", storageErrors: 1},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			errorsBefore := testutil.ToFloat64(storageErrors.WithLabelValues("FPutObject"))
+			bytesBefore := testutil.ToFloat64(uploadBytes.WithLabelValues(scenario.contentType))
+			fu := &FileUpload{
+				FileName:    "a",
+				File:        strings.NewReader("hello"),
+				Size:        5,
+				ContentType: scenario.contentType,
+				UserID:      "alice",
+			}
+			_ = fu.Upload(context.Background(), scenario.storage, "test")
+
+			assert.Equal(t, scenario.storageErrors, testutil.ToFloat64(storageErrors.WithLabelValues("FPutObject"))-errorsBefore)
+			assert.Equal(t, scenario.uploadBytes, testutil.ToFloat64(uploadBytes.WithLabelValues(scenario.contentType))-bytesBefore)
+			assert.Zero(t, testutil.ToFloat64(uploadsInFlight))
+		})
+	}
+}
+
+func TestInstrumentedIdentityClient(t *testing.T) {
+	before := testutil.ToFloat64(identityErrors)
+	_, err := NewInstrumentedIdentityClient(failingIdentity{}).Me(context.Background(), &identity.UserRequest{})
+	require.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(identityErrors))
+}
+
+func TestObserveGraphQLOperation(t *testing.T) {
+	scenarios := []struct {
+		name      string
+		operation string
+		failed    bool
+		label     string
+	}{
+		{name: "named", operation: "listFiles", label: "listFiles"},
+		{name: "failed", operation: "listFiles", failed: true, label: "listFiles"},
+		{name: "anonymous", label: "anonymous"},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			operations := testutil.ToFloat64(graphQLOperations.WithLabelValues(scenario.label))
+			failures := testutil.ToFloat64(graphQLErrors.WithLabelValues(scenario.label))
+			ObserveGraphQLOperation(scenario.operation, scenario.failed)
+			assert.Equal(t, operations+1, testutil.ToFloat64(graphQLOperations.WithLabelValues(scenario.label)))
+			if scenario.failed {
+				failures++
+			}
+			assert.Equal(t, failures, testutil.ToFloat64(graphQLErrors.WithLabelValues(scenario.label)))
+		})
+	}
+}
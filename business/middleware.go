@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/riyadennis/ingestion-service/foundation"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc/metadata"
 
@@ -21,18 +22,19 @@ type contextKey string
 
 const UserIDContextKey contextKey = "userID"
 
-func NeedsAuthMiddleWare(client identity.IdentityClient, logger *logrus.Logger) func(http.Handler) http.Handler {
+func NeedsAuthMiddleWare(auth Authenticator, logger *logrus.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
-			
-			userID, err := UsrIDFromToken(ctx, r, client)
+
+			principal, err := PrincipalFromRequest(ctx, r, auth)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
+				logger.Errorf("failed to authenticate the user: %v", err)
+				foundation.ErrorResponse(w, r, ErrUnauthenticated)
 				return
 			}
 			// Store user info in context
-			ctx = context.WithValue(ctx, UserIDContextKey, userID)
+			ctx = WithPrincipal(ctx, principal)
 
 			// Continue to next handler with user context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -40,9 +42,21 @@ func NeedsAuthMiddleWare(client identity.IdentityClient, logger *logrus.Logger)
 	}
 }
 
-func UsrIDFromToken(ctx context.Context, r *http.Request, client identity.IdentityClient) (string, error) {
-	// Extract authorization token from header
-	authHeader := r.Header.Get("Authorization")
+func UsrIDFromToken(ctx context.Context, r *http.Request, client identity.IdentityClient) (_ string, err error) {
+	ctx, span := startSpan(ctx, "UsrIDFromToken")
+	defer func() {
+		endSpan(span, err)
+	}()
+	token, err := BearerToken(r.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+
+	return UserIDFromBearer(ctx, client, token)
+}
+
+// BearerToken extracts the token from an authorization header value
+func BearerToken(authHeader string) (string, error) {
 	if authHeader == "" {
 		return "", errors.New("missing authorization header")
 	}
@@ -52,8 +66,16 @@ func UsrIDFromToken(ctx context.Context, r *http.Request, client identity.Identi
 	if len(parts) != 2 || parts[0] != "Bearer" {
 		return "", errors.New("invalid authorization header format")
 	}
-	token := parts[1]
 
+	return parts[1], nil
+}
+
+// UserIDFromBearer asks the identity server who the token belongs to
+func UserIDFromBearer(ctx context.Context, client identity.IdentityClient, token string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "UserIDFromBearer")
+	defer func() {
+		endSpan(span, err)
+	}()
 	// Create gRPC metadata with the token
 	md := metadata.New(map[string]string{
 		"Authorization": "Bearer " + token,
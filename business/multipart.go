@@ -0,0 +1,161 @@
+package business
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	// ErrMultipartUnsupported is returned when the storage can not stream multipart uploads
+	ErrMultipartUnsupported = foundation.NewError(foundation.NotImplemented, "storage does not support multipart uploads")
+	// ErrInvalidFileSize is returned when a large upload has no size or is above MaxSize
+	ErrInvalidFileSize = foundation.NewError(foundation.InvalidRequest, "invalid file size")
+)
+
+// MultipartStorage is the part of the minio client which streams objects in parts,
+// ComposeObject copies objects of any size onto themselves to replace their metadata
+type MultipartStorage interface {
+	PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader,
+		objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	RemoveIncompleteUpload(ctx context.Context, bucketName, objectName string) error
+	ComposeObject(ctx context.Context, dst minio.CopyDestOptions, srcs ...minio.CopySrcOptions) (minio.UploadInfo, error)
+}
+
+/*
+LargeUploadConfig tunes uploads above MaxFileSize
+  - Parts of PartSize bytes are sent to storage by Parallelism workers,
+    up to PartSize * Parallelism bytes are buffered per upload
+  - Requests may take BaseTimeout plus the time to receive the file at MinThroughput
+*/
+type LargeUploadConfig struct {
+	PartSize      uint64
+	Parallelism   uint
+	MaxSize       int64
+	BaseTimeout   time.Duration
+	MinThroughput int64
+}
+
+// NewEnvLargeUploadConfig reads the large upload settings from the environment
+func NewEnvLargeUploadConfig() LargeUploadConfig {
+	return LargeUploadConfig{
+		PartSize:      uint64(envInt("UPLOAD_PART_SIZE", 16*1024*1024)),
+		Parallelism:   uint(envInt("UPLOAD_PARALLELISM", 4)),
+		MaxSize:       int64(envInt("LARGE_FILE_MAX_SIZE", 10*1024*1024*1024)),
+		BaseTimeout:   envDuration("UPLOAD_BASE_TIMEOUT", 30*time.Second),
+		MinThroughput: int64(envInt("UPLOAD_MIN_THROUGHPUT", 1024*1024)),
+	}
+}
+
+// Timeout is how long a request sending size bytes may take
+func (cfg LargeUploadConfig) Timeout(size int64) time.Duration {
+	if cfg.MinThroughput <= 0 {
+		return cfg.BaseTimeout
+	}
+
+	return cfg.BaseTimeout + time.Duration(size/cfg.MinThroughput)*time.Second
+}
+
+/*
+UploadLarge streams a file to storage as a parallel multipart upload
+  - The file is not buffered whole or written to disk, Size must be its exact length
+  - The SHA-256 is computed on the way, when the client sent a checksum that does
+    not match the object is removed
+  - When the client sent no checksum the computed one is stored once the upload
+    completed, by copying the object onto itself with the checksum in its metadata
+  - Incomplete multipart uploads are aborted when the upload fails
+*/
+func (bu *BucketUpload) UploadLarge(ctx context.Context, fu *FileUpload, cfg LargeUploadConfig) (err error) {
+	ctx, span := startSpan(ctx, "BucketUpload.UploadLarge",
+		attribute.String("content_type", fu.ContentType), attribute.Int64("size", fu.Size))
+	defer func() {
+		bu.audit(ctx, AuditUpload, fu.ID, err)
+		endSpan(span, err)
+	}()
+	storage, ok := bu.Storage.(MultipartStorage)
+	if !ok {
+		return ErrMultipartUnsupported
+	}
+	if !AllowedTypes[fu.ContentType] {
+		return ErrUnsupportedFileType
+	}
+	if fu.Size <= 0 || fu.Size > cfg.MaxSize {
+		return ErrInvalidFileSize
+	}
+	metadata, err := fu.objectMetadata()
+	if err != nil {
+		return err
+	}
+	folder, ok := cleanFolder(fu.Folder)
+	if !ok {
+		return ErrInvalidFolder
+	}
+	if err := bu.ensureFolder(ctx, fu.UserID, folder); err != nil {
+		return err
+	}
+	// only a checksum sent by the client is known before the upload, it is verified below
+	if fu.Checksum != "" {
+		metadata["checksum"] = strings.ToLower(fu.Checksum)
+	}
+
+	uploadsInFlight.Inc()
+	defer uploadsInFlight.Dec()
+	id := objectKey(folder, generateSafeFilename(fu.FileName, fu.ContentType))
+	h := sha256.New()
+	start := time.Now()
+	info, err := storage.PutObject(ctx, bu.BucketName, id, io.TeeReader(io.LimitReader(fu.File, fu.Size), h), fu.Size, minio.PutObjectOptions{
+		ContentType:           fu.ContentType,
+		UserMetadata:          metadata,
+		PartSize:              cfg.PartSize,
+		NumThreads:            cfg.Parallelism,
+		ConcurrentStreamParts: true,
+	})
+	observeStorage("PutObject", start, err)
+	if err != nil {
+		// use a fresh context, the request one is likely what failed
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return errors.Join(err, storage.RemoveIncompleteUpload(abortCtx, bu.BucketName, id))
+	}
+
+	if info.Size != fu.Size {
+		return errors.Join(ErrInvalidFileSize,
+			bu.Storage.RemoveObject(ctx, bu.BucketName, id, minio.RemoveObjectOptions{}))
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if fu.Checksum != "" && !strings.EqualFold(fu.Checksum, checksum) {
+		return errors.Join(ErrChecksumMismatch,
+			bu.Storage.RemoveObject(ctx, bu.BucketName, id, minio.RemoveObjectOptions{}))
+	}
+	if fu.Checksum == "" {
+		metadata["checksum"] = checksum
+		// copies over 5GiB are done in parts, which only keep the content type from the metadata
+		metadata["Content-Type"] = fu.ContentType
+		_, err := storage.ComposeObject(ctx, minio.CopyDestOptions{
+			Bucket:          bu.BucketName,
+			Object:          id,
+			UserMetadata:    metadata,
+			ReplaceMetadata: true,
+			ContentType:     fu.ContentType,
+			PartSize:        cfg.PartSize,
+		}, minio.CopySrcOptions{Bucket: bu.BucketName, Object: id, MatchETag: info.ETag})
+		if err != nil {
+			return errors.Join(err, bu.Storage.RemoveObject(ctx, bu.BucketName, id, minio.RemoveObjectOptions{}))
+		}
+	}
+	observeUpload(fu.ContentType, fu.Size)
+	fu.Checksum = checksum
+	fu.ID = id
+	fu.Folder = folder
+	bu.indexFile(id)
+
+	return nil
+}
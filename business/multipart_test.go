@@ -0,0 +1,103 @@
+package business
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingMultipart fails uploads and records which were aborted
+type failingMultipart struct {
+	*storagetest.Memory
+	aborted []string
+}
+
+func (f *failingMultipart) PutObject(context.Context, string, string, io.Reader, int64, minio.PutObjectOptions) (minio.UploadInfo, error) {
+	return minio.UploadInfo{}, errors.New("connection reset")
+}
+
+func (f *failingMultipart) RemoveIncompleteUpload(_ context.Context, _, objectName string) error {
+	f.aborted = append(f.aborted, objectName)
+	return nil
+}
+
+func TestUploadLarge(t *testing.T) {
+	cfg := LargeUploadConfig{PartSize: 5, Parallelism: 2, MaxSize: 20}
+	sum := sha256.Sum256([]byte("hello world"))
+
+	scenarios := []struct {
+		name     string
+		size     int64
+		content  string
+		checksum string
+		folder   string
+		err      error
+	}{
+		{name: "upload", size: 11, content: "hello world"},
+		{name: "upload with checksum", size: 11, content: "hello world", checksum: hex.EncodeToString(sum[:])},
+		{name: "upload to a folder", size: 11, content: "hello world", folder: "/reports/2026/"},
+		{name: "checksum mismatch", size: 11, content: "hello there", checksum: hex.EncodeToString(sum[:]), err: ErrChecksumMismatch},
+		{name: "body shorter than size", size: 12, content: "hello world", err: ErrInvalidFileSize},
+		{name: "too large", size: 21, content: strings.Repeat("a", 21), err: ErrInvalidFileSize},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := storagetest.NewMemory()
+			bu := NewBucketUpload(store, "test")
+			fu := &FileUpload{
+				RealName:    "big.pdf",
+				FileName:    "big.pdf",
+				File:        strings.NewReader(scenario.content),
+				Size:        scenario.size,
+				ContentType: "application/pdf",
+				UserID:      "alice",
+				Checksum:    scenario.checksum,
+				Folder:      scenario.folder,
+			}
+			err := bu.UploadLarge(ctx, fu, cfg)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				files, err := bu.ListAllFiles(ctx, FileFilter{})
+				require.NoError(t, err)
+				assert.Empty(t, files, "failed uploads are removed")
+				return
+			}
+			require.NoError(t, err)
+			info, err := bu.StatFile(ctx, "alice", fu.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "big.pdf", info.Name)
+			assert.EqualValues(t, 11, info.Size)
+			assert.Equal(t, "application/pdf", info.ContentType)
+			assert.Equal(t, hex.EncodeToString(sum[:]), fu.Checksum)
+			assert.Equal(t, fu.Checksum, info.Checksum, "the checksum is stored with the file")
+			assert.Equal(t, strings.Trim(scenario.folder, "/"), fu.Folder)
+			assert.Equal(t, fu.Folder, info.Folder)
+		})
+	}
+}
+
+func TestUploadLargeAborts(t *testing.T) {
+	store := &failingMultipart{Memory: storagetest.NewMemory()}
+	fu := &FileUpload{File: strings.NewReader("hello"), Size: 5, ContentType: "application/pdf"}
+	err := NewBucketUpload(store, "test").UploadLarge(context.Background(), fu, LargeUploadConfig{MaxSize: 10})
+	assert.ErrorContains(t, err, "connection reset")
+	assert.Len(t, store.aborted, 1)
+}
+
+func TestLargeUploadTimeout(t *testing.T) {
+	cfg := LargeUploadConfig{BaseTimeout: 30 * time.Second, MinThroughput: 1024 * 1024}
+	assert.Equal(t, 30*time.Second, cfg.Timeout(1024))
+	assert.Equal(t, 30*time.Second+time.Hour, cfg.Timeout(3600*1024*1024))
+	assert.Equal(t, 30*time.Second, LargeUploadConfig{BaseTimeout: 30 * time.Second}.Timeout(1<<40))
+}
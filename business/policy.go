@@ -0,0 +1,145 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Permission is an action a principal can be allowed to perform
+type Permission string
+
+const (
+	// PermissionUpload allows uploading files
+	PermissionUpload Permission = "upload"
+	// PermissionReadOwn allows listing and downloading the caller's own files
+	PermissionReadOwn Permission = "read-own"
+	// PermissionReadAll allows listing and downloading files of every user
+	PermissionReadAll Permission = "read-all"
+	// PermissionDeleteOwn allows deleting the caller's own files
+	PermissionDeleteOwn Permission = "delete-own"
+	// PermissionDeleteAny allows deleting files of every user
+	PermissionDeleteAny Permission = "delete-any"
+	// PermissionAdmin grants every other permission
+	PermissionAdmin Permission = "admin"
+)
+
+var (
+	permissions = []Permission{
+		PermissionUpload, PermissionReadOwn, PermissionReadAll,
+		PermissionDeleteOwn, PermissionDeleteAny, PermissionAdmin,
+	}
+	// scopePermissions is what an API key scope allows, keys only act on their tenant's files
+	scopePermissions = map[string][]Permission{
+		ScopeUpload: {PermissionUpload},
+		ScopeRead:   {PermissionReadOwn},
+		ScopeDelete: {PermissionDeleteOwn},
+	}
+
+	errUnknownPermission = errors.New("unknown permission")
+)
+
+/*
+Policy maps roles to permissions
+  - Roles come from the token, for JWTs, and from Users, as the identity
+    server does not return roles
+  - DefaultRoles are given to every authenticated user
+*/
+type Policy struct {
+	Roles        map[string][]Permission `json:"roles"`
+	Users        map[string][]string     `json:"users"`
+	DefaultRoles []string                `json:"defaultRoles"`
+}
+
+// DefaultPolicy lets every user manage their own files and nothing else
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Roles: map[string][]Permission{
+			"user":  {PermissionUpload, PermissionReadOwn, PermissionDeleteOwn},
+			"admin": {PermissionAdmin},
+		},
+		DefaultRoles: []string{"user"},
+	}
+}
+
+// LoadPolicy reads a JSON policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid policy file: %w", err)
+	}
+	for role, perms := range p.Roles {
+		for _, perm := range perms {
+			if !slices.Contains(permissions, perm) {
+				return nil, fmt.Errorf("%w %q in role %s", errUnknownPermission, perm, role)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// NewEnvPolicy loads POLICY_FILE, or the default policy when it is not set
+func NewEnvPolicy() (*Policy, error) {
+	path := os.Getenv("POLICY_FILE")
+	if path == "" {
+		return DefaultPolicy(), nil
+	}
+
+	return LoadPolicy(path)
+}
+
+// Grant sets the roles and permissions of a user principal,
+// API key principals keep the permissions of their scopes
+func (p *Policy) Grant(principal *Principal) {
+	if principal.APIKeyID != "" {
+		return
+	}
+	roles := slices.Concat(principal.Roles, p.Users[principal.UserID], p.DefaultRoles)
+	slices.Sort(roles)
+	principal.Roles = slices.Compact(roles)
+
+	var granted []Permission
+	for _, role := range principal.Roles {
+		granted = append(granted, p.Roles[role]...)
+	}
+	slices.Sort(granted)
+	principal.Permissions = slices.Compact(granted)
+}
+
+// scopesPermissions returns what the API key scopes allow
+func scopesPermissions(scopes []string) []Permission {
+	var granted []Permission
+	for _, scope := range scopes {
+		granted = append(granted, scopePermissions[scope]...)
+	}
+	return granted
+}
+
+// PolicyAuthenticator grants permissions to the principals returned by Authenticator
+type PolicyAuthenticator struct {
+	Authenticator
+	Policy *Policy
+}
+
+func NewPolicyAuthenticator(auth Authenticator, policy *Policy) *PolicyAuthenticator {
+	return &PolicyAuthenticator{Authenticator: auth, Policy: policy}
+}
+
+// Authenticate authenticates the token and applies the policy
+func (a *PolicyAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	principal, err := a.Authenticator.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	a.Policy.Grant(principal)
+
+	return principal, nil
+}
@@ -0,0 +1,90 @@
+package business
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyGrant(t *testing.T) {
+	policy := &Policy{
+		Roles: map[string][]Permission{
+			"viewer":  {PermissionReadOwn},
+			"auditor": {PermissionReadOwn, PermissionReadAll},
+			"admin":   {PermissionAdmin},
+		},
+		Users:        map[string][]string{"carol": {"auditor"}},
+		DefaultRoles: []string{"viewer"},
+	}
+	scenarios := []struct {
+		name        string
+		principal   *Principal
+		allowed     []Permission
+		denied      []Permission
+		expectRoles []string
+	}{
+		{
+			name:        "default roles",
+			principal:   &Principal{UserID: "alice"},
+			allowed:     []Permission{PermissionReadOwn},
+			denied:      []Permission{PermissionUpload, PermissionReadAll},
+			expectRoles: []string{"viewer"},
+		},
+		{
+			name:        "roles from the policy users",
+			principal:   &Principal{UserID: "carol"},
+			allowed:     []Permission{PermissionReadOwn, PermissionReadAll},
+			denied:      []Permission{PermissionDeleteAny},
+			expectRoles: []string{"auditor", "viewer"},
+		},
+		{
+			name:        "roles from token claims",
+			principal:   &Principal{UserID: "dave", Roles: []string{"admin", "unknown"}},
+			allowed:     []Permission{PermissionUpload, PermissionReadAll, PermissionDeleteAny, PermissionAdmin},
+			expectRoles: []string{"admin", "unknown", "viewer"},
+		},
+		{
+			name:      "api keys keep their scopes",
+			principal: &Principal{UserID: "pipeline", APIKeyID: "key", Permissions: scopesPermissions([]string{ScopeUpload})},
+			allowed:   []Permission{PermissionUpload},
+			denied:    []Permission{PermissionReadOwn},
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			policy.Grant(scenario.principal)
+			for _, perm := range scenario.allowed {
+				assert.True(t, scenario.principal.Can(perm), perm)
+			}
+			for _, perm := range scenario.denied {
+				assert.False(t, scenario.principal.Can(perm), perm)
+			}
+			assert.Equal(t, scenario.expectRoles, scenario.principal.Roles)
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "policy.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{
+		"roles": {"uploader": ["upload"], "admin": ["admin"]},
+		"users": {"alice": ["admin"]},
+		"defaultRoles": ["uploader"]
+	}`), 0o600))
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"roles": {"uploader": ["fly"]}}`), 0o600))
+
+	policy, err := LoadPolicy(valid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, policy.Users["alice"])
+	assert.Equal(t, []Permission{PermissionUpload}, policy.Roles["uploader"])
+
+	_, err = LoadPolicy(invalid)
+	assert.ErrorIs(t, err, errUnknownPermission)
+	_, err = LoadPolicy(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
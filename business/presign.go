@@ -0,0 +1,343 @@
+package business
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+const (
+	// DefaultPresignExpiry is used when a presigned URL is requested without an expiry
+	DefaultPresignExpiry = 15 * time.Minute
+	// MaxPresignExpiry is the longest a presigned URL can be valid for
+	MaxPresignExpiry = 24 * time.Hour
+	// MaxPresignedFileSize is the largest object a single presigned PUT or POST can store
+	MaxPresignedFileSize = 5 * 1024 * 1024 * 1024
+
+	presignRecords = "presigned/"
+)
+
+var (
+	// ErrPresignUnsupported is returned when the storage can not sign requests
+	ErrPresignUnsupported = foundation.NewError(foundation.NotImplemented, "storage does not support presigned URLs")
+	// ErrInvalidPresign is returned for invalid content types, size ranges or expiries
+	ErrInvalidPresign = foundation.NewError(foundation.InvalidRequest, "invalid presigned upload request")
+	// ErrPresignedUploadNotFound is returned when completing an unknown upload
+	ErrPresignedUploadNotFound = foundation.NewError(foundation.NotFound, "presigned upload not found")
+	// ErrUploadIncomplete is returned when the object has not been uploaded yet
+	ErrUploadIncomplete = foundation.NewError(foundation.Conflict, "object has not been uploaded")
+	// ErrUploadRejected is returned when the uploaded object does not match the
+	// content type or size range it was presigned for, the object is deleted
+	ErrUploadRejected = foundation.NewError(foundation.UploadRejected, "uploaded object does not match the presigned constraints")
+)
+
+// Presigner is the part of the minio client needed to send bytes straight to the bucket
+type Presigner interface {
+	PresignHeader(ctx context.Context, method, bucketName, objectName string,
+		expires time.Duration, reqParams url.Values, extraHeaders http.Header) (*url.URL, error)
+	PresignedPostPolicy(ctx context.Context, p *minio.PostPolicy) (*url.URL, map[string]string, error)
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
+}
+
+// PresignOptions constrains a presigned upload
+type PresignOptions struct {
+	FileName    string
+	ContentType string
+	MinSize     int64
+	// MaxSize of zero allows up to MaxPresignedFileSize
+	MaxSize   int64
+	ExpiresIn time.Duration
+	// Post returns a POST policy for browser forms instead of a PUT URL
+	Post bool
+}
+
+/*
+PresignedUpload tells the client how to send the file to the bucket
+  - PUT requests must send Headers, the content type is part of the signature
+  - POST requests must send FormData before the file field
+*/
+type PresignedUpload struct {
+	ID        string            `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	FormData  map[string]string `json:"formData,omitempty"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// PresignedDownload is a URL the file can be fetched from without authentication
+type PresignedDownload struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// pendingUpload is kept until the client completes the upload
+type pendingUpload struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"userID"`
+	FileName    string    `json:"fileName"`
+	ContentType string    `json:"contentType"`
+	MinSize     int64     `json:"minSize"`
+	MaxSize     int64     `json:"maxSize"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+/*
+PresignUpload returns a URL the user can upload a file straight to the bucket with
+  - The object key is generated the same way as for uploads through the service
+  - The object is not the user's file until CompleteUpload validated it
+*/
+func (bu *BucketUpload) PresignUpload(ctx context.Context, userID string, opts PresignOptions) (*PresignedUpload, error) {
+	presigner, ok := bu.Storage.(Presigner)
+	if !ok {
+		return nil, ErrPresignUnsupported
+	}
+	if opts.ExpiresIn == 0 {
+		opts.ExpiresIn = DefaultPresignExpiry
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = MaxPresignedFileSize
+	}
+	if !AllowedTypes[opts.ContentType] || opts.MinSize < 0 || opts.MinSize > opts.MaxSize ||
+		opts.MaxSize > MaxPresignedFileSize || opts.ExpiresIn < 0 || opts.ExpiresIn > MaxPresignExpiry {
+		return nil, ErrInvalidPresign
+	}
+	id := generateSafeFilename(SanitizeFilename(opts.FileName), opts.ContentType)
+	expiresAt := time.Now().UTC().Add(opts.ExpiresIn).Truncate(time.Second)
+	err := bu.putRecord(ctx, presignRecords+id, &pendingUpload{
+		ID:          id,
+		UserID:      userID,
+		FileName:    opts.FileName,
+		ContentType: opts.ContentType,
+		MinSize:     opts.MinSize,
+		MaxSize:     opts.MaxSize,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	upload := &PresignedUpload{ID: id, ExpiresAt: expiresAt}
+	if opts.Post {
+		policy := minio.NewPostPolicy()
+		for _, err := range []error{
+			policy.SetBucket(bu.BucketName),
+			policy.SetKey(id),
+			policy.SetExpires(expiresAt),
+			policy.SetContentType(opts.ContentType),
+			policy.SetContentLengthRange(opts.MinSize, opts.MaxSize),
+		} {
+			if err != nil {
+				return nil, err
+			}
+		}
+		u, formData, err := presigner.PresignedPostPolicy(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		upload.Method, upload.URL, upload.FormData = http.MethodPost, u.String(), formData
+		return upload, nil
+	}
+
+	u, err := presigner.PresignHeader(ctx, http.MethodPut, bu.BucketName, id, opts.ExpiresIn, nil,
+		http.Header{"Content-Type": {opts.ContentType}})
+	if err != nil {
+		return nil, err
+	}
+	upload.Method, upload.URL = http.MethodPut, u.String()
+	upload.Headers = map[string]string{"Content-Type": opts.ContentType}
+
+	return upload, nil
+}
+
+/*
+CompleteUpload records a presigned upload as the user's file
+  - The object must exist, have the presigned content type and fit the size range,
+    otherwise it is deleted
+  - The object is read back once to compute its SHA-256
+  - The owner, file name and checksum are stored with a server side copy of the
+    object onto itself, the copy fails if the object was replaced meanwhile
+*/
+func (bu *BucketUpload) CompleteUpload(ctx context.Context, userID, id string) (_ *FileInfo, err error) {
+	defer func() {
+		bu.audit(ctx, AuditUpload, id, err)
+	}()
+	presigner, ok := bu.Storage.(Presigner)
+	if !ok {
+		return nil, ErrPresignUnsupported
+	}
+	pending := &pendingUpload{}
+	err = bu.getRecord(ctx, presignRecords+id, pending)
+	if errors.Is(err, errRecordNotFound) || (err == nil && pending.UserID != userID) {
+		return nil, ErrPresignedUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	obj, err := bu.Storage.StatObject(ctx, bu.BucketName, id, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrUploadIncomplete
+		}
+		return nil, err
+	}
+
+	contentType, _, _ := mime.ParseMediaType(obj.ContentType)
+	if contentType != pending.ContentType || obj.Size < pending.MinSize || obj.Size > pending.MaxSize {
+		err = bu.Storage.RemoveObject(ctx, bu.BucketName, id, minio.RemoveObjectOptions{})
+		if err == nil {
+			err = bu.removeRecord(ctx, presignRecords+id)
+		}
+		return nil, errors.Join(ErrUploadRejected, err)
+	}
+
+	checksum, err := bu.objectChecksum(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = presigner.CopyObject(ctx, minio.CopyDestOptions{
+		Bucket: bu.BucketName,
+		Object: id,
+		UserMetadata: map[string]string{
+			"fileName": pending.FileName,
+			"userID":   userID,
+			"checksum": checksum,
+		},
+		ReplaceMetadata: true,
+		ContentType:     pending.ContentType,
+	}, minio.CopySrcOptions{Bucket: bu.BucketName, Object: id, MatchETag: obj.ETag})
+	if err != nil {
+		return nil, err
+	}
+	if err := bu.removeRecord(ctx, presignRecords+id); err != nil {
+		return nil, err
+	}
+	bu.indexFile(id)
+
+	return bu.StatFile(ctx, userID, id)
+}
+
+// objectChecksum reads the object to compute its SHA-256
+func (bu *BucketUpload) objectChecksum(ctx context.Context, id string) (string, error) {
+	_, file, err := bu.openFile(ctx, &FileInfo{ID: id})
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PresignCleaner removes presigned uploads which were not completed before they expired
+type PresignCleaner struct {
+	bu *BucketUpload
+}
+
+func NewPresignCleaner(bu *BucketUpload) *PresignCleaner {
+	return &PresignCleaner{bu: bu}
+}
+
+/*
+Cleanup removes expired presigned upload records and the objects sent for them,
+it returns how many uploads were removed
+  - Objects which already have an owner were completed, only their record is removed
+*/
+func (c *PresignCleaner) Cleanup(ctx context.Context) (int, error) {
+	keys, err := c.bu.recordKeys(ctx, presignRecords)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, key := range keys {
+		pending := &pendingUpload{}
+		err := c.bu.getRecord(ctx, key, pending)
+		if errors.Is(err, errRecordNotFound) {
+			// completed or removed by another replica since it was listed
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		if time.Now().Before(pending.ExpiresAt) {
+			continue
+		}
+		id := strings.TrimPrefix(key, presignRecords)
+		obj, err := c.bu.Storage.StatObject(ctx, c.bu.BucketName, id, minio.StatObjectOptions{})
+		switch {
+		case minio.ToErrorResponse(err).Code == "NoSuchKey":
+		case err != nil:
+			return removed, err
+		case metadataValue(obj.UserMetadata, "userID") == "":
+			err = c.bu.Storage.RemoveObject(ctx, c.bu.BucketName, id, minio.RemoveObjectOptions{})
+			if err != nil {
+				return removed, err
+			}
+		}
+		if err := c.bu.removeRecord(ctx, key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// PresignDownload returns a URL to a file owned by the user
+func (bu *BucketUpload) PresignDownload(ctx context.Context, userID, id string, expiresIn time.Duration) (*PresignedDownload, error) {
+	return bu.presignDownload(ctx, id, ownedBy(userID), expiresIn)
+}
+
+// PresignAnyDownload returns a URL to a file whoever owns it
+func (bu *BucketUpload) PresignAnyDownload(ctx context.Context, id string, expiresIn time.Duration) (*PresignedDownload, error) {
+	return bu.presignDownload(ctx, id, anyOwner, expiresIn)
+}
+
+func (bu *BucketUpload) presignDownload(ctx context.Context, id string, match func(owner string) bool, expiresIn time.Duration) (_ *PresignedDownload, err error) {
+	defer func() {
+		bu.audit(ctx, AuditPresignDownload, id, err)
+	}()
+	presigner, ok := bu.Storage.(Presigner)
+	if !ok {
+		return nil, ErrPresignUnsupported
+	}
+	if expiresIn == 0 {
+		expiresIn = DefaultPresignExpiry
+	}
+	if expiresIn < 0 || expiresIn > MaxPresignExpiry {
+		return nil, ErrInvalidPresign
+	}
+	info, err := bu.statFile(ctx, id, match)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("response-content-type", info.ContentType)
+	if info.Name != "" {
+		params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name}))
+	}
+	u, err := presigner.PresignHeader(ctx, http.MethodGet, bu.BucketName, id, expiresIn, params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedDownload{
+		URL:       u.String(),
+		ExpiresAt: time.Now().UTC().Add(expiresIn).Truncate(time.Second),
+	}, nil
+}
@@ -0,0 +1,208 @@
+package business
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storageOnly hides the presigning methods of the store
+type storageOnly struct {
+	Storage
+}
+
+func TestPresignUpload(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+
+	scenarios := []struct {
+		name string
+		opts PresignOptions
+		err  error
+	}{
+		{name: "put", opts: PresignOptions{FileName: "scan.pdf", ContentType: "application/pdf"}},
+		{name: "post", opts: PresignOptions{FileName: "scan.pdf", ContentType: "application/pdf", MinSize: 1, MaxSize: 10, Post: true}},
+		{name: "unsupported type", opts: PresignOptions{ContentType: "text/html"}, err: ErrInvalidPresign},
+		{name: "inverted size range", opts: PresignOptions{ContentType: "application/pdf", MinSize: 10, MaxSize: 1}, err: ErrInvalidPresign},
+		{name: "too large", opts: PresignOptions{ContentType: "application/pdf", MaxSize: MaxPresignedFileSize + 1}, err: ErrInvalidPresign},
+		{name: "expiry too long", opts: PresignOptions{ContentType: "application/pdf", ExpiresIn: MaxPresignExpiry + time.Hour}, err: ErrInvalidPresign},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			upload, err := bu.PresignUpload(ctx, "alice", scenario.opts)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, strings.HasSuffix(upload.ID, ".pdf"))
+			if scenario.opts.Post {
+				assert.Equal(t, "POST", upload.Method)
+				assert.NotEmpty(t, upload.FormData["policy"])
+				return
+			}
+			assert.Equal(t, "PUT", upload.Method)
+			assert.Equal(t, "application/pdf", upload.Headers["Content-Type"])
+			u, err := url.Parse(upload.URL)
+			require.NoError(t, err)
+			assert.Equal(t, "/"+upload.ID, u.Path)
+			assert.Equal(t, "900", u.Query().Get("X-Amz-Expires"))
+			assert.Equal(t, "content-type", u.Query().Get("X-Amz-SignedHeaders"))
+		})
+	}
+
+	_, err := NewBucketUpload(storageOnly{storagetest.NewMemory()}, "test").
+		PresignUpload(ctx, "alice", PresignOptions{ContentType: "application/pdf"})
+	assert.ErrorIs(t, err, ErrPresignUnsupported)
+}
+
+func TestCompleteUpload(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	bu := NewBucketUpload(store, "test")
+	presign := func(t *testing.T) string {
+		upload, err := bu.PresignUpload(ctx, "alice", PresignOptions{
+			FileName:    "scan.pdf",
+			ContentType: "application/pdf",
+			MinSize:     2,
+			MaxSize:     5,
+		})
+		require.NoError(t, err)
+		return upload.ID
+	}
+
+	id := presign(t)
+	_, err := bu.CompleteUpload(ctx, "bob", id)
+	assert.ErrorIs(t, err, ErrPresignedUploadNotFound)
+	_, err = bu.CompleteUpload(ctx, "alice", id)
+	assert.ErrorIs(t, err, ErrUploadIncomplete)
+
+	// the bucket stores the object the client sent
+	store.Put(id, "application/pdf", []byte("pdf"), nil)
+	files, err := bu.ListFiles(ctx, "alice", FileFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, files, "uploads are not the user's files until completed")
+
+	info, err := bu.CompleteUpload(ctx, "alice", id)
+	require.NoError(t, err)
+	assert.Equal(t, "scan.pdf", info.Name)
+	assert.Equal(t, "alice", info.UserID)
+	sum := sha256.Sum256([]byte("pdf"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), info.Checksum)
+	_, err = bu.CompleteUpload(ctx, "alice", id)
+	assert.ErrorIs(t, err, ErrPresignedUploadNotFound, "uploads are only completed once")
+
+	for name, object := range map[string]struct {
+		contentType string
+		data        string
+	}{
+		"too small":          {contentType: "application/pdf", data: "p"},
+		"too large":          {contentType: "application/pdf", data: "too large"},
+		"wrong content type": {contentType: "image/png", data: "png"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			id := presign(t)
+			store.Put(id, object.contentType, []byte(object.data), nil)
+			_, err := bu.CompleteUpload(ctx, "alice", id)
+			assert.ErrorIs(t, err, ErrUploadRejected)
+			_, err = store.StatObject(ctx, "test", id, minio.StatObjectOptions{})
+			assert.Error(t, err, "rejected objects are deleted")
+		})
+	}
+}
+
+func TestPresignCleanup(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	bu := NewBucketUpload(store, "test")
+	presign := func(expiresIn time.Duration) string {
+		upload, err := bu.PresignUpload(ctx, "alice", PresignOptions{ContentType: "application/pdf"})
+		require.NoError(t, err)
+		pending := &pendingUpload{}
+		require.NoError(t, bu.getRecord(ctx, presignRecords+upload.ID, pending))
+		pending.ExpiresAt = time.Now().Add(expiresIn)
+		require.NoError(t, bu.putRecord(ctx, presignRecords+upload.ID, pending))
+		return upload.ID
+	}
+
+	scenarios := []struct {
+		name           string
+		expiresIn      time.Duration
+		object         map[string]string
+		expectedObject bool
+		expectedRecord bool
+	}{
+		{
+			name:           "not expired",
+			expiresIn:      time.Minute,
+			object:         map[string]string{},
+			expectedObject: true,
+			expectedRecord: true,
+		},
+		{
+			name:      "expired",
+			expiresIn: -time.Minute,
+			object:    map[string]string{},
+		},
+		{
+			name:      "expired without object",
+			expiresIn: -time.Minute,
+		},
+		{
+			name:           "completed before the record was removed",
+			expiresIn:      -time.Minute,
+			object:         map[string]string{"userID": "alice"},
+			expectedObject: true,
+		},
+	}
+	removed := 0
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			id := presign(scenario.expiresIn)
+			if scenario.object != nil {
+				store.Put(id, "application/pdf", []byte("pdf"), scenario.object)
+			}
+			n, err := NewPresignCleaner(bu).Cleanup(ctx)
+			require.NoError(t, err)
+			removed += n
+			_, err = store.StatObject(ctx, "test", id, minio.StatObjectOptions{})
+			assert.Equal(t, scenario.expectedObject, err == nil)
+			err = bu.getRecord(ctx, presignRecords+id, &pendingUpload{})
+			assert.Equal(t, scenario.expectedRecord, err == nil)
+		})
+	}
+	assert.Equal(t, 3, removed)
+}
+
+func TestPresignDownload(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	store.Put("a.jpeg", "image/jpeg", []byte("hello"),
+		map[string]string{"userID": "alice", "fileName": "holiday.jpeg"})
+	bu := NewBucketUpload(store, "test")
+
+	_, err := bu.PresignDownload(ctx, "bob", "a.jpeg", 0)
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	_, err = bu.PresignDownload(ctx, "alice", "a.jpeg", -time.Second)
+	assert.ErrorIs(t, err, ErrInvalidPresign)
+
+	download, err := bu.PresignDownload(ctx, "alice", "a.jpeg", time.Minute)
+	require.NoError(t, err)
+	u, err := url.Parse(download.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "60", u.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, "GET", u.Query().Get("X-Amz-Method"))
+	assert.Equal(t, `attachment; filename=holiday.jpeg`, u.Query().Get("response-content-disposition"))
+
+	_, err = bu.PresignAnyDownload(ctx, "a.jpeg", 0)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,165 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// SystemPrefix holds the records the service keeps in the bucket for itself,
+// objects under it are never listed or served as user files
+const SystemPrefix = "_system/"
+
+// recordAttempts bounds how often a conditional update is retried
+// when other replicas keep changing the record
+const recordAttempts = 5
+
+var (
+	errRecordNotFound = errors.New("record not found")
+	errRecordExists   = errors.New("record already exists")
+	errRecordChanged  = errors.New("record changed")
+)
+
+// isSystemKey reports whether the object belongs to the service rather than a user
+func isSystemKey(key string) bool {
+	return strings.HasPrefix(key, SystemPrefix)
+}
+
+// putRecord stores v as JSON under the system prefix
+func (bu *BucketUpload) putRecord(ctx context.Context, key string, v any) error {
+	return bu.writeRecord(ctx, key, v, minio.PutObjectOptions{})
+}
+
+// createRecord is putRecord failing with errRecordExists instead of
+// replacing a record, the check is done by the storage so it holds across replicas
+func (bu *BucketUpload) createRecord(ctx context.Context, key string, v any) error {
+	opts := minio.PutObjectOptions{}
+	opts.SetMatchETagExcept("*")
+	err := bu.writeRecord(ctx, key, v, opts)
+	if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+		return errRecordExists
+	}
+
+	return err
+}
+
+// updateRecord is putRecord failing with errRecordChanged when the record
+// no longer has the etag returned by getRecordETag
+func (bu *BucketUpload) updateRecord(ctx context.Context, key string, v any, etag string) error {
+	opts := minio.PutObjectOptions{}
+	opts.SetMatchETag(etag)
+	err := bu.writeRecord(ctx, key, v, opts)
+	switch minio.ToErrorResponse(err).StatusCode {
+	case http.StatusPreconditionFailed:
+		return errRecordChanged
+	case http.StatusNotFound:
+		return errRecordNotFound
+	}
+
+	return err
+}
+
+func (bu *BucketUpload) writeRecord(ctx context.Context, key string, v any, opts minio.PutObjectOptions) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "record-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	_, err = tmp.Write(data)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	opts.ContentType = "application/json"
+	_, err = bu.Storage.FPutObject(ctx, bu.BucketName, SystemPrefix+key, tmp.Name(), opts)
+
+	return err
+}
+
+// getRecord reads the JSON stored by putRecord into v
+func (bu *BucketUpload) getRecord(ctx context.Context, key string, v any) error {
+	return bu.readRecord(ctx, key, v, minio.GetObjectOptions{})
+}
+
+// getRecordETag is getRecord also returning the etag updateRecord needs,
+// the etag is checked on read so it always belongs to the JSON in v
+func (bu *BucketUpload) getRecordETag(ctx context.Context, key string, v any) (string, error) {
+	for range recordAttempts {
+		obj, err := bu.Storage.StatObject(ctx, bu.BucketName, SystemPrefix+key, minio.StatObjectOptions{})
+		if err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				return "", errRecordNotFound
+			}
+			return "", err
+		}
+		opts := minio.GetObjectOptions{}
+		if err := opts.SetMatchETag(obj.ETag); err != nil {
+			return "", err
+		}
+		err = bu.readRecord(ctx, key, v, opts)
+		if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+			continue
+		}
+		return obj.ETag, err
+	}
+
+	return "", errRecordChanged
+}
+
+func (bu *BucketUpload) readRecord(ctx context.Context, key string, v any, opts minio.GetObjectOptions) error {
+	tmp, err := os.CreateTemp("", "record-*")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Close()
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	err = bu.Storage.FGetObject(ctx, bu.BucketName, SystemPrefix+key, tmp.Name(), opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return errRecordNotFound
+		}
+		return err
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// recordKeys lists the keys of the records under prefix, without the system prefix
+func (bu *BucketUpload) recordKeys(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	for obj := range bu.Storage.ListObjects(ctx, bu.BucketName, minio.ListObjectsOptions{
+		Prefix:    SystemPrefix + prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, strings.TrimPrefix(obj.Key, SystemPrefix))
+	}
+
+	return keys, nil
+}
+
+// removeRecord deletes the record stored by putRecord
+func (bu *BucketUpload) removeRecord(ctx context.Context, key string) error {
+	return bu.Storage.RemoveObject(ctx, bu.BucketName, SystemPrefix+key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,508 @@
+package business
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSearchResults is the page size when the caller does not ask for one
+	DefaultSearchResults = 20
+	// MaxSearchResults bounds the page size
+	MaxSearchResults = 100
+
+	// indexQueueSize bounds the files waiting to be indexed
+	indexQueueSize = 1024
+	// defaultIndexTimeout bounds indexing one file, text extraction reads the whole file
+	defaultIndexTimeout = time.Minute
+
+	maxSearchQuery = 256
+	maxSearchTerms = 10
+	maxTermLength  = 64
+
+	// weights of a term by where it was found, text counts once per occurrence
+	nameWeight     = 4
+	tagWeight      = 3
+	metadataWeight = 2
+	folderWeight   = 2
+	textWeight     = 1
+)
+
+var (
+	// ErrInvalidSearch is returned for empty or too long queries
+	ErrInvalidSearch = foundation.NewError(foundation.InvalidRequest, "search queries are 1 to 10 words of up to 256 characters")
+	// ErrInvalidCursor is returned when after is not a cursor returned by a search
+	ErrInvalidCursor = foundation.NewError(foundation.InvalidRequest, "invalid cursor")
+	// ErrSearchDisabled is returned when the service runs without a search index
+	ErrSearchDisabled = foundation.NewError(foundation.NotImplemented, "search is disabled")
+)
+
+// SearchOptions select a page of results, After is the cursor of the last result seen
+type SearchOptions struct {
+	Query string
+	First int
+	After string
+}
+
+// SearchHit is a file matching a search, best matches first
+type SearchHit struct {
+	File   *FileInfo `json:"file"`
+	Score  float64   `json:"score"`
+	Cursor string    `json:"cursor"`
+}
+
+// SearchResults is a page of hits, EndCursor is the cursor of the last one
+type SearchResults struct {
+	Hits        []*SearchHit `json:"hits"`
+	Total       int          `json:"total"`
+	EndCursor   string       `json:"endCursor,omitempty"`
+	HasNextPage bool         `json:"hasNextPage"`
+}
+
+// searchDoc is an indexed file, text holds the term counts of the extracted
+// text so it is only extracted again when the content changes
+type searchDoc struct {
+	info       *FileInfo
+	contentKey string
+	text       map[string]int
+	terms      map[string]float64
+	indexedAt  time.Time
+}
+
+/*
+SearchIndex is an inverted index of the files in the bucket, kept in memory
+  - Files are indexed by name, folder, metadata, tags and the text of PDF and
+    text files when they are stored, changed or removed through the service
+  - Stored and changed files are queued for a background worker, requests never
+    wait for text extraction, files dropped while the queue is full are picked
+    up by the next Reindex
+  - Reindex rebuilds it from storage, it is run on start up and periodically
+    to pick up files stored by other replicas
+  - Hits are checked against storage before they are returned, so files
+    removed elsewhere are never served
+*/
+type SearchIndex struct {
+	bu     *BucketUpload
+	Logger *logrus.Logger
+
+	// Timeout bounds indexing one file
+	Timeout time.Duration
+
+	queue chan indexTask
+	start sync.Once
+
+	mu       sync.RWMutex
+	docs     map[string]*searchDoc
+	postings map[string]map[string]float64
+	// reindexMu runs one reindex at a time
+	reindexMu sync.Mutex
+}
+
+// indexTask is a file to index, moved from another ID when from is set,
+// or a flush waiting for the tasks queued before it
+type indexTask struct {
+	id      string
+	from    string
+	flushed chan struct{}
+}
+
+func NewSearchIndex(bu *BucketUpload, logger *logrus.Logger) *SearchIndex {
+	return &SearchIndex{
+		bu:       bu,
+		Logger:   logger,
+		Timeout:  defaultIndexTimeout,
+		queue:    make(chan indexTask, indexQueueSize),
+		docs:     map[string]*searchDoc{},
+		postings: map[string]map[string]float64{},
+	}
+}
+
+// Index queues the file to be added or refreshed, failures are logged as the file is stored anyway
+func (s *SearchIndex) Index(id string) {
+	s.enqueue(indexTask{id: id})
+}
+
+// Move queues the file to be indexed under its new ID, the text of the old one is kept
+func (s *SearchIndex) Move(from, to string) {
+	s.enqueue(indexTask{id: to, from: from})
+}
+
+// Flush waits until the files queued so far are indexed, or ctx is done
+func (s *SearchIndex) Flush(ctx context.Context) error {
+	s.start.Do(func() {
+		go s.work()
+	})
+	flushed := make(chan struct{})
+	select {
+	case s.queue <- indexTask{flushed: flushed}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue never blocks, the file is left to Reindex when the queue is full
+func (s *SearchIndex) enqueue(task indexTask) {
+	s.start.Do(func() {
+		go s.work()
+	})
+	select {
+	case s.queue <- task:
+	default:
+		s.Logger.WithField("object", task.id).Warn("search index queue is full, the file is indexed by the next reindex")
+	}
+}
+
+// work indexes the queued files one at a time
+func (s *SearchIndex) work() {
+	for task := range s.queue {
+		if task.flushed != nil {
+			close(task.flushed)
+			continue
+		}
+		s.mu.RLock()
+		previous := s.docs[cmp.Or(task.from, task.id)]
+		s.mu.RUnlock()
+		if task.from != "" {
+			s.Remove(task.from)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+		s.index(ctx, task.id, previous)
+		cancel()
+	}
+}
+
+func (s *SearchIndex) index(ctx context.Context, id string, previous *searchDoc) {
+	obj, err := s.bu.Storage.StatObject(ctx, s.bu.BucketName, id, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		// removed since it was queued
+		return
+	}
+	if err == nil {
+		var doc *searchDoc
+		if doc, err = s.newDoc(ctx, obj, previous); err == nil {
+			s.mu.Lock()
+			s.remove(id)
+			s.add(doc)
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.Logger.WithField("object", id).Errorf("failed to index file: %v", err)
+}
+
+// Remove drops the file from the index
+func (s *SearchIndex) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(id)
+}
+
+// newDoc tokenizes the file, text is reused from previous when the content is the same
+func (s *SearchIndex) newDoc(ctx context.Context, obj minio.ObjectInfo, previous *searchDoc) (*searchDoc, error) {
+	info := newFileInfo(obj)
+	doc := &searchDoc{
+		info:       info,
+		contentKey: cmp.Or(info.Checksum, obj.ETag),
+		terms:      map[string]float64{},
+		indexedAt:  time.Now(),
+	}
+	if previous != nil && previous.contentKey == doc.contentKey {
+		doc.text = previous.text
+	} else if extractable(info.ContentType, info.Size) {
+		_, file, err := s.bu.getFile(ctx, info)
+		if err != nil {
+			return nil, err
+		}
+		text, err := extractText(info.ContentType, file)
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+		doc.text = map[string]int{}
+		for _, term := range searchTerms(text) {
+			doc.text[term]++
+		}
+	}
+
+	addTerms := func(value string, weight float64) {
+		for _, term := range searchTerms(value) {
+			doc.terms[term] = max(doc.terms[term], weight)
+		}
+	}
+	addTerms(info.Name, nameWeight)
+	addTerms(info.Folder, folderWeight)
+	for k, v := range info.Metadata {
+		addTerms(k, metadataWeight)
+		addTerms(v, metadataWeight)
+	}
+	for _, tag := range info.Tags {
+		addTerms(tag, tagWeight)
+	}
+	for term, count := range doc.text {
+		doc.terms[term] += textWeight * (1 + math.Log(float64(count)))
+	}
+
+	return doc, nil
+}
+
+func (s *SearchIndex) add(doc *searchDoc) {
+	s.docs[doc.info.ID] = doc
+	for term, weight := range doc.terms {
+		if s.postings[term] == nil {
+			s.postings[term] = map[string]float64{}
+		}
+		s.postings[term][doc.info.ID] = weight
+	}
+}
+
+func (s *SearchIndex) remove(id string) {
+	doc, ok := s.docs[id]
+	if !ok {
+		return
+	}
+	delete(s.docs, id)
+	for term := range doc.terms {
+		delete(s.postings[term], id)
+		if len(s.postings[term]) == 0 {
+			delete(s.postings, term)
+		}
+	}
+}
+
+/*
+Reindex rebuilds the index from every file in the bucket and returns how many were indexed
+  - Text is only extracted again for files whose content changed
+  - Files indexed while it runs are kept
+*/
+func (s *SearchIndex) Reindex(ctx context.Context) (int, error) {
+	s.reindexMu.Lock()
+	defer s.reindexMu.Unlock()
+	start := time.Now()
+
+	docs := map[string]*searchDoc{}
+	for obj := range s.bu.Storage.ListObjects(ctx, s.bu.BucketName, minio.ListObjectsOptions{
+		Recursive:    true,
+		WithMetadata: true,
+	}) {
+		if obj.Err != nil {
+			return 0, obj.Err
+		}
+		if isSystemKey(obj.Key) {
+			continue
+		}
+		// metadata is only returned in listings by MinIO, fall back to stat for others
+		if metadataValue(obj.UserMetadata, "userID") == "" {
+			info, err := s.bu.Storage.StatObject(ctx, s.bu.BucketName, obj.Key, minio.StatObjectOptions{})
+			if err != nil {
+				return 0, err
+			}
+			obj = info
+		}
+		s.mu.RLock()
+		previous := s.docs[obj.Key]
+		s.mu.RUnlock()
+		doc, err := s.newDoc(ctx, obj, previous)
+		if err != nil {
+			s.Logger.WithField("object", obj.Key).Errorf("failed to index file: %v", err)
+			continue
+		}
+		docs[obj.Key] = doc
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, doc := range s.docs {
+		if _, ok := docs[id]; !ok && doc.indexedAt.After(start) {
+			docs[id] = doc
+		}
+	}
+	s.docs, s.postings = map[string]*searchDoc{}, map[string]map[string]float64{}
+	for _, doc := range docs {
+		s.add(doc)
+	}
+
+	return len(docs), nil
+}
+
+// ReindexEvery rebuilds the index at every interval until ctx is done
+func (s *SearchIndex) ReindexEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Reindex(ctx); err != nil {
+				s.Logger.Errorf("failed to rebuild search index: %v", err)
+			}
+		}
+	}
+}
+
+// Search returns the files of the user matching the query
+func (s *SearchIndex) Search(ctx context.Context, userID string, opts SearchOptions) (*SearchResults, error) {
+	return s.search(ctx, ownedBy(userID), opts)
+}
+
+// SearchAll returns the files of every user matching the query,
+// callers must check the principal was granted PermissionReadAll
+func (s *SearchIndex) SearchAll(ctx context.Context, opts SearchOptions) (*SearchResults, error) {
+	return s.search(ctx, anyOwner, opts)
+}
+
+/*
+search scores the files with every word of the query by TF-IDF
+  - Words are matched case insensitively, a trailing * matches words starting with it
+  - Ties are broken by the newest file first
+*/
+func (s *SearchIndex) search(ctx context.Context, match func(owner string) bool, opts SearchOptions) (*SearchResults, error) {
+	terms := searchTerms(opts.Query)
+	if len(opts.Query) > maxSearchQuery || len(terms) == 0 || len(terms) > maxSearchTerms {
+		return nil, ErrInvalidSearch
+	}
+	offset, err := parseCursor(opts.After)
+	if err != nil {
+		return nil, err
+	}
+	first := opts.First
+	if first <= 0 {
+		first = DefaultSearchResults
+	}
+	first = min(first, MaxSearchResults)
+	prefixes := map[string]bool{}
+	for _, word := range strings.Fields(opts.Query) {
+		if strings.HasSuffix(word, "*") {
+			if t := searchTerms(word); len(t) > 0 {
+				prefixes[t[len(t)-1]] = true
+			}
+		}
+	}
+
+	s.mu.RLock()
+	var scores map[string]float64
+	for _, term := range terms {
+		// the weight of a prefix is the best of the words it matches
+		weights := s.postings[term]
+		if prefixes[term] {
+			weights = map[string]float64{}
+			for indexed, postings := range s.postings {
+				if strings.HasPrefix(indexed, term) {
+					for id, weight := range postings {
+						weights[id] = max(weights[id], weight)
+					}
+				}
+			}
+		}
+		idf := math.Log(1 + float64(len(s.docs))/float64(max(len(weights), 1)))
+		next := map[string]float64{}
+		for id, weight := range weights {
+			if scores != nil {
+				if _, ok := scores[id]; !ok {
+					continue
+				}
+			}
+			if match(s.docs[id].info.UserID) {
+				next[id] = scores[id] + weight*idf
+			}
+		}
+		scores = next
+	}
+	hits := make([]*SearchHit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, &SearchHit{File: s.docs[id].info, Score: score})
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(hits, func(a, b *SearchHit) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score),
+			b.File.CreatedAt.Compare(a.File.CreatedAt),
+			cmp.Compare(a.File.ID, b.File.ID))
+	})
+	res := &SearchResults{Hits: make([]*SearchHit, 0, first), Total: len(hits)}
+	for i := offset; i < len(hits) && len(res.Hits) < first; i++ {
+		hit := hits[i]
+		hit.Cursor = formatCursor(i + 1)
+		res.EndCursor = hit.Cursor
+		res.HasNextPage = i+1 < len(hits)
+		// the index may be behind changes made by other replicas
+		info, err := s.bu.statFile(ctx, hit.File.ID, match)
+		if errors.Is(err, ErrFileNotFound) {
+			s.Remove(hit.File.ID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		hit.File = info
+		res.Hits = append(res.Hits, hit)
+	}
+
+	return res, nil
+}
+
+// searchTerms lower cases the words of value, anything but letters and digits separates words
+func searchTerms(value string) []string {
+	words := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return slices.DeleteFunc(words, func(word string) bool {
+		return len(word) > maxTermLength
+	})
+}
+
+// cursors are the position after a hit, they are only valid for the same query
+func formatCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func parseCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	value, ok := strings.CutPrefix(string(data), "offset:")
+	offset, err := strconv.Atoi(value)
+	if !ok || err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return offset, nil
+}
+
+// indexFile queues the file for the search index when search is enabled
+func (bu *BucketUpload) indexFile(id string) {
+	if bu.Index != nil {
+		bu.Index.Index(id)
+	}
+}
+
+// unindexFile removes the file from the search index when search is enabled
+func (bu *BucketUpload) unindexFile(id string) {
+	if bu.Index != nil {
+		bu.Index.Remove(id)
+	}
+}
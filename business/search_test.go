@@ -0,0 +1,229 @@
+package business
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPDF builds a PDF with one page showing content, compressed with FlateDecode when flate is set
+func testPDF(t *testing.T, content string, flate bool) []byte {
+	stream, filter := []byte(content), ""
+	if flate {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		_, err := zw.Write(stream)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		stream, filter = buf.Bytes(), " /Filter /FlateDecode"
+	}
+
+	return fmt.Appendf(nil, "%%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n"+
+		"4 0 obj\n<< /Length %d%s >>\nstream\n%s\nendstream\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%%%EOF\n",
+		len(stream), filter, stream)
+}
+
+func TestExtractText(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		contentType string
+		data        []byte
+		expected    string
+	}{
+		{name: "text", contentType: "application/octet-stream", data: []byte("quarterly report"), expected: "quarterly report"},
+		{name: "binary", contentType: "application/octet-stream", data: []byte{0x89, 'P', 'N', 'G', 0, 1, 2}},
+		{name: "image", contentType: "image/png", data: []byte("not searched")},
+		{
+			name:        "pdf",
+			contentType: "application/pdf",
+			data:        testPDF(t, "BT /F1 12 Tf 72 712 Td (Invoice) Tj T* (caf\\351 \\(paid\\)) Tj ET", false),
+			expected:    "Invoice café (paid)",
+		},
+		{
+			name:        "compressed pdf",
+			contentType: "application/pdf",
+			data:        testPDF(t, "BT [(Quar)-20(terly)] TJ (report) Tj ET", true),
+			expected:    "Quarterly report",
+		},
+		{
+			name:        "strings outside text objects",
+			contentType: "application/pdf",
+			data:        testPDF(t, "(hidden) Tj BT (shown) Tj ET", false),
+			expected:    "shown",
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			text, err := extractText(scenario.contentType, bytes.NewReader(scenario.data))
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expected, text)
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	bu := NewBucketUpload(store, "test")
+	bu.Index = NewSearchIndex(bu, logrus.New())
+	upload := func(userID, name, contentType string, data []byte, metadata map[string]string, tags ...string) string {
+		fu := &FileUpload{
+			RealName:       name,
+			FileName:       name,
+			File:           bytes.NewReader(data),
+			Size:           int64(len(data)),
+			ContentType:    contentType,
+			UserID:         userID,
+			ClientMetadata: metadata,
+			Tags:           tags,
+		}
+		require.NoError(t, bu.Upload(ctx, fu))
+		return fu.ID
+	}
+	invoice := upload("alice", "invoice-march.pdf", "application/pdf",
+		testPDF(t, "BT (Apollo consulting services) Tj ET", true), map[string]string{"project": "apollo"}, "paid")
+	notes := upload("alice", "notes.txt", "application/octet-stream",
+		[]byte("meeting notes about the apollo launch"), nil)
+	upload("alice", "holiday.jpeg", "image/jpeg", []byte("apollo"), nil, "beach")
+	upload("bob", "apollo.pdf", "application/pdf", testPDF(t, "BT (secret) Tj ET", false), nil)
+	require.NoError(t, bu.Index.Flush(ctx))
+
+	names := func(res *SearchResults) []string {
+		var names []string
+		for _, hit := range res.Hits {
+			names = append(names, hit.File.Name)
+		}
+		return names
+	}
+	scenarios := []struct {
+		name     string
+		query    string
+		all      bool
+		expected []string
+		err      error
+	}{
+		{name: "file name", query: "invoice", expected: []string{"invoice-march.pdf"}},
+		{name: "pdf text", query: "Consulting", expected: []string{"invoice-march.pdf"}},
+		{name: "text file", query: "launch", expected: []string{"notes.txt"}},
+		{name: "tag", query: "beach", expected: []string{"holiday.jpeg"}},
+		{name: "metadata and text rank before text", query: "apollo", expected: []string{"invoice-march.pdf", "notes.txt"}},
+		{name: "every word must match", query: "apollo paid", expected: []string{"invoice-march.pdf"}},
+		{name: "prefix", query: "meet*", expected: []string{"notes.txt"}},
+		{name: "image content is not searched", query: "holiday apollo"},
+		{name: "other users' files", query: "secret"},
+		{name: "every user", query: "secret", all: true, expected: []string{"apollo.pdf"}},
+		{name: "empty query", query: " - ", err: ErrInvalidSearch},
+		{name: "too many words", query: strings.Repeat("a ", maxSearchTerms+1), err: ErrInvalidSearch},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var (
+				res *SearchResults
+				err error
+			)
+			if scenario.all {
+				res, err = bu.Index.SearchAll(ctx, SearchOptions{Query: scenario.query})
+			} else {
+				res, err = bu.Index.Search(ctx, "alice", SearchOptions{Query: scenario.query})
+			}
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expected, names(res))
+		})
+	}
+
+	page, err := bu.Index.Search(ctx, "alice", SearchOptions{Query: "apollo", First: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"invoice-march.pdf"}, names(page))
+	assert.True(t, page.HasNextPage)
+	assert.Equal(t, 2, page.Total)
+	page, err = bu.Index.Search(ctx, "alice", SearchOptions{Query: "apollo", First: 1, After: page.EndCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"notes.txt"}, names(page))
+	assert.False(t, page.HasNextPage)
+	_, err = bu.Index.Search(ctx, "alice", SearchOptions{Query: "apollo", After: "nope"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// changes made through the service are indexed
+	_, err = bu.UpdateMetadata(ctx, "alice", notes, MetadataUpdate{Tags: []string{"minutes"}})
+	require.NoError(t, err)
+	folder := "archive"
+	moved, err := bu.MoveFile(ctx, "alice", invoice, MoveOptions{Folder: &folder})
+	require.NoError(t, err)
+	require.NoError(t, bu.DeleteFile(ctx, "alice", notes))
+	require.NoError(t, bu.Index.Flush(ctx))
+	res, err := bu.Index.Search(ctx, "alice", SearchOptions{Query: "archive consulting"})
+	require.NoError(t, err)
+	require.Len(t, res.Hits, 1)
+	assert.Equal(t, moved.ID, res.Hits[0].File.ID)
+	res, err = bu.Index.Search(ctx, "alice", SearchOptions{Query: "minutes"})
+	require.NoError(t, err)
+	assert.Empty(t, res.Hits)
+
+	// files removed behind the service's back are never returned
+	require.NoError(t, store.RemoveObject(ctx, "test", moved.ID, minio.RemoveObjectOptions{}))
+	res, err = bu.Index.Search(ctx, "alice", SearchOptions{Query: "consulting"})
+	require.NoError(t, err)
+	assert.Empty(t, res.Hits)
+
+	// a new index is rebuilt from storage
+	store.Put("guest.pdf", "application/pdf", testPDF(t, "BT (uploaded elsewhere) Tj ET", false),
+		map[string]string{"userID": "alice", "fileName": "guest.pdf"})
+	index := NewSearchIndex(bu, logrus.New())
+	count, err := index.Reindex(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	res, err = index.Search(ctx, "alice", SearchOptions{Query: "elsewhere"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"guest.pdf"}, names(res))
+}
+
+func TestSearchIndexQueue(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	index := NewSearchIndex(bu, logrus.New())
+	bu.Index = index
+	// the worker is held back so uploads only queue their files
+	index.queue = make(chan indexTask, 1)
+	index.start.Do(func() {})
+	for _, name := range []string{"first.txt", "second.txt"} {
+		data := []byte("quarterly " + strings.TrimSuffix(name, ".txt"))
+		require.NoError(t, bu.Upload(ctx, &FileUpload{
+			RealName:    name,
+			FileName:    name,
+			File:        bytes.NewReader(data),
+			Size:        int64(len(data)),
+			ContentType: "application/octet-stream",
+			UserID:      "alice",
+		}))
+	}
+	res, err := index.Search(ctx, "alice", SearchOptions{Query: "quarterly"})
+	require.NoError(t, err)
+	assert.Empty(t, res.Hits)
+
+	// the second file did not fit in the queue
+	go index.work()
+	require.NoError(t, index.Flush(ctx))
+	res, err = index.Search(ctx, "alice", SearchOptions{Query: "quarterly"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Total)
+
+	// reindexing repairs the gap
+	_, err = index.Reindex(ctx)
+	require.NoError(t, err)
+	res, err = index.Search(ctx, "alice", SearchOptions{Query: "quarterly"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Total)
+}
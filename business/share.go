@@ -0,0 +1,298 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+const (
+	// DefaultShareExpiry is used when a share link is created without an expiry
+	DefaultShareExpiry = 24 * time.Hour
+	// MaxShareExpiry is the longest a share link can be valid for
+	MaxShareExpiry = 30 * 24 * time.Hour
+
+	shareKind    = "share"
+	shareRecords = "shares/"
+	// maxShareAccesses bounds the access log kept on each link
+	maxShareAccesses = 100
+)
+
+var (
+	// ErrShareNotFound is returned for unknown, tampered or revoked links
+	ErrShareNotFound = foundation.NewError(foundation.NotFound, "share link not found")
+	// ErrShareExpired is returned once a link expired or ran out of downloads
+	ErrShareExpired = foundation.NewError(foundation.Expired, "share link expired")
+	// ErrSharePassword is returned when the password is missing or wrong
+	ErrSharePassword = foundation.NewError(foundation.PasswordRequired, "share link password required")
+	// ErrShareBusy is returned when the link kept changing while it was updated
+	ErrShareBusy = foundation.NewError(foundation.Conflict, "share link is being updated, retry")
+	// ErrInvalidShare is returned for invalid expiry or download limits
+	ErrInvalidShare = foundation.NewError(foundation.InvalidRequest, "share links expire within 30 days and allow zero or more downloads")
+
+	// errShareUnchanged leaves the link as is in updateShare
+	errShareUnchanged = errors.New("share link unchanged")
+)
+
+// ShareOptions limits a share link
+type ShareOptions struct {
+	ExpiresIn time.Duration
+	// MaxDownloads of zero allows unlimited downloads until expiry
+	MaxDownloads int
+	Password     string
+}
+
+// ShareAccess records a download of a shared file
+type ShareAccess struct {
+	At         time.Time `json:"at"`
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent"`
+}
+
+// ShareLink describes a link to a file, the token is only returned on creation
+type ShareLink struct {
+	ID                string        `json:"id"`
+	FileID            string        `json:"fileID"`
+	UserID            string        `json:"userID"`
+	URL               string        `json:"url,omitempty"`
+	ExpiresAt         time.Time     `json:"expiresAt"`
+	MaxDownloads      int           `json:"maxDownloads,omitempty"`
+	Downloads         int           `json:"downloads"`
+	PasswordProtected bool          `json:"passwordProtected"`
+	CreatedAt         time.Time     `json:"createdAt"`
+	RevokedAt         *time.Time    `json:"revokedAt,omitempty"`
+	Accesses          []ShareAccess `json:"accesses,omitempty"`
+}
+
+type shareRecord struct {
+	ShareLink
+	PasswordHash string `json:"passwordHash,omitempty"`
+}
+
+// CreateShare issues a link to a file owned by the user
+func (l *Links) CreateShare(ctx context.Context, userID, fileID string, opts ShareOptions) (_ *ShareLink, err error) {
+	defer func() {
+		l.bu.audit(ctx, AuditShare, fileID, err)
+	}()
+	if opts.ExpiresIn == 0 {
+		opts.ExpiresIn = DefaultShareExpiry
+	}
+	if opts.ExpiresIn < 0 || opts.ExpiresIn > MaxShareExpiry || opts.MaxDownloads < 0 {
+		return nil, ErrInvalidShare
+	}
+	if _, err := l.bu.StatFile(ctx, userID, fileID); err != nil {
+		return nil, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	rec := &shareRecord{
+		ShareLink: ShareLink{
+			ID:                id,
+			FileID:            fileID,
+			UserID:            userID,
+			ExpiresAt:         now.Add(opts.ExpiresIn).Truncate(time.Second),
+			MaxDownloads:      opts.MaxDownloads,
+			PasswordProtected: hash != "",
+			CreatedAt:         now,
+		},
+		PasswordHash: hash,
+	}
+	if err := l.bu.putRecord(ctx, shareRecords+id, rec); err != nil {
+		return nil, err
+	}
+	link := rec.ShareLink
+	link.URL = l.BaseURL + "/s/" + l.sign(shareKind, id, rec.ExpiresAt)
+
+	return &link, nil
+}
+
+// ListShares returns the links created for a file owned by the user, newest first
+func (l *Links) ListShares(ctx context.Context, userID, fileID string) ([]*ShareLink, error) {
+	keys, err := l.bu.recordKeys(ctx, shareRecords)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]*ShareLink, 0)
+	for _, key := range keys {
+		rec, err := l.share(ctx, strings.TrimPrefix(key, shareRecords))
+		if err != nil {
+			return nil, err
+		}
+		if rec.UserID == userID && rec.FileID == fileID {
+			links = append(links, &rec.ShareLink)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].CreatedAt.After(links[j].CreatedAt)
+	})
+
+	return links, nil
+}
+
+// RevokeShare stops a link created by the user from working
+func (l *Links) RevokeShare(ctx context.Context, userID, id string) (err error) {
+	var fileID string
+	defer func() {
+		l.bu.audit(ctx, AuditShareRevoke, fileID, err)
+	}()
+	_, err = l.updateShare(ctx, id, func(rec *shareRecord) error {
+		fileID = rec.FileID
+		if rec.UserID != userID {
+			return ErrShareNotFound
+		}
+		if rec.RevokedAt != nil {
+			return errShareUnchanged
+		}
+		now := time.Now().UTC()
+		rec.RevokedAt = &now
+		return nil
+	})
+	if errors.Is(err, errShareUnchanged) {
+		return nil
+	}
+
+	return err
+}
+
+/*
+OpenShare returns the shared file
+  - The token and the password are verified before the file is opened
+  - A download is counted and logged on the link once the file opened, with
+    If-Match on the etag of the link so concurrent downloads on any replica
+    never exceed MaxDownloads
+*/
+func (l *Links) OpenShare(ctx context.Context, token, password string, access ShareAccess) (_ *ShareLink, _ *FileInfo, _ io.ReadCloser, err error) {
+	var fileID string
+	defer func() {
+		l.bu.audit(ctx, AuditShareDownload, fileID, err)
+	}()
+	id, expires, err := l.verify(shareKind, token)
+	if err != nil {
+		return nil, nil, nil, ErrShareNotFound
+	}
+	if time.Now().After(expires) {
+		return nil, nil, nil, ErrShareExpired
+	}
+	rec, err := l.share(ctx, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := rec.allow(password); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the download is audited as share.download, not as a download by the owner
+	fileID = rec.FileID
+	info, err := l.bu.StatFile(ctx, rec.UserID, rec.FileID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info, file, err := l.bu.getFile(ctx, info)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rec, err = l.updateShare(ctx, id, func(rec *shareRecord) error {
+		if err := rec.usable(); err != nil {
+			return err
+		}
+		rec.Downloads++
+		rec.Accesses = append(rec.Accesses, access)
+		if len(rec.Accesses) > maxShareAccesses {
+			rec.Accesses = rec.Accesses[len(rec.Accesses)-maxShareAccesses:]
+		}
+		return nil
+	})
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, nil, err
+	}
+
+	return &rec.ShareLink, info, file, nil
+}
+
+// allow checks the link can still be used with the password
+func (rec *shareRecord) allow(password string) error {
+	if err := rec.usable(); err != nil {
+		return err
+	}
+	if rec.PasswordHash != "" && !checkPassword(rec.PasswordHash, password) {
+		return ErrSharePassword
+	}
+
+	return nil
+}
+
+// usable checks the link was not revoked and has downloads left
+func (rec *shareRecord) usable() error {
+	switch {
+	case rec.RevokedAt != nil:
+		return ErrShareNotFound
+	case rec.MaxDownloads > 0 && rec.Downloads >= rec.MaxDownloads:
+		return ErrShareExpired
+	}
+
+	return nil
+}
+
+/*
+updateShare applies change to the link and writes it with If-Match on its etag
+  - The link is read again and change retried when another request changed it
+  - An error from change is returned as is and nothing is written
+*/
+func (l *Links) updateShare(ctx context.Context, id string, change func(*shareRecord) error) (*shareRecord, error) {
+	if len(id) != 16 || !isHex(id) {
+		return nil, ErrShareNotFound
+	}
+	for range recordAttempts {
+		rec := &shareRecord{}
+		etag, err := l.bu.getRecordETag(ctx, shareRecords+id, rec)
+		switch {
+		case errors.Is(err, errRecordNotFound):
+			return nil, ErrShareNotFound
+		case errors.Is(err, errRecordChanged):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if err := change(rec); err != nil {
+			return nil, err
+		}
+		err = l.bu.updateRecord(ctx, shareRecords+id, rec, etag)
+		switch {
+		case errors.Is(err, errRecordNotFound):
+			return nil, ErrShareNotFound
+		case !errors.Is(err, errRecordChanged):
+			return rec, err
+		}
+	}
+
+	return nil, ErrShareBusy
+}
+
+func (l *Links) share(ctx context.Context, id string) (*shareRecord, error) {
+	if len(id) != 16 || !isHex(id) {
+		return nil, ErrShareNotFound
+	}
+	rec := &shareRecord{}
+	err := l.bu.getRecord(ctx, shareRecords+id, rec)
+	if errors.Is(err, errRecordNotFound) {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
@@ -0,0 +1,152 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLinks(t *testing.T) *Links {
+	t.Helper()
+	store := storagetest.NewMemory()
+	store.Put("a.jpeg", "image/jpeg", []byte("hello"),
+		map[string]string{"userID": "alice", "fileName": "holiday.jpeg"})
+
+	return NewLinks(NewBucketUpload(store, "test"), []byte("secret"), "https://files.example.com/")
+}
+
+func shareToken(link *ShareLink) string {
+	return strings.TrimPrefix(link.URL, "https://files.example.com/s/")
+}
+
+func TestShareLinks(t *testing.T) {
+	ctx := context.Background()
+	links := newTestLinks(t)
+
+	_, err := links.CreateShare(ctx, "bob", "a.jpeg", ShareOptions{})
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	_, err = links.CreateShare(ctx, "alice", "a.jpeg", ShareOptions{ExpiresIn: 365 * 24 * time.Hour})
+	assert.ErrorIs(t, err, ErrInvalidShare)
+
+	link, err := links.CreateShare(ctx, "alice", "a.jpeg", ShareOptions{MaxDownloads: 2, Password: "open sesame"})
+	require.NoError(t, err)
+	assert.True(t, link.PasswordProtected)
+	assert.WithinDuration(t, time.Now().Add(DefaultShareExpiry), link.ExpiresAt, time.Minute)
+	token := shareToken(link)
+
+	_, _, _, err = links.OpenShare(ctx, token, "", ShareAccess{})
+	assert.ErrorIs(t, err, ErrSharePassword)
+	_, _, _, err = links.OpenShare(ctx, token, "wrong", ShareAccess{})
+	assert.ErrorIs(t, err, ErrSharePassword)
+
+	for i := 1; i <= 2; i++ {
+		opened, info, file, err := links.OpenShare(ctx, token, "open sesame", ShareAccess{RemoteAddr: "192.0.2.1"})
+		require.NoError(t, err)
+		assert.Equal(t, i, opened.Downloads)
+		assert.Equal(t, "holiday.jpeg", info.Name)
+		content, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(content))
+		require.NoError(t, file.Close())
+	}
+	_, _, _, err = links.OpenShare(ctx, token, "open sesame", ShareAccess{})
+	assert.ErrorIs(t, err, ErrShareExpired)
+
+	listed, err := links.ListShares(ctx, "alice", "a.jpeg")
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Len(t, listed[0].Accesses, 2)
+	assert.Empty(t, listed[0].URL, "tokens are only returned on creation")
+}
+
+func TestShareLinksRejected(t *testing.T) {
+	ctx := context.Background()
+	links := newTestLinks(t)
+	link, err := links.CreateShare(ctx, "alice", "a.jpeg", ShareOptions{})
+	require.NoError(t, err)
+	token := shareToken(link)
+	id, _, err := links.verify(shareKind, token)
+	require.NoError(t, err)
+	other := NewLinks(links.bu, []byte("other secret"), "")
+
+	scenarios := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "malformed", token: "nope", err: ErrShareNotFound},
+		{name: "signed with another secret", token: other.sign(shareKind, id, link.ExpiresAt), err: ErrShareNotFound},
+		{name: "expiry extended", token: id + "." + "9999999999" + token[strings.LastIndex(token, "."):], err: ErrShareNotFound},
+		{name: "signed for another kind of link", token: links.sign("upload", id, link.ExpiresAt), err: ErrShareNotFound},
+		{name: "expired", token: links.sign(shareKind, id, time.Now().Add(-time.Minute)), err: ErrShareExpired},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			_, _, _, err := links.OpenShare(ctx, scenario.token, "", ShareAccess{})
+			assert.ErrorIs(t, err, scenario.err)
+		})
+	}
+
+	assert.ErrorIs(t, links.RevokeShare(ctx, "bob", id), ErrShareNotFound)
+	require.NoError(t, links.RevokeShare(ctx, "alice", id))
+	_, _, _, err = links.OpenShare(ctx, token, "", ShareAccess{})
+	assert.ErrorIs(t, err, ErrShareNotFound)
+}
+
+func TestShareDownloadsAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	replica := newTestLinks(t)
+	other := NewLinks(replica.bu, []byte("secret"), "https://files.example.com/")
+	link, err := replica.CreateShare(ctx, "alice", "a.jpeg", ShareOptions{MaxDownloads: 3})
+	require.NoError(t, err)
+	token := shareToken(link)
+
+	var (
+		mu     sync.Mutex
+		opened int
+		wg     sync.WaitGroup
+	)
+	for i := range 20 {
+		links := replica
+		if i%2 == 1 {
+			links = other
+		}
+		wg.Go(func() {
+			_, _, file, err := links.OpenShare(ctx, token, "", ShareAccess{})
+			if err != nil {
+				assert.True(t, errors.Is(err, ErrShareExpired) || errors.Is(err, ErrShareBusy), err)
+				return
+			}
+			_ = file.Close()
+			mu.Lock()
+			opened++
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	listed, err := replica.ListShares(ctx, "alice", "a.jpeg")
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.LessOrEqual(t, opened, 3)
+	assert.Equal(t, opened, listed[0].Downloads)
+
+	// a file that fails to open does not use up a download
+	link, err = replica.CreateShare(ctx, "alice", "a.jpeg", ShareOptions{MaxDownloads: 1})
+	require.NoError(t, err)
+	require.NoError(t, replica.bu.Storage.RemoveObject(ctx, "test", "a.jpeg", minio.RemoveObjectOptions{}))
+	_, _, _, err = replica.OpenShare(ctx, shareToken(link), "", ShareAccess{})
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	rec, err := replica.share(ctx, link.ID)
+	require.NoError(t, err)
+	assert.Zero(t, rec.Downloads)
+}
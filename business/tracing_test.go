@@ -0,0 +1,99 @@
+package business
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	spansOnce sync.Once
+	spans     = tracetest.NewInMemoryExporter()
+)
+
+// recordSpans sends the spans of the package to spans, tracers only pick up
+// the first global provider so it is set once
+func recordSpans(t *testing.T) {
+	t.Helper()
+	spansOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+	})
+	spans.Reset()
+}
+
+func TestUploadSpans(t *testing.T) {
+	recordSpans(t)
+	fu := &FileUpload{
+		FileName:    "a",
+		File:        strings.NewReader("hello"),
+		Size:        5,
+		ContentType: "image/png",
+		UserID:      "alice",
+	}
+	require.NoError(t, fu.Upload(context.Background(), storagetest.NewMemory(), "test"))
+
+	recorded := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range spans.GetSpans().Snapshots() {
+		recorded[span.Name()] = span
+	}
+	parent := recorded["FileUpload.Upload"]
+	require.NotNil(t, parent)
+	for _, name := range []string{"read file", "write temp file", "storage FPutObject"} {
+		t.Run(name, func(t *testing.T) {
+			span := recorded[name]
+			require.NotNil(t, span)
+			assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		})
+	}
+}
+
+func TestNewEnvTracerProvider(t *testing.T) {
+	// bind the package tracer before the providers below replace the global one
+	recordSpans(t)
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+	})
+	scenarios := []struct {
+		name     string
+		exporter string
+		file     bool
+		err      error
+	}{
+		{name: "disabled"},
+		{name: "none", exporter: "none"},
+		{name: "stdout", exporter: "stdout"},
+		{name: "file", exporter: "stdout", file: true},
+		{name: "unknown", exporter: "jaeger", err: errUnknownTracesExporter},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", scenario.exporter)
+			path := filepath.Join(t.TempDir(), "spans.json")
+			if scenario.file {
+				t.Setenv("OTEL_TRACES_FILE", path)
+			}
+			shutdown, err := NewEnvTracerProvider(context.Background(), "test")
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+			if scenario.file {
+				_, err := os.Stat(path)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,385 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+const (
+	// TusExpiry is how long an unfinished upload is kept after its last chunk
+	TusExpiry = 24 * time.Hour
+	// TusChecksumAlgorithms are the algorithms accepted in Upload-Checksum
+	TusChecksumAlgorithms = "sha1,sha256,md5"
+
+	tusRecords = "tus/uploads/"
+	tusParts   = "tus/parts/"
+)
+
+var (
+	// ErrTusUploadNotFound is returned for unknown or terminated uploads
+	ErrTusUploadNotFound = foundation.NewError(foundation.NotFound, "upload not found")
+	// ErrTusUploadExpired is returned for unfinished uploads past their expiry
+	ErrTusUploadExpired = foundation.NewError(foundation.Expired, "upload expired")
+	// ErrInvalidTusUpload is returned for invalid lengths, types or checksums on creation
+	ErrInvalidTusUpload = foundation.NewError(foundation.InvalidRequest, "uploads need a length up to 100MB, a supported file type and a SHA-256 checksum if any")
+	// ErrTusOffsetMismatch is returned when a chunk does not start at the upload offset
+	ErrTusOffsetMismatch = foundation.NewError(foundation.Conflict, "upload offset does not match")
+	// ErrTusLocked is returned while another chunk is being appended to the upload
+	ErrTusLocked = foundation.NewError(foundation.Locked, "upload is locked by another request")
+	// ErrTusTooLarge is returned when a chunk goes past the upload length
+	ErrTusTooLarge = foundation.NewError(foundation.TooLarge, "chunk exceeds the upload length")
+	// ErrTusChecksumAlgorithm is returned for algorithms missing from TusChecksumAlgorithms
+	ErrTusChecksumAlgorithm = foundation.NewError(foundation.InvalidRequest, "unsupported checksum algorithm")
+	// ErrTusChecksumMismatch is returned when a chunk does not match its checksum, it is discarded
+	ErrTusChecksumMismatch = foundation.NewError(foundation.ChecksumMismatch, "chunk checksum mismatch")
+)
+
+/*
+TusUpload is a resumable upload
+  - Metadata holds the client metadata, filename, filetype and checksum
+    (hex encoded SHA-256 of the whole file) are used for the file
+  - FileID is set once all bytes arrived and the file was stored
+*/
+type TusUpload struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"userID"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	FileID    string            `json:"fileID,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+/*
+Tus keeps resumable uploads
+  - Every chunk is staged as its own object under SystemPrefix, they are joined
+    and handed to FileUpload.Upload once the last chunk arrives
+  - Chunks of one upload are appended one at a time
+*/
+type Tus struct {
+	bu *BucketUpload
+	// locks holds a mutex per upload being appended to
+	locks sync.Map
+}
+
+func NewTus(bu *BucketUpload) *Tus {
+	return &Tus{bu: bu}
+}
+
+// Create starts an upload of length bytes for the user
+func (t *Tus) Create(ctx context.Context, userID string, length int64, metadata map[string]string) (*TusUpload, error) {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	if metadata["filetype"] == "" {
+		metadata["filetype"] = "application/octet-stream"
+	}
+	checksum := metadata["checksum"]
+	if length <= 0 || length > MaxFileSize || !AllowedTypes[metadata["filetype"]] ||
+		(checksum != "" && (len(checksum) != sha256.Size*2 || !isHex(checksum))) {
+		return nil, ErrInvalidTusUpload
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	upload := &TusUpload{
+		ID:        id,
+		UserID:    userID,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(TusExpiry),
+	}
+	if err := t.bu.putRecord(ctx, tusRecords+id, upload); err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// Get returns an upload of the user
+func (t *Tus) Get(ctx context.Context, userID, id string) (*TusUpload, error) {
+	upload, err := t.upload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.UserID != userID {
+		return nil, ErrTusUploadNotFound
+	}
+	if upload.FileID == "" && time.Now().After(upload.ExpiresAt) {
+		return nil, ErrTusUploadExpired
+	}
+
+	return upload, nil
+}
+
+/*
+Append adds a chunk at offset to an upload of the user
+  - algorithm and sum are the optional Upload-Checksum of the chunk,
+    chunks that do not match are discarded
+  - Without a checksum the bytes read before the client went away are kept
+    so the upload can resume from there
+  - The file is stored once the last chunk arrived, uploads which fail
+    validation are terminated, an empty chunk at the end retries storing it
+*/
+func (t *Tus) Append(ctx context.Context, userID, id string, offset int64, body io.Reader, algorithm string, sum []byte) (*TusUpload, error) {
+	var h hash.Hash
+	if algorithm != "" {
+		switch algorithm {
+		case "sha1":
+			h = sha1.New()
+		case "sha256":
+			h = sha256.New()
+		case "md5":
+			h = md5.New()
+		default:
+			return nil, ErrTusChecksumAlgorithm
+		}
+	}
+	// only uploads which exist get a lock, it is read again once the lock is held
+	if _, err := t.Get(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	lock, _ := t.locks.LoadOrStore(id, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		return nil, ErrTusLocked
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	upload, err := t.Get(ctx, userID, id)
+	if errors.Is(err, ErrTusUploadNotFound) {
+		// terminated or expired since, drop the lock remove already let go of
+		t.locks.Delete(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if upload.FileID != "" || offset != upload.Offset {
+		return nil, ErrTusOffsetMismatch
+	}
+
+	tmp, err := os.CreateTemp("", "tus-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	w := io.Writer(tmp)
+	if h != nil {
+		w = io.MultiWriter(tmp, h)
+	}
+	// read one byte more than is left to notice chunks past the length
+	n, readErr := io.Copy(w, io.LimitReader(body, upload.Length-upload.Offset+1))
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	switch {
+	case n > upload.Length-upload.Offset:
+		return nil, ErrTusTooLarge
+	case h != nil && readErr != nil:
+		return nil, readErr
+	case h != nil && !bytes.Equal(h.Sum(nil), sum):
+		return nil, ErrTusChecksumMismatch
+	}
+	if n > 0 {
+		_, err = t.bu.Storage.FPutObject(ctx, t.bu.BucketName, t.partKey(id, upload.Offset), tmp.Name(),
+			minio.PutObjectOptions{ContentType: "application/octet-stream"})
+		if err != nil {
+			return nil, err
+		}
+		upload.Offset += n
+		upload.ExpiresAt = time.Now().UTC().Add(TusExpiry)
+		if err := t.bu.putRecord(ctx, tusRecords+id, upload); err != nil {
+			return nil, err
+		}
+	}
+	if readErr != nil {
+		return upload, readErr
+	}
+	if upload.Offset == upload.Length {
+		return upload, t.finish(ctx, upload)
+	}
+
+	return upload, nil
+}
+
+// Terminate deletes an upload of the user and its chunks
+func (t *Tus) Terminate(ctx context.Context, userID, id string) error {
+	upload, err := t.upload(ctx, id)
+	if err != nil {
+		return err
+	}
+	if upload.UserID != userID {
+		return ErrTusUploadNotFound
+	}
+
+	return t.remove(ctx, id)
+}
+
+// Cleanup removes unfinished uploads past their expiry and finished ones
+// older than TusExpiry, it returns how many uploads were removed
+func (t *Tus) Cleanup(ctx context.Context) (int, error) {
+	keys, err := t.bu.recordKeys(ctx, tusRecords)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, key := range keys {
+		upload, err := t.upload(ctx, strings.TrimPrefix(key, tusRecords))
+		if errors.Is(err, ErrTusUploadNotFound) {
+			// terminated since it was listed
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		if time.Now().Before(upload.ExpiresAt) {
+			continue
+		}
+		if err := t.remove(ctx, upload.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// finish joins the chunks and stores the file, it runs under the upload lock
+func (t *Tus) finish(ctx context.Context, upload *TusUpload) error {
+	joined, err := os.CreateTemp("", "tus-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = joined.Close()
+		_ = os.Remove(joined.Name())
+	}()
+	for obj := range t.bu.Storage.ListObjects(ctx, t.bu.BucketName, minio.ListObjectsOptions{
+		Prefix:    SystemPrefix + tusParts + upload.ID + "/",
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if err := t.appendPart(ctx, joined, obj.Key); err != nil {
+			return err
+		}
+	}
+	if _, err := joined.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	fu := &FileUpload{
+		RealName:    upload.Metadata["filename"],
+		FileName:    SanitizeFilename(upload.Metadata["filename"]),
+		File:        joined,
+		Size:        upload.Length,
+		ContentType: upload.Metadata["filetype"],
+		UserID:      upload.UserID,
+		Checksum:    upload.Metadata["checksum"],
+	}
+	err = t.bu.Upload(ctx, fu)
+	if errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrUnsupportedFileType) {
+		return errors.Join(err, t.remove(ctx, upload.ID))
+	}
+	if err != nil {
+		return err
+	}
+	upload.FileID = fu.ID
+	if err := t.bu.putRecord(ctx, tusRecords+upload.ID, upload); err != nil {
+		return err
+	}
+
+	return t.removeParts(ctx, upload.ID)
+}
+
+// appendPart copies a staged chunk to the end of w
+func (t *Tus) appendPart(ctx context.Context, w io.Writer, key string) error {
+	tmp, err := os.CreateTemp("", "tus-part-*")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Close()
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := t.bu.Storage.FGetObject(ctx, t.bu.BucketName, key, tmp.Name(), minio.GetObjectOptions{}); err != nil {
+		return err
+	}
+	part, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = part.Close()
+	}()
+	_, err = io.Copy(w, part)
+
+	return err
+}
+
+func (t *Tus) remove(ctx context.Context, id string) error {
+	if err := t.removeParts(ctx, id); err != nil {
+		return err
+	}
+	t.locks.Delete(id)
+
+	return t.bu.removeRecord(ctx, tusRecords+id)
+}
+
+func (t *Tus) removeParts(ctx context.Context, id string) error {
+	for obj := range t.bu.Storage.ListObjects(ctx, t.bu.BucketName, minio.ListObjectsOptions{
+		Prefix:    SystemPrefix + tusParts + id + "/",
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		err := t.bu.Storage.RemoveObject(ctx, t.bu.BucketName, obj.Key, minio.RemoveObjectOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partKey orders chunks by offset when listed
+func (t *Tus) partKey(id string, offset int64) string {
+	return fmt.Sprintf("%s%s%s/%020d", SystemPrefix, tusParts, id, offset)
+}
+
+func (t *Tus) upload(ctx context.Context, id string) (*TusUpload, error) {
+	if len(id) != 32 || !isHex(id) {
+		return nil, ErrTusUploadNotFound
+	}
+	upload := &TusUpload{}
+	err := t.bu.getRecord(ctx, tusRecords+id, upload)
+	if errors.Is(err, errRecordNotFound) {
+		return nil, ErrTusUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
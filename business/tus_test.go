@@ -0,0 +1,208 @@
+package business
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// brokenReader returns data then fails like a dropped connection
+type brokenReader struct {
+	data io.Reader
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	n, err := b.data.Read(p)
+	if errors.Is(err, io.EOF) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestTusCreate(t *testing.T) {
+	tus := NewTus(NewBucketUpload(storagetest.NewMemory(), "test"))
+	sum := sha256.Sum256([]byte("hello"))
+
+	scenarios := []struct {
+		name     string
+		length   int64
+		metadata map[string]string
+		err      error
+	}{
+		{name: "without metadata", length: 5},
+		{name: "with metadata", length: 5, metadata: map[string]string{"filename": "a.pdf", "filetype": "application/pdf", "checksum": hex.EncodeToString(sum[:])}},
+		{name: "empty", length: 0, err: ErrInvalidTusUpload},
+		{name: "too large", length: MaxFileSize + 1, err: ErrInvalidTusUpload},
+		{name: "unsupported type", length: 5, metadata: map[string]string{"filetype": "text/html"}, err: ErrInvalidTusUpload},
+		{name: "invalid checksum", length: 5, metadata: map[string]string{"checksum": "abc"}, err: ErrInvalidTusUpload},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			upload, err := tus.Create(context.Background(), "alice", scenario.length, scenario.metadata)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, upload.ID, 32)
+			assert.WithinDuration(t, time.Now().Add(TusExpiry), upload.ExpiresAt, time.Minute)
+		})
+	}
+}
+
+func TestTusAppend(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	bu := NewBucketUpload(store, "test")
+	tus := NewTus(bu)
+	sum := sha256.Sum256([]byte("hello world"))
+	upload, err := tus.Create(ctx, "alice", 11, map[string]string{
+		"filename": "greeting.pdf",
+		"filetype": "application/pdf",
+		"checksum": hex.EncodeToString(sum[:]),
+	})
+	require.NoError(t, err)
+
+	_, err = tus.Get(ctx, "bob", upload.ID)
+	assert.ErrorIs(t, err, ErrTusUploadNotFound)
+	_, err = tus.Append(ctx, "alice", upload.ID, 3, strings.NewReader("hello"), "", nil)
+	assert.ErrorIs(t, err, ErrTusOffsetMismatch)
+	_, err = tus.Append(ctx, "alice", upload.ID, 0, strings.NewReader("hello world!"), "", nil)
+	assert.ErrorIs(t, err, ErrTusTooLarge)
+	_, err = tus.Append(ctx, "alice", upload.ID, 0, strings.NewReader("hello"), "crc32", nil)
+	assert.ErrorIs(t, err, ErrTusChecksumAlgorithm)
+	_, err = tus.Append(ctx, "alice", upload.ID, 0, strings.NewReader("hello"), "sha1", []byte("wrong"))
+	assert.ErrorIs(t, err, ErrTusChecksumMismatch)
+
+	// the connection drops after a few bytes, they are kept
+	appended, err := tus.Append(ctx, "alice", upload.ID, 0, &brokenReader{data: strings.NewReader("hel")}, "", nil)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.EqualValues(t, 3, appended.Offset)
+
+	chunk := sha1.Sum([]byte("lo "))
+	appended, err = tus.Append(ctx, "alice", upload.ID, 3, strings.NewReader("lo "), "sha1", chunk[:])
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, appended.Offset)
+	assert.Empty(t, appended.FileID)
+
+	appended, err = tus.Append(ctx, "alice", upload.ID, 6, strings.NewReader("world"), "", nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, appended.FileID)
+
+	info, file, err := bu.GetFile(ctx, "alice", appended.FileID)
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Equal(t, "hello world", string(content))
+	assert.Equal(t, "greeting.pdf", info.Name)
+	assert.Equal(t, hex.EncodeToString(sum[:]), info.Checksum)
+
+	got, err := tus.Get(ctx, "alice", upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, appended.FileID, got.FileID)
+	for obj := range store.ListObjects(ctx, "test", minio.ListObjectsOptions{Prefix: SystemPrefix + tusParts}) {
+		t.Errorf("chunk %s was not removed", obj.Key)
+	}
+}
+
+func TestTusChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	tus := NewTus(NewBucketUpload(storagetest.NewMemory(), "test"))
+	sum := sha256.Sum256([]byte("other"))
+	upload, err := tus.Create(ctx, "alice", 5, map[string]string{"checksum": hex.EncodeToString(sum[:])})
+	require.NoError(t, err)
+
+	_, err = tus.Append(ctx, "alice", upload.ID, 0, strings.NewReader("hello"), "", nil)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = tus.Get(ctx, "alice", upload.ID)
+	assert.ErrorIs(t, err, ErrTusUploadNotFound, "uploads failing validation are terminated")
+}
+
+// removedRecord lists a system record which was removed before it is read
+type removedRecord struct {
+	*storagetest.Memory
+	key string
+}
+
+func (s removedRecord) ListObjects(ctx context.Context, bucket string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+		if strings.HasPrefix(SystemPrefix+s.key, opts.Prefix) {
+			objects <- minio.ObjectInfo{Key: SystemPrefix + s.key}
+		}
+		for obj := range s.Memory.ListObjects(ctx, bucket, opts) {
+			objects <- obj
+		}
+	}()
+
+	return objects
+}
+
+func TestTusAppendUnknownUploads(t *testing.T) {
+	ctx := context.Background()
+	tus := NewTus(NewBucketUpload(storagetest.NewMemory(), "test"))
+	upload, err := tus.Create(ctx, "alice", 10, nil)
+	require.NoError(t, err)
+
+	for _, id := range []string{strings.Repeat("ab", 16), "../../etc", upload.ID} {
+		_, err := tus.Append(ctx, "bob", id, 0, strings.NewReader("hello"), "", nil)
+		assert.ErrorIs(t, err, ErrTusUploadNotFound)
+	}
+	_, err = tus.Append(ctx, "alice", upload.ID, 0, strings.NewReader("hello"), "", nil)
+	require.NoError(t, err)
+
+	locks := 0
+	tus.locks.Range(func(any, any) bool {
+		locks++
+		return true
+	})
+	assert.Equal(t, 1, locks, "only uploads which exist get a lock")
+}
+
+func TestTusCleanup(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewMemory()
+	bu := NewBucketUpload(store, "test")
+	tus := NewTus(bu)
+
+	abandoned, err := tus.Create(ctx, "alice", 10, nil)
+	require.NoError(t, err)
+	_, err = tus.Append(ctx, "alice", abandoned.ID, 0, strings.NewReader("hello"), "", nil)
+	require.NoError(t, err)
+	abandoned.Offset, abandoned.ExpiresAt = 5, time.Now().Add(-time.Minute)
+	require.NoError(t, bu.putRecord(ctx, tusRecords+abandoned.ID, abandoned))
+	active, err := tus.Create(ctx, "alice", 10, nil)
+	require.NoError(t, err)
+
+	_, err = tus.Get(ctx, "alice", abandoned.ID)
+	assert.ErrorIs(t, err, ErrTusUploadExpired)
+
+	removed, err := NewTus(NewBucketUpload(removedRecord{store, tusRecords + strings.Repeat("ab", 16)}, "test")).Cleanup(ctx)
+	require.NoError(t, err, "uploads terminated while cleaning up are skipped")
+	assert.Equal(t, 1, removed)
+	_, err = tus.Get(ctx, "alice", abandoned.ID)
+	assert.ErrorIs(t, err, ErrTusUploadNotFound)
+	_, err = tus.Get(ctx, "alice", active.ID)
+	assert.NoError(t, err)
+	for obj := range store.ListObjects(ctx, "test", minio.ListObjectsOptions{Prefix: SystemPrefix + tusParts}) {
+		t.Errorf("chunk %s was not removed", obj.Key)
+	}
+
+	assert.ErrorIs(t, tus.Terminate(ctx, "bob", active.ID), ErrTusUploadNotFound)
+	require.NoError(t, tus.Terminate(ctx, "alice", active.ID))
+	_, err = tus.Get(ctx, "alice", active.ID)
+	assert.ErrorIs(t, err, ErrTusUploadNotFound)
+}
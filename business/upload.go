@@ -3,18 +3,31 @@ package business
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-const MaxFileSize = 1024 * 1024 * 100
+const (
+	MaxFileSize = 1024 * 1024 * 100
+
+	// ChecksumHeader carries the hex encoded SHA-256 of the file content
+	ChecksumHeader = "X-Checksum-SHA256"
+)
 
 var (
-	errUnsupportedFileType = errors.New("unsupported file type")
+	// ErrChecksumMismatch is returned when the content does not match the checksum sent by the client
+	ErrChecksumMismatch = foundation.NewError(foundation.ChecksumMismatch, "file content does not match the checksum")
+	// ErrUnsupportedFileType is returned for content types missing from AllowedTypes
+	ErrUnsupportedFileType = foundation.NewError(foundation.UnsupportedType, "unsupported file type")
 	AllowedTypes           = map[string]bool{
 		"image/jpeg":               true,
 		"image/png":                true,
@@ -26,11 +39,21 @@ var (
 type Storage interface {
 	FPutObject(ctx context.Context, bucketName,
 		objectName, filePath string, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	FGetObject(ctx context.Context, bucketName,
+		objectName, filePath string, opts minio.GetObjectOptions) error
+	StatObject(ctx context.Context, bucketName,
+		objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
 }
 
 type BucketUpload struct {
 	Storage    Storage
 	BucketName string
+	// Audit records the file operations, nil disables the audit log
+	Audit *Audit
+	// Index makes the files searchable, nil disables search
+	Index *SearchIndex
 }
 
 func NewBucketUpload(storage Storage, bucketName string) *BucketUpload {
@@ -40,6 +63,28 @@ func NewBucketUpload(storage Storage, bucketName string) *BucketUpload {
 	}
 }
 
+// Upload stores the file in the bucket, creating its folder, and records it in the audit log
+func (bu *BucketUpload) Upload(ctx context.Context, fu *FileUpload) (err error) {
+	defer func() {
+		bu.audit(ctx, AuditUpload, fu.ID, err)
+	}()
+	folder, ok := cleanFolder(fu.Folder)
+	if !ok {
+		return ErrInvalidFolder
+	}
+	fu.Folder = folder
+	if err := bu.ensureFolder(ctx, fu.UserID, fu.Folder); err != nil {
+		return err
+	}
+
+	if err := fu.Upload(ctx, bu.Storage, bu.BucketName); err != nil {
+		return err
+	}
+	bu.indexFile(fu.ID)
+
+	return nil
+}
+
 type FileUploader interface {
 	Upload(ctx context.Context, storage Storage, bucketName string) error
 }
@@ -51,29 +96,81 @@ type FileUpload struct {
 	Size        int64
 	ContentType string
 	UserID      string
+	// Checksum is the hex encoded SHA-256 expected by the client,
+	// it is set to the computed value after a successful upload
+	Checksum string
+	// ID is the generated object name under Folder, set after a successful upload
+	ID string
+	// Folder is the folder of the user the file is stored in, empty for the root
+	Folder string
+	// Metadata is stored with the file next to its name, owner and checksum
+	Metadata map[string]string
+	// ClientMetadata and Tags are sent by the client, they are checked with NormalizeMetadata
+	ClientMetadata map[string]string
+	Tags           []string
+}
+
+// objectMetadata is the metadata stored with the object, without the checksum
+func (f *FileUpload) objectMetadata() (map[string]string, error) {
+	clientMetadata, tags, err := NormalizeMetadata(f.ClientMetadata, f.Tags)
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]string{}
+	for k, v := range f.Metadata {
+		metadata[k] = v
+	}
+	setUserMetadata(metadata, clientMetadata, tags)
+	metadata["fileName"] = f.RealName
+	metadata["userID"] = f.UserID
+
+	return metadata, nil
 }
 
 /*
 Upload uploads a file to storage client set on start up
-  - Validates file type (JPEG, PNG, PDF, octet-stream)
+  - Validates file type (JPEG, PNG, PDF, octet-stream) and the client metadata
   - Reads file data (max 100MB)
+  - Verifies the SHA-256 checksum when the client sent one
   - Generates safe filename with random hex string
   - Writes temporary file
   - Uploads to MinIO bucket
   - Cleans up temp file
 */
-func (f *FileUpload) Upload(ctx context.Context, storage Storage, bucketName string) error {
+func (f *FileUpload) Upload(ctx context.Context, storage Storage, bucketName string) (err error) {
+	ctx, span := startSpan(ctx, "FileUpload.Upload",
+		attribute.String("content_type", f.ContentType), attribute.Int64("size", f.Size))
+	defer func() {
+		endSpan(span, err)
+	}()
 	// validate file type
 	if !AllowedTypes[f.ContentType] {
-		return errUnsupportedFileType
+		return ErrUnsupportedFileType
+	}
+	metadata, err := f.objectMetadata()
+	if err != nil {
+		return err
 	}
+	uploadsInFlight.Inc()
+	defer uploadsInFlight.Dec()
 	// save a temporary copy of the file
+	_, readSpan := startSpan(ctx, "read file")
 	data := make([]byte, f.Size)
-	if _, err := io.ReadFull(f.File, data); err != nil {
+	_, err = io.ReadFull(f.File, data)
+	endSpan(readSpan, err)
+	if err != nil {
 		return err
 	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if f.Checksum != "" && !strings.EqualFold(f.Checksum, checksum) {
+		return ErrChecksumMismatch
+	}
 	generatedFileName := generateSafeFilename(f.FileName, f.ContentType)
-	if err := os.WriteFile(generatedFileName, data, 0644); err != nil {
+	_, writeSpan := startSpan(ctx, "write temp file")
+	err = os.WriteFile(generatedFileName, data, 0644)
+	endSpan(writeSpan, err)
+	if err != nil {
 		return err
 	}
 
@@ -87,19 +184,26 @@ func (f *FileUpload) Upload(ctx context.Context, storage Storage, bucketName str
 	if removeErr != nil {
 		return removeErr
 	}
+	metadata["checksum"] = checksum
 	// upload the file to the bucket
-	_, err := storage.FPutObject(ctx,
-		bucketName, generatedFileName, generatedFileName,
+	storageCtx, storageSpan := startSpan(ctx, "storage FPutObject", attribute.String("bucket", bucketName))
+	start := time.Now()
+	key := objectKey(f.Folder, generatedFileName)
+	_, err = storage.FPutObject(storageCtx,
+		bucketName, key, generatedFileName,
 		minio.PutObjectOptions{
-			ContentType: f.ContentType,
-			UserMetadata: map[string]string{
-				"fileName": f.RealName,
-				"userID":   f.UserID,
-			},
+			ContentType:  f.ContentType,
+			UserMetadata: metadata,
 		})
+	observeStorage("FPutObject", start, err)
+	endSpan(storageSpan, err)
 	if err != nil {
 		return err
 	}
+	observeUpload(f.ContentType, f.Size)
+	f.Checksum = checksum
+	f.ID = key
+	span.SetAttributes(attribute.String("file_id", f.ID))
 
 	return nil
 }
@@ -0,0 +1,253 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/foundation"
+)
+
+const (
+	// DefaultUploadLinkExpiry is used when an upload link is created without an expiry
+	DefaultUploadLinkExpiry = 7 * 24 * time.Hour
+	// MaxUploadLinkExpiry is the longest an upload link can be valid for
+	MaxUploadLinkExpiry = 30 * 24 * time.Hour
+
+	uploadKind        = "upload"
+	uploadLinkRecords = "uploadlinks/"
+)
+
+var (
+	// ErrUploadLinkNotFound is returned for unknown, tampered or revoked links
+	ErrUploadLinkNotFound = foundation.NewError(foundation.NotFound, "upload link not found")
+	// ErrUploadLinkExpired is returned once a link expired or received all its files
+	ErrUploadLinkExpired = foundation.NewError(foundation.Expired, "upload link expired")
+	// ErrUploadLinkTooLarge is returned when a file does not fit in what is left of the total size
+	ErrUploadLinkTooLarge = foundation.NewError(foundation.QuotaExceeded, "file exceeds the size left on the upload link")
+	// ErrUploadLinkBusy is returned when the link kept changing while it was updated
+	ErrUploadLinkBusy = foundation.NewError(foundation.Conflict, "upload link is being updated, retry")
+	// ErrInvalidUploadLink is returned for invalid limits, types or folders
+	ErrInvalidUploadLink = foundation.NewError(foundation.InvalidRequest, "upload links expire within 30 days and need valid limits, types and folder")
+
+	// errUploadLinkUnchanged leaves the link as is in updateUploadLink
+	errUploadLinkUnchanged = errors.New("upload link unchanged")
+)
+
+// UploadLinkOptions limits an upload link, zero limits are unlimited
+type UploadLinkOptions struct {
+	ExpiresIn    time.Duration
+	MaxFiles     int
+	MaxTotalSize int64
+	// AllowedTypes narrows AllowedTypes, empty allows all of them
+	AllowedTypes []string
+	Folder       string
+}
+
+// UploadLink lets guests upload files on behalf of a user, the token is only returned on creation
+type UploadLink struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"userID"`
+	URL          string     `json:"url,omitempty"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	MaxFiles     int        `json:"maxFiles,omitempty"`
+	MaxTotalSize int64      `json:"maxTotalSize,omitempty"`
+	AllowedTypes []string   `json:"allowedTypes,omitempty"`
+	Folder       string     `json:"folder,omitempty"`
+	Files        int        `json:"files"`
+	TotalSize    int64      `json:"totalSize"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+}
+
+// CreateUploadLink issues a link guests can upload files to the user's bucket with
+func (l *Links) CreateUploadLink(ctx context.Context, userID string, opts UploadLinkOptions) (_ *UploadLink, err error) {
+	var id string
+	defer func() {
+		l.bu.audit(ctx, AuditUploadLink, id, err)
+	}()
+	if opts.ExpiresIn == 0 {
+		opts.ExpiresIn = DefaultUploadLinkExpiry
+	}
+	if opts.ExpiresIn < 0 || opts.ExpiresIn > MaxUploadLinkExpiry ||
+		opts.MaxFiles < 0 || opts.MaxTotalSize < 0 {
+		return nil, ErrInvalidUploadLink
+	}
+	for _, contentType := range opts.AllowedTypes {
+		if !AllowedTypes[contentType] {
+			return nil, ErrInvalidUploadLink
+		}
+	}
+	folder, ok := cleanFolder(opts.Folder)
+	if !ok {
+		return nil, ErrInvalidUploadLink
+	}
+	id, err = randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	link := &UploadLink{
+		ID:           id,
+		UserID:       userID,
+		ExpiresAt:    now.Add(opts.ExpiresIn).Truncate(time.Second),
+		MaxFiles:     opts.MaxFiles,
+		MaxTotalSize: opts.MaxTotalSize,
+		AllowedTypes: opts.AllowedTypes,
+		Folder:       folder,
+		CreatedAt:    now,
+	}
+	if err := l.bu.putRecord(ctx, uploadLinkRecords+id, link); err != nil {
+		return nil, err
+	}
+	created := *link
+	created.URL = l.BaseURL + "/upload/" + l.sign(uploadKind, id, link.ExpiresAt)
+
+	return &created, nil
+}
+
+// RevokeUploadLink stops a link created by the user from accepting files
+func (l *Links) RevokeUploadLink(ctx context.Context, userID, id string) (err error) {
+	defer func() {
+		l.bu.audit(ctx, AuditUploadLinkRevoke, id, err)
+	}()
+	_, err = l.updateUploadLink(ctx, id, func(link *UploadLink) error {
+		if link.UserID != userID {
+			return ErrUploadLinkNotFound
+		}
+		if link.RevokedAt != nil {
+			return errUploadLinkUnchanged
+		}
+		now := time.Now().UTC()
+		link.RevokedAt = &now
+		return nil
+	})
+	if errors.Is(err, errUploadLinkUnchanged) {
+		return nil
+	}
+
+	return err
+}
+
+/*
+UploadWithLink stores a file sent by a guest
+  - The token is verified and a file reserved on the link before read is called,
+    so nothing is read from guests without a valid link
+  - read gets the most bytes the link still accepts, its size is counted against
+    the link limits before the file is uploaded
+  - The reservation is released again if reading or the upload fails
+  - The file belongs to the user who created the link, it is flagged as a guest
+    upload with the link ID and folder in its metadata
+*/
+func (l *Links) UploadWithLink(ctx context.Context, token string, read func(limit int64) (*FileUpload, error)) (*UploadLink, *FileUpload, error) {
+	id, expires, err := l.verify(uploadKind, token)
+	if err != nil {
+		return nil, nil, ErrUploadLinkNotFound
+	}
+	if time.Now().After(expires) {
+		return nil, nil, ErrUploadLinkExpired
+	}
+
+	link, err := l.reserve(ctx, id, 1, 0, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	limit := int64(MaxFileSize)
+	if link.MaxTotalSize > 0 {
+		limit = min(limit, link.MaxTotalSize-link.TotalSize)
+	}
+	fu, err := read(limit)
+	if err != nil {
+		return nil, nil, l.release(ctx, id, 1, 0, err)
+	}
+	link, err = l.reserve(ctx, id, 0, fu.Size, fu.ContentType)
+	if err != nil {
+		return nil, nil, l.release(ctx, id, 1, 0, err)
+	}
+	fu.UserID = link.UserID
+	fu.Metadata = map[string]string{
+		"guest":      "true",
+		"uploadLink": link.ID,
+	}
+	fu.Folder = link.Folder
+	if err := l.bu.Upload(ctx, fu); err != nil {
+		return nil, nil, l.release(ctx, id, 1, fu.Size, err)
+	}
+
+	return link, fu, nil
+}
+
+/*
+reserve adds files and size to the link usage
+  - The file limit is checked when files are added, the total size and
+    allowed types when the size of a file is added
+  - The link is written with If-Match on its etag so concurrent uploads on any
+    replica never exceed MaxFiles or MaxTotalSize
+*/
+func (l *Links) reserve(ctx context.Context, id string, files int, size int64, contentType string) (*UploadLink, error) {
+	return l.updateUploadLink(ctx, id, func(link *UploadLink) error {
+		switch {
+		case link.RevokedAt != nil:
+			return ErrUploadLinkNotFound
+		case files > 0 && link.MaxFiles > 0 && link.Files >= link.MaxFiles:
+			return ErrUploadLinkExpired
+		case link.MaxTotalSize > 0 && link.TotalSize+size > link.MaxTotalSize:
+			return ErrUploadLinkTooLarge
+		case contentType != "" && len(link.AllowedTypes) > 0 && !slices.Contains(link.AllowedTypes, contentType):
+			return ErrUnsupportedFileType
+		}
+		link.Files += files
+		link.TotalSize += size
+		return nil
+	})
+}
+
+// release removes what reserve added after the upload failed with err, which is returned
+func (l *Links) release(ctx context.Context, id string, files int, size int64, err error) error {
+	_, releaseErr := l.updateUploadLink(ctx, id, func(link *UploadLink) error {
+		link.Files -= files
+		link.TotalSize -= size
+		return nil
+	})
+	if releaseErr != nil {
+		return errors.Join(err, releaseErr)
+	}
+
+	return err
+}
+
+/*
+updateUploadLink applies change to the link and writes it with If-Match on its etag
+  - The link is read again and change retried when another request changed it
+  - An error from change is returned as is and nothing is written
+*/
+func (l *Links) updateUploadLink(ctx context.Context, id string, change func(*UploadLink) error) (*UploadLink, error) {
+	if len(id) != 16 || !isHex(id) {
+		return nil, ErrUploadLinkNotFound
+	}
+	for range recordAttempts {
+		link := &UploadLink{}
+		etag, err := l.bu.getRecordETag(ctx, uploadLinkRecords+id, link)
+		switch {
+		case errors.Is(err, errRecordNotFound):
+			return nil, ErrUploadLinkNotFound
+		case errors.Is(err, errRecordChanged):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if err := change(link); err != nil {
+			return nil, err
+		}
+		err = l.bu.updateRecord(ctx, uploadLinkRecords+id, link, etag)
+		switch {
+		case errors.Is(err, errRecordNotFound):
+			return nil, ErrUploadLinkNotFound
+		case !errors.Is(err, errRecordChanged):
+			return link, err
+		}
+	}
+
+	return nil, ErrUploadLinkBusy
+}
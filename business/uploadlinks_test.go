@@ -0,0 +1,146 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func guestFile(contentType, content string) func(int64) (*FileUpload, error) {
+	return func(int64) (*FileUpload, error) {
+		return &FileUpload{
+			RealName:    "invoice",
+			FileName:    "invoice",
+			File:        bytes.NewReader([]byte(content)),
+			Size:        int64(len(content)),
+			ContentType: contentType,
+		}, nil
+	}
+}
+
+func TestCreateUploadLink(t *testing.T) {
+	links := NewLinks(NewBucketUpload(storagetest.NewMemory(), "test"), []byte("secret"), "https://files.example.com")
+
+	scenarios := []struct {
+		name string
+		opts UploadLinkOptions
+		err  error
+	}{
+		{name: "defaults", opts: UploadLinkOptions{}},
+		{name: "limited", opts: UploadLinkOptions{MaxFiles: 2, MaxTotalSize: 10, AllowedTypes: []string{"application/pdf"}, Folder: "/customers/acme/"}},
+		{name: "expiry too long", opts: UploadLinkOptions{ExpiresIn: MaxUploadLinkExpiry + time.Hour}, err: ErrInvalidUploadLink},
+		{name: "negative limit", opts: UploadLinkOptions{MaxTotalSize: -1}, err: ErrInvalidUploadLink},
+		{name: "unsupported type", opts: UploadLinkOptions{AllowedTypes: []string{"text/html"}}, err: ErrInvalidUploadLink},
+		{name: "folder outside the root", opts: UploadLinkOptions{Folder: "../other"}, err: ErrInvalidUploadLink},
+		{name: "folder not clean", opts: UploadLinkOptions{Folder: "a/../b"}, err: ErrInvalidUploadLink},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			link, err := links.CreateUploadLink(context.Background(), "alice", scenario.opts)
+			if scenario.err != nil {
+				assert.ErrorIs(t, err, scenario.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, link.URL, "https://files.example.com/upload/"+link.ID+".")
+			assert.Equal(t, strings.Trim(scenario.opts.Folder, "/"), link.Folder)
+		})
+	}
+}
+
+func TestUploadWithLink(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	links := NewLinks(bu, []byte("secret"), "")
+	link, err := links.CreateUploadLink(ctx, "alice", UploadLinkOptions{
+		MaxFiles:     2,
+		MaxTotalSize: 10,
+		AllowedTypes: []string{"application/pdf"},
+		Folder:       "customers/acme",
+	})
+	require.NoError(t, err)
+	token := link.URL[len("/upload/"):]
+
+	_, _, err = links.UploadWithLink(ctx, token, guestFile("image/png", "png"))
+	assert.ErrorIs(t, err, ErrUnsupportedFileType)
+	_, _, err = links.UploadWithLink(ctx, token, guestFile("application/pdf", "far too large"))
+	assert.ErrorIs(t, err, ErrUploadLinkTooLarge)
+	_, _, err = links.UploadWithLink(ctx, token+"0", guestFile("application/pdf", "pdf"))
+	assert.ErrorIs(t, err, ErrUploadLinkNotFound)
+	_, _, err = links.UploadWithLink(ctx, links.sign(uploadKind, link.ID, time.Now().Add(-time.Minute)), guestFile("application/pdf", "pdf"))
+	assert.ErrorIs(t, err, ErrUploadLinkExpired)
+	_, _, err = links.UploadWithLink(ctx, links.sign(shareKind, link.ID, link.ExpiresAt), guestFile("application/pdf", "pdf"))
+	assert.ErrorIs(t, err, ErrUploadLinkNotFound)
+
+	var limit int64
+	used, fu, err := links.UploadWithLink(ctx, token, func(l int64) (*FileUpload, error) {
+		limit = l
+		return guestFile("application/pdf", "pdf")(l)
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, limit, "read is limited to the size left on the link")
+	assert.Equal(t, 1, used.Files)
+	assert.EqualValues(t, 3, used.TotalSize)
+
+	info, err := bu.StatFile(ctx, "alice", fu.ID)
+	require.NoError(t, err)
+	assert.True(t, info.Guest)
+	assert.Equal(t, "customers/acme", info.Folder)
+
+	_, _, err = links.UploadWithLink(ctx, token, func(int64) (*FileUpload, error) {
+		return nil, errors.New("connection reset")
+	})
+	assert.Error(t, err)
+	_, _, err = links.UploadWithLink(ctx, token, func(l int64) (*FileUpload, error) {
+		fu, err := guestFile("application/pdf", "pdf")(l)
+		fu.Checksum = "0000"
+		return fu, err
+	})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	used, _, err = links.UploadWithLink(ctx, token, guestFile("application/pdf", "pdf"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, used.Files, "failed uploads are not counted")
+	_, _, err = links.UploadWithLink(ctx, token, guestFile("application/pdf", "pdf"))
+	assert.ErrorIs(t, err, ErrUploadLinkExpired)
+
+	assert.ErrorIs(t, links.RevokeUploadLink(ctx, "bob", link.ID), ErrUploadLinkNotFound)
+	require.NoError(t, links.RevokeUploadLink(ctx, "alice", link.ID))
+	_, _, err = links.UploadWithLink(ctx, token, guestFile("application/pdf", "pdf"))
+	assert.ErrorIs(t, err, ErrUploadLinkNotFound)
+}
+
+func TestUploadWithLinkAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	bu := NewBucketUpload(storagetest.NewMemory(), "test")
+	replicas := []*Links{NewLinks(bu, []byte("secret"), ""), NewLinks(bu, []byte("secret"), "")}
+	link, err := replicas[0].CreateUploadLink(ctx, "alice", UploadLinkOptions{MaxFiles: 3})
+	require.NoError(t, err)
+	token := link.URL[len("/upload/"):]
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			_, _, err := replicas[i%2].UploadWithLink(ctx, token, guestFile("application/pdf", "pdf"))
+			if err != nil {
+				assert.True(t, errors.Is(err, ErrUploadLinkExpired) || errors.Is(err, ErrUploadLinkBusy), err)
+			}
+		})
+	}
+	wg.Wait()
+
+	files, err := bu.ListFiles(ctx, "alice", FileFilter{})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(files), 3)
+	used := &UploadLink{}
+	require.NoError(t, bu.getRecord(ctx, uploadLinkRecords+link.ID, used))
+	assert.Equal(t, len(files), used.Files)
+}
@@ -0,0 +1,234 @@
+// Package client is a Go SDK for the ingestion service REST and GraphQL APIs.
+package client
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = 500 * time.Millisecond
+	maxBackoff        = 30 * time.Second
+)
+
+// Client calls the ingestion service on behalf of a user
+type Client struct {
+	baseURL    string
+	graphQLURL string
+	token      string
+	apiKey     string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken sets the bearer token issued by the identity server
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithAPIKey authenticates with a service API key instead of a bearer token
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithRetries sets how many times a request failing with 5xx or 429 is retried
+// and the initial backoff, which doubles with every attempt
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// WithGraphQLURL sets the GraphQL endpoint, by default it is /graphql on the base URL
+func WithGraphQLURL(u string) Option {
+	return func(c *Client) {
+		c.graphQLURL = u
+	}
+}
+
+// New creates a client for the service running at baseURL
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.graphQLURL == "" {
+		c.graphQLURL = c.baseURL + "/graphql"
+	}
+
+	return c
+}
+
+// APIError is returned for responses with a non 2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Code is the entry of the service error catalogue, such as too-large or checksum-mismatch
+	Code string
+	// RequestID identifies the request in the service logs
+	RequestID string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// newRequest is called for every attempt so the body can be rewound
+type newRequest func(ctx context.Context) (*http.Request, error)
+
+/*
+do sends the request built by newReq
+  - Adds the bearer token or API key
+  - Retries 5xx and 429 responses and transport errors with exponential backoff,
+    honouring Retry-After, when retryable is set
+  - Converts non 2xx responses into *APIError
+*/
+func (c *Client) do(ctx context.Context, newReq newRequest, retryable bool) (*http.Response, error) {
+	attempts := 1
+	if retryable {
+		attempts += c.maxRetries
+	}
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.wait(ctx, attempt, lastErr); err != nil {
+				return nil, err
+			}
+		}
+		req, err := newReq(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		}
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		if res.StatusCode >= 200 && res.StatusCode < 300 {
+			return res, nil
+		}
+		apiErr := readAPIError(res)
+		if !apiErr.Temporary() {
+			return nil, apiErr
+		}
+		lastErr = &retryError{APIError: apiErr, retryAfter: retryAfter(res)}
+	}
+	if rErr, ok := lastErr.(*retryError); ok {
+		return nil, rErr.APIError
+	}
+
+	return nil, lastErr
+}
+
+// wait sleeps before the next attempt
+func (c *Client) wait(ctx context.Context, attempt int, lastErr error) error {
+	delay := c.backoff << (attempt - 1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	// jitter stops clients that failed together from retrying together
+	delay += rand.N(c.backoff + 1)
+	if rErr, ok := lastErr.(*retryError); ok && rErr.retryAfter > delay {
+		delay = rErr.retryAfter
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type retryError struct {
+	*APIError
+	retryAfter time.Duration
+}
+
+func retryAfter(res *http.Response) time.Duration {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// readAPIError reads the RFC 7807 problem of the response, services before
+// problems were introduced sent message and error-code instead
+func readAPIError(res *http.Response) *APIError {
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	apiErr := &APIError{StatusCode: res.StatusCode}
+	body := struct {
+		Detail    string `json:"detail"`
+		Code      string `json:"code"`
+		RequestID string `json:"requestId"`
+		Message   string `json:"message"`
+		ErrorCode string `json:"error-code"`
+	}{}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1<<16))
+	if err := json.Unmarshal(data, &body); err == nil {
+		apiErr.Message = cmp.Or(body.Detail, body.Message)
+		apiErr.Code = cmp.Or(body.Code, body.ErrorCode)
+		apiErr.RequestID = body.RequestID
+	} else {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+
+	return apiErr
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/riyadennis/identity-server/app/proto/identity"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/riyadennis/ingestion-service/rest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// mockIdentity resolves bearer tokens to user IDs
+type mockIdentity struct {
+	users map[string]string
+}
+
+func (m *mockIdentity) Login(_ context.Context, _ *identity.LoginRequest, _ ...grpc.CallOption) (*identity.LoginResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockIdentity) Me(ctx context.Context, _ *identity.UserRequest, _ ...grpc.CallOption) (*identity.UserResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for _, auth := range md.Get("Authorization") {
+		if id, ok := m.users[auth]; ok {
+			return &identity.UserResponse{ID: &id}, nil
+		}
+	}
+	return nil, errors.New("invalid token")
+}
+
+func newRESTServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	idc := &mockIdentity{users: map[string]string{"Bearer alice": "alice"}}
+	bu := business.NewBucketUpload(storagetest.NewMemory(), "test")
+	bu.Index = business.NewSearchIndex(bu, logrus.New())
+	srv := httptest.NewServer(rest.LoadRESTEndpoints(logrus.New(), bu,
+		business.NewPolicyAuthenticator(business.NewIdentityAuthenticator(idc), business.DefaultPolicy()), nil))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestClientFiles(t *testing.T) {
+	srv := newRESTServer(t)
+	c := New(srv.URL, WithToken("alice"))
+	ctx := context.Background()
+	content, err := os.ReadFile("../testdata/image1.jpg")
+	require.NoError(t, err)
+
+	var progress int64
+	uploaded, err := c.Upload(ctx, bytes.NewReader(content), UploadOptions{
+		FileName: "image1.jpg",
+		Progress: func(sent int64) { progress = sent },
+		Metadata: map[string]string{"album": "holiday"},
+		Tags:     []string{"beach"},
+		Folder:   "photos/2026",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", uploaded.ContentType)
+	assert.Equal(t, "photos/2026", uploaded.Folder)
+	assert.Equal(t, int64(len(content)), progress)
+	assert.Equal(t, map[string]string{"album": "holiday"}, uploaded.Metadata)
+
+	updated, err := c.UpdateMetadata(ctx, uploaded.ID, MetadataUpdate{
+		Metadata: map[string]string{"album": "", "year": "2026"},
+		Tags:     []string{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"year": "2026"}, updated.Metadata)
+	assert.Empty(t, updated.Tags)
+
+	root := ""
+	moved, err := c.Move(ctx, uploaded.ID, MoveOptions{Folder: &root, Name: "beach.jpg"})
+	require.NoError(t, err)
+	assert.Empty(t, moved.Folder)
+	assert.Equal(t, "beach.jpg", moved.Name)
+	_, _, err = c.Download(ctx, uploaded.ID)
+	assert.Error(t, err, "the old ID is gone")
+
+	found, err := c.Search(ctx, "beach", 10, "")
+	require.NoError(t, err)
+	require.Len(t, found.Hits, 1)
+	assert.Equal(t, moved.ID, found.Hits[0].File.ID)
+	assert.False(t, found.HasNextPage)
+
+	files, err := c.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "beach.jpg", files[0].Name)
+	assert.Equal(t, uploaded.Checksum, files[0].Checksum)
+
+	f, body, err := c.Download(ctx, files[0].ID)
+	require.NoError(t, err)
+	downloaded, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	assert.Equal(t, content, downloaded)
+	assert.Equal(t, "beach.jpg", f.Name)
+
+	require.NoError(t, c.Delete(ctx, files[0].ID))
+	files, err = c.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	err = c.Delete(ctx, "missing")
+	apiErr := &APIError{}
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := newRESTServer(t)
+	scenarios := []struct {
+		name           string
+		client         *Client
+		call           func(c *Client) error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:   "missing token",
+			client: New(srv.URL),
+			call: func(c *Client) error {
+				_, err := c.List(context.Background())
+				return err
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   "unauthenticated",
+		},
+		{
+			name:   "checksum mismatch",
+			client: New(srv.URL, WithToken("alice")),
+			call: func(c *Client) error {
+				_, err := c.Upload(context.Background(), bytes.NewReader([]byte("hello")), UploadOptions{
+					FileName: "hello.txt",
+					Checksum: "0000",
+				})
+				return err
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "checksum-mismatch",
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			err := scenario.call(scenario.client)
+			apiErr := &APIError{}
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, scenario.expectedStatus, apiErr.StatusCode)
+			assert.Equal(t, scenario.expectedCode, apiErr.Code)
+			assert.NotEmpty(t, apiErr.RequestID)
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	scenarios := []struct {
+		name             string
+		failures         int32
+		status           int
+		reader           io.Reader
+		expectedAttempts int32
+		expectedError    bool
+	}{
+		{
+			name:             "recovers from 5xx",
+			failures:         2,
+			status:           http.StatusServiceUnavailable,
+			reader:           bytes.NewReader([]byte("hello")),
+			expectedAttempts: 3,
+		},
+		{
+			name:             "recovers from 429",
+			failures:         1,
+			status:           http.StatusTooManyRequests,
+			reader:           bytes.NewReader([]byte("hello")),
+			expectedAttempts: 2,
+		},
+		{
+			name:             "gives up after max retries",
+			failures:         10,
+			status:           http.StatusInternalServerError,
+			reader:           bytes.NewReader([]byte("hello")),
+			expectedAttempts: 4,
+			expectedError:    true,
+		},
+		{
+			name:             "does not retry 4xx",
+			failures:         10,
+			status:           http.StatusBadRequest,
+			reader:           bytes.NewReader([]byte("hello")),
+			expectedAttempts: 1,
+			expectedError:    true,
+		},
+		{
+			name:             "does not retry readers that cannot be rewound",
+			failures:         10,
+			status:           http.StatusServiceUnavailable,
+			reader:           io.MultiReader(bytes.NewReader([]byte("hello"))),
+			expectedAttempts: 1,
+			expectedError:    true,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), "hello")
+				if attempts.Add(1) <= scenario.failures {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(scenario.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			c := New(srv.URL, WithRetries(3, time.Millisecond))
+			_, err := c.Upload(context.Background(), scenario.reader, UploadOptions{FileName: "hello.txt"})
+			assert.Equal(t, scenario.expectedError, err != nil)
+			assert.Equal(t, scenario.expectedAttempts, attempts.Load())
+		})
+	}
+}
+
+func TestClientGraphQL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graphql", r.URL.Path)
+		assert.Equal(t, "Bearer alice", r.Header.Get("Authorization"))
+		if r.Header.Get("Content-Type") == "application/json" {
+			_, _ = w.Write([]byte(`{"errors": [{"message": "not implemented"}]}`))
+			return
+		}
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Contains(t, r.FormValue("operations"), "singleUpload")
+		_, _ = w.Write([]byte(`{"data": {"singleUpload": {"ID": "abc.doc", "Name": "hello.txt", "Size": "5",
+			"CreateAt": "2026-01-02T03:04:05Z", "UserID": "alice"}}}`))
+	}))
+	defer srv.Close()
+	c := New(srv.URL, WithToken("alice"))
+
+	err := c.GraphQL(context.Background(), `{ FetchFile(Name: "a") { Size } }`, nil, nil)
+	gqlErrs := GraphQLErrors{}
+	require.ErrorAs(t, err, &gqlErrs)
+	assert.Equal(t, "not implemented", gqlErrs[0].Message)
+
+	f, err := c.SingleUpload(context.Background(), bytes.NewReader([]byte("hello")), UploadOptions{FileName: "hello.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, "abc.doc", f.ID)
+	assert.Equal(t, int64(5), f.Size)
+	assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), f.CreatedAt)
+}
@@ -0,0 +1,422 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ChecksumHeader carries the hex encoded SHA-256 of the file content
+const ChecksumHeader = "X-Checksum-SHA256"
+
+// IdempotencyKeyHeader carries the key the service uses to detect retried uploads
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	// MetadataHeaderPrefix starts the headers carrying the metadata of an upload
+	MetadataHeaderPrefix = "X-Meta-"
+	// TagsHeader carries the comma separated tags of an upload
+	TagsHeader = "X-Tags"
+)
+
+// ErrChecksumMismatch is returned when downloaded content does not match the checksum sent by the service
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// acceptedTypes are the content types the service stores as is,
+// anything else is sent as application/octet-stream
+var acceptedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"application/pdf": true,
+}
+
+// File describes a file stored by the service
+type File struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	UserID      string    `json:"userID"`
+	Checksum    string    `json:"checksum,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Metadata and Tags were set by the client
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	// Folder is the folder the file is in, empty for the root
+	Folder string `json:"folder,omitempty"`
+}
+
+// MoveOptions tell Move where a file goes
+type MoveOptions struct {
+	// Folder is the folder to move the file to, nil keeps it and empty is the root
+	Folder *string `json:"folder,omitempty"`
+	// Name renames the file when set
+	Name string `json:"name,omitempty"`
+}
+
+// MetadataUpdate changes the metadata and tags of a file
+type MetadataUpdate struct {
+	// Metadata is merged into the metadata of the file, empty values remove keys
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Tags replace the tags of the file, nil keeps them and an empty slice removes them
+	Tags []string `json:"tags"`
+}
+
+// SearchResults is a page of files matching a search, best matches first
+type SearchResults struct {
+	Hits []struct {
+		File   *File   `json:"file"`
+		Score  float64 `json:"score"`
+		Cursor string  `json:"cursor"`
+	} `json:"hits"`
+	Total int `json:"total"`
+	// EndCursor is passed as after to get the next page
+	EndCursor   string `json:"endCursor"`
+	HasNextPage bool   `json:"hasNextPage"`
+}
+
+// UploadOptions describe the file being uploaded
+type UploadOptions struct {
+	// FileName is the original name of the file
+	FileName string
+	// ContentType is sniffed from the content when empty
+	ContentType string
+	// Checksum is the hex encoded SHA-256 of the content,
+	// it is computed when empty and the reader is an io.Seeker
+	Checksum string
+	// Progress is called with the total number of bytes sent so far
+	Progress func(sent int64)
+	// IdempotencyKey makes the service store the file once when the
+	// request is retried or sent again with the same key
+	IdempotencyKey string
+	// Metadata is stored with the file, keys are letters, digits and hyphens
+	// and values printable ASCII
+	Metadata map[string]string
+	// Tags are stored with the file
+	Tags []string
+	// Folder is the folder to store the file in, it is created when missing
+	Folder string
+}
+
+/*
+Upload streams r to the service as multipart form data
+  - Content is never buffered in memory
+  - Requests are only retried when r is an io.Seeker so it can be rewound
+  - The service verifies the checksum and rejects the upload if it does not match
+*/
+func (c *Client) Upload(ctx context.Context, r io.Reader, opts UploadOptions) (*File, error) {
+	seeker, retryable := r.(io.ReadSeeker)
+	var start int64
+	if retryable {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		if opts.Checksum == "" {
+			h := sha256.New()
+			if _, err := io.Copy(h, seeker); err != nil {
+				return nil, err
+			}
+			opts.Checksum = hex.EncodeToString(h.Sum(nil))
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opts.ContentType == "" {
+		br := bufio.NewReaderSize(r, 512)
+		head, _ := br.Peek(512)
+		opts.ContentType = sniffContentType(head)
+		if retryable {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		} else {
+			r = br
+		}
+	}
+
+	var sent atomic.Int64
+	newReq := func(ctx context.Context) (*http.Request, error) {
+		if retryable {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		sent.Store(0)
+		pr, pw := io.Pipe()
+		writer := multipart.NewWriter(pw)
+		go func() {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", mime.FormatMediaType("form-data",
+				map[string]string{"name": "file", "filename": opts.FileName}))
+			header.Set("Content-Type", opts.ContentType)
+			part, err := writer.CreatePart(header)
+			if err == nil {
+				_, err = io.Copy(part, &countingReader{Reader: r, sent: &sent, progress: opts.Progress})
+			}
+			if err == nil {
+				err = writer.Close()
+			}
+			_ = pw.CloseWithError(err)
+		}()
+		path := "/upload"
+		if opts.Folder != "" {
+			path += "?" + url.Values{"folder": {opts.Folder}}.Encode()
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, pr)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if opts.Checksum != "" {
+			req.Header.Set(ChecksumHeader, opts.Checksum)
+		}
+		if opts.IdempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, opts.IdempotencyKey)
+		}
+		for k, v := range opts.Metadata {
+			req.Header.Set(MetadataHeaderPrefix+k, v)
+		}
+		if len(opts.Tags) > 0 {
+			req.Header.Set(TagsHeader, strings.Join(opts.Tags, ","))
+		}
+		return req, nil
+	}
+	res, err := c.do(ctx, newReq, retryable)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	f := &File{}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, err
+		}
+	}
+	if f.Name == "" {
+		f.Name = opts.FileName
+	}
+	if f.ContentType == "" {
+		f.ContentType = opts.ContentType
+	}
+	if f.Checksum == "" {
+		f.Checksum = opts.Checksum
+	}
+	if f.Size == 0 {
+		f.Size = sent.Load()
+	}
+
+	return f, nil
+}
+
+// Download returns the content of a file, the caller must close it.
+// Reading the body returns ErrChecksumMismatch at the end if the content
+// does not match the checksum sent by the service
+func (c *Client) Download(ctx context.Context, id string) (*File, io.ReadCloser, error) {
+	res, err := c.do(ctx, c.get("/files/"+url.PathEscape(id)), true)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := &File{
+		ID:          id,
+		Name:        id,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+		Checksum:    res.Header.Get(ChecksumHeader),
+	}
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		f.Name = params["filename"]
+		if unquoted, err := strconv.Unquote(f.Name); err == nil {
+			f.Name = unquoted
+		}
+	}
+	if f.Checksum == "" {
+		return f, res.Body, nil
+	}
+
+	return f, &verifyingReader{ReadCloser: res.Body, hash: sha256.New(), expected: f.Checksum}, nil
+}
+
+// List returns the files uploaded by the user, newest first
+func (c *Client) List(ctx context.Context) ([]*File, error) {
+	res, err := c.do(ctx, c.get("/files"), true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	var files []*File
+	if err := json.NewDecoder(res.Body).Decode(&files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// Delete removes a file
+func (c *Client) Delete(ctx context.Context, id string) error {
+	res, err := c.do(ctx, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodDelete, c.baseURL+"/files/"+url.PathEscape(id), nil)
+	}, true)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// UpdateMetadata changes the metadata and tags of a file and returns the file
+func (c *Client) UpdateMetadata(ctx context.Context, id string, update MetadataUpdate) (*File, error) {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, c.baseURL+"/files/"+url.PathEscape(id), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	f := &File{}
+	if err := json.NewDecoder(res.Body).Decode(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Search returns the files matching the query, first is the page size and
+// after the EndCursor of the previous page, zero values are the defaults
+func (c *Client) Search(ctx context.Context, query string, first int, after string) (*SearchResults, error) {
+	params := url.Values{"q": {query}}
+	if first > 0 {
+		params.Set("first", strconv.Itoa(first))
+	}
+	if after != "" {
+		params.Set("after", after)
+	}
+	res, err := c.do(ctx, c.get("/search?"+params.Encode()), true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	results := &SearchResults{}
+	if err := json.NewDecoder(res.Body).Decode(results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Move moves a file to another folder and or renames it, the returned file has the new ID.
+// It is not retried as the old ID is gone once the file moved
+func (c *Client) Move(ctx context.Context, id string, opts MoveOptions) (*File, error) {
+	body, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/files/"+url.PathEscape(id)+"/move", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	f := &File{}
+	if err := json.NewDecoder(res.Body).Decode(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (c *Client) get(path string) newRequest {
+	return func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	}
+}
+
+func sniffContentType(head []byte) string {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !acceptedTypes[contentType] {
+		return "application/octet-stream"
+	}
+
+	return contentType
+}
+
+type countingReader struct {
+	io.Reader
+	sent     *atomic.Int64
+	progress func(int64)
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	total := r.sent.Add(int64(n))
+	if r.progress != nil && n > 0 {
+		r.progress(total)
+	}
+	return n, err
+}
+
+// verifyingReader hashes the content as it is read and checks it at EOF
+type verifyingReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (r *verifyingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.hash.Write(b[:n])
+	if errors.Is(err, io.EOF) && !strings.EqualFold(hex.EncodeToString(r.hash.Sum(nil)), r.expected) {
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const singleUploadMutation = `mutation ($file: Upload!, $idempotencyKey: String, $metadata: [MetadataInput!], $tags: [String!]) {
+  singleUpload(file: $file, idempotencyKey: $idempotencyKey, metadata: $metadata, tags: $tags) {
+    ID Name Size ContentType Checksum CreateAt UserID Metadata { key value } Tags
+  }
+}`
+
+// GraphQLError is a single error returned by the GraphQL server
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// Code returns extensions.code, the same catalogue entry the REST API reports
+func (e GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// GraphQLErrors is returned when the response contains errors
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Message)
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// GraphQL runs a query or mutation and decodes the data field into out
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]any, out any) error {
+	body, err := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+	// queries are safe to retry, mutations might not be
+	retryable := !strings.HasPrefix(strings.TrimSpace(query), "mutation")
+	res, err := c.do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.graphQLURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, retryable)
+	if err != nil {
+		return err
+	}
+
+	return decodeGraphQL(res, out)
+}
+
+// SingleUpload uploads a file through the singleUpload mutation using the
+// GraphQL multipart request spec, it returns the stored file
+func (c *Client) SingleUpload(ctx context.Context, r io.Reader, opts UploadOptions) (*File, error) {
+	seeker, retryable := r.(io.ReadSeeker)
+	var start int64
+	if retryable {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ContentType == "" {
+		opts.ContentType = "application/octet-stream"
+	}
+	variables := map[string]any{"file": nil}
+	if opts.IdempotencyKey != "" {
+		variables["idempotencyKey"] = opts.IdempotencyKey
+	}
+	if len(opts.Metadata) > 0 {
+		metadata := make([]graphQLMetadata, 0, len(opts.Metadata))
+		for k, v := range opts.Metadata {
+			metadata = append(metadata, graphQLMetadata{Key: k, Value: v})
+		}
+		variables["metadata"] = metadata
+	}
+	if len(opts.Tags) > 0 {
+		variables["tags"] = opts.Tags
+	}
+	operations, err := json.Marshal(graphQLRequest{
+		Query:     singleUploadMutation,
+		Variables: variables,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(ctx, func(ctx context.Context) (*http.Request, error) {
+		if retryable {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		pr, pw := io.Pipe()
+		writer := multipart.NewWriter(pw)
+		go func() {
+			err := writer.WriteField("operations", string(operations))
+			if err == nil {
+				err = writer.WriteField("map", `{"0": ["variables.file"]}`)
+			}
+			var part io.Writer
+			if err == nil {
+				header := make(textproto.MIMEHeader)
+				header.Set("Content-Disposition", mime.FormatMediaType("form-data",
+					map[string]string{"name": "0", "filename": opts.FileName}))
+				header.Set("Content-Type", opts.ContentType)
+				part, err = writer.CreatePart(header)
+			}
+			if err == nil {
+				_, err = io.Copy(part, r)
+			}
+			if err == nil {
+				err = writer.Close()
+			}
+			_ = pw.CloseWithError(err)
+		}()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.graphQLURL, pr)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req, nil
+	}, retryable)
+	if err != nil {
+		return nil, err
+	}
+
+	out := struct {
+		SingleUpload graphQLFile `json:"singleUpload"`
+	}{}
+	if err := decodeGraphQL(res, &out); err != nil {
+		return nil, err
+	}
+
+	return out.SingleUpload.file()
+}
+
+// graphQLFile is the File type of the schema, which sends sizes and times as strings
+type graphQLFile struct {
+	ID          string            `json:"ID"`
+	Name        string            `json:"Name"`
+	Size        string            `json:"Size"`
+	ContentType string            `json:"ContentType"`
+	Checksum    string            `json:"Checksum"`
+	CreateAt    string            `json:"CreateAt"`
+	UserID      string            `json:"UserID"`
+	Metadata    []graphQLMetadata `json:"Metadata"`
+	Tags        []string          `json:"Tags"`
+}
+
+type graphQLMetadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (f graphQLFile) file() (*File, error) {
+	file := &File{
+		ID:          f.ID,
+		Name:        f.Name,
+		ContentType: f.ContentType,
+		Checksum:    f.Checksum,
+		UserID:      f.UserID,
+		Tags:        f.Tags,
+	}
+	for _, m := range f.Metadata {
+		if file.Metadata == nil {
+			file.Metadata = map[string]string{}
+		}
+		file.Metadata[m.Key] = m.Value
+	}
+	var err error
+	if f.Size != "" {
+		if file.Size, err = strconv.ParseInt(f.Size, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if f.CreateAt != "" {
+		if file.CreatedAt, err = time.Parse(time.RFC3339, f.CreateAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+func decodeGraphQL(res *http.Response, out any) error {
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	gqlRes := &graphQLResponse{}
+	if err := json.NewDecoder(res.Body).Decode(gqlRes); err != nil {
+		return err
+	}
+	if len(gqlRes.Errors) > 0 {
+		return gqlRes.Errors
+	}
+	if out == nil || len(gqlRes.Data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(gqlRes.Data, out)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// auditResult is printed by audit verify
+type auditResult struct {
+	Valid   bool   `json:"valid"`
+	Entries int64  `json:"entries"`
+	Head    string `json:"head"`
+	Error   string `json:"error,omitempty"`
+}
+
+// addAuditCommands adds the commands that read the audit log straight from storage,
+// they use the same STORAGE_* variables as the servers
+func addAuditCommands(root *cobra.Command, logger *logrus.Logger) {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log",
+	}
+	verifyCmd := &cobra.Command{
+		Use:          "verify",
+		Short:        "Check the hash chain of the audit log",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cf := storage.NewEnvConfig(logger)
+			client, err := storage.NewClient(cf)
+			if err != nil {
+				return err
+			}
+			bu := business.NewBucketUpload(client, cf.BucketName)
+			count, head, err := business.NewAudit(bu, logger).Verify(cmd.Context())
+			if err != nil && !errors.Is(err, business.ErrAuditTampered) {
+				return err
+			}
+
+			result := auditResult{Valid: err == nil, Entries: count, Head: head}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+				if err := printJSON(cmd.OutOrStdout(), result); err != nil {
+					return err
+				}
+			} else if err == nil {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "verified %d entries, head %s\n", count, head)
+			}
+			// the valid prefix is reported before failing
+			if err != nil {
+				return fmt.Errorf("%w after %d valid entries, head %s", err, count, head)
+			}
+			return nil
+		},
+	}
+
+	auditCmd.AddCommand(verifyCmd)
+	root.AddCommand(auditCmd)
+}
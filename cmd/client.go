@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/client"
+	"github.com/spf13/cobra"
+)
+
+const defaultServiceURL = "http://localhost:9091"
+
+// clientConfig is read from the config file and can be overridden
+// by INGESTION_URL, INGESTION_TOKEN and the matching flags
+type clientConfig struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+type clientFlags struct {
+	url        string
+	token      string
+	configPath string
+	jsonOutput bool
+}
+
+// uploadResult is printed for every path given to upload
+type uploadResult struct {
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+// addClientCommands adds the commands that talk to a running service
+func addClientCommands(root *cobra.Command) {
+	flags := &clientFlags{}
+	root.PersistentFlags().StringVar(&flags.url, "url", "", "ingestion service URL (env INGESTION_URL)")
+	root.PersistentFlags().StringVar(&flags.token, "token", "", "bearer token (env INGESTION_TOKEN)")
+	root.PersistentFlags().StringVar(&flags.configPath, "config", "", "client config file (default $XDG_CONFIG_HOME/ingestion/config.json)")
+	root.PersistentFlags().BoolVar(&flags.jsonOutput, "json", false, "print JSON output for scripting")
+
+	var recursive bool
+	uploadCmd := &cobra.Command{
+		Use:          "upload <paths...>",
+		Short:        "Upload files, globs or directories",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadClientConfig(flags)
+			if err != nil {
+				return err
+			}
+			paths, err := expandPaths(args, recursive)
+			if err != nil {
+				return err
+			}
+			c := newClient(cfg)
+			results := make([]uploadResult, 0, len(paths))
+			failed := 0
+			for _, path := range paths {
+				res := uploadResult{Path: path}
+				var size int64
+				if info, err := os.Stat(path); err == nil {
+					size = info.Size()
+				}
+				progress := flags.progress(path, size)
+				err := uploadFile(cmd.Context(), c, path, progress)
+				progress.Finish()
+				if err != nil {
+					res.Error = err.Error()
+					failed++
+				}
+				results = append(results, res)
+				if !flags.jsonOutput {
+					printUploadResult(cmd.OutOrStdout(), res)
+				}
+			}
+			if flags.jsonOutput {
+				if err := printJSON(cmd.OutOrStdout(), results); err != nil {
+					return err
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d uploads failed", failed, len(paths))
+			}
+			return nil
+		},
+	}
+	uploadCmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "upload directories recursively")
+
+	lsCmd := &cobra.Command{
+		Use:          "ls",
+		Short:        "List uploaded files",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadClientConfig(flags)
+			if err != nil {
+				return err
+			}
+			files, err := newClient(cfg).List(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if flags.jsonOutput {
+				return printJSON(cmd.OutOrStdout(), files)
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "ID\tNAME\tSIZE\tTYPE\tCREATED")
+			for _, f := range files {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.ID, f.Name,
+					humanBytes(f.Size), f.ContentType, f.CreatedAt.Format(time.RFC3339))
+			}
+			return tw.Flush()
+		},
+	}
+
+	var output string
+	getCmd := &cobra.Command{
+		Use:          "get <id>",
+		Short:        "Download a file",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadClientConfig(flags)
+			if err != nil {
+				return err
+			}
+			file, body, err := newClient(cfg).Download(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = body.Close()
+			}()
+			if output == "" {
+				output = business.SanitizeFilename(file.Name)
+				// names made only of separators and dots sanitize to "."
+				if output == "." {
+					output = business.SanitizeFilename(path.Base(args[0]))
+				}
+			}
+			// the summary must not end up in the file bytes piped to stdout
+			summary := cmd.OutOrStdout()
+			progress := flags.progress(output, file.Size)
+			if output == "-" {
+				summary = cmd.ErrOrStderr()
+				_, err = io.Copy(progress.Writer(cmd.OutOrStdout()), body)
+			} else {
+				err = writeFile(output, body, progress.Writer)
+			}
+			if err != nil {
+				return err
+			}
+			progress.Finish()
+			if flags.jsonOutput {
+				return printJSON(summary, map[string]any{"id": args[0], "path": output, "size": file.Size})
+			}
+			return nil
+		},
+	}
+	getCmd.Flags().StringVarP(&output, "output", "o", "", "file to write to, - for stdout with the --json summary on stderr (default original file name)")
+
+	rmCmd := &cobra.Command{
+		Use:          "rm <id...>",
+		Short:        "Delete files",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadClientConfig(flags)
+			if err != nil {
+				return err
+			}
+			c := newClient(cfg)
+			deleted := make([]string, 0, len(args))
+			for _, id := range args {
+				if err := c.Delete(cmd.Context(), id); err != nil {
+					return fmt.Errorf("failed to delete %s: %w", id, err)
+				}
+				deleted = append(deleted, id)
+				if !flags.jsonOutput {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "deleted %s\n", id)
+				}
+			}
+			if flags.jsonOutput {
+				return printJSON(cmd.OutOrStdout(), map[string][]string{"deleted": deleted})
+			}
+			return nil
+		},
+	}
+
+	root.AddCommand(uploadCmd, lsCmd, getCmd, rmCmd)
+}
+
+func newClient(cfg clientConfig) *client.Client {
+	return client.New(cfg.URL, client.WithToken(cfg.Token))
+}
+
+// writeFile copies body to the file at path through wrap, the file is removed
+// when the copy fails so no partial download is left behind
+func writeFile(path string, body io.Reader, wrap func(io.Writer) io.Writer) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+	_, err = io.Copy(wrap(f), body)
+
+	return err
+}
+
+func uploadFile(ctx context.Context, c *client.Client, path string, progress *progressBar) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	_, err = c.Upload(ctx, f, client.UploadOptions{
+		FileName: filepath.Base(path),
+		Progress: progress.Set,
+	})
+
+	return err
+}
+
+// progress returns a bar drawn on stderr, or one that draws nowhere
+// when the output is meant for scripts
+func (f *clientFlags) progress(label string, total int64) *progressBar {
+	if f.jsonOutput {
+		return newProgressBar(io.Discard, label, total)
+	}
+	return newProgressBar(os.Stderr, label, total)
+}
+
+// loadClientConfig merges the config file, environment and flags,
+// later sources win
+func loadClientConfig(flags *clientFlags) (clientConfig, error) {
+	cfg := clientConfig{URL: defaultServiceURL}
+	path := flags.configPath
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "ingestion", "config.json")
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+		case errors.Is(err, os.ErrNotExist) && flags.configPath == "":
+			// the default config file is optional
+		default:
+			return cfg, err
+		}
+	}
+	if v := os.Getenv("INGESTION_URL"); v != "" {
+		cfg.URL = v
+	}
+	if v := os.Getenv("INGESTION_TOKEN"); v != "" {
+		cfg.Token = v
+	}
+	if flags.url != "" {
+		cfg.URL = flags.url
+	}
+	if flags.token != "" {
+		cfg.Token = flags.token
+	}
+	if cfg.Token == "" {
+		return cfg, errors.New("no token, use --token, INGESTION_TOKEN or the config file")
+	}
+	return cfg, nil
+}
+
+// expandPaths resolves globs and, when recursive is set, walks directories
+func expandPaths(args []string, recursive bool) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			matches, err = filepath.Glob(arg)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				paths = append(paths, match)
+				continue
+			}
+			if !recursive {
+				return nil, fmt.Errorf("%s is a directory, use -r to upload it", match)
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					paths = append(paths, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return paths, nil
+}
+
+func printUploadResult(w io.Writer, res uploadResult) {
+	if res.Error != "" {
+		_, _ = fmt.Fprintf(w, "failed %s: %s\n", res.Path, res.Error)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "uploaded %s\n", res.Path)
+}
+
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/riyadennis/identity-server/app/proto/identity"
 	"github.com/riyadennis/ingestion-service/business"
 	"github.com/riyadennis/ingestion-service/graph"
+	"github.com/riyadennis/ingestion-service/rest"
+	"github.com/riyadennis/ingestion-service/rpc"
 	"github.com/riyadennis/ingestion-service/server"
 	"github.com/riyadennis/ingestion-service/storage"
 	"github.com/sirupsen/logrus"
@@ -17,28 +22,16 @@ import (
 func main() {
 	logger := logrus.New()
 	logger.SetLevel(logrus.DebugLevel)
-	cf := storage.NewEnvConfig(logger)
-	ctx := context.Background()
-
-	client, err := storage.NewClient(cf)
-	if err != nil {
-		logger.Fatalf("failed to initialise storage client: %v", err)
-	}
 
-	err = cf.MakeBucket(ctx, client)
-	if err != nil {
-		logger.Fatalf("failed to make bucket: %v", err)
-	}
-	bu := business.NewBucketUpload(client, cf.BucketName)
-	identityClient, err := business.IdentityClient(os.Getenv("IDENTITY_URL"))
-	if err != nil {
-		logger.Fatalf("failed to create identity gRPC client: %v", err)
-	}
-	rootCommand := cobra.Command{Use: "ingestion"}
+	rootCommand := cobra.Command{Use: "ingestion", SilenceErrors: true}
 	restCmd := &cobra.Command{
 		Use:   "rest-server",
 		Short: "Start REST server",
 		Run: func(cmd *cobra.Command, args []string) {
+			defer tracing(logger)()
+			deps := serverDependencies(logger)
+			defer flushAudit(logger, deps.bu)
+			go runAdmin(logger, deps)
 			restServer, err := server.NewServer(os.Getenv("REST_PORT"))
 			if err != nil {
 				logger.Fatalf("failed to initialise server: %v", err)
@@ -47,7 +40,7 @@ func main() {
 
 			signal.Notify(restServer.ShutDown, os.Interrupt, syscall.SIGTERM)
 
-			err = restServer.Run(logger, bu, identityClient)
+			err = restServer.Run(logger, deps.bu, deps.auth, deps.links)
 			if err != nil {
 				logger.Fatalf("failed to rest start server: %v", err)
 			}
@@ -57,24 +50,259 @@ func main() {
 		Use:   "gql-server",
 		Short: "Start graphQL server",
 		Run: func(cmd *cobra.Command, args []string) {
+			defer tracing(logger)()
+			deps := serverDependencies(logger)
+			defer flushAudit(logger, deps.bu)
+			go runAdmin(logger, deps)
 			gqlServer := graph.NewServer(
 				logger,
-				business.NewBucketUpload(client, cf.BucketName),
-				identityClient,
+				deps.bu,
+				deps.auth,
+				deps.links,
 				os.Getenv("GQL_PORT"),
 			)
 			signal.Notify(gqlServer.ShutDown, os.Interrupt, syscall.SIGTERM)
-			err = gqlServer.Start(os.Getenv("GQL_PORT"))
+			err := gqlServer.Run()
+			if err != nil {
+				logger.Fatalf("failed to run graphQL server: %v", err)
+			}
+		},
+	}
+
+	grpcCmd := &cobra.Command{
+		Use:   "grpc-server",
+		Short: "Start gRPC server",
+		Run: func(cmd *cobra.Command, args []string) {
+			defer tracing(logger)()
+			deps := serverDependencies(logger)
+			defer flushAudit(logger, deps.bu)
+			go runAdmin(logger, deps)
+			grpcServer, err := rpc.NewServer(logger, deps.bu, deps.auth, os.Getenv("GRPC_PORT"))
+			if err != nil {
+				logger.Fatalf("failed to initialise gRPC server: %v", err)
+			}
+			signal.Notify(grpcServer.ShutDown, os.Interrupt, syscall.SIGTERM)
+			err = grpcServer.Run()
 			if err != nil {
-				logger.Fatalf("failed to start graphQL server: %v", err)
+				logger.Fatalf("failed to run gRPC server: %v", err)
 			}
-			<-gqlServer.ShutDown
 		},
 	}
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Start REST, graphQL and admin servers in one process",
+		Run: func(cmd *cobra.Command, args []string) {
+			defer tracing(logger)()
+			deps := serverDependencies(logger)
+			defer flushAudit(logger, deps.bu)
+			group := server.NewGroup(logger)
 
-	rootCommand.AddCommand(restCmd, gqlCmd)
-	err = rootCommand.Execute()
+			restServer, err := server.NewServer(os.Getenv("REST_PORT"))
+			if err != nil {
+				logger.Fatalf("failed to initialise server: %v", err)
+			}
+			group.Add("rest-server", func() error {
+				return restServer.Run(logger, deps.bu, deps.auth, deps.links)
+			}, restServer.ShutDown)
+
+			gqlServer := graph.NewServer(logger, deps.bu, deps.auth, deps.links, os.Getenv("GQL_PORT"))
+			group.Add("gql-server", gqlServer.Run, gqlServer.ShutDown)
+
+			if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+				grpcServer, err := rpc.NewServer(logger, deps.bu, deps.auth, grpcPort)
+				if err != nil {
+					logger.Fatalf("failed to initialise gRPC server: %v", err)
+				}
+				group.Add("grpc-server", grpcServer.Run, grpcServer.ShutDown)
+			}
+
+			// the admin server is optional, probes are also served on the REST port
+			if adminServer, run := newAdminServer(logger, deps); adminServer != nil {
+				group.Add("admin-server", run, adminServer.ShutDown)
+			}
+
+			signal.Notify(group.ShutDown, os.Interrupt, syscall.SIGTERM)
+			err = group.Run()
+			if err != nil {
+				logger.Fatalf("failed to run servers: %v", err)
+			}
+		},
+	}
+
+	rootCommand.AddCommand(restCmd, gqlCmd, grpcCmd, serveCmd)
+	addClientCommands(&rootCommand)
+	addAuditCommands(&rootCommand, logger)
+	err := rootCommand.Execute()
 	if err != nil {
-		logger.Fatalf("failed to run servers: %v", err)
+		logger.Fatalf("failed to run command: %v", err)
+	}
+}
+
+// dependencies are shared by the servers of a command
+type dependencies struct {
+	bu    *business.BucketUpload
+	auth  business.Authenticator
+	links *business.Links
+	keys  *business.APIKeys
+}
+
+// serverDependencies connects to storage and sets up the authenticator
+// picked by AUTH_MODE, API keys are accepted whatever the mode and
+// permissions come from the policy, only the server commands need them.
+// Search and cleanup are started here so every server command runs them
+func serverDependencies(logger *logrus.Logger) *dependencies {
+	cf := storage.NewEnvConfig(logger)
+	ctx := context.Background()
+
+	client, err := storage.NewClient(cf)
+	if err != nil {
+		logger.Fatalf("failed to initialise storage client: %v", err)
+	}
+
+	err = cf.MakeBucket(ctx, client)
+	if err != nil {
+		logger.Fatalf("failed to make bucket: %v", err)
+	}
+	business.DefaultHealth.Register("storage", business.BucketCheck(client, cf.BucketName))
+	// uploads are staged in the working directory and resumable ones in the temp directory
+	business.DefaultHealth.Register("disk", business.NewEnvDiskSpaceCheck(".", os.TempDir()))
+
+	auth, err := business.NewEnvAuthenticator(func() (identity.IdentityClient, error) {
+		conn, err := business.IdentityConn(os.Getenv("IDENTITY_URL"))
+		if err != nil {
+			return nil, err
+		}
+		business.DefaultHealth.Register("identity", business.GRPCConnCheck(conn))
+		return business.NewCachedIdentityClient(business.NewInstrumentedIdentityClient(identity.NewIdentityClient(conn)),
+			business.NewEnvCacheConfig()), nil
+	})
+	if err != nil {
+		logger.Fatalf("failed to set up authentication: %v", err)
+	}
+	// rotated signing keys are picked up without waiting for a token using them
+	if jwtAuth, ok := auth.(*business.JWTAuthenticator); ok {
+		go jwtAuth.RefreshEvery(ctx, logger)
+	}
+
+	policy, err := business.NewEnvPolicy()
+	if err != nil {
+		logger.Fatalf("failed to load policy: %v", err)
+	}
+
+	bu := business.NewBucketUpload(client, cf.BucketName)
+	bu.Audit = business.NewAudit(bu, logger)
+	keys := business.NewAPIKeys(bu)
+	auth = business.NewAPIKeyAuthenticator(auth, keys)
+
+	secret := []byte(os.Getenv("LINK_SECRET"))
+	if len(secret) == 0 {
+		logger.Warn("LINK_SECRET is not set, share links will stop working on restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logger.Fatalf("failed to generate link secret: %v", err)
+		}
+	}
+	links := business.NewLinks(bu, secret, os.Getenv("PUBLIC_URL"))
+	enableSearch(logger, bu)
+	go cleanup(logger, bu)
+
+	return &dependencies{
+		bu:    bu,
+		auth:  business.NewPolicyAuthenticator(auth, policy),
+		links: links,
+		keys:  keys,
+	}
+}
+
+// flushAudit stores the audit entries still queued once the servers stopped
+func flushAudit(logger *logrus.Logger, bu *business.BucketUpload) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := bu.Audit.Flush(ctx); err != nil {
+		logger.Errorf("failed to store audit entries: %v", err)
+	}
+}
+
+// tracing sets up the exporter picked by OTEL_TRACES_EXPORTER,
+// the returned function flushes the spans left
+func tracing(logger *logrus.Logger) func() {
+	shutdown, err := business.NewEnvTracerProvider(context.Background(), "ingestion-service")
+	if err != nil {
+		logger.Fatalf("failed to set up tracing: %v", err)
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			logger.Errorf("failed to flush spans: %v", err)
+		}
+	}
+}
+
+// newAdminServer sets up the server for probes, metrics and API key management
+// on ADMIN_PORT, it returns nil when the port is not set
+func newAdminServer(logger *logrus.Logger, deps *dependencies) (*server.Server, func() error) {
+	adminPort := os.Getenv("ADMIN_PORT")
+	if adminPort == "" {
+		return nil, nil
+	}
+	adminServer, err := server.NewServer(adminPort)
+	if err != nil {
+		logger.Fatalf("failed to initialise admin server: %v", err)
+	}
+
+	return adminServer, func() error {
+		return adminServer.RunHandler(logger, rest.LoadAdminEndpoints(logger, deps.keys, deps.bu.Audit, deps.bu.Index, os.Getenv("ADMIN_TOKEN")))
+	}
+}
+
+// runAdmin runs the admin server next to a single server command
+func runAdmin(logger *logrus.Logger, deps *dependencies) {
+	adminServer, run := newAdminServer(logger, deps)
+	if adminServer == nil {
+		return
+	}
+	signal.Notify(adminServer.ShutDown, os.Interrupt, syscall.SIGTERM)
+	if err := run(); err != nil {
+		logger.Errorf("admin server stopped: %v", err)
+	}
+}
+
+// enableSearch indexes the files in the background and rebuilds the index
+// every SEARCH_REINDEX_INTERVAL, an hour by default, to pick up files stored
+// by other replicas
+func enableSearch(logger *logrus.Logger, bu *business.BucketUpload) {
+	interval, err := time.ParseDuration(os.Getenv("SEARCH_REINDEX_INTERVAL"))
+	if err != nil || interval <= 0 {
+		if os.Getenv("SEARCH_REINDEX_INTERVAL") != "" {
+			logger.Warnf("invalid SEARCH_REINDEX_INTERVAL, rebuilding the search index every hour")
+		}
+		interval = time.Hour
+	}
+	bu.Index = business.NewSearchIndex(bu, logger)
+	go func() {
+		count, err := bu.Index.Reindex(context.Background())
+		if err != nil {
+			logger.Errorf("failed to build search index: %v", err)
+		} else {
+			logger.Infof("indexed %d files for search", count)
+		}
+		bu.Index.ReindexEvery(context.Background(), interval)
+	}()
+}
+
+// cleanup removes abandoned resumable and presigned uploads, expired idempotency keys
+// and exports every CLEANUP_INTERVAL, an hour by default
+func cleanup(logger *logrus.Logger, bu *business.BucketUpload) {
+	interval, err := time.ParseDuration(os.Getenv("CLEANUP_INTERVAL"))
+	if err != nil || interval <= 0 {
+		if os.Getenv("CLEANUP_INTERVAL") != "" {
+			logger.Warnf("invalid CLEANUP_INTERVAL, cleaning up every hour")
+		}
+		interval = time.Hour
 	}
+	business.CleanupEvery(context.Background(), interval, logger,
+		business.NewTus(bu), business.NewEnvIdempotentUploads(bu), business.NewExports(bu, nil, logger),
+		business.NewPresignCleaner(bu))
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const progressWidth = 30
+
+// progressBar draws the progress of a transfer on a single terminal line
+type progressBar struct {
+	out      io.Writer
+	label    string
+	total    int64
+	current  int64
+	lastDraw time.Time
+}
+
+func newProgressBar(out io.Writer, label string, total int64) *progressBar {
+	return &progressBar{
+		out:   out,
+		label: label,
+		total: total,
+	}
+}
+
+// Writer wraps w so that every write advances the bar
+func (p *progressBar) Writer(w io.Writer) io.Writer {
+	return &progressWriter{Writer: w, bar: p}
+}
+
+func (p *progressBar) add(n int) {
+	p.Set(p.current + int64(n))
+}
+
+// Set moves the bar to the number of bytes transferred so far
+func (p *progressBar) Set(current int64) {
+	p.current = current
+	// redrawing on every read floods slow terminals
+	if time.Since(p.lastDraw) < 100*time.Millisecond {
+		return
+	}
+	p.draw()
+}
+
+// Finish draws the final state and moves to the next line
+func (p *progressBar) Finish() {
+	p.draw()
+	_, _ = fmt.Fprintln(p.out)
+}
+
+func (p *progressBar) draw() {
+	p.lastDraw = time.Now()
+	if p.total <= 0 {
+		_, _ = fmt.Fprintf(p.out, "\r%-30s %s", p.label, humanBytes(p.current))
+		return
+	}
+	done := p.current
+	if done > p.total {
+		done = p.total
+	}
+	filled := int(done * progressWidth / p.total)
+	bar := strings.Repeat("=", filled)
+	if filled < progressWidth {
+		bar += ">" + strings.Repeat(" ", progressWidth-filled-1)
+	}
+	_, _ = fmt.Fprintf(p.out, "\r%-30s [%s] %3d%% %s/%s",
+		p.label, bar, done*100/p.total, humanBytes(done), humanBytes(p.total))
+}
+
+type progressWriter struct {
+	io.Writer
+	bar *progressBar
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.bar.add(n)
+	return n, err
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
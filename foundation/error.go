@@ -1,17 +1,121 @@
 package foundation
 
+import (
+	"errors"
+	"net/http"
+)
+
+// Error codes are part of the API, clients branch on them so they never change
 const (
 	// InvalidRequest is returned if the request is not valid
 	InvalidRequest = "invalid-request"
+	// Unauthenticated is returned when the credentials are missing or not accepted
+	Unauthenticated = "unauthenticated"
+	// PasswordRequired is returned when a share link password is missing or wrong
+	PasswordRequired = "password-required"
+	// Forbidden is returned when the caller lacks the permission
+	Forbidden = "forbidden"
+	// NotFound is returned for missing files, links and uploads, and for those of other users
+	NotFound = "not-found"
+	// Conflict is returned when the resource is not in a state allowing the request
+	Conflict = "conflict"
+	// Expired is returned for links and uploads past their expiry or limits
+	Expired = "expired"
+	// LengthRequired is returned when the request needs a Content-Length
+	LengthRequired = "length-required"
+	// PreconditionFailed is returned when a protocol precondition does not hold
+	PreconditionFailed = "precondition-failed"
+	// TooLarge is returned for files over the size limit
+	TooLarge = "too-large"
+	// QuotaExceeded is returned when a file does not fit in what is left of a limit
+	QuotaExceeded = "quota-exceeded"
+	// UnsupportedType is returned for content types which can not be uploaded
+	UnsupportedType = "unsupported-type"
+	// ChecksumMismatch is returned when the content does not match the checksum sent
+	ChecksumMismatch = "checksum-mismatch"
+	// IdempotencyConflict is returned when an idempotency key is reused for a different file
+	IdempotencyConflict = "idempotency-conflict"
+	// UploadRejected is returned when an uploaded object breaks the constraints it was presigned with
+	UploadRejected = "upload-rejected"
+	// Locked is returned while another request holds the resource
+	Locked = "locked"
+	// Timeout is returned when the request took longer than allowed
+	Timeout = "timeout"
+	// NotImplemented is returned when the configured storage lacks a feature
+	NotImplemented = "not-implemented"
+	// StorageUnavailable is returned when the object storage can not be reached, retrying may help
+	StorageUnavailable = "storage-unavailable"
+	// Unavailable is returned while the service is shutting down
+	Unavailable = "unavailable"
+	// Internal is returned for failures the client can not do anything about
+	Internal = "internal"
 )
 
+// statuses maps every code to the HTTP status it is served with
+var statuses = map[string]int{
+	InvalidRequest:      http.StatusBadRequest,
+	Unauthenticated:     http.StatusUnauthorized,
+	PasswordRequired:    http.StatusUnauthorized,
+	Forbidden:           http.StatusForbidden,
+	NotFound:            http.StatusNotFound,
+	Conflict:            http.StatusConflict,
+	Expired:             http.StatusGone,
+	LengthRequired:      http.StatusLengthRequired,
+	PreconditionFailed:  http.StatusPreconditionFailed,
+	TooLarge:            http.StatusRequestEntityTooLarge,
+	QuotaExceeded:       http.StatusRequestEntityTooLarge,
+	UnsupportedType:     http.StatusUnsupportedMediaType,
+	ChecksumMismatch:    http.StatusBadRequest,
+	IdempotencyConflict: http.StatusUnprocessableEntity,
+	UploadRejected:      http.StatusUnprocessableEntity,
+	Locked:              http.StatusLocked,
+	Timeout:             http.StatusRequestTimeout,
+	NotImplemented:      http.StatusNotImplemented,
+	StorageUnavailable:  http.StatusServiceUnavailable,
+	Unavailable:         http.StatusServiceUnavailable,
+	Internal:            http.StatusInternalServerError,
+}
+
+// Status returns the HTTP status of a code, unknown codes are internal errors
+func Status(code string) int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
 // CustomError holds error code and details about the error
 type CustomError struct {
 	Code string
 	Err  error
 }
 
+// NewError returns an error with a code from the catalogue, declare them as
+// package variables so callers can match them with errors.Is
+func NewError(code, message string) *CustomError {
+	return &CustomError{Code: code, Err: errors.New(message)}
+}
+
 // Error returns just the error message for a custom error
 func (e *CustomError) Error() string {
 	return e.Err.Error()
 }
+
+func (e *CustomError) Unwrap() error {
+	return e.Err
+}
+
+// AsCustomError returns the first error in the chain of err carrying a code
+func AsCustomError(err error) (*CustomError, bool) {
+	var ce *CustomError
+	ok := errors.As(err, &ce)
+	return ce, ok
+}
+
+// Code returns the code of err, errors without one are internal
+func Code(err error) string {
+	if ce, ok := AsCustomError(err); ok {
+		return ce.Code
+	}
+	return Internal
+}
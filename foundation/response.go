@@ -3,39 +3,68 @@ package foundation
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ProblemContentType is the media type of error responses, RFC 7807
+	ProblemContentType = "application/problem+json"
+
+	// problemTypePrefix makes every code a problem type URI
+	problemTypePrefix = "urn:ingestion-service:problem:"
 )
 
-// Response is the response structure for error messages
-// and success messages
-type Response struct {
+/*
+Problem is the RFC 7807 body of error responses
+  - Code is the entry of the error catalogue, Type is the same as a URI
+  - RequestID and TraceID let operators find the request in logs and traces
+*/
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
 	Status    int    `json:"status"`
-	Message   string `json:"message"`
-	ErrorCode string `json:"error-code"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+	TraceID   string `json:"traceId,omitempty"`
 }
 
-// ErrorResponse give details to the user about the error that occurred
-func ErrorResponse(w http.ResponseWriter, code int, errr error, customCode string) {
-	w.Header().Set("Content-Type", "application/json")
-	_ = JSONResponse(w, code, errr.Error(), customCode)
+// ErrorResponse gives details to the user about the error that occurred,
+// the status comes from the code of err, errors without a code are not
+// described to the client
+func ErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	ProblemResponse(w, r, Status(Code(err)), err)
 }
 
-// JSONResponse converts response into a json
-func JSONResponse(w http.ResponseWriter, status int, message, errCode string) error {
-	w.Header().Set("Content-Type", "application/json")
+// ProblemResponse is ErrorResponse with a status set by a protocol rather than the catalogue
+func ProblemResponse(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.Header().Set("Content-Type", ProblemContentType)
 	w.WriteHeader(status)
-	res := NewResponse(status, message, errCode)
-	err := json.NewEncoder(w).Encode(res)
-	if err != nil {
-		return err
-	}
-	return nil
+	_ = json.NewEncoder(w).Encode(NewProblem(r, status, err))
 }
 
-// NewResponse creates an instance of the response structure
-func NewResponse(status int, message, errCode string) *Response {
-	return &Response{
-		Status:    status,
-		Message:   message,
-		ErrorCode: errCode,
+// NewProblem describes err, the detail is the message of its code rather than
+// the errors wrapped around or inside it
+func NewProblem(r *http.Request, status int, err error) *Problem {
+	code, detail := Internal, http.StatusText(http.StatusInternalServerError)
+	if ce, ok := AsCustomError(err); ok {
+		code, detail = ce.Code, ce.Err.Error()
+	}
+	problem := &Problem{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
 	}
+	problem.RequestID = middleware.GetReqID(r.Context())
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		problem.TraceID = sc.TraceID().String()
+	}
+
+	return problem
 }
@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"context"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/riyadennis/ingestion-service/graph/model"
+)
+
+var (
+	errUnauthenticated = foundation.NewError(foundation.Unauthenticated, "failed to authenticate the user")
+	errForbidden       = foundation.NewError(foundation.Forbidden, "not allowed to perform this action")
+)
+
+// HasPermission implements the @hasPermission directive, it checks the
+// permissions granted to the principal by the policy
+func HasPermission(ctx context.Context, _ any, next graphql.Resolver, permission model.Permission) (any, error) {
+	p, ok := business.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	if !p.Can(businessPermission(permission)) {
+		return nil, errForbidden
+	}
+
+	return next(ctx)
+}
+
+// businessPermission maps READ_OWN to read-own
+func businessPermission(p model.Permission) business.Permission {
+	return business.Permission(strings.ReplaceAll(strings.ToLower(string(p)), "_", "-"))
+}
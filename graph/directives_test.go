@@ -0,0 +1,117 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAuthenticator resolves tokens to fixed principals
+type stubAuthenticator map[string]*business.Principal
+
+func (s stubAuthenticator) Authenticate(_ context.Context, token string) (*business.Principal, error) {
+	p, ok := s[token]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return p, nil
+}
+
+func uploadRequest(t *testing.T, token string) *http.Request {
+	t.Helper()
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	require.NoError(t, w.WriteField("operations",
+		`{"query":"mutation($file: Upload!) { singleUpload(file: $file) { ID } }","variables":{"file":null}}`))
+	require.NoError(t, w.WriteField("map", `{"0":["variables.file"]}`))
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="0"; filename="a.jpeg"`)
+	h.Set("Content-Type", "image/jpeg")
+	part, err := w.CreatePart(h)
+	require.NoError(t, err)
+	_, err = part.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/graphql", body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func queryRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/graphql",
+		strings.NewReader(`{"query":"{ FetchFile(Name: \"a.jpeg\") { Size } }"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestHasPermission(t *testing.T) {
+	auth := stubAuthenticator{
+		"viewer":   {UserID: "viewer", Permissions: []business.Permission{business.PermissionReadOwn}},
+		"uploader": {UserID: "uploader", Permissions: []business.Permission{business.PermissionUpload}},
+		"admin":    {UserID: "admin", Permissions: []business.Permission{business.PermissionAdmin}},
+	}
+	s := NewServer(logrus.New(), business.NewBucketUpload(storagetest.NewMemory(), "test"), auth, nil, "0")
+	handler := s.Server.(*http.Server).Handler
+
+	scenarios := []struct {
+		name      string
+		request   func(token string) *http.Request
+		token     string
+		forbidden bool
+	}{
+		{
+			name:      "singleUpload without upload",
+			request:   func(token string) *http.Request { return uploadRequest(t, token) },
+			token:     "viewer",
+			forbidden: true,
+		},
+		{
+			name:    "singleUpload with upload",
+			request: func(token string) *http.Request { return uploadRequest(t, token) },
+			token:   "uploader",
+		},
+		{
+			name:    "singleUpload as admin",
+			request: func(token string) *http.Request { return uploadRequest(t, token) },
+			token:   "admin",
+		},
+		{
+			name:      "FetchFile without read-own",
+			request:   queryRequest,
+			token:     "uploader",
+			forbidden: true,
+		},
+		{
+			name:    "FetchFile with read-own",
+			request: queryRequest,
+			token:   "viewer",
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, scenario.request(scenario.token))
+			require.Equal(t, http.StatusOK, w.Code)
+			if scenario.forbidden {
+				assert.Contains(t, w.Body.String(), errForbidden.Error())
+				return
+			}
+			assert.NotContains(t, w.Body.String(), errForbidden.Error())
+		})
+	}
+}
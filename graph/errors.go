@@ -0,0 +1,53 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+var (
+	errLinksDisabled = foundation.NewError(foundation.NotImplemented, "share links are not enabled")
+	errShuttingDown  = foundation.NewError(foundation.Unavailable, "shutting down")
+	errInternal      = foundation.NewError(foundation.Internal, "internal server error")
+)
+
+/*
+presentError sets extensions.code to the code of the REST error catalogue
+  - Coded errors keep their own message, not the errors wrapped around or inside them
+  - Errors gqlgen raised about the request keep their message, and their code when they have one
+  - Anything else is logged and reported as internal, or as storage-unavailable
+*/
+func presentError(logger *logrus.Logger) graphql.ErrorPresenterFunc {
+	return func(ctx context.Context, err error) *gqlerror.Error {
+		gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+		var requestErr *gqlerror.Error
+		code := ""
+		if ce, ok := foundation.AsCustomError(err); ok {
+			gqlErr.Message, code = ce.Err.Error(), ce.Code
+		} else if errors.As(err, &requestErr) {
+			if _, ok := gqlErr.Extensions["code"]; ok {
+				return gqlErr
+			}
+			code = foundation.InvalidRequest
+		} else {
+			logger.Errorf("graphQL operation failed: %v", err)
+			internal := errInternal
+			if business.IsStorageUnavailable(err) {
+				internal = business.ErrStorageUnavailable
+			}
+			gqlErr.Message, code = internal.Err.Error(), internal.Code
+		}
+		if gqlErr.Extensions == nil {
+			gqlErr.Extensions = map[string]any{}
+		}
+		gqlErr.Extensions["code"] = code
+
+		return gqlErr
+	}
+}
@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestPresentError(t *testing.T) {
+	scenarios := []struct {
+		name            string
+		err             error
+		expectedMessage string
+		expectedCode    any
+	}{
+		{
+			name:            "coded error",
+			err:             fmt.Errorf("resolver: %w", errLinksDisabled),
+			expectedMessage: "share links are not enabled",
+			expectedCode:    foundation.NotImplemented,
+		},
+		{
+			name:            "business error",
+			err:             business.ErrShareExpired,
+			expectedMessage: business.ErrShareExpired.Err.Error(),
+			expectedCode:    foundation.Expired,
+		},
+		{
+			name:            "invalid request",
+			err:             &gqlerror.Error{Message: "missing argument"},
+			expectedMessage: "missing argument",
+			expectedCode:    foundation.InvalidRequest,
+		},
+		{
+			name: "request error with a code",
+			err: &gqlerror.Error{
+				Message:    "cannot parse query",
+				Extensions: map[string]any{"code": "GRAPHQL_PARSE_FAILED"},
+			},
+			expectedMessage: "cannot parse query",
+			expectedCode:    "GRAPHQL_PARSE_FAILED",
+		},
+		{
+			name:            "unexpected error",
+			err:             errors.New("connection reset by peer"),
+			expectedMessage: "internal server error",
+			expectedCode:    foundation.Internal,
+		},
+	}
+	presenter := presentError(logrus.New())
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			gqlErr := presenter(context.Background(), sc.err)
+			assert.Equal(t, sc.expectedMessage, gqlErr.Message)
+			assert.Equal(t, sc.expectedCode, gqlErr.Extensions["code"])
+		})
+	}
+}
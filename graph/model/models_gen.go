@@ -2,17 +2,141 @@
 
 package model
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
 type File struct {
-	Size     *string `json:"Size,omitempty"`
-	CreateAt *string `json:"CreateAt,omitempty"`
-	UserID   *string `json:"UserID,omitempty"`
-	Content  *string `json:"Content,omitempty"`
+	ID          *string     `json:"ID,omitempty"`
+	Name        *string     `json:"Name,omitempty"`
+	Size        *string     `json:"Size,omitempty"`
+	ContentType *string     `json:"ContentType,omitempty"`
+	Checksum    *string     `json:"Checksum,omitempty"`
+	CreateAt    *string     `json:"CreateAt,omitempty"`
+	UserID      *string     `json:"UserID,omitempty"`
+	Content     *string     `json:"Content,omitempty"`
+	Metadata    []*Metadata `json:"Metadata,omitempty"`
+	Tags        []string    `json:"Tags,omitempty"`
+	Folder      *string     `json:"Folder,omitempty"`
+}
+
+// A folder of the caller, the root has an empty path. Files and children are loaded when they are asked for, at any depth.
+type Folder struct {
+	Path      string  `json:"path"`
+	Name      string  `json:"name"`
+	CreatedAt *string `json:"createdAt,omitempty"`
+}
+
+// A key and value the client stored with a file.
+type Metadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Keys are letters, digits and hyphens, a null value removes the key when updating.
+type MetadataInput struct {
+	Key   string  `json:"key"`
+	Value *string `json:"value,omitempty"`
 }
 
 // The `Mutation` type, represents all updates we can make to our data.
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor,omitempty"`
+}
+
 // The `Query` type, represents all of the entry points into our object graph.
 type Query struct {
 }
+
+// Files matching a search, best matches first.
+type SearchConnection struct {
+	Edges      []*SearchEdge `json:"edges"`
+	PageInfo   *PageInfo     `json:"pageInfo"`
+	TotalCount int           `json:"totalCount"`
+}
+
+type SearchEdge struct {
+	Cursor string  `json:"cursor"`
+	Score  float64 `json:"score"`
+	Node   *File   `json:"node"`
+}
+
+// A signed link to a file which works without an account, url is relative when PUBLIC_URL is not set.
+type ShareLink struct {
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	ExpiresAt         string `json:"expiresAt"`
+	MaxDownloads      *int   `json:"maxDownloads,omitempty"`
+	PasswordProtected bool   `json:"passwordProtected"`
+}
+
+// Actions a user can be allowed to perform, see the policy file.
+type Permission string
+
+const (
+	PermissionUpload    Permission = "UPLOAD"
+	PermissionReadOwn   Permission = "READ_OWN"
+	PermissionReadAll   Permission = "READ_ALL"
+	PermissionDeleteOwn Permission = "DELETE_OWN"
+	PermissionDeleteAny Permission = "DELETE_ANY"
+	PermissionAdmin     Permission = "ADMIN"
+)
+
+var AllPermission = []Permission{
+	PermissionUpload,
+	PermissionReadOwn,
+	PermissionReadAll,
+	PermissionDeleteOwn,
+	PermissionDeleteAny,
+	PermissionAdmin,
+}
+
+func (e Permission) IsValid() bool {
+	switch e {
+	case PermissionUpload, PermissionReadOwn, PermissionReadAll, PermissionDeleteOwn, PermissionDeleteAny, PermissionAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Permission) String() string {
+	return string(e)
+}
+
+func (e *Permission) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Permission(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Permission", str)
+	}
+	return nil
+}
+
+func (e Permission) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *Permission) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e Permission) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
@@ -1,9 +1,15 @@
 package graph
 
 import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
 	"github.com/sirupsen/logrus"
 
 	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/graph/model"
 )
 
 // This file will not be regenerated automatically.
@@ -12,13 +18,91 @@ import (
 // here.
 
 type Resolver struct {
-	Uploader *business.BucketUpload
-	Logger   *logrus.Logger
+	Uploader    *business.BucketUpload
+	Idempotency *business.IdempotentUploads
+	Links       *business.Links
+	Logger      *logrus.Logger
 }
 
-func NewResolver(logger *logrus.Logger, bu *business.BucketUpload) *Resolver {
+func NewResolver(logger *logrus.Logger, bu *business.BucketUpload, links *business.Links) *Resolver {
 	return &Resolver{
-		Uploader: bu,
-		Logger:   logger,
+		Uploader:    bu,
+		Idempotency: business.NewEnvIdempotentUploads(bu),
+		Links:       links,
+		Logger:      logger,
+	}
+}
+
+// newFile describes a stored file, its content is downloaded from the REST API
+func newFile(info *business.FileInfo) *model.File {
+	size := strconv.FormatInt(info.Size, 10)
+	createdAt := info.CreatedAt.Format(time.RFC3339)
+	f := &model.File{
+		ID:          &info.ID,
+		Name:        &info.Name,
+		Size:        &size,
+		ContentType: &info.ContentType,
+		CreateAt:    &createdAt,
+		UserID:      &info.UserID,
+	}
+	if info.Checksum != "" {
+		f.Checksum = &info.Checksum
+	}
+	for _, k := range slices.Sorted(maps.Keys(info.Metadata)) {
+		f.Metadata = append(f.Metadata, &model.Metadata{Key: k, Value: info.Metadata[k]})
+	}
+	f.Tags = info.Tags
+	if info.Folder != "" {
+		f.Folder = &info.Folder
+	}
+
+	return f
+}
+
+// newFolder describes a folder, its files and children are loaded by the folder resolver
+func newFolder(folder *business.Folder) *model.Folder {
+	f := &model.Folder{
+		Path: folder.Path,
+		Name: folder.Name,
+	}
+	if !folder.CreatedAt.IsZero() {
+		createdAt := folder.CreatedAt.Format(time.RFC3339)
+		f.CreatedAt = &createdAt
 	}
+
+	return f
+}
+
+// newSearchConnection pages search results the way Relay connections do
+func newSearchConnection(res *business.SearchResults) *model.SearchConnection {
+	conn := &model.SearchConnection{
+		Edges:      make([]*model.SearchEdge, 0, len(res.Hits)),
+		PageInfo:   &model.PageInfo{HasNextPage: res.HasNextPage},
+		TotalCount: res.Total,
+	}
+	if res.EndCursor != "" {
+		conn.PageInfo.EndCursor = &res.EndCursor
+	}
+	for _, hit := range res.Hits {
+		conn.Edges = append(conn.Edges, &model.SearchEdge{Cursor: hit.Cursor, Score: hit.Score, Node: newFile(hit.File)})
+	}
+
+	return conn
+}
+
+// metadataMap turns the metadata input into the map the business layer takes,
+// null values become empty strings which remove keys on updates
+func metadataMap(input []*model.MetadataInput) map[string]string {
+	if input == nil {
+		return nil
+	}
+	metadata := make(map[string]string, len(input))
+	for _, m := range input {
+		metadata[m.Key] = ""
+		if m.Value != nil {
+			metadata[m.Key] = *m.Value
+		}
+	}
+
+	return metadata
 }
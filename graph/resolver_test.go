@@ -0,0 +1,375 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/graph/model"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateFileMetadata(t *testing.T) {
+	store := storagetest.NewMemory()
+	store.Put("a.pdf", "application/pdf", []byte("hello"), map[string]string{
+		"userID": "uploader", "fileName": "a.pdf", "meta-stage": "draft", "tags": "invoice",
+	})
+	auth := stubAuthenticator{
+		"uploader": {UserID: "uploader", Permissions: []business.Permission{business.PermissionUpload}},
+		"other":    {UserID: "other", Permissions: []business.Permission{business.PermissionUpload}},
+	}
+	s := NewServer(logrus.New(), business.NewBucketUpload(store, "test"), auth, nil, "0")
+	handler := s.Server.(*http.Server).Handler
+
+	scenarios := []struct {
+		name         string
+		token        string
+		query        string
+		expectedFile *model.File
+		expectedCode string
+	}{
+		{
+			name:  "merge metadata and keep tags",
+			token: "uploader",
+			query: `mutation { updateFileMetadata(fileID: "a.pdf", metadata: [{key: "stage", value: null}, {key: "Project", value: "apollo"}]) { Metadata { key value } Tags } }`,
+			expectedFile: &model.File{
+				Metadata: []*model.Metadata{{Key: "project", Value: "apollo"}},
+				Tags:     []string{"invoice"},
+			},
+		},
+		{
+			name:  "replace tags",
+			token: "uploader",
+			query: `mutation { updateFileMetadata(fileID: "a.pdf", tags: ["paid"]) { Metadata { key value } Tags } }`,
+			expectedFile: &model.File{
+				Metadata: []*model.Metadata{{Key: "project", Value: "apollo"}},
+				Tags:     []string{"paid"},
+			},
+		},
+		{
+			name:         "invalid tag",
+			token:        "uploader",
+			query:        `mutation { updateFileMetadata(fileID: "a.pdf", tags: ["two words"]) { Tags } }`,
+			expectedCode: "invalid-request",
+		},
+		{
+			name:         "someone else's file",
+			token:        "other",
+			query:        `mutation { updateFileMetadata(fileID: "a.pdf", tags: []) { Tags } }`,
+			expectedCode: "not-found",
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			body, err := json.Marshal(map[string]string{"query": scenario.query})
+			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Authorization", "Bearer "+scenario.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			res := struct {
+				Data struct {
+					UpdateFileMetadata *model.File `json:"updateFileMetadata"`
+				} `json:"data"`
+				Errors []struct {
+					Extensions map[string]any `json:"extensions"`
+				} `json:"errors"`
+			}{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+			if scenario.expectedCode != "" {
+				require.Len(t, res.Errors, 1)
+				assert.Equal(t, scenario.expectedCode, res.Errors[0].Extensions["code"])
+				return
+			}
+			require.Empty(t, res.Errors)
+			assert.Equal(t, scenario.expectedFile, res.Data.UpdateFileMetadata)
+		})
+	}
+}
+
+func TestFolders(t *testing.T) {
+	store := storagetest.NewMemory()
+	store.Put("a.pdf", "application/pdf", []byte("hello"), map[string]string{"userID": "uploader", "fileName": "a.pdf"})
+	store.Put("c.pdf", "application/pdf", []byte("hello"), map[string]string{"userID": "uploader", "fileName": "c.pdf"})
+	auth := stubAuthenticator{
+		"uploader": {UserID: "uploader", Permissions: []business.Permission{
+			business.PermissionUpload, business.PermissionReadOwn, business.PermissionDeleteOwn,
+		}},
+	}
+	s := NewServer(logrus.New(), business.NewBucketUpload(store, "test"), auth, nil, "0")
+	handler := s.Server.(*http.Server).Handler
+
+	scenarios := []struct {
+		name         string
+		query        string
+		expected     string
+		expectedCode string
+	}{
+		{
+			name:     "create",
+			query:    `mutation { createFolder(path: "invoices/2026") { path name } }`,
+			expected: `{"createFolder":{"path":"invoices/2026","name":"2026"}}`,
+		},
+		{
+			name:         "create existing",
+			query:        `mutation { createFolder(path: "invoices") { path } }`,
+			expectedCode: "conflict",
+		},
+		{
+			name:     "move a file",
+			query:    `mutation { moveFile(fileID: "a.pdf", folder: "invoices", name: "b.pdf") { ID Name Folder } }`,
+			expected: `{"moveFile":{"ID":"invoices/a.pdf","Name":"b.pdf","Folder":"invoices"}}`,
+		},
+		{
+			name:     "move a file two levels down",
+			query:    `mutation { moveFile(fileID: "c.pdf", folder: "invoices/2026") { ID } }`,
+			expected: `{"moveFile":{"ID":"invoices/2026/c.pdf"}}`,
+		},
+		{
+			name:     "list",
+			query:    `query { folder(path: "invoices") { path files { Name } children { path } } }`,
+			expected: `{"folder":{"path":"invoices","files":[{"Name":"b.pdf"}],"children":[{"path":"invoices/2026"}]}}`,
+		},
+		{
+			name:  "list two levels",
+			query: `query { folder { children { path files { Name } children { path files { Name } children { path } } } } }`,
+			expected: `{"folder":{"children":[{"path":"invoices","files":[{"Name":"b.pdf"}],` +
+				`"children":[{"path":"invoices/2026","files":[{"Name":"c.pdf"}],"children":[]}]}]}}`,
+		},
+		{
+			name:         "list a missing folder",
+			query:        `query { folder(path: "missing") { files { Name } } }`,
+			expectedCode: "not-found",
+		},
+		{
+			name:     "rename",
+			query:    `mutation { renameFolder(path: "invoices", newPath: "archive") { path } }`,
+			expected: `{"renameFolder":{"path":"archive"}}`,
+		},
+		{
+			name:         "delete not empty",
+			query:        `mutation { deleteFolder(path: "archive") }`,
+			expectedCode: "conflict",
+		},
+		{
+			name:     "delete recursive",
+			query:    `mutation { deleteFolder(path: "archive", recursive: true) }`,
+			expected: `{"deleteFolder":true}`,
+		},
+		{
+			name:     "list the root",
+			query:    `query { folder { path files { Name } children { path } } }`,
+			expected: `{"folder":{"path":"","files":[],"children":[]}}`,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			body, err := json.Marshal(map[string]string{"query": scenario.query})
+			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Authorization", "Bearer uploader")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			res := struct {
+				Data   json.RawMessage `json:"data"`
+				Errors []struct {
+					Extensions map[string]any `json:"extensions"`
+				} `json:"errors"`
+			}{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+			if scenario.expectedCode != "" {
+				require.Len(t, res.Errors, 1)
+				assert.Equal(t, scenario.expectedCode, res.Errors[0].Extensions["code"])
+				return
+			}
+			require.Empty(t, res.Errors)
+			assert.JSONEq(t, scenario.expected, string(res.Data))
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store := storagetest.NewMemory()
+	store.Put("a.pdf", "application/pdf", []byte("%PDF-1.4"), map[string]string{"userID": "uploader", "fileName": "invoice-march.pdf"})
+	store.Put("b.pdf", "application/pdf", []byte("%PDF-1.4"), map[string]string{"userID": "uploader", "fileName": "invoice-april.pdf"})
+	store.Put("c.pdf", "application/pdf", []byte("%PDF-1.4"), map[string]string{"userID": "other", "fileName": "invoice-may.pdf"})
+	bu := business.NewBucketUpload(store, "test")
+	bu.Index = business.NewSearchIndex(bu, logrus.New())
+	_, err := bu.Index.Reindex(context.Background())
+	require.NoError(t, err)
+	auth := stubAuthenticator{
+		"uploader": {UserID: "uploader", Permissions: []business.Permission{business.PermissionReadOwn}},
+		"auditor":  {UserID: "auditor", Permissions: []business.Permission{business.PermissionReadOwn, business.PermissionReadAll}},
+	}
+	s := NewServer(logrus.New(), bu, auth, nil, "0")
+	handler := s.Server.(*http.Server).Handler
+
+	scenarios := []struct {
+		name          string
+		token         string
+		query         string
+		expectedNames []string
+		expectedEdges int
+		expectedTotal int
+		hasNextPage   bool
+		expectedCode  string
+	}{
+		{
+			name:          "own files",
+			token:         "uploader",
+			query:         `{ search(query: "invoice") { totalCount edges { node { Name } } pageInfo { hasNextPage } } }`,
+			expectedNames: []string{"invoice-april.pdf", "invoice-march.pdf"},
+			expectedTotal: 2,
+		},
+		{
+			name:          "first page",
+			token:         "uploader",
+			query:         `{ search(query: "invoice", first: 1) { totalCount edges { node { Name } } pageInfo { hasNextPage } } }`,
+			expectedEdges: 1,
+			expectedTotal: 2,
+			hasNextPage:   true,
+		},
+		{
+			name:          "every user",
+			token:         "auditor",
+			query:         `{ search(query: "may", all: true) { totalCount edges { node { Name } } pageInfo { hasNextPage } } }`,
+			expectedNames: []string{"invoice-may.pdf"},
+			expectedTotal: 1,
+		},
+		{
+			name:         "every user needs read all",
+			token:        "uploader",
+			query:        `{ search(query: "may", all: true) { totalCount } }`,
+			expectedCode: "forbidden",
+		},
+		{
+			name:         "empty query",
+			token:        "uploader",
+			query:        `{ search(query: "") { totalCount } }`,
+			expectedCode: "invalid-request",
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			body, err := json.Marshal(map[string]string{"query": scenario.query})
+			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Authorization", "Bearer "+scenario.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			res := struct {
+				Data struct {
+					Search *model.SearchConnection `json:"search"`
+				} `json:"data"`
+				Errors []struct {
+					Extensions map[string]any `json:"extensions"`
+				} `json:"errors"`
+			}{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+			if scenario.expectedCode != "" {
+				require.Len(t, res.Errors, 1)
+				assert.Equal(t, scenario.expectedCode, res.Errors[0].Extensions["code"])
+				return
+			}
+			require.Empty(t, res.Errors)
+			var names []string
+			for _, edge := range res.Data.Search.Edges {
+				names = append(names, *edge.Node.Name)
+			}
+			if scenario.expectedNames != nil {
+				assert.ElementsMatch(t, scenario.expectedNames, names)
+			} else {
+				assert.Len(t, names, scenario.expectedEdges)
+			}
+			assert.Equal(t, scenario.expectedTotal, res.Data.Search.TotalCount)
+			assert.Equal(t, scenario.hasNextPage, res.Data.Search.PageInfo.HasNextPage)
+		})
+	}
+}
+
+func TestFetchFile(t *testing.T) {
+	store := storagetest.NewMemory()
+	store.Put("a.pdf", "application/pdf", []byte("hello"), map[string]string{"userID": "viewer", "fileName": "invoice.pdf"})
+	auth := stubAuthenticator{
+		"viewer": {UserID: "viewer", Permissions: []business.Permission{business.PermissionReadOwn}},
+		"other":  {UserID: "other", Permissions: []business.Permission{business.PermissionReadOwn}},
+	}
+	s := NewServer(logrus.New(), business.NewBucketUpload(store, "test"), auth, nil, "0")
+	handler := s.Server.(*http.Server).Handler
+
+	scenarios := []struct {
+		name         string
+		token        string
+		query        string
+		expected     string
+		expectedCode string
+	}{
+		{
+			name:     "own file",
+			token:    "viewer",
+			query:    `{ FetchFile(Name: "a.pdf") { ID Name Size ContentType UserID } }`,
+			expected: `{"FetchFile":{"ID":"a.pdf","Name":"invoice.pdf","Size":"5","ContentType":"application/pdf","UserID":"viewer"}}`,
+		},
+		{
+			name:         "someone else's file",
+			token:        "other",
+			query:        `{ FetchFile(Name: "a.pdf") { ID } }`,
+			expectedCode: "not-found",
+		},
+		{
+			name:         "missing file",
+			token:        "viewer",
+			query:        `{ FetchFile(Name: "b.pdf") { ID } }`,
+			expectedCode: "not-found",
+		},
+		{
+			name:         "without a name",
+			token:        "viewer",
+			query:        `{ FetchFile { ID } }`,
+			expectedCode: "not-found",
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			body, err := json.Marshal(map[string]string{"query": scenario.query})
+			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Authorization", "Bearer "+scenario.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			res := struct {
+				Data   json.RawMessage `json:"data"`
+				Errors []struct {
+					Extensions map[string]any `json:"extensions"`
+				} `json:"errors"`
+			}{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+			if scenario.expectedCode != "" {
+				require.Len(t, res.Errors, 1)
+				assert.Equal(t, scenario.expectedCode, res.Errors[0].Extensions["code"])
+				return
+			}
+			require.Empty(t, res.Errors)
+			assert.JSONEq(t, scenario.expected, string(res.Data))
+		})
+	}
+}
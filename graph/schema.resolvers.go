@@ -7,8 +7,7 @@ package graph
 
 import (
 	"context"
-	"errors"
-	"fmt"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/riyadennis/ingestion-service/business"
@@ -16,25 +15,174 @@ import (
 	"github.com/riyadennis/ingestion-service/graph/model"
 )
 
+// Files is the resolver for the files field.
+func (r *folderResolver) Files(ctx context.Context, obj *model.Folder) ([]*model.File, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	infos, err := r.Uploader.FolderFiles(ctx, userID, obj.Path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*model.File, 0, len(infos))
+	for _, info := range infos {
+		files = append(files, newFile(info))
+	}
+
+	return files, nil
+}
+
+// Children is the resolver for the children field.
+func (r *folderResolver) Children(ctx context.Context, obj *model.Folder) ([]*model.Folder, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	subfolders, err := r.Uploader.Subfolders(ctx, userID, obj.Path)
+	if err != nil {
+		return nil, err
+	}
+	children := make([]*model.Folder, 0, len(subfolders))
+	for _, child := range subfolders {
+		children = append(children, newFolder(child))
+	}
+
+	return children, nil
+}
+
 // SingleUpload is the resolver for the singleUpload field.
-func (r *mutationResolver) SingleUpload(ctx context.Context, file graphql.Upload) (bool, error) {
+func (r *mutationResolver) SingleUpload(ctx context.Context, file graphql.Upload, idempotencyKey *string, metadata []*model.MetadataInput, tags []string, folder *string) (*model.File, error) {
 	r.Logger.Infof("uploading file content type: %s", file.ContentType)
-	userID := ctx.Value(business.UserIDContextKey).(*string)
-	if *userID == "" {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	if userID == "" {
 		r.Logger.Error("unauthorised request, userID not present in context")
-		return false, errors.New("userID not present in context")
+		return nil, errUnauthenticated
 	}
 
 	fu := &business.FileUpload{
-		RealName:    file.Filename,
-		FileName:    business.SanitizeFilename(file.Filename),
-		Size:        file.Size,
-		ContentType: file.ContentType,
-		File:        file.File,
-		UserID:      *userID,
+		RealName:       file.Filename,
+		FileName:       business.SanitizeFilename(file.Filename),
+		Size:           file.Size,
+		ContentType:    file.ContentType,
+		File:           file.File,
+		UserID:         userID,
+		ClientMetadata: metadataMap(metadata),
+		Tags:           tags,
+	}
+	if folder != nil {
+		fu.Folder = *folder
+	}
+	key := ""
+	if idempotencyKey != nil {
+		key = *idempotencyKey
+	}
+	if _, err := r.Resolver.Idempotency.Upload(ctx, key, fu); err != nil {
+		return nil, err
+	}
+	info, err := r.Uploader.StatFile(ctx, userID, fu.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFile(info), nil
+}
+
+// CreateShareLink is the resolver for the createShareLink field.
+func (r *mutationResolver) CreateShareLink(ctx context.Context, fileID string, expiresIn *int, maxDownloads *int, password *string) (*model.ShareLink, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	if r.Links == nil {
+		return nil, errLinksDisabled
+	}
+	opts := business.ShareOptions{}
+	if expiresIn != nil {
+		opts.ExpiresIn = time.Duration(*expiresIn) * time.Second
+	}
+	if maxDownloads != nil {
+		opts.MaxDownloads = *maxDownloads
+	}
+	if password != nil {
+		opts.Password = *password
+	}
+	link, err := r.Links.CreateShare(ctx, userID, fileID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &model.ShareLink{
+		ID:                link.ID,
+		URL:               link.URL,
+		ExpiresAt:         link.ExpiresAt.Format(time.RFC3339),
+		PasswordProtected: link.PasswordProtected,
+	}
+	if link.MaxDownloads > 0 {
+		res.MaxDownloads = &link.MaxDownloads
+	}
+
+	return res, nil
+}
+
+// UpdateFileMetadata is the resolver for the updateFileMetadata field.
+func (r *mutationResolver) UpdateFileMetadata(ctx context.Context, fileID string, metadata []*model.MetadataInput, tags []string) (*model.File, error) {
+	p, ok := business.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	update := business.MetadataUpdate{
+		Metadata: metadataMap(metadata),
+		Tags:     tags,
+	}
+	var (
+		info *business.FileInfo
+		err  error
+	)
+	if p.Can(business.PermissionAdmin) {
+		info, err = r.Uploader.UpdateAnyMetadata(ctx, fileID, update)
+	} else {
+		info, err = r.Uploader.UpdateMetadata(ctx, p.UserID, fileID, update)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newFile(info), nil
+}
+
+// MoveFile is the resolver for the moveFile field.
+func (r *mutationResolver) MoveFile(ctx context.Context, fileID string, folder *string, name *string) (*model.File, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	opts := business.MoveOptions{Folder: folder}
+	if name != nil {
+		opts.Name = *name
+	}
+	info, err := r.Uploader.MoveFile(ctx, userID, fileID, opts)
+	if err != nil {
+		return nil, err
 	}
-	err := fu.Upload(ctx, r.Resolver.Uploader.Storage, r.Resolver.Uploader.BucketName)
+
+	return newFile(info), nil
+}
+
+// CreateFolder is the resolver for the createFolder field.
+func (r *mutationResolver) CreateFolder(ctx context.Context, path string) (*model.Folder, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	folder, err := r.Uploader.CreateFolder(ctx, userID, path)
 	if err != nil {
+		return nil, err
+	}
+
+	return newFolder(folder), nil
+}
+
+// RenameFolder is the resolver for the renameFolder field.
+func (r *mutationResolver) RenameFolder(ctx context.Context, path string, newPath string) (*model.Folder, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	folder, err := r.Uploader.RenameFolder(ctx, userID, path, newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFolder(folder), nil
+}
+
+// DeleteFolder is the resolver for the deleteFolder field.
+func (r *mutationResolver) DeleteFolder(ctx context.Context, path string, recursive *bool) (bool, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	if err := r.Uploader.DeleteFolder(ctx, userID, path, recursive != nil && *recursive); err != nil {
 		return false, err
 	}
 
@@ -43,14 +191,77 @@ func (r *mutationResolver) SingleUpload(ctx context.Context, file graphql.Upload
 
 // FetchFile is the resolver for the FetchFile field.
 func (r *queryResolver) FetchFile(ctx context.Context, name *string) (*model.File, error) {
-	panic(fmt.Errorf("not implemented: FetchFile - FetchFile"))
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	if name == nil {
+		return nil, business.ErrFileNotFound
+	}
+	info, err := r.Uploader.StatFile(ctx, userID, *name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFile(info), nil
+}
+
+// Folder is the resolver for the folder field.
+func (r *queryResolver) Folder(ctx context.Context, path *string) (*model.Folder, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	folder := ""
+	if path != nil {
+		folder = *path
+	}
+	f, err := r.Uploader.StatFolder(ctx, userID, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFolder(f), nil
 }
 
+// Search is the resolver for the search field.
+func (r *queryResolver) Search(ctx context.Context, query string, first *int, after *string, all *bool) (*model.SearchConnection, error) {
+	p, ok := business.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	if r.Uploader.Index == nil {
+		return nil, business.ErrSearchDisabled
+	}
+	opts := business.SearchOptions{Query: query}
+	if first != nil {
+		opts.First = *first
+	}
+	if after != nil {
+		opts.After = *after
+	}
+	var (
+		res *business.SearchResults
+		err error
+	)
+	if all != nil && *all {
+		if !p.Can(business.PermissionReadAll) {
+			return nil, errForbidden
+		}
+		res, err = r.Uploader.Index.SearchAll(ctx, opts)
+	} else {
+		res, err = r.Uploader.Index.Search(ctx, p.UserID, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newSearchConnection(res), nil
+}
+
+// Folder returns generated.FolderResolver implementation.
+func (r *Resolver) Folder() generated.FolderResolver { return &folderResolver{r} }
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+type folderResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
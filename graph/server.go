@@ -7,8 +7,12 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
@@ -16,12 +20,16 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/riyadennis/identity-server/app/proto/identity"
 	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
 	"github.com/riyadennis/ingestion-service/graph/generated"
+	"github.com/riyadennis/ingestion-service/rest"
 	"github.com/sirupsen/logrus"
 )
 
+// shutdownTimeout is how long in-flight uploads and subscriptions get to finish
+const shutdownTimeout = 30 * time.Second
+
 // ErrFailedToStartListener means that the listener couldn't be started
 var ErrFailedToStartListener = errors.New("failed to start listener")
 
@@ -31,17 +39,32 @@ type HTTPServer interface {
 	Shutdown(ctx context.Context) error
 	Serve(l net.Listener) error
 }
+
+// Server have all the setup needed to run and shut down the graphQL server
 type Server struct {
-	Server   HTTPServer
-	Logger   *logrus.Logger
-	ShutDown chan os.Signal
+	Server          HTTPServer
+	Logger          *logrus.Logger
+	ServerError     chan error
+	ShutDown        chan os.Signal
+	ShutdownTimeout time.Duration
+
+	addr  string
+	ready atomic.Bool
+	// websocket connections are hijacked, http.Server.Shutdown does not wait
+	// for them, so they are tracked and closed through their base context
+	// when they outlive the shutdown timeout
+	connections      sync.WaitGroup
+	closeConnections context.CancelFunc
 }
 
-func NewServer(logger *logrus.Logger, bu *business.BucketUpload, identityClient identity.IdentityClient, port string) *Server {
-	resolver := NewResolver(logger, bu)
+func NewServer(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator, links *business.Links, port string) *Server {
+	resolver := NewResolver(logger, bu, links)
 	srv := handler.New(generated.NewExecutableSchema(
 		generated.Config{
 			Resolvers: resolver,
+			Directives: generated.DirectiveRoot{
+				HasPermission: HasPermission,
+			},
 		},
 	))
 	srv.AddTransport(transport.Websocket{
@@ -52,54 +75,159 @@ func NewServer(logger *logrus.Logger, bu *business.BucketUpload, identityClient
 	srv.AddTransport(transport.POST{})
 	srv.AddTransport(transport.MultipartForm{})
 	srv.Use(extension.Introspection{})
+	srv.AroundResponses(observeOperation)
+	srv.Use(Tracer{})
+	srv.SetErrorPresenter(presentError(logger))
 
 	addr := fmt.Sprintf(":%s", port)
+	connCtx, cancel := context.WithCancel(context.Background())
 	server := &Server{
-		Server: &http.Server{
-			Addr:    addr,
-			Handler: newRouter(srv, identityClient, logger),
+		Logger:           logger,
+		ServerError:      make(chan error, 1),
+		ShutDown:         make(chan os.Signal, 1),
+		ShutdownTimeout:  shutdownTimeout,
+		addr:             addr,
+		closeConnections: cancel,
+	}
+	server.Server = &http.Server{
+		Addr:    addr,
+		Handler: newRouter(srv, auth, logger, server),
+		BaseContext: func(net.Listener) context.Context {
+			return connCtx
 		},
-		Logger:   logger,
-		ShutDown: make(chan os.Signal, 1),
 	}
+
 	return server
 }
 
-func (s *Server) Start(port string) error {
-	s.Logger.Info("starting service", "port", port)
-	listener, err := net.Listen("tcp", ":"+port)
+// Run starts the graphQL server and waits to receive from shutdown and error channels,
+// on shutdown readiness fails straight away and in-flight requests and
+// subscriptions get ShutdownTimeout to finish
+func (s *Server) Run() error {
+	s.Logger.Infof("starting graphQL server on %s", s.addr)
+	listener, err := net.Listen("tcp", s.addr)
 	if err != nil {
 		s.Logger.Errorf("failed to start http listener: %v", err)
-		return ErrFailedToStartListener
+		return fmt.Errorf("%w: %v", ErrFailedToStartListener, err)
 	}
-	var sErr error
+
+	return s.serve(listener)
+}
+
+func (s *Server) serve(listener net.Listener) error {
 	go func() {
-		s.Logger.Info("service finished starting and is now ready to accept requests")
-
-		// start http listener
-		sErr = s.Server.Serve(listener)
-		if sErr != nil {
-			if !errors.Is(err, http.ErrServerClosed) {
-				s.Logger.Errorf("failed to start http server: %v", sErr)
-				return
-			}
+		s.ServerError <- s.Server.Serve(listener)
+	}()
+	s.ready.Store(true)
+	s.Logger.Info("service finished starting and is now ready to accept requests")
+
+	select {
+	case err := <-s.ServerError:
+		s.ready.Store(false)
+		s.closeConnections()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
 		}
+	case sig := <-s.ShutDown:
+		s.Logger.Infof("graphQL server: %v: start shutdown", sig)
+		return s.shutdown()
+	}
+
+	return nil
+}
+
+/*
+shutdown stops accepting connections and waits for the open ones
+  - Requests and subscriptions get ShutdownTimeout to finish
+  - Subscriptions still open at the deadline are cancelled through their
+    base context and the deadline error is returned
+*/
+func (s *Server) shutdown() error {
+	s.ready.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	defer s.closeConnections()
+
+	err := s.Server.Shutdown(ctx)
+	drained := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		close(drained)
 	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		s.Logger.Warnf("graphQL server: closing subscriptions still open: %v", ctx.Err())
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	return err
+}
 
-	return sErr
+// Ready reports whether the server accepts traffic
+func (s *Server) Ready() bool {
+	return s.ready.Load()
 }
 
-func newRouter(srv *handler.Server, client identity.IdentityClient, logger *logrus.Logger) http.Handler {
+// readiness fails as soon as shutdown starts so that no new traffic is routed here
+func (s *Server) readiness(w http.ResponseWriter, r *http.Request) {
+	if !s.Ready() {
+		foundation.ErrorResponse(w, r, errShuttingDown)
+		return
+	}
+	rest.Ready(w, r)
+}
+
+// observeOperation records every operation by name and whether it returned errors
+func observeOperation(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	res := next(ctx)
+	if !graphql.HasOperationContext(ctx) {
+		return res
+	}
+	oc := graphql.GetOperationContext(ctx)
+	name := oc.OperationName
+	if name == "" && oc.Operation != nil {
+		name = oc.Operation.Name
+	}
+	business.ObserveGraphQLOperation(name, res != nil && len(res.Errors) > 0)
+
+	return res
+}
+
+// trackConnections keeps count of websocket connections which outlive their handler otherwise
+func (s *Server) trackConnections(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			s.connections.Add(1)
+			defer s.connections.Done()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRouter(srv *handler.Server, auth business.Authenticator, logger *logrus.Logger, s *Server) http.Handler {
 	chiRouter := chi.NewRouter()
 
+	chiRouter.Use(rest.Tracing("graphql"))
 	chiRouter.Use(middleware.RequestID)
+	chiRouter.Use(middleware.RealIP)
+	chiRouter.Use(rest.RequestInfo)
 	chiRouter.Use(middleware.Recoverer)
+	chiRouter.Use(rest.Metrics)
 	chiRouter.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"*"},
 	}))
-	chiRouter.Use(business.NeedsAuthMiddleWare(client, logger))
-	chiRouter.Handle("/", playground.Handler("GraphQL playground", "/graphql"))
+	chiRouter.Get(rest.LivenessEndPoint, rest.Liveness)
+	chiRouter.Get(rest.ReadinessEndPoint, s.readiness)
+
+	chiRouter.Group(func(r chi.Router) {
+		r.Use(business.NeedsAuthMiddleWare(auth, logger))
+		r.Use(s.trackConnections)
+		r.Handle("/", playground.Handler("GraphQL playground", "/graphql"))
+		r.Handle("/graphql", srv)
+	})
 
-	chiRouter.Handle("/graphql", srv)
 	return chiRouter
 }
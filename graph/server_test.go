@@ -0,0 +1,204 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/rest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockHTTPServer blocks in Serve until Shutdown is called
+type mockHTTPServer struct {
+	serveErr      error
+	shutdownErr   error
+	shutdownDelay time.Duration
+	stopped       chan struct{}
+	// readyOnShutdown records readiness at the time Shutdown is called
+	readyOnShutdown bool
+	server          *Server
+}
+
+func (m *mockHTTPServer) Serve(_ net.Listener) error {
+	if m.serveErr != nil {
+		return m.serveErr
+	}
+	<-m.stopped
+	return http.ErrServerClosed
+}
+
+func (m *mockHTTPServer) Shutdown(ctx context.Context) error {
+	m.readyOnShutdown = m.server.Ready()
+	close(m.stopped)
+	select {
+	case <-time.After(m.shutdownDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return m.shutdownErr
+}
+
+func newTestServer(t *testing.T, mock *mockHTTPServer) (*Server, context.Context) {
+	t.Helper()
+	s := NewServer(logrus.New(), nil, nil, nil, "0")
+	base := s.Server.(*http.Server).BaseContext(nil)
+	mock.stopped = make(chan struct{})
+	mock.server = s
+	s.Server = mock
+	s.ShutdownTimeout = 100 * time.Millisecond
+	s.addr = "127.0.0.1:0"
+
+	return s, base
+}
+
+func TestServerRun(t *testing.T) {
+	errServe := errors.New("failed to serve")
+	errShutdown := errors.New("failed to shutdown")
+	scenarios := []struct {
+		name          string
+		mock          *mockHTTPServer
+		signal        bool
+		expectedError error
+	}{
+		{
+			name:          "serve error is returned",
+			mock:          &mockHTTPServer{serveErr: errServe},
+			expectedError: errServe,
+		},
+		{
+			name:   "graceful shutdown",
+			mock:   &mockHTTPServer{},
+			signal: true,
+		},
+		{
+			name:          "shutdown error is returned",
+			mock:          &mockHTTPServer{shutdownErr: errShutdown},
+			signal:        true,
+			expectedError: errShutdown,
+		},
+		{
+			name:          "shutdown deadline exceeded",
+			mock:          &mockHTTPServer{shutdownDelay: time.Second},
+			signal:        true,
+			expectedError: context.DeadlineExceeded,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			s, _ := newTestServer(t, scenario.mock)
+			if scenario.signal {
+				s.ShutDown <- syscall.SIGTERM
+			}
+			err := s.Run()
+			if scenario.expectedError != nil {
+				assert.ErrorIs(t, err, scenario.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.False(t, s.Ready())
+			if scenario.signal {
+				assert.False(t, scenario.mock.readyOnShutdown)
+			}
+		})
+	}
+}
+
+func TestServerRunListenerError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = l.Close()
+	}()
+	s, _ := newTestServer(t, &mockHTTPServer{})
+	s.addr = l.Addr().String()
+
+	assert.ErrorIs(t, s.Run(), ErrFailedToStartListener)
+}
+
+func TestServerDrainsSubscriptions(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		clientCloses  bool
+		expectedError error
+	}{
+		{name: "subscription ending before the deadline is not cancelled", clientCloses: true},
+		{name: "subscription open at the deadline is cancelled", expectedError: context.DeadlineExceeded},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			s, base := newTestServer(t, &mockHTTPServer{})
+			// a subscription lives until the client leaves or its connection context is cancelled
+			subscribed := make(chan struct{})
+			leave := make(chan struct{})
+			cancelled := make(chan bool, 1)
+			handler := s.trackConnections(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(subscribed)
+				select {
+				case <-leave:
+					cancelled <- false
+				case <-base.Done():
+					cancelled <- true
+				}
+			}))
+			go func() {
+				r := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+				r.Header.Set("Upgrade", "websocket")
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+			}()
+			<-subscribed
+
+			done := make(chan error)
+			go func() {
+				done <- s.Run()
+			}()
+			assert.Eventually(t, s.Ready, time.Second, time.Millisecond)
+			s.ShutDown <- syscall.SIGTERM
+			if scenario.clientCloses {
+				close(leave)
+			}
+
+			err := <-done
+			if scenario.expectedError != nil {
+				assert.ErrorIs(t, err, scenario.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, !scenario.clientCloses, <-cancelled)
+		})
+	}
+}
+
+func TestServerReadiness(t *testing.T) {
+	s, _ := newTestServer(t, &mockHTTPServer{})
+	scenarios := []struct {
+		name           string
+		ready          bool
+		expectedStatus int
+	}{
+		{
+			name:           "not ready before start and during shutdown",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "ready",
+			ready:          true,
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			s.ready.Store(scenario.ready)
+			w := httptest.NewRecorder()
+			s.readiness(w, httptest.NewRequest(http.MethodGet, rest.ReadinessEndPoint, nil))
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+		})
+	}
+}
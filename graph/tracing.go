@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/riyadennis/ingestion-service/business"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+Tracer is a gqlgen extension adding spans to the request span
+  - One span per operation named after it, lasting until its response is written
+  - One span per field with a resolver, fields read from a struct are skipped
+*/
+type Tracer struct{}
+
+var (
+	_ graphql.HandlerExtension     = Tracer{}
+	_ graphql.OperationInterceptor = Tracer{}
+	_ graphql.FieldInterceptor     = Tracer{}
+)
+
+func (Tracer) ExtensionName() string {
+	return "Tracer"
+}
+
+func (Tracer) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (Tracer) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	oc := graphql.GetOperationContext(ctx)
+	name := oc.OperationName
+	if name == "" && oc.Operation != nil {
+		name = oc.Operation.Name
+	}
+	kind := "query"
+	if oc.Operation != nil {
+		kind = string(oc.Operation.Operation)
+	}
+	ctx, span := otel.Tracer(business.TracerName).Start(ctx, "graphql "+kind+" "+name,
+		trace.WithAttributes(
+			attribute.String("graphql.operation.name", name),
+			attribute.String("graphql.operation.type", kind),
+		))
+	responses := next(ctx)
+
+	// the operation runs when its responses are read, subscriptions end with a nil response
+	return func(ctx context.Context) *graphql.Response {
+		res := responses(ctx)
+		if res != nil && len(res.Errors) > 0 {
+			span.SetStatus(codes.Error, res.Errors.Error())
+		}
+		if res == nil || kind != "subscription" {
+			span.End()
+		}
+		return res
+	}
+}
+
+func (Tracer) InterceptField(ctx context.Context, next graphql.Resolver) (any, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+	ctx, span := otel.Tracer(business.TracerName).Start(ctx, fc.Object+"."+fc.Field.Name,
+		trace.WithAttributes(attribute.String("graphql.field.path", fc.Path().String())))
+	defer span.End()
+	res, err := next(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return res, err
+}
@@ -0,0 +1,53 @@
+package graph
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/graph/generated"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	spans := tracetest.NewInMemoryExporter()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+	})
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{
+		Resolvers:  NewResolver(logrus.New(), business.NewBucketUpload(storagetest.NewMemory(), "test"), nil),
+		Directives: generated.DirectiveRoot{HasPermission: HasPermission},
+	}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(Tracer{})
+
+	request := httptest.NewRequest(http.MethodPost, "/graphql",
+		strings.NewReader(`{"query": "query Fetch { FetchFile(Name: \"a.pdf\") { Size } }"}`))
+	request.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(httptest.NewRecorder(), request)
+
+	recorded := map[string]tracetest.SpanStub{}
+	for _, span := range spans.GetSpans() {
+		recorded[span.Name] = span
+	}
+	operation, ok := recorded["graphql query Fetch"]
+	require.True(t, ok)
+	// the caller is not authenticated
+	assert.Equal(t, otelcodes.Error, operation.Status.Code)
+	field, ok := recorded["Query.FetchFile"]
+	require.True(t, ok)
+	assert.Equal(t, operation.SpanContext.SpanID(), field.Parent.SpanID())
+}
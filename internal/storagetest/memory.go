@@ -0,0 +1,277 @@
+// Package storagetest provides an in-memory object store for tests
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Memory keeps objects in memory, it implements the subset of the
+// minio client used by the service
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info minio.ObjectInfo
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]memoryObject)}
+}
+
+// Put stores data directly, user metadata keys are stored the way
+// MinIO returns them in listings
+func (m *Memory) Put(key, contentType string, data []byte, metadata map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = newMemoryObject(key, contentType, data, metadata)
+}
+
+// BucketExists reports every bucket as existing, objects are not kept per bucket
+func (m *Memory) BucketExists(context.Context, string) (bool, error) {
+	return true, nil
+}
+
+func (m *Memory) FPutObject(_ context.Context, _,
+	objectName, filePath string, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	return m.put(objectName, data, opts)
+}
+
+// put stores the object unless the conditional headers of opts fail, as MinIO and S3 do:
+// If-None-Match: * only creates objects and If-Match only replaces the object with the etag
+func (m *Memory) put(objectName string, data []byte, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[objectName]
+	if ok && opts.Header().Get("If-None-Match") == "*" {
+		return minio.UploadInfo{}, preconditionFailed(objectName)
+	}
+	if match := opts.Header().Get("If-Match"); match != "" {
+		if !ok {
+			return minio.UploadInfo{}, noSuchKey(objectName)
+		}
+		if strings.Trim(match, `"`) != obj.info.ETag {
+			return minio.UploadInfo{}, preconditionFailed(objectName)
+		}
+	}
+	stored := newMemoryObject(objectName, opts.ContentType, data, opts.UserMetadata)
+	m.objects[objectName] = stored
+
+	return minio.UploadInfo{Key: objectName, Size: stored.info.Size, ETag: stored.info.ETag}, nil
+}
+
+func (m *Memory) FGetObject(_ context.Context, _,
+	objectName, filePath string, opts minio.GetObjectOptions) error {
+	obj, err := m.get(objectName, opts)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, obj.data, 0644)
+}
+
+func (m *Memory) OpenObject(_ context.Context, _,
+	objectName string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	obj, err := m.get(objectName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// get returns the object, failing like S3 when it does not have the etag of If-Match
+func (m *Memory) get(objectName string, opts minio.GetObjectOptions) (memoryObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[objectName]
+	if !ok {
+		return memoryObject{}, noSuchKey(objectName)
+	}
+	if match := opts.Header().Get("If-Match"); match != "" && strings.Trim(match, `"`) != obj.info.ETag {
+		return memoryObject{}, preconditionFailed(objectName)
+	}
+
+	return obj, nil
+}
+
+func (m *Memory) StatObject(_ context.Context, _,
+	objectName string, _ minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[objectName]
+	if !ok {
+		return minio.ObjectInfo{}, noSuchKey(objectName)
+	}
+
+	return obj.info, nil
+}
+
+func (m *Memory) ListObjects(_ context.Context, _ string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		if strings.HasPrefix(key, opts.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	ch := make(chan minio.ObjectInfo, len(keys))
+	for _, key := range keys {
+		ch <- m.objects[key].info
+	}
+	close(ch)
+
+	return ch
+}
+
+func (m *Memory) RemoveObject(_ context.Context, _, objectName string, _ minio.RemoveObjectOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, objectName)
+
+	return nil
+}
+
+func newMemoryObject(key, contentType string, data []byte, metadata map[string]string) memoryObject {
+	userMetadata := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		userMetadata["X-Amz-Meta-"+k] = v
+	}
+	sum := md5.Sum(data)
+
+	return memoryObject{
+		data: data,
+		info: minio.ObjectInfo{
+			Key:          key,
+			Size:         int64(len(data)),
+			ETag:         hex.EncodeToString(sum[:]),
+			ContentType:  contentType,
+			LastModified: time.Now(),
+			UserMetadata: userMetadata,
+		},
+	}
+}
+
+func preconditionFailed(key string) error {
+	return minio.ErrorResponse{
+		StatusCode: http.StatusPreconditionFailed,
+		Code:       "PreconditionFailed",
+		Key:        key,
+	}
+}
+
+func noSuchKey(key string) error {
+	return minio.ErrorResponse{
+		Code:       "NoSuchKey",
+		Key:        key,
+		Message:    "The specified key does not exist.",
+		StatusCode: 404,
+	}
+}
+
+// PresignHeader returns a memory:// URL carrying the expiry and signed headers,
+// it can not be used to reach the store
+func (m *Memory) PresignHeader(_ context.Context, method, bucketName, objectName string,
+	expires time.Duration, reqParams url.Values, extraHeaders http.Header) (*url.URL, error) {
+	query := url.Values{}
+	for k, v := range reqParams {
+		query[k] = v
+	}
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	for k := range extraHeaders {
+		query.Add("X-Amz-SignedHeaders", strings.ToLower(k))
+	}
+	query.Set("X-Amz-Method", method)
+
+	return &url.URL{Scheme: "memory", Host: bucketName, Path: "/" + objectName, RawQuery: query.Encode()}, nil
+}
+
+// PresignedPostPolicy returns a memory:// URL and the policy as form data
+func (m *Memory) PresignedPostPolicy(_ context.Context, p *minio.PostPolicy) (*url.URL, map[string]string, error) {
+	return &url.URL{Scheme: "memory", Host: "bucket"}, map[string]string{
+		"policy": base64.StdEncoding.EncodeToString([]byte(p.String())),
+	}, nil
+}
+
+// CopyObject copies an object within the store, metadata is replaced when asked to
+func (m *Memory) CopyObject(_ context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[src.Object]
+	if !ok {
+		return minio.UploadInfo{}, noSuchKey(src.Object)
+	}
+	if src.MatchETag != "" && src.MatchETag != obj.info.ETag {
+		return minio.UploadInfo{}, preconditionFailed(src.Object)
+	}
+	copied := obj
+	if dst.ReplaceMetadata {
+		contentType := dst.ContentType
+		if contentType == "" {
+			contentType = obj.info.ContentType
+		}
+		copied = newMemoryObject(dst.Object, contentType, obj.data, dst.UserMetadata)
+	}
+	copied.info.Key = dst.Object
+	m.objects[dst.Object] = copied
+
+	return minio.UploadInfo{Key: dst.Object, Size: copied.info.Size}, nil
+}
+
+// ComposeObject copies a single source like CopyObject, a Content-Type in the
+// metadata sets the content type as it does for minio
+func (m *Memory) ComposeObject(ctx context.Context, dst minio.CopyDestOptions, srcs ...minio.CopySrcOptions) (minio.UploadInfo, error) {
+	if len(srcs) != 1 {
+		return minio.UploadInfo{}, errors.New("memory storage composes a single source")
+	}
+	if contentType, ok := dst.UserMetadata["Content-Type"]; ok {
+		dst.UserMetadata = maps.Clone(dst.UserMetadata)
+		delete(dst.UserMetadata, "Content-Type")
+		dst.ContentType = contentType
+	}
+
+	return m.CopyObject(ctx, dst, srcs[0])
+}
+
+// PutObject reads the whole object, parts and threads are ignored
+func (m *Memory) PutObject(_ context.Context, _, objectName string, reader io.Reader,
+	_ int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	return m.put(objectName, data, opts)
+}
+
+// RemoveIncompleteUpload does nothing, objects are stored whole
+func (m *Memory) RemoveIncompleteUpload(context.Context, string, string) error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+LoadAdminEndpoints adds the operational endpoints served on the admin port
+  - Prometheus metrics are served at /metrics without authentication,
+    the admin port is not meant to be exposed publicly
+  - API key management and the audit log are only added when adminToken is set,
+    callers must send it as a bearer token
+  - The audit log is only served when audit is not nil, and reindexing search when index is not nil
+*/
+func LoadAdminEndpoints(logger *logrus.Logger, keys *business.APIKeys, audit *business.Audit,
+	index *business.SearchIndex, adminToken string) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: logger}))
+	r.Use(middleware.Recoverer)
+
+	r.Get(LivenessEndPoint, Liveness)
+	r.Get(ReadinessEndPoint, Ready)
+	r.Handle(business.MetricsEndpoint, business.MetricsHandler())
+
+	if adminToken == "" {
+		logger.Warn("ADMIN_TOKEN is not set, API key management is disabled")
+		return r
+	}
+	apiKeys := NewAPIKeysHandler(logger, keys)
+	r.Group(func(r chi.Router) {
+		r.Use(adminAuth(adminToken))
+		r.Use(middleware.SetHeader("Content-Type", "application/json"))
+		r.Post(APIKeysEndpoint, apiKeys.Create)
+		r.Get(APIKeysEndpoint, apiKeys.List)
+		r.Post(RotateAPIKeyEndpoint, apiKeys.Rotate)
+		r.Delete(APIKeyEndpoint, apiKeys.Revoke)
+		if audit != nil {
+			auditLog := NewAuditHandler(logger, audit)
+			r.Get(AuditEndpoint, auditLog.Query)
+			r.Get(VerifyAuditEndpoint, auditLog.Verify)
+		}
+		if index != nil {
+			r.Post(ReindexEndpoint, NewSearchHandler(logger, index, nil).Reindex)
+		}
+	})
+
+	return r
+}
@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// APIKeysEndpoint creates and lists API keys on the admin port
+	APIKeysEndpoint = "/admin/api-keys"
+
+	// APIKeyEndpoint revokes an API key
+	APIKeyEndpoint = "/admin/api-keys/{id}"
+
+	// RotateAPIKeyEndpoint issues a new secret for an API key
+	RotateAPIKeyEndpoint = "/admin/api-keys/{id}/rotate"
+)
+
+var (
+	errInvalidAPIKeyRequest = foundation.NewError(foundation.InvalidRequest, "invalid api key request")
+	errManagingAPIKeys      = foundation.NewError(foundation.Internal, "error managing api keys")
+	errAdminUnauthorised    = foundation.NewError(foundation.Unauthenticated, "admin token required")
+	errAPIKeyRevoked        = foundation.NewError(foundation.Conflict, "api key was revoked")
+)
+
+// APIKeysHandler serves the admin API for service API keys
+type APIKeysHandler struct {
+	Keys   *business.APIKeys
+	Logger *logrus.Logger
+}
+
+func NewAPIKeysHandler(logger *logrus.Logger, keys *business.APIKeys) *APIKeysHandler {
+	return &APIKeysHandler{
+		Keys:   keys,
+		Logger: logger,
+	}
+}
+
+// createAPIKeyRequest is the body of a create request
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Tenant string   `json:"tenant"`
+	Scopes []string `json:"scopes"`
+}
+
+// apiKeyResponse returns the key secret, it is only ever shown once
+type apiKeyResponse struct {
+	*business.APIKey
+	Secret string `json:"secret"`
+}
+
+// Create issues a new API key
+func (h *APIKeysHandler) Create(w http.ResponseWriter, r *http.Request) {
+	req := &createAPIKeyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		foundation.ErrorResponse(w, r, errInvalidAPIKeyRequest)
+		return
+	}
+	key, secret, err := h.Keys.Create(r.Context(), req.Name, req.Tenant, req.Scopes)
+	if err != nil {
+		h.apiKeyError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, apiKeyResponse{APIKey: key, Secret: secret})
+}
+
+// List returns every API key without their secrets
+func (h *APIKeysHandler) List(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.Keys.List(r.Context())
+	if err != nil {
+		h.apiKeyError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// Rotate issues a new secret for an API key
+func (h *APIKeysHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	key, secret, err := h.Keys.Rotate(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.apiKeyError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiKeyResponse{APIKey: key, Secret: secret})
+}
+
+// Revoke stops an API key from being accepted
+func (h *APIKeysHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := h.Keys.Revoke(r.Context(), chi.URLParam(r, "id")); err != nil {
+		h.apiKeyError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *APIKeysHandler) apiKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	// keys are only invalid here when they were revoked
+	if errors.Is(err, business.ErrInvalidAPIKey) {
+		err = errAPIKeyRevoked
+	}
+	writeError(w, r, h.Logger, err, errManagingAPIKeys)
+}
+
+// adminAuth only lets requests carrying the admin token through
+func adminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, err := business.BearerToken(r.Header.Get("Authorization"))
+			if err != nil || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				foundation.ErrorResponse(w, r, errAdminUnauthorised)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
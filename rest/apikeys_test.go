@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	logger := logrus.New()
+	store := storagetest.NewMemory()
+	store.Put("a.jpeg", "image/jpeg", []byte("hello"),
+		map[string]string{"userID": "pipeline", "fileName": "a.jpeg"})
+	bu := business.NewBucketUpload(store, "test")
+	keys := business.NewAPIKeys(bu)
+	auth := business.NewPolicyAuthenticator(
+		business.NewAPIKeyAuthenticator(business.NewIdentityAuthenticator(&mockIdentity{}), keys),
+		business.DefaultPolicy(),
+	)
+	admin := LoadAdminEndpoints(logger, keys, nil, nil, "admin-secret")
+	api := LoadRESTEndpoints(logger, bu, auth, nil)
+
+	serve := func(handler http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, request)
+		return w
+	}
+	adminToken := map[string]string{"Authorization": "Bearer admin-secret"}
+
+	w := serve(admin, http.MethodPost, APIKeysEndpoint, `{"name":"import","tenant":"pipeline","scopes":["read"]}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serve(admin, http.MethodPost, APIKeysEndpoint, `{"tenant":"pipeline","scopes":["admin"]}`, adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(admin, http.MethodPost, APIKeysEndpoint, `{"name":"import","tenant":"pipeline","scopes":["read"]}`, adminToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+	created := struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	scenarios := []struct {
+		name           string
+		method         string
+		path           string
+		key            string
+		expectedStatus int
+	}{
+		{
+			name:           "read with read scope",
+			method:         http.MethodGet,
+			path:           "/files/a.jpeg",
+			key:            created.Secret,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "delete without delete scope",
+			method:         http.MethodDelete,
+			path:           "/files/a.jpeg",
+			key:            created.Secret,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "upload without upload scope",
+			method:         http.MethodPost,
+			path:           UploadEndpoint,
+			key:            created.Secret,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "unknown key",
+			method:         http.MethodGet,
+			path:           FilesEndpoint,
+			key:            "ik_0123456789abcdef_nope",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "bearer token in the api key header",
+			method:         http.MethodGet,
+			path:           FilesEndpoint,
+			key:            "alice",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := serve(api, scenario.method, scenario.path, "hello", map[string]string{
+				business.APIKeyHeader: scenario.key,
+				"Content-Type":        "image/jpeg",
+			})
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+		})
+	}
+
+	w = serve(admin, http.MethodPost, "/admin/api-keys/"+created.ID+"/rotate", "", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = serve(api, http.MethodGet, FilesEndpoint, "", map[string]string{business.APIKeyHeader: created.Secret})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serve(admin, http.MethodDelete, "/admin/api-keys/"+created.ID, "", adminToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = serve(admin, http.MethodDelete, "/admin/api-keys/unknown", "", adminToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(admin, http.MethodGet, APIKeysEndpoint, "", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "hash")
+	assert.Contains(t, w.Body.String(), "revokedAt")
+}
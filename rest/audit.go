@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AuditEndpoint queries the audit log on the admin port
+	AuditEndpoint = "/admin/audit"
+
+	// VerifyAuditEndpoint checks the hash chain of the audit log
+	VerifyAuditEndpoint = "/admin/audit/verify"
+)
+
+var (
+	errInvalidAuditQuery = foundation.NewError(foundation.InvalidRequest, "invalid audit query")
+	errReadingAudit      = foundation.NewError(foundation.Internal, "error reading audit log")
+)
+
+// RequestInfo keeps the request ID and client IP for the audit log, use it after
+// middleware.RequestID and middleware.RealIP
+func RequestInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &business.RequestInfo{
+			ID:       middleware.GetReqID(r.Context()),
+			ClientIP: clientIP(r.RemoteAddr),
+		}
+		next.ServeHTTP(w, r.WithContext(business.WithRequestInfo(r.Context(), info)))
+	})
+}
+
+// clientIP drops the port RemoteAddr has unless middleware.RealIP replaced it
+func clientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// AuditHandler serves the admin API for the audit log
+type AuditHandler struct {
+	Audit  *business.Audit
+	Logger *logrus.Logger
+}
+
+func NewAuditHandler(logger *logrus.Logger, audit *business.Audit) *AuditHandler {
+	return &AuditHandler{
+		Audit:  audit,
+		Logger: logger,
+	}
+}
+
+type auditResponse struct {
+	Entries []*business.AuditEntry `json:"entries"`
+	// Next is the before parameter of the next page, it is set while older entries may exist
+	Next int64 `json:"next,omitempty"`
+}
+
+type verifyAuditResponse struct {
+	Valid   bool   `json:"valid"`
+	Entries int64  `json:"entries"`
+	Head    string `json:"head"`
+	Error   string `json:"error,omitempty"`
+}
+
+/*
+Query returns the entries matching the query parameters, newest first
+  - userID, objectID and action match exactly
+  - since and until take RFC 3339 times or unix seconds
+  - limit defaults to 100 and is at most 1000
+  - before returns the entries numbered lower, pass next of the previous page
+*/
+func (h *AuditHandler) Query(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := business.AuditFilter{
+		UserID:   query.Get("userID"),
+		ObjectID: query.Get("objectID"),
+		Action:   query.Get("action"),
+	}
+	var err error
+	if filter.Since, err = business.ParseAuditTime(query.Get("since")); err != nil {
+		foundation.ErrorResponse(w, r, errInvalidAuditQuery)
+		return
+	}
+	if filter.Until, err = business.ParseAuditTime(query.Get("until")); err != nil {
+		foundation.ErrorResponse(w, r, errInvalidAuditQuery)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			foundation.ErrorResponse(w, r, errInvalidAuditQuery)
+			return
+		}
+	}
+	if before := query.Get("before"); before != "" {
+		if filter.Before, err = strconv.ParseInt(before, 10, 64); err != nil || filter.Before <= 0 {
+			foundation.ErrorResponse(w, r, errInvalidAuditQuery)
+			return
+		}
+	}
+	entries, err := h.Audit.Query(r.Context(), filter)
+	if err != nil {
+		h.Logger.Errorf("failed to query audit log: %v", err)
+		foundation.ErrorResponse(w, r, errReadingAudit)
+		return
+	}
+	resp := auditResponse{Entries: entries}
+	if len(entries) > 0 && entries[len(entries)-1].Seq > 1 {
+		resp.Next = entries[len(entries)-1].Seq
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Verify checks the whole chain, a broken chain is reported with 409
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	count, head, err := h.Audit.Verify(r.Context())
+	switch {
+	case errors.Is(err, business.ErrAuditTampered):
+		h.Logger.Errorf("audit log verification failed: %v", err)
+		writeJSON(w, http.StatusConflict, verifyAuditResponse{Entries: count, Head: head, Error: err.Error()})
+	case err != nil:
+		h.Logger.Errorf("failed to verify audit log: %v", err)
+		foundation.ErrorResponse(w, r, errReadingAudit)
+	default:
+		writeJSON(w, http.StatusOK, verifyAuditResponse{Valid: true, Entries: count, Head: head})
+	}
+}
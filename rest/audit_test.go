@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	logger := logrus.New()
+	f := newFixture(t, false, "alice")
+	f.store.Put("a.jpeg", "image/jpeg", []byte("hello"),
+		map[string]string{"userID": "alice", "fileName": "a.jpeg"})
+	f.bu.Audit = business.NewAudit(f.bu, logger)
+	admin := LoadAdminEndpoints(logger, business.NewAPIKeys(f.bu), f.bu.Audit, nil, "admin-secret")
+
+	request := httptest.NewRequest(http.MethodGet, "/files/a.jpeg", nil)
+	request.Header.Set("Authorization", "Bearer alice")
+	request.Header.Set("X-Forwarded-For", "203.0.113.7")
+	request.Header.Set("X-Request-Id", "req-1")
+	w := httptest.NewRecorder()
+	f.handler.ServeHTTP(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	scenarios := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+		entries        int
+	}{
+		{name: "without admin token", path: AuditEndpoint, expectedStatus: http.StatusUnauthorized},
+		{name: "all entries", path: AuditEndpoint, token: "admin-secret", expectedStatus: http.StatusOK, entries: 1},
+		{name: "other user", path: AuditEndpoint + "?userID=bob", token: "admin-secret", expectedStatus: http.StatusOK},
+		{name: "invalid since", path: AuditEndpoint + "?since=yesterday", token: "admin-secret", expectedStatus: http.StatusBadRequest},
+		{name: "invalid limit", path: AuditEndpoint + "?limit=-1", token: "admin-secret", expectedStatus: http.StatusBadRequest},
+		{name: "before", path: AuditEndpoint + "?before=1", token: "admin-secret", expectedStatus: http.StatusOK},
+		{name: "invalid before", path: AuditEndpoint + "?before=0", token: "admin-secret", expectedStatus: http.StatusBadRequest},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, scenario.path, nil)
+			if scenario.token != "" {
+				request.Header.Set("Authorization", "Bearer "+scenario.token)
+			}
+			w := httptest.NewRecorder()
+			admin.ServeHTTP(w, request)
+			require.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.expectedStatus != http.StatusOK {
+				return
+			}
+			resp := &auditResponse{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+			require.Len(t, resp.Entries, scenario.entries)
+			if scenario.entries > 0 {
+				entry := resp.Entries[0]
+				assert.Equal(t, business.AuditDownload, entry.Action)
+				assert.Equal(t, "alice", entry.UserID)
+				assert.Equal(t, "req-1", entry.RequestID)
+				assert.Equal(t, "203.0.113.7", entry.ClientIP)
+				assert.Equal(t, "a.jpeg", entry.ObjectID)
+				assert.Equal(t, business.AuditSuccess, entry.Outcome)
+			}
+		})
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, VerifyAuditEndpoint, nil)
+		request.Header.Set("Authorization", "Bearer admin-secret")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, request)
+		require.Equal(t, http.StatusOK, w.Code)
+		resp := &verifyAuditResponse{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+		assert.True(t, resp.Valid)
+		assert.Equal(t, int64(1), resp.Entries)
+
+		entries, err := f.bu.Audit.Query(context.Background(), business.AuditFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, entries[0].Hash, resp.Head)
+	})
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
-	"github.com/riyadennis/identity-server/app/proto/identity"
 	"github.com/riyadennis/ingestion-service/business"
 	"github.com/sirupsen/logrus"
 )
@@ -16,6 +15,15 @@ const (
 	// UploadEndpoint is to upload files
 	UploadEndpoint = "/upload"
 
+	// FilesEndpoint lists the files uploaded by the user
+	FilesEndpoint = "/files"
+
+	// MoveFileEndpoint moves or renames a file
+	MoveFileEndpoint = "/files/{id}/move"
+
+	// FileEndpoint downloads or deletes a single file
+	FileEndpoint = "/files/{id}"
+
 	// LivenessEndPoint is for kubernetes to check when to restart the container
 	LivenessEndPoint = "/liveness"
 
@@ -23,34 +31,95 @@ const (
 	ReadinessEndPoint = "/readiness"
 )
 
-// LoadRESTEndpoints adds REST endpoints to the router
-func LoadRESTEndpoints(logger *logrus.Logger, bu *business.BucketUpload, client identity.IdentityClient) http.Handler {
+// LoadRESTEndpoints adds REST endpoints to the router,
+// share and upload links are only served when links is set
+func LoadRESTEndpoints(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator, links *business.Links) http.Handler {
 	r := chi.NewRouter()
+	r.Use(Tracing("rest"))
 	// wrap already initialised logger to Chi logger
 	r.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: logger}))
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-
-	// Set a timeout value on the request context (ctx) that will signal
-	// through ctx.Done() that the request has timed out and further
-	// processing should be stopped.
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(RequestInfo)
+	r.Use(Metrics)
 	r.Use(middleware.SetHeader("Content-Type", "application/json"))
 	r.Use(cors.Handler(cors.Options{
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc: func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "OPTIONS"},
+		AllowedHeaders: append([]string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Filename",
+			business.ChecksumHeader, business.APIKeyHeader, business.IdempotencyKeyHeader, business.TagsHeader, SharePasswordHeader}, TusHeaders...),
+		ExposedHeaders: []string{"Link", "Content-Disposition", "Location", business.ChecksumHeader, FileIDHeader, business.IdempotentReplayedHeader,
+			"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", "Upload-Metadata"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value isn't ignored by any of the major browsers
 	}))
-	r.Get(LivenessEndPoint, Liveness)
-	r.Get(ReadinessEndPoint, Ready)
+	// large uploads set their own deadline from the size of the file
+	r.Post(LargeUploadEndpoint, NewLargeUploadHandler(logger, bu, auth, business.NewEnvLargeUploadConfig()).Upload)
+	// exports set their own deadline from the size of the archive
+	exports := NewExportsHandler(logger, bu, business.NewExports(bu, links, logger), auth, business.NewEnvLargeUploadConfig())
+	r.Post(ExportsEndpoint, exports.Create)
+	if links != nil {
+		r.Get(ExportDownloadEndpoint, exports.Download)
+	}
+
+	r.Group(func(r chi.Router) {
+		// Set a timeout value on the request context (ctx) that will signal
+		// through ctx.Done() that the request has timed out and further
+		// processing should be stopped.
+		// Large uploads and exports are kept out of it, they set their own deadlines through ResponseController.
+		r.Use(middleware.Timeout(60 * time.Second))
+
+		r.Get(LivenessEndPoint, Liveness)
+		r.Get(ReadinessEndPoint, Ready)
+
+		r.Post(UploadEndpoint, NewUploader(logger, bu, auth).Upload)
+
+		files := NewFilesHandler(logger, bu, auth)
+		r.Get(FilesEndpoint, files.List)
+		r.Get(FileEndpoint, files.Download)
+		r.Patch(FileEndpoint, files.Update)
+		r.Delete(FileEndpoint, files.Delete)
+		r.Post(MoveFileEndpoint, files.Move)
+
+		r.Get(SearchEndpoint, NewSearchHandler(logger, bu.Index, auth).Search)
+
+		folders := NewFoldersHandler(logger, bu, auth)
+		r.Post(FoldersEndpoint, folders.Create)
+		r.Get(FoldersEndpoint, folders.Get)
+		r.Get(FolderEndpoint, folders.Get)
+		r.Patch(FolderEndpoint, folders.Rename)
+		r.Delete(FolderEndpoint, folders.Delete)
+
+		tus := NewTusHandler(logger, business.NewTus(bu), auth)
+		r.Options(TusEndpoint, tus.Options)
+		r.Post(TusEndpoint, tus.Create)
+		r.Head(TusUploadEndpoint, tus.Head)
+		r.Patch(TusUploadEndpoint, tus.Patch)
+		r.Delete(TusUploadEndpoint, tus.Delete)
+
+		presign := NewPresignHandler(logger, bu, auth)
+		r.Post(PresignUploadEndpoint, presign.Upload)
+		r.Post(CompleteUploadEndpoint, presign.Complete)
+		r.Get(PresignDownloadEndpoint, presign.Download)
+
+		if links != nil {
+			shares := NewShareHandler(logger, links, auth)
+			r.Post(ShareFileEndpoint, shares.Create)
+			r.Get(FileSharesEndpoint, shares.List)
+			r.Delete(ShareEndpoint, shares.Revoke)
+			r.Get(SharedFileEndpoint, shares.Open)
+
+			uploadLinks := NewUploadLinksHandler(logger, links, auth)
+			r.Post(UploadLinksEndpoint, uploadLinks.Create)
+			r.Delete(UploadLinkEndpoint, uploadLinks.Revoke)
+			r.Post(GuestUploadEndpoint, uploadLinks.Upload)
 
-	r.Post(UploadEndpoint, NewUploader(logger, bu, client).Upload)
+			r.Get(ExportEndpoint, exports.Get)
+		}
+	})
 
 	return r
 }
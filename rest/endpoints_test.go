@@ -25,6 +25,26 @@ func (m *MockStorage) FPutObject(_ context.Context, _,
 	return m.uploadInfo, m.err
 }
 
+func (m *MockStorage) FGetObject(_ context.Context, _,
+	_, _ string, _ minio.GetObjectOptions) error {
+	return m.err
+}
+
+func (m *MockStorage) StatObject(_ context.Context, _,
+	_ string, _ minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	return minio.ObjectInfo{}, m.err
+}
+
+func (m *MockStorage) ListObjects(_ context.Context, _ string, _ minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	ch := make(chan minio.ObjectInfo)
+	close(ch)
+	return ch
+}
+
+func (m *MockStorage) RemoveObject(_ context.Context, _, _ string, _ minio.RemoveObjectOptions) error {
+	return m.err
+}
+
 func TestLoadRESTEndpoints(t *testing.T) {
 	scenarios := []struct {
 		name               string
@@ -78,7 +98,7 @@ func TestLoadRESTEndpoints(t *testing.T) {
 	client := &MockStorage{}
 	for _, scenario := range scenarios {
 		t.Run(scenario.name, func(t *testing.T) {
-			handler := LoadRESTEndpoints(logger, &business.BucketUpload{Storage: client, BucketName: "test"}, nil)
+			handler := LoadRESTEndpoints(logger, &business.BucketUpload{Storage: client, BucketName: "test"}, nil, nil)
 			w := httptest.NewRecorder()
 			handler.ServeHTTP(w, scenario.request)
 			assert.Equal(t, scenario.expectedStatusCode, w.Code)
@@ -0,0 +1,28 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+writeError reports err as a problem
+  - Errors with a code from the catalogue are described to the client
+  - Anything else is logged and reported as internal, or as storage-unavailable
+    when the storage could not be reached so clients know to retry
+*/
+func writeError(w http.ResponseWriter, r *http.Request, logger *logrus.Logger, err, internal error) {
+	if _, ok := foundation.AsCustomError(err); ok {
+		foundation.ErrorResponse(w, r, err)
+		return
+	}
+	logger.Errorf("%v: %v", internal, err)
+	if business.IsStorageUnavailable(err) {
+		foundation.ErrorResponse(w, r, business.ErrStorageUnavailable)
+		return
+	}
+	foundation.ErrorResponse(w, r, internal)
+}
@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ExportsEndpoint exports files as a ZIP archive
+	ExportsEndpoint = "/exports"
+
+	// ExportEndpoint returns the status of an async export
+	ExportEndpoint = "/exports/{id}"
+
+	// ExportDownloadEndpoint serves the archive of an async export without authentication
+	ExportDownloadEndpoint = "/exports/download/{token}"
+)
+
+var (
+	errInvalidExportRequest = foundation.NewError(foundation.InvalidRequest, "invalid export request")
+	errExportingFiles       = foundation.NewError(foundation.Internal, "error exporting files")
+)
+
+// ExportsHandler serves ZIP exports of the files of a user
+type ExportsHandler struct {
+	Files   *business.BucketUpload
+	Exports *business.Exports
+	Logger  *logrus.Logger
+	// Config sets how long an archive may take to send from its size
+	Config business.LargeUploadConfig
+	auth   business.Authenticator
+}
+
+func NewExportsHandler(logger *logrus.Logger, bu *business.BucketUpload, exports *business.Exports,
+	auth business.Authenticator, cfg business.LargeUploadConfig) *ExportsHandler {
+	return &ExportsHandler{
+		Files:   bu,
+		Exports: exports,
+		Logger:  logger,
+		Config:  cfg,
+		auth:    auth,
+	}
+}
+
+/*
+Create exports the files of the user picked by the body as a ZIP archive
+  - The archive is streamed back as the files are read, exports over 1GB must be async
+  - The response may take as long as the size of the files needs at the configured
+    minimum throughput, instead of the server write timeout
+  - Async exports respond with 202 and the export, its Location is polled
+    until the status is ready and the url downloads the archive
+  - Errors after the archive started abort the connection so clients
+    never mistake a truncated archive for a complete one
+*/
+func (h *ExportsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionReadOwn)
+	if !ok {
+		return
+	}
+	req := business.ExportRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		foundation.ErrorResponse(w, r, errInvalidExportRequest)
+		return
+	}
+	entries, err := h.Files.ExportFiles(r.Context(), principal.UserID, req)
+	if err != nil {
+		writeError(w, r, h.Logger, err, errExportingFiles)
+		return
+	}
+	if req.Async {
+		export, err := h.Exports.Start(r.Context(), principal.UserID, entries)
+		if err != nil {
+			writeError(w, r, h.Logger, err, errExportingFiles)
+			return
+		}
+		w.Header().Set("Location", ExportsEndpoint+"/"+export.ID)
+		writeJSON(w, http.StatusAccepted, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+	ctx, cancel := context.WithDeadline(r.Context(), h.extendDeadline(w, business.ExportSize(entries)))
+	defer cancel()
+	w.WriteHeader(http.StatusOK)
+	if err := h.Files.WriteZip(ctx, w, entries); err != nil {
+		h.Logger.Errorf("failed to stream export: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Get returns an async export started by the user
+func (h *ExportsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionReadOwn)
+	if !ok {
+		return
+	}
+	export, err := h.Exports.Get(r.Context(), principal.UserID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, h.Logger, err, errExportingFiles)
+		return
+	}
+	// links are relative when no public URL is configured
+	if strings.HasPrefix(export.URL, "/") {
+		export.URL = requestOrigin(r) + export.URL
+	}
+
+	writeJSON(w, http.StatusOK, export)
+}
+
+// Download streams the archive of an async export, the signed link is the only credential
+func (h *ExportsHandler) Download(w http.ResponseWriter, r *http.Request) {
+	info, file, err := h.Exports.Open(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		writeError(w, r, h.Logger, err, errExportingFiles)
+		return
+	}
+	h.extendDeadline(w, info.Size)
+
+	writeFile(w, h.Logger, info, file)
+}
+
+// extendDeadline lets the response take as long as sending size bytes needs
+func (h *ExportsHandler) extendDeadline(w http.ResponseWriter, size int64) time.Time {
+	deadline := time.Now().Add(h.Config.Timeout(size))
+	err := http.NewResponseController(w).SetWriteDeadline(deadline)
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.Logger.Warnf("failed to extend deadline for export: %v", err)
+	}
+
+	return deadline
+}
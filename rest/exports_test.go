@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zipNames returns the names of the entries of the archive
+func zipNames(t *testing.T, data []byte) []string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		names = append(names, f.Name)
+	}
+
+	return names
+}
+
+func TestExports(t *testing.T) {
+	f := newFixture(t, true, "alice", "bob")
+	f.store.Put("a.jpeg", "image/jpeg", []byte("hello"),
+		map[string]string{"userID": "alice", "fileName": "holiday.jpeg"})
+	f.store.Put("b.jpeg", "image/jpeg", []byte("world"),
+		map[string]string{"userID": "alice", "fileName": "holiday.jpeg"})
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		return f.serve(method, path, token, body, nil)
+	}
+
+	scenarios := []struct {
+		name           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedNames  []string
+	}{
+		{name: "without token", body: `{"ids":["a.jpeg"]}`, expectedStatus: http.StatusUnauthorized},
+		{name: "invalid body", token: "alice", body: `{"ids":`, expectedStatus: http.StatusBadRequest},
+		{name: "nothing picked", token: "alice", body: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "other user's files", token: "bob", body: `{"ids":["a.jpeg"]}`, expectedStatus: http.StatusNotFound},
+		{
+			name:           "ids",
+			token:          "alice",
+			body:           `{"ids":["a.jpeg","b.jpeg"]}`,
+			expectedStatus: http.StatusOK,
+			expectedNames:  []string{"holiday.jpeg", "holiday (1).jpeg"},
+		},
+		{
+			name:           "folder",
+			token:          "alice",
+			body:           `{"folder":""}`,
+			expectedStatus: http.StatusOK,
+			expectedNames:  []string{"holiday.jpeg", "holiday (1).jpeg"},
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := serve(http.MethodPost, ExportsEndpoint, scenario.token, scenario.body)
+			require.Equal(t, scenario.expectedStatus, w.Code, w.Body.String())
+			if scenario.expectedStatus != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+			assert.Equal(t, `attachment; filename="export.zip"`, w.Header().Get("Content-Disposition"))
+			assert.ElementsMatch(t, scenario.expectedNames, zipNames(t, w.Body.Bytes()))
+		})
+	}
+
+	w := serve(http.MethodPost, ExportsEndpoint, "alice", `{"ids":["a.jpeg"],"async":true}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	export := &business.Export{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), export))
+	assert.Equal(t, ExportsEndpoint+"/"+export.ID, w.Header().Get("Location"))
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, w.Header().Get("Location"), "bob", "").Code)
+
+	require.Eventually(t, func() bool {
+		w := serve(http.MethodGet, ExportsEndpoint+"/"+export.ID, "alice", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), export))
+		return export.Status == business.ExportReady
+	}, 5*time.Second, 10*time.Millisecond)
+	require.True(t, strings.HasPrefix(export.URL, "http://example.com/exports/download/"), export.URL)
+
+	w = serve(http.MethodGet, strings.TrimPrefix(export.URL, "http://example.com"), "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(t, []string{"holiday.jpeg"}, zipNames(t, w.Body.Bytes()))
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/exports/download/"+export.ID+".1.forged", "", "").Code)
+
+	// async exports need links
+	f = newFixture(t, false, "alice")
+	f.store.Put("a.jpeg", "image/jpeg", []byte("hello"), map[string]string{"userID": "alice"})
+	assert.Equal(t, http.StatusNotImplemented, serve(http.MethodPost, ExportsEndpoint, "alice", `{"ids":["a.jpeg"],"async":true}`).Code)
+}
@@ -0,0 +1,255 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errListingFiles    = foundation.NewError(foundation.Internal, "error listing files")
+	errUpdatingFile    = foundation.NewError(foundation.Internal, "error updating file")
+	errInvalidMetadata = foundation.NewError(foundation.InvalidRequest, "invalid metadata update")
+	errInvalidMove     = foundation.NewError(foundation.InvalidRequest, "invalid move request")
+	errMovingFile      = foundation.NewError(foundation.Internal, "error moving file")
+	errDeletingFile    = foundation.NewError(foundation.Internal, "error deleting file")
+	errForbidden       = foundation.NewError(foundation.Forbidden, "not allowed to perform this action")
+)
+
+type FilesHandler struct {
+	Files  *business.BucketUpload
+	Logger *logrus.Logger
+	auth   business.Authenticator
+}
+
+func NewFilesHandler(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator) *FilesHandler {
+	return &FilesHandler{
+		Files:  bu,
+		Logger: logger,
+		auth:   auth,
+	}
+}
+
+/*
+List returns the files uploaded by the authenticated user
+  - ?all=true lists the files of every user, it needs PermissionReadAll
+  - ?meta.<key>=<value> and ?tag=<tag> only list files with the metadata and tags,
+    tag can be repeated
+*/
+func (f *FilesHandler) List(w http.ResponseWriter, r *http.Request) {
+	principal, ok := f.authenticate(w, r, business.PermissionReadOwn, business.PermissionReadAll)
+	if !ok {
+		return
+	}
+	var (
+		files []*business.FileInfo
+		err   error
+	)
+	if r.URL.Query().Get("all") == "true" {
+		if !principal.Can(business.PermissionReadAll) {
+			foundation.ErrorResponse(w, r, errForbidden)
+			return
+		}
+		files, err = f.Files.ListAllFiles(r.Context(), fileFilter(r))
+	} else {
+		files, err = f.Files.ListFiles(r.Context(), principal.UserID, fileFilter(r))
+	}
+	if err != nil {
+		f.Logger.Errorf("failed to list files: %v", err)
+		foundation.ErrorResponse(w, r, errListingFiles)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(files)
+}
+
+// Download streams a file owned by the authenticated user,
+// or any file with PermissionReadAll
+func (f *FilesHandler) Download(w http.ResponseWriter, r *http.Request) {
+	principal, ok := f.authenticate(w, r, business.PermissionReadOwn, business.PermissionReadAll)
+	if !ok {
+		return
+	}
+	var (
+		info *business.FileInfo
+		file io.ReadCloser
+		err  error
+	)
+	if principal.Can(business.PermissionReadAll) {
+		info, file, err = f.Files.GetAnyFile(r.Context(), fileID(r))
+	} else {
+		info, file, err = f.Files.GetFile(r.Context(), principal.UserID, fileID(r))
+	}
+	if err != nil {
+		f.fileError(w, r, err, errFetchingFile)
+		return
+	}
+	writeFile(w, f.Logger, info, file)
+}
+
+// Delete removes a file owned by the authenticated user,
+// or any file with PermissionDeleteAny
+func (f *FilesHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	principal, ok := f.authenticate(w, r, business.PermissionDeleteOwn, business.PermissionDeleteAny)
+	if !ok {
+		return
+	}
+	var err error
+	if principal.Can(business.PermissionDeleteAny) {
+		err = f.Files.DeleteAnyFile(r.Context(), fileID(r))
+	} else {
+		err = f.Files.DeleteFile(r.Context(), principal.UserID, fileID(r))
+	}
+	if err != nil {
+		f.fileError(w, r, err, errDeletingFile)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+Update changes the metadata and tags of a file owned by the authenticated user,
+or any file with PermissionAdmin
+  - metadata is merged into the metadata of the file, null removes a key
+  - tags replace the tags of the file when present
+*/
+func (f *FilesHandler) Update(w http.ResponseWriter, r *http.Request) {
+	principal, ok := f.authenticate(w, r, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	update := business.MetadataUpdate{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		foundation.ErrorResponse(w, r, errInvalidMetadata)
+		return
+	}
+	var (
+		info *business.FileInfo
+		err  error
+	)
+	if principal.Can(business.PermissionAdmin) {
+		info, err = f.Files.UpdateAnyMetadata(r.Context(), fileID(r), update)
+	} else {
+		info, err = f.Files.UpdateMetadata(r.Context(), principal.UserID, fileID(r), update)
+	}
+	if err != nil {
+		f.fileError(w, r, err, errUpdatingFile)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+/*
+Move moves a file owned by the authenticated user to another folder and or renames it
+  - folder is the target folder, empty for the root, the file stays in its folder without it
+  - name renames the file
+  - The ID changes with the folder, the new one is returned in Location
+*/
+func (f *FilesHandler) Move(w http.ResponseWriter, r *http.Request) {
+	principal, ok := f.authenticate(w, r, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	opts := business.MoveOptions{}
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		foundation.ErrorResponse(w, r, errInvalidMove)
+		return
+	}
+	info, err := f.Files.MoveFile(r.Context(), principal.UserID, fileID(r), opts)
+	if err != nil {
+		f.fileError(w, r, err, errMovingFile)
+		return
+	}
+
+	w.Header().Set("Location", fileLocation(info.ID))
+	writeJSON(w, http.StatusOK, info)
+}
+
+// fileID is the ID in the path, IDs of files in folders hold slashes
+// which clients escape as %2F
+func fileID(r *http.Request) string {
+	id := chi.URLParam(r, "id")
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		return unescaped
+	}
+
+	return id
+}
+
+// fileLocation is the path a file is downloaded from
+func fileLocation(id string) string {
+	return "/files/" + url.PathEscape(id)
+}
+
+// fileFilter reads the metadata and tags a listing is narrowed down to
+func fileFilter(r *http.Request) business.FileFilter {
+	filter := business.FileFilter{}
+	for k, v := range r.URL.Query() {
+		if key, ok := strings.CutPrefix(k, business.MetadataFieldPrefix); ok && len(v) > 0 {
+			if filter.Metadata == nil {
+				filter.Metadata = map[string]string{}
+			}
+			filter.Metadata[key] = v[0]
+		}
+	}
+	for _, tag := range r.URL.Query()["tag"] {
+		filter.Tags = append(filter.Tags, business.ParseTags(tag)...)
+	}
+
+	return filter
+}
+
+func (f *FilesHandler) authenticate(w http.ResponseWriter, r *http.Request, perms ...business.Permission) (*business.Principal, bool) {
+	return authenticate(w, r, f.auth, f.Logger, perms...)
+}
+
+// authenticate returns the caller when it was granted one of perms
+func authenticate(w http.ResponseWriter, r *http.Request, auth business.Authenticator,
+	logger *logrus.Logger, perms ...business.Permission) (*business.Principal, bool) {
+	principal, err := business.PrincipalFromRequest(r.Context(), r, auth)
+	if err != nil {
+		logger.Errorf("failed to authenticate the user: %v", err)
+		foundation.ErrorResponse(w, r, errAuthenicationFailed)
+		return nil, false
+	}
+	if !slices.ContainsFunc(perms, principal.Can) {
+		foundation.ErrorResponse(w, r, errForbidden)
+		return nil, false
+	}
+
+	return principal, true
+}
+
+// writeFile streams the file as an attachment and closes it
+func writeFile(w http.ResponseWriter, logger *logrus.Logger, info *business.FileInfo, file io.ReadCloser) {
+	defer func() {
+		_ = file.Close()
+	}()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(info.Name))
+	if info.Checksum != "" {
+		w.Header().Set(business.ChecksumHeader, info.Checksum)
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		logger.Errorf("failed to stream file: %v", err)
+	}
+}
+
+func (f *FilesHandler) fileError(w http.ResponseWriter, r *http.Request, err, internal error) {
+	writeError(w, r, f.Logger, err, internal)
+}
@@ -0,0 +1,221 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/identity-server/app/proto/identity"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// mockIdentity resolves bearer tokens to user IDs
+type mockIdentity struct {
+	users map[string]string
+}
+
+func (m *mockIdentity) Login(_ context.Context, _ *identity.LoginRequest, _ ...grpc.CallOption) (*identity.LoginResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockIdentity) Me(ctx context.Context, _ *identity.UserRequest, _ ...grpc.CallOption) (*identity.UserResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for _, auth := range md.Get("Authorization") {
+		if id, ok := m.users[auth]; ok {
+			return &identity.UserResponse{ID: &id}, nil
+		}
+	}
+	return nil, errors.New("invalid token")
+}
+
+// newAuthenticator grants the mock identity users the permissions of the policy
+func newAuthenticator(idc *mockIdentity, policy *business.Policy) business.Authenticator {
+	return business.NewPolicyAuthenticator(business.NewIdentityAuthenticator(idc), policy)
+}
+
+func TestFiles(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "list without token",
+			method:         http.MethodGet,
+			path:           FilesEndpoint,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "download own file",
+			method:         http.MethodGet,
+			path:           "/files/a.jpeg",
+			token:          "alice",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "hello",
+		},
+		{
+			name:           "download file owned by someone else",
+			method:         http.MethodGet,
+			path:           "/files/a.jpeg",
+			token:          "bob",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "download missing file",
+			method:         http.MethodGet,
+			path:           "/files/missing.jpeg",
+			token:          "alice",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "delete file owned by someone else",
+			method:         http.MethodDelete,
+			path:           "/files/a.jpeg",
+			token:          "bob",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "delete own file",
+			method:         http.MethodDelete,
+			path:           "/files/a.jpeg",
+			token:          "alice",
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+	f := newFixture(t, false, "alice", "bob")
+	f.store.Put("a.jpeg", "image/jpeg", []byte("hello"),
+		map[string]string{"userID": "alice", "fileName": "holiday.jpeg"})
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			request := httptest.NewRequest(scenario.method, scenario.path, nil)
+			if scenario.token != "" {
+				request.Header.Set("Authorization", "Bearer "+scenario.token)
+			}
+			w := httptest.NewRecorder()
+			f.handler.ServeHTTP(w, request)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.expectedBody != "" {
+				assert.Equal(t, scenario.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	f := newFixture(t, false, "alice")
+	f.store.Put("a.jpeg", "image/jpeg", []byte("hello"),
+		map[string]string{"userID": "alice", "fileName": "a.jpeg"})
+	f.store.Put("b.jpeg", "image/jpeg", []byte("world"),
+		map[string]string{"userID": "bob", "fileName": "b.jpeg"})
+
+	request := httptest.NewRequest(http.MethodGet, FilesEndpoint, nil)
+	request.Header.Set("Authorization", "Bearer alice")
+	w := httptest.NewRecorder()
+	f.handler.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var files []*business.FileInfo
+	data, err := io.ReadAll(w.Result().Body)
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(bytes.NewReader(data)).Decode(&files))
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "a.jpeg", files[0].ID)
+		assert.Equal(t, "alice", files[0].UserID)
+	}
+}
+
+func TestFileMetadata(t *testing.T) {
+	f := newFixture(t, false, "alice", "bob")
+	serveAs := func(user, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+user)
+		for k, v := range header {
+			request.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		f.handler.ServeHTTP(w, request)
+		return w
+	}
+
+	w := serveAs("alice", http.MethodPost, UploadEndpoint, "hello", map[string]string{
+		"Content-Type":      "application/pdf",
+		"X-Filename":        "scan.pdf",
+		"X-Meta-Project":    "apollo",
+		"X-Meta-Stage":      "draft",
+		business.TagsHeader: "invoice, 2026",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	uploaded := &business.FileInfo{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(uploaded))
+	assert.Equal(t, map[string]string{"project": "apollo", "stage": "draft"}, uploaded.Metadata)
+	assert.Equal(t, []string{"2026", "invoice"}, uploaded.Tags)
+
+	scenarios := []struct {
+		name             string
+		user             string
+		body             string
+		expectedStatus   int
+		expectedMetadata map[string]string
+		expectedTags     []string
+	}{
+		{
+			name:             "merge and remove keys",
+			user:             "alice",
+			body:             `{"metadata": {"stage": null, "owner": "finance"}}`,
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: map[string]string{"project": "apollo", "owner": "finance"},
+			expectedTags:     []string{"2026", "invoice"},
+		},
+		{
+			name:             "replace tags",
+			user:             "alice",
+			body:             `{"tags": ["paid"]}`,
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: map[string]string{"project": "apollo", "owner": "finance"},
+			expectedTags:     []string{"paid"},
+		},
+		{name: "invalid metadata", user: "alice", body: `{"metadata": {"bad key": "x"}}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid body", user: "alice", body: `[]`, expectedStatus: http.StatusBadRequest},
+		{name: "someone else's file", user: "bob", body: `{"tags": []}`, expectedStatus: http.StatusNotFound},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := serveAs(scenario.user, http.MethodPatch, "/files/"+uploaded.ID, scenario.body, nil)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.expectedStatus != http.StatusOK {
+				return
+			}
+			info := &business.FileInfo{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(info))
+			assert.Equal(t, scenario.expectedMetadata, info.Metadata)
+			assert.Equal(t, scenario.expectedTags, info.Tags)
+		})
+	}
+
+	for query, expected := range map[string]int{
+		"?meta.project=apollo":         1,
+		"?meta.project=gemini":         0,
+		"?tag=paid":                    1,
+		"?tag=paid&meta.owner=finance": 1,
+		"?tag=invoice":                 0,
+	} {
+		w := serveAs("alice", http.MethodGet, FilesEndpoint+query, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var files []*business.FileInfo
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&files))
+		assert.Len(t, files, expected, query)
+	}
+}
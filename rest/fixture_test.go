@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+)
+
+// fixture is the REST API served over memory storage
+type fixture struct {
+	store   *storagetest.Memory
+	bu      *business.BucketUpload
+	auth    business.Authenticator
+	links   *business.Links
+	handler http.Handler
+}
+
+/*
+newFixture serves the REST API to the users with the default policy
+  - Each user is authenticated by "Bearer <user>"
+  - Share and upload links are enabled when withLinks is set
+*/
+func newFixture(t *testing.T, withLinks bool, users ...string) *fixture {
+	t.Helper()
+	idc := &mockIdentity{users: map[string]string{}}
+	for _, user := range users {
+		idc.users["Bearer "+user] = user
+	}
+	f := &fixture{store: storagetest.NewMemory()}
+	f.bu = business.NewBucketUpload(f.store, "test")
+	if withLinks {
+		f.links = business.NewLinks(f.bu, []byte("secret"), "")
+	}
+	f.auth = newAuthenticator(idc, business.DefaultPolicy())
+	f.handler = LoadRESTEndpoints(logrus.New(), f.bu, f.auth, f.links)
+
+	return f
+}
+
+// serve sends the request as the user of token, anonymously when it is empty
+func (f *fixture) serve(method, path, token, body string, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	f.handler.ServeHTTP(w, request)
+
+	return w
+}
@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FoldersEndpoint creates folders and lists the root folder
+	FoldersEndpoint = "/folders"
+
+	// FolderEndpoint lists, renames and deletes the folder in the path
+	FolderEndpoint = "/folders/*"
+)
+
+var (
+	errInvalidFolderRequest = foundation.NewError(foundation.InvalidRequest, "invalid folder request")
+	errFolder               = foundation.NewError(foundation.Internal, "error handling folder")
+)
+
+// FoldersHandler serves the folders of the authenticated user
+type FoldersHandler struct {
+	Files  *business.BucketUpload
+	Logger *logrus.Logger
+	auth   business.Authenticator
+}
+
+func NewFoldersHandler(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator) *FoldersHandler {
+	return &FoldersHandler{
+		Files:  bu,
+		Logger: logger,
+		auth:   auth,
+	}
+}
+
+// folderRequest is the body creating or renaming a folder
+type folderRequest struct {
+	Path string `json:"path"`
+}
+
+// Create creates a folder and its parents, responding 201 with the folder
+func (h *FoldersHandler) Create(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	req := &folderRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		foundation.ErrorResponse(w, r, errInvalidFolderRequest)
+		return
+	}
+	folder, err := h.Files.CreateFolder(r.Context(), principal.UserID, req.Path)
+	if err != nil {
+		writeError(w, r, h.Logger, err, errFolder)
+		return
+	}
+
+	w.Header().Set("Location", folderLocation(folder.Path))
+	writeJSON(w, http.StatusCreated, folder)
+}
+
+// Get returns the folder with the files and folders directly in it, /folders is the root
+func (h *FoldersHandler) Get(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionReadOwn)
+	if !ok {
+		return
+	}
+	folder, err := h.Files.ListFolder(r.Context(), principal.UserID, folderPath(r))
+	if err != nil {
+		writeError(w, r, h.Logger, err, errFolder)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, folder)
+}
+
+/*
+Rename moves the folder to the path in the body
+  - The files in it get new IDs, share links to them stop working
+*/
+func (h *FoldersHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	req := &folderRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		foundation.ErrorResponse(w, r, errInvalidFolderRequest)
+		return
+	}
+	folder, err := h.Files.RenameFolder(r.Context(), principal.UserID, folderPath(r), req.Path)
+	if err != nil {
+		writeError(w, r, h.Logger, err, errFolder)
+		return
+	}
+
+	w.Header().Set("Location", folderLocation(folder.Path))
+	writeJSON(w, http.StatusOK, folder)
+}
+
+// Delete removes an empty folder, ?recursive=true also deletes the files and folders in it
+func (h *FoldersHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionDeleteOwn)
+	if !ok {
+		return
+	}
+	recursive := r.URL.Query().Get("recursive") == "true"
+	if err := h.Files.DeleteFolder(r.Context(), principal.UserID, folderPath(r), recursive); err != nil {
+		writeError(w, r, h.Logger, err, errFolder)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// folderPath is the folder after /folders/, chi matches the escaped path
+func folderPath(r *http.Request) string {
+	folder := chi.URLParam(r, "*")
+	if unescaped, err := url.PathUnescape(folder); err == nil {
+		return unescaped
+	}
+
+	return folder
+}
+
+// folderLocation is the path a folder is listed at
+func folderLocation(folder string) string {
+	return (&url.URL{Path: FoldersEndpoint + "/" + folder}).EscapedPath()
+}
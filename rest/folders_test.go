@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolders(t *testing.T) {
+	f := newFixture(t, false, "alice", "bob")
+	serveAs := func(user, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+user)
+		for k, v := range header {
+			request.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		f.handler.ServeHTTP(w, request)
+		return w
+	}
+
+	w := serveAs("alice", http.MethodPost, UploadEndpoint+"?folder=invoices/2026", "hello", map[string]string{
+		"Content-Type": "application/pdf",
+		"X-Filename":   "scan.pdf",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	uploaded := &business.FileInfo{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(uploaded))
+	assert.Equal(t, "invoices/2026", uploaded.Folder)
+	assert.Equal(t, "/files/"+url.PathEscape(uploaded.ID), w.Header().Get("Location"))
+
+	w = serveAs("alice", http.MethodGet, w.Header().Get("Location"), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "escaped IDs are downloaded")
+
+	scenarios := []struct {
+		name           string
+		user           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedPath   string
+	}{
+		{name: "create", user: "alice", method: http.MethodPost, path: FoldersEndpoint, body: `{"path": "archive"}`, expectedStatus: http.StatusCreated, expectedPath: "archive"},
+		{name: "create existing", user: "alice", method: http.MethodPost, path: FoldersEndpoint, body: `{"path": "archive"}`, expectedStatus: http.StatusConflict},
+		{name: "create outside the root", user: "alice", method: http.MethodPost, path: FoldersEndpoint, body: `{"path": "../x"}`, expectedStatus: http.StatusBadRequest},
+		{name: "list the root", user: "alice", method: http.MethodGet, path: FoldersEndpoint, expectedStatus: http.StatusOK},
+		{name: "list", user: "alice", method: http.MethodGet, path: "/folders/invoices/2026", expectedStatus: http.StatusOK, expectedPath: "invoices/2026"},
+		{name: "list someone else's", user: "bob", method: http.MethodGet, path: "/folders/invoices", expectedStatus: http.StatusNotFound},
+		{name: "delete not empty", user: "alice", method: http.MethodDelete, path: "/folders/invoices", expectedStatus: http.StatusConflict},
+		{name: "rename", user: "alice", method: http.MethodPatch, path: "/folders/invoices", body: `{"path": "archive/invoices"}`, expectedStatus: http.StatusOK, expectedPath: "archive/invoices"},
+		{name: "delete recursive", user: "alice", method: http.MethodDelete, path: "/folders/archive?recursive=true", expectedStatus: http.StatusNoContent},
+		{name: "deleted", user: "alice", method: http.MethodGet, path: "/folders/archive", expectedStatus: http.StatusNotFound},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := serveAs(scenario.user, scenario.method, scenario.path, scenario.body, nil)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.expectedPath == "" {
+				return
+			}
+			folder := &business.Folder{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(folder))
+			assert.Equal(t, scenario.expectedPath, folder.Path)
+		})
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	f := newFixture(t, false, "alice", "bob")
+	serveAs := func(user, method, path, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+user)
+		request.Header.Set("Content-Type", "application/pdf")
+		request.Header.Set("X-Filename", "scan.pdf")
+		w := httptest.NewRecorder()
+		f.handler.ServeHTTP(w, request)
+		return w
+	}
+	w := serveAs("alice", http.MethodPost, UploadEndpoint, "hello")
+	require.Equal(t, http.StatusCreated, w.Code)
+	location := w.Header().Get("Location")
+
+	scenarios := []struct {
+		name           string
+		user           string
+		body           string
+		expectedStatus int
+		expectedFolder string
+		expectedName   string
+	}{
+		{name: "someone else's file", user: "bob", body: `{"folder": "inbox"}`, expectedStatus: http.StatusNotFound},
+		{name: "invalid body", user: "alice", body: `[]`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid folder", user: "alice", body: `{"folder": "../inbox"}`, expectedStatus: http.StatusBadRequest},
+		{name: "move", user: "alice", body: `{"folder": "inbox"}`, expectedStatus: http.StatusOK, expectedFolder: "inbox", expectedName: "scan.pdf"},
+		{name: "rename", user: "alice", body: `{"name": "invoice.pdf"}`, expectedStatus: http.StatusOK, expectedFolder: "inbox", expectedName: "invoice.pdf"},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := serveAs(scenario.user, http.MethodPost, location+"/move", scenario.body)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.expectedStatus != http.StatusOK {
+				return
+			}
+			info := &business.FileInfo{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(info))
+			assert.Equal(t, scenario.expectedFolder, info.Folder)
+			assert.Equal(t, scenario.expectedName, info.Name)
+			location = w.Header().Get("Location")
+			assert.Equal(t, "/files/"+url.PathEscape(info.ID), location)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotentUpload(t *testing.T) {
+	f := newFixture(t, false, "alice")
+
+	upload := func(key, content string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, err := writer.CreateFormFile("file", "a.txt")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		request := httptest.NewRequest(http.MethodPost, UploadEndpoint, &buf)
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+		request.Header.Set("Authorization", "Bearer alice")
+		if key != "" {
+			request.Header.Set(business.IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		f.handler.ServeHTTP(w, request)
+		return w
+	}
+
+	scenarios := []struct {
+		name           string
+		key            string
+		content        string
+		expectedStatus int
+		replayed       bool
+	}{
+		{name: "first request", key: "k1", content: "hello", expectedStatus: http.StatusCreated},
+		{name: "retry", key: "k1", content: "hello", expectedStatus: http.StatusCreated, replayed: true},
+		{name: "different content", key: "k1", content: "world", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "without key", content: "hello", expectedStatus: http.StatusCreated},
+	}
+	location := ""
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := upload(scenario.key, scenario.content)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.replayed {
+				assert.Equal(t, "true", w.Header().Get(business.IdempotentReplayedHeader))
+				// the original file is returned
+				assert.Equal(t, location, w.Header().Get("Location"))
+			} else {
+				location = w.Header().Get("Location")
+				assert.Empty(t, w.Header().Get(business.IdempotentReplayedHeader))
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+// LargeUploadEndpoint streams files above MaxFileSize to storage in parallel parts
+const LargeUploadEndpoint = "/uploads/large"
+
+var (
+	errLengthRequired = foundation.NewError(foundation.LengthRequired, "content length is required")
+	errFileTooLarge   = foundation.NewError(foundation.TooLarge, "file is too large")
+	errUploadTimeout  = foundation.NewError(foundation.Timeout, "upload took too long")
+)
+
+// LargeUploadHandler serves uploads above MaxFileSize
+type LargeUploadHandler struct {
+	Files  *business.BucketUpload
+	Logger *logrus.Logger
+	Config business.LargeUploadConfig
+	auth   business.Authenticator
+}
+
+func NewLargeUploadHandler(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator, cfg business.LargeUploadConfig) *LargeUploadHandler {
+	return &LargeUploadHandler{
+		Files:  bu,
+		Logger: logger,
+		Config: cfg,
+		auth:   auth,
+	}
+}
+
+/*
+Upload streams the body to storage as a parallel multipart upload
+  - The body is the file, Content-Type and Content-Length are required,
+    X-Filename and X-Checksum-SHA256 are optional as for /upload
+  - The request may take as long as the declared size needs at the configured
+    minimum throughput, instead of the server timeouts
+*/
+func (h *LargeUploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	size := r.ContentLength
+	switch {
+	case size <= 0:
+		foundation.ErrorResponse(w, r, errLengthRequired)
+		return
+	case size > h.Config.MaxSize:
+		foundation.ErrorResponse(w, r, errFileTooLarge)
+		return
+	case !business.AllowedTypes[r.Header.Get("Content-Type")]:
+		foundation.ErrorResponse(w, r, business.ErrUnsupportedFileType)
+		return
+	}
+
+	deadline := time.Now().Add(h.Config.Timeout(size))
+	rc := http.NewResponseController(w)
+	for _, err := range []error{rc.SetReadDeadline(deadline), rc.SetWriteDeadline(deadline)} {
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			h.Logger.Warnf("failed to extend deadline for large upload: %v", err)
+		}
+	}
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	defer cancel()
+
+	metadata, tags := business.MetadataFromHeader(r.Header)
+	fu := &business.FileUpload{
+		RealName:       r.Header.Get("X-Filename"),
+		FileName:       business.SanitizeFilename(r.Header.Get("X-Filename")),
+		File:           r.Body,
+		Size:           size,
+		ContentType:    r.Header.Get("Content-Type"),
+		UserID:         principal.UserID,
+		Checksum:       r.Header.Get(business.ChecksumHeader),
+		Folder:         r.URL.Query().Get("folder"),
+		ClientMetadata: metadata,
+		Tags:           tags,
+	}
+	err := h.Files.UploadLarge(ctx, fu, h.Config)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errUploadTimeout
+	}
+	if err != nil {
+		writeError(w, r, h.Logger, err, errFetchingFile)
+		return
+	}
+
+	info, err := h.Files.StatFile(r.Context(), principal.UserID, fu.ID)
+	if err != nil {
+		writeError(w, r, h.Logger, err, errFetchingFile)
+		return
+	}
+	w.Header().Set("Location", fileLocation(fu.ID))
+	writeJSON(w, http.StatusCreated, info)
+}
@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLargeUpload(t *testing.T) {
+	t.Setenv("LARGE_FILE_MAX_SIZE", "20")
+	f := newFixture(t, false, "alice")
+
+	scenarios := []struct {
+		name           string
+		token          string
+		contentType    string
+		body           string
+		chunked        bool
+		expectedStatus int
+	}{
+		{
+			name:           "without token",
+			contentType:    "application/pdf",
+			body:           "hello",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "without length",
+			token:          "alice",
+			contentType:    "application/pdf",
+			body:           "hello",
+			chunked:        true,
+			expectedStatus: http.StatusLengthRequired,
+		},
+		{
+			name:           "too large",
+			token:          "alice",
+			contentType:    "application/pdf",
+			body:           strings.Repeat("a", 21),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "unsupported type",
+			token:          "alice",
+			contentType:    "text/html",
+			body:           "hello",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "upload",
+			token:          "alice",
+			contentType:    "application/pdf",
+			body:           "hello world",
+			expectedStatus: http.StatusCreated,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, LargeUploadEndpoint, strings.NewReader(scenario.body))
+			if scenario.chunked {
+				request.ContentLength = -1
+			}
+			if scenario.token != "" {
+				request.Header.Set("Authorization", "Bearer "+scenario.token)
+			}
+			request.Header.Set("Content-Type", scenario.contentType)
+			request.Header.Set("X-Filename", "big.pdf")
+			w := httptest.NewRecorder()
+			f.handler.ServeHTTP(w, request)
+			require.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.expectedStatus != http.StatusCreated {
+				return
+			}
+			info := &business.FileInfo{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), info))
+			assert.Equal(t, "/files/"+info.ID, w.Header().Get("Location"))
+			assert.Equal(t, "big.pdf", info.Name)
+			assert.EqualValues(t, 11, info.Size)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/riyadennis/ingestion-service/business"
+)
+
+// Metrics records the count and latency of requests by route pattern and status,
+// requests that matched no route are recorded as unmatched
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		business.ObserveRequest(routePattern(r), r.Method, status, time.Since(start))
+	})
+}
+
+// routePattern is the pattern of the chi route which served r,
+// it is only known once the request was routed
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+
+	return "unmatched"
+}
@@ -0,0 +1,39 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	f := newFixture(t, false)
+	for _, path := range []string{LivenessEndPoint, "/files/abc", "/nowhere"} {
+		f.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	LoadAdminEndpoints(logrus.New(), business.NewAPIKeys(f.bu), nil, nil, "").
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, business.MetricsEndpoint, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	scenarios := []struct {
+		name   string
+		series string
+	}{
+		{name: "route", series: `ingestion_http_requests_total{method="GET",route="/liveness",status="200"}`},
+		{name: "route pattern", series: `ingestion_http_requests_total{method="GET",route="/files/{id}",status="401"}`},
+		{name: "unmatched", series: `ingestion_http_requests_total{method="GET",route="unmatched",status="404"}`},
+		{name: "runtime", series: "go_goroutines"},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			assert.Contains(t, w.Body.String(), scenario.series)
+		})
+	}
+}
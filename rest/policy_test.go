@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutePermissions(t *testing.T) {
+	policy := &business.Policy{
+		Roles: map[string][]business.Permission{
+			"viewer":  {business.PermissionReadOwn},
+			"user":    {business.PermissionUpload, business.PermissionReadOwn, business.PermissionDeleteOwn},
+			"auditor": {business.PermissionReadAll},
+			"janitor": {business.PermissionDeleteAny},
+			"admin":   {business.PermissionAdmin},
+		},
+		Users: map[string][]string{
+			"victor": {"viewer"},
+			"ursula": {"user"},
+			"audrey": {"auditor"},
+			"jan":    {"janitor"},
+			"ada":    {"admin"},
+		},
+	}
+	users := map[string]string{}
+	for user := range policy.Users {
+		users["Bearer "+user] = user
+	}
+	users["Bearer nobody"] = "nobody"
+
+	scenarios := []struct {
+		name   string
+		method string
+		path   string
+		// expected status per user
+		expected map[string]int
+	}{
+		{
+			name:   "upload",
+			method: http.MethodPost,
+			path:   UploadEndpoint,
+			expected: map[string]int{
+				"nobody": http.StatusForbidden,
+				"victor": http.StatusForbidden,
+				"ursula": http.StatusCreated,
+				"audrey": http.StatusForbidden,
+				"ada":    http.StatusCreated,
+			},
+		},
+		{
+			name:   "list own files",
+			method: http.MethodGet,
+			path:   FilesEndpoint,
+			expected: map[string]int{
+				"nobody": http.StatusForbidden,
+				"victor": http.StatusOK,
+				"audrey": http.StatusOK,
+				"jan":    http.StatusForbidden,
+			},
+		},
+		{
+			name:   "list all files",
+			method: http.MethodGet,
+			path:   FilesEndpoint + "?all=true",
+			expected: map[string]int{
+				"victor": http.StatusForbidden,
+				"audrey": http.StatusOK,
+				"ada":    http.StatusOK,
+			},
+		},
+		{
+			name:   "download someone else's file",
+			method: http.MethodGet,
+			path:   "/files/owned.jpeg",
+			expected: map[string]int{
+				"nobody": http.StatusForbidden,
+				"victor": http.StatusNotFound,
+				"audrey": http.StatusOK,
+				"ada":    http.StatusOK,
+			},
+		},
+		{
+			name:   "delete someone else's file",
+			method: http.MethodDelete,
+			path:   "/files/owned.jpeg",
+			expected: map[string]int{
+				"victor": http.StatusForbidden,
+				"ursula": http.StatusNotFound,
+				"audrey": http.StatusForbidden,
+				"jan":    http.StatusNoContent,
+			},
+		},
+	}
+	for _, scenario := range scenarios {
+		for user, status := range scenario.expected {
+			t.Run(scenario.name+" as "+user, func(t *testing.T) {
+				store := storagetest.NewMemory()
+				store.Put("owned.jpeg", "image/jpeg", []byte("hello"),
+					map[string]string{"userID": "owner", "fileName": "owned.jpeg"})
+				handler := LoadRESTEndpoints(logrus.New(), business.NewBucketUpload(store, "test"),
+					newAuthenticator(&mockIdentity{users: users}, policy), nil)
+
+				request := httptest.NewRequest(scenario.method, scenario.path, strings.NewReader("hello"))
+				request.Header.Set("Authorization", "Bearer "+user)
+				request.Header.Set("Content-Type", "image/jpeg")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, request)
+				assert.Equal(t, status, w.Code)
+			})
+		}
+	}
+}
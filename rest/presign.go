@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PresignUploadEndpoint returns a URL to upload a file straight to the bucket
+	PresignUploadEndpoint = "/uploads/presign"
+
+	// CompleteUploadEndpoint records a presigned upload once the file is in the bucket
+	CompleteUploadEndpoint = "/uploads/{id}/complete"
+
+	// PresignDownloadEndpoint returns a URL to download a file straight from the bucket
+	PresignDownloadEndpoint = "/files/{id}/presign"
+)
+
+var (
+	errInvalidPresignRequest = foundation.NewError(foundation.InvalidRequest, "invalid presign request")
+	errPresigning            = foundation.NewError(foundation.Internal, "error presigning request")
+)
+
+// PresignHandler lets clients move bytes straight to and from the bucket
+type PresignHandler struct {
+	Files  *business.BucketUpload
+	Logger *logrus.Logger
+	auth   business.Authenticator
+}
+
+func NewPresignHandler(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator) *PresignHandler {
+	return &PresignHandler{
+		Files:  bu,
+		Logger: logger,
+		auth:   auth,
+	}
+}
+
+// presignUploadRequest is the body of a presign request, expiresIn is in seconds
+// and method is PUT (the default) or POST
+type presignUploadRequest struct {
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	MinSize     int64  `json:"minSize"`
+	MaxSize     int64  `json:"maxSize"`
+	ExpiresIn   int64  `json:"expiresIn"`
+	Method      string `json:"method"`
+}
+
+/*
+Upload returns a presigned PUT URL or POST policy
+  - The client sends the file to the bucket then calls Complete with the returned ID
+*/
+func (h *PresignHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	req := &presignUploadRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil || (req.Method != "" && req.Method != http.MethodPut && req.Method != http.MethodPost) {
+		foundation.ErrorResponse(w, r, errInvalidPresignRequest)
+		return
+	}
+	upload, err := h.Files.PresignUpload(r.Context(), principal.UserID, business.PresignOptions{
+		FileName:    req.FileName,
+		ContentType: req.ContentType,
+		MinSize:     req.MinSize,
+		MaxSize:     req.MaxSize,
+		ExpiresIn:   time.Duration(req.ExpiresIn) * time.Second,
+		Post:        req.Method == http.MethodPost,
+	})
+	if err != nil {
+		h.presignError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, upload)
+}
+
+// Complete validates a presigned upload and records it as the user's file
+func (h *PresignHandler) Complete(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	info, err := h.Files.CompleteUpload(r.Context(), principal.UserID, chi.URLParam(r, "id"))
+	if err != nil {
+		h.presignError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, info)
+}
+
+/*
+Download returns a presigned GET URL to a file owned by the user,
+or any file with PermissionReadAll
+  - ?expiresIn sets how long the URL is valid for in seconds
+*/
+func (h *PresignHandler) Download(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionReadOwn, business.PermissionReadAll)
+	if !ok {
+		return
+	}
+	var expiresIn int64
+	if v := r.URL.Query().Get("expiresIn"); v != "" {
+		var err error
+		expiresIn, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			foundation.ErrorResponse(w, r, errInvalidPresignRequest)
+			return
+		}
+	}
+	var (
+		download *business.PresignedDownload
+		err      error
+	)
+	id := fileID(r)
+	if principal.Can(business.PermissionReadAll) {
+		download, err = h.Files.PresignAnyDownload(r.Context(), id, time.Duration(expiresIn)*time.Second)
+	} else {
+		download, err = h.Files.PresignDownload(r.Context(), principal.UserID, id, time.Duration(expiresIn)*time.Second)
+	}
+	if err != nil {
+		h.presignError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, download)
+}
+
+func (h *PresignHandler) presignError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, business.ErrUploadRejected) {
+		h.Logger.Warnf("presigned upload rejected: %v", err)
+	}
+	writeError(w, r, h.Logger, err, errPresigning)
+}
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresign(t *testing.T) {
+	f := newFixture(t, false, "alice", "bob")
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		return f.serve(method, path, token, body, nil)
+	}
+
+	scenarios := []struct {
+		name           string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "without token",
+			body:           `{"contentType":"application/pdf"}`,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown method",
+			token:          "alice",
+			body:           `{"contentType":"application/pdf","method":"PATCH"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unsupported type",
+			token:          "alice",
+			body:           `{"contentType":"text/html"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "post policy",
+			token:          "alice",
+			body:           `{"fileName":"scan.pdf","contentType":"application/pdf","maxSize":10,"method":"POST"}`,
+			expectedStatus: http.StatusCreated,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := serve(http.MethodPost, PresignUploadEndpoint, scenario.token, scenario.body)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+		})
+	}
+
+	w := serve(http.MethodPost, PresignUploadEndpoint, "alice", `{"fileName":"scan.pdf","contentType":"application/pdf"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	upload := &business.PresignedUpload{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), upload))
+	assert.Equal(t, http.MethodPut, upload.Method)
+
+	complete := "/uploads/" + upload.ID + "/complete"
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, complete, "alice", "").Code)
+	f.store.Put(upload.ID, "application/pdf", []byte("pdf"), nil)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, complete, "bob", "").Code)
+	w = serve(http.MethodPost, complete, "alice", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"scan.pdf"`)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/files/"+upload.ID+"/presign", "bob", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/files/"+upload.ID+"/presign?expiresIn=soon", "alice", "").Code)
+	w = serve(http.MethodGet, "/files/"+upload.ID+"/presign?expiresIn=60", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "X-Amz-Expires=60")
+}
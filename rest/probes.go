@@ -5,7 +5,7 @@ import (
 	"net/http"
 	"os"
 
-	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/riyadennis/ingestion-service/business"
 )
 
 // @Summary		Liveness probe
@@ -41,12 +41,25 @@ func Liveness(w http.ResponseWriter, _ *http.Request) {
 }
 
 // @Summary		Readiness probe
-// @Description	Checks if API is ready for traffic (DB available)
+// @Description	Checks if API is ready for traffic, storage, identity server and disk space
 // @Tags			Health
 // @Produce		json
-// @Success		200	{object}	foundation.Response
-// @Failure		500	{object}	foundation.Response
+// @Success		200	{object}	business.HealthReport
+// @Failure		503	{object}	business.HealthReport
 // @Router			/readiness [get]
 func Ready(w http.ResponseWriter, request *http.Request) {
-	_ = foundation.JSONResponse(w, http.StatusOK, "OK", "")
+	Readiness(business.DefaultHealth)(w, request)
+}
+
+// Readiness reports the checks registered with health, with 503 when any fails
+func Readiness(health *business.Health) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := health.Check(r.Context())
+		status := http.StatusOK
+		if !report.Healthy() {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, status, report)
+	}
 }
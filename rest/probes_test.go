@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	scenarios := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "dependencies available", expectedStatus: http.StatusOK},
+		{name: "dependency unavailable", err: errors.New("storage is down"), expectedStatus: http.StatusServiceUnavailable},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			health := business.NewHealth(time.Second, time.Minute)
+			health.Register("storage", func(context.Context) error { return scenario.err })
+			w := httptest.NewRecorder()
+			Readiness(health)(w, httptest.NewRequest(http.MethodGet, ReadinessEndPoint, nil))
+			require.Equal(t, scenario.expectedStatus, w.Code)
+
+			report := &business.HealthReport{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), report))
+			check, ok := report.Checks["storage"]
+			require.True(t, ok)
+			if scenario.err != nil {
+				assert.Equal(t, scenario.err.Error(), check.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SearchEndpoint searches the files of the user
+	SearchEndpoint = "/search"
+
+	// ReindexEndpoint rebuilds the search index from storage on the admin port
+	ReindexEndpoint = "/admin/search/reindex"
+)
+
+var (
+	errInvalidSearchQuery = foundation.NewError(foundation.InvalidRequest, "first must be a number")
+	errSearching          = foundation.NewError(foundation.Internal, "error searching files")
+)
+
+// SearchHandler serves searches over the files the caller may read
+type SearchHandler struct {
+	Index  *business.SearchIndex
+	Logger *logrus.Logger
+	auth   business.Authenticator
+}
+
+func NewSearchHandler(logger *logrus.Logger, index *business.SearchIndex, auth business.Authenticator) *SearchHandler {
+	return &SearchHandler{
+		Index:  index,
+		Logger: logger,
+		auth:   auth,
+	}
+}
+
+/*
+Search returns the files of the authenticated user matching ?q=, best matches first
+  - ?first= is the page size, 20 by default and at most 100
+  - ?after= is the endCursor of the previous page
+  - ?all=true searches the files of every user, it needs PermissionReadAll
+*/
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionReadOwn, business.PermissionReadAll)
+	if !ok {
+		return
+	}
+	if h.Index == nil {
+		foundation.ErrorResponse(w, r, business.ErrSearchDisabled)
+		return
+	}
+	query := r.URL.Query()
+	opts := business.SearchOptions{Query: query.Get("q"), After: query.Get("after")}
+	if first := query.Get("first"); first != "" {
+		var err error
+		if opts.First, err = strconv.Atoi(first); err != nil {
+			foundation.ErrorResponse(w, r, errInvalidSearchQuery)
+			return
+		}
+	}
+	var (
+		res *business.SearchResults
+		err error
+	)
+	if query.Get("all") == "true" {
+		if !principal.Can(business.PermissionReadAll) {
+			foundation.ErrorResponse(w, r, errForbidden)
+			return
+		}
+		res, err = h.Index.SearchAll(r.Context(), opts)
+	} else {
+		res, err = h.Index.Search(r.Context(), principal.UserID, opts)
+	}
+	if err != nil {
+		writeError(w, r, h.Logger, err, errSearching)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// Reindex rebuilds the search index from storage and returns how many files it holds
+func (h *SearchHandler) Reindex(w http.ResponseWriter, r *http.Request) {
+	count, err := h.Index.Reindex(r.Context())
+	if err != nil {
+		writeError(w, r, h.Logger, err, errSearching)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"indexed": count})
+}
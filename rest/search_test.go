@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	logger := logrus.New()
+	f := newFixture(t, false, "alice")
+	f.store.Put("a.pdf", "application/pdf", []byte("%PDF-1.4"),
+		map[string]string{"userID": "alice", "fileName": "invoice-march.pdf"})
+	f.store.Put("b.pdf", "application/pdf", []byte("%PDF-1.4"),
+		map[string]string{"userID": "bob", "fileName": "invoice-april.pdf"})
+	// the search handler is given the index when the endpoints are loaded
+	f.bu.Index = business.NewSearchIndex(f.bu, logger)
+	api := LoadRESTEndpoints(logger, f.bu, f.auth, nil)
+	admin := LoadAdminEndpoints(logger, business.NewAPIKeys(f.bu), nil, f.bu.Index, "admin-secret")
+
+	request := httptest.NewRequest(http.MethodPost, ReindexEndpoint, nil)
+	request.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"indexed": 2}`, w.Body.String())
+
+	scenarios := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+		expectedIDs    []string
+	}{
+		{name: "without token", path: SearchEndpoint + "?q=invoice", expectedStatus: http.StatusUnauthorized},
+		{name: "own files", path: SearchEndpoint + "?q=invoice", token: "alice", expectedStatus: http.StatusOK, expectedIDs: []string{"a.pdf"}},
+		{name: "prefix", path: SearchEndpoint + "?q=mar*", token: "alice", expectedStatus: http.StatusOK, expectedIDs: []string{"a.pdf"}},
+		{name: "no match", path: SearchEndpoint + "?q=april", token: "alice", expectedStatus: http.StatusOK},
+		{name: "every user needs read all", path: SearchEndpoint + "?q=invoice&all=true", token: "alice", expectedStatus: http.StatusForbidden},
+		{name: "empty query", path: SearchEndpoint, token: "alice", expectedStatus: http.StatusBadRequest},
+		{name: "invalid first", path: SearchEndpoint + "?q=invoice&first=ten", token: "alice", expectedStatus: http.StatusBadRequest},
+		{name: "invalid cursor", path: SearchEndpoint + "?q=invoice&after=x", token: "alice", expectedStatus: http.StatusBadRequest},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, scenario.path, nil)
+			if scenario.token != "" {
+				request.Header.Set("Authorization", "Bearer "+scenario.token)
+			}
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, request)
+			require.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.expectedStatus != http.StatusOK {
+				return
+			}
+			res := &business.SearchResults{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(res))
+			var ids []string
+			for _, hit := range res.Hits {
+				ids = append(ids, hit.File.ID)
+			}
+			assert.Equal(t, scenario.expectedIDs, ids)
+		})
+	}
+}
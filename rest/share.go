@@ -0,0 +1,167 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ShareFileEndpoint creates a share link for a file
+	ShareFileEndpoint = "/files/{id}/share"
+
+	// FileSharesEndpoint lists the share links of a file
+	FileSharesEndpoint = "/files/{id}/shares"
+
+	// ShareEndpoint revokes a share link
+	ShareEndpoint = "/shares/{id}"
+
+	// SharedFileEndpoint serves a shared file without authentication
+	SharedFileEndpoint = "/s/{token}"
+
+	// SharePasswordHeader carries the password of a protected share link
+	SharePasswordHeader = "X-Share-Password"
+)
+
+var (
+	errInvalidShareRequest = foundation.NewError(foundation.InvalidRequest, "invalid share request")
+	errSharingFile         = foundation.NewError(foundation.Internal, "error sharing file")
+)
+
+// ShareHandler serves share links
+type ShareHandler struct {
+	Links  *business.Links
+	Logger *logrus.Logger
+	auth   business.Authenticator
+}
+
+func NewShareHandler(logger *logrus.Logger, links *business.Links, auth business.Authenticator) *ShareHandler {
+	return &ShareHandler{
+		Links:  links,
+		Logger: logger,
+		auth:   auth,
+	}
+}
+
+// createShareRequest is the body of a share request, expiresIn is in seconds
+type createShareRequest struct {
+	ExpiresIn    int64  `json:"expiresIn"`
+	MaxDownloads int    `json:"maxDownloads"`
+	Password     string `json:"password"`
+}
+
+// Create returns a signed link to a file owned by the user
+func (h *ShareHandler) Create(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionReadOwn)
+	if !ok {
+		return
+	}
+	req := &createShareRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		foundation.ErrorResponse(w, r, errInvalidShareRequest)
+		return
+	}
+	link, err := h.Links.CreateShare(r.Context(), principal.UserID, fileID(r), business.ShareOptions{
+		ExpiresIn:    time.Duration(req.ExpiresIn) * time.Second,
+		MaxDownloads: req.MaxDownloads,
+		Password:     req.Password,
+	})
+	if err != nil {
+		h.shareError(w, r, err)
+		return
+	}
+	// links are relative when no public URL is configured
+	if strings.HasPrefix(link.URL, "/") {
+		link.URL = requestOrigin(r) + link.URL
+	}
+
+	writeJSON(w, http.StatusCreated, link)
+}
+
+// List returns the share links of a file owned by the user
+func (h *ShareHandler) List(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionReadOwn)
+	if !ok {
+		return
+	}
+	links, err := h.Links.ListShares(r.Context(), principal.UserID, fileID(r))
+	if err != nil {
+		h.shareError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, links)
+}
+
+// Revoke stops a share link created by the user from working
+func (h *ShareHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionReadOwn)
+	if !ok {
+		return
+	}
+	if err := h.Links.RevokeShare(r.Context(), principal.UserID, chi.URLParam(r, "id")); err != nil {
+		h.shareError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+Open streams a shared file, it does not need authentication
+  - Password protected links need the password in X-Share-Password
+    or the password query parameter
+  - Every attempt is logged, successful downloads are also kept on the link
+*/
+func (h *ShareHandler) Open(w http.ResponseWriter, r *http.Request) {
+	password := r.Header.Get(SharePasswordHeader)
+	if password == "" {
+		password = r.URL.Query().Get("password")
+	}
+	link, info, file, err := h.Links.OpenShare(r.Context(), chi.URLParam(r, "token"), password, business.ShareAccess{
+		At:         time.Now().UTC(),
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	})
+	entry := h.Logger.WithFields(logrus.Fields{
+		"remote_addr": r.RemoteAddr,
+		"user_agent":  r.UserAgent(),
+	})
+	if err != nil {
+		entry.WithError(err).Warn("share link access denied")
+		h.shareError(w, r, err)
+		return
+	}
+	entry.WithFields(logrus.Fields{
+		"share":     link.ID,
+		"file":      link.FileID,
+		"downloads": link.Downloads,
+	}).Info("share link accessed")
+
+	writeFile(w, h.Logger, info, file)
+}
+
+func (h *ShareHandler) shareError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, h.Logger, err, errSharingFile)
+}
+
+// requestOrigin is the scheme and host the request was sent to
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host
+}
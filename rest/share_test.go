@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareLinks(t *testing.T) {
+	f := newFixture(t, true, "alice", "bob")
+	f.store.Put("a.jpeg", "image/jpeg", []byte("hello"),
+		map[string]string{"userID": "alice", "fileName": "holiday.jpeg"})
+
+	assert.Equal(t, http.StatusUnauthorized, f.serve(http.MethodPost, "/files/a.jpeg/share", "", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, f.serve(http.MethodPost, "/files/a.jpeg/share", "bob", "", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, f.serve(http.MethodPost, "/files/a.jpeg/share", "alice", `{"expiresIn":-1}`, nil).Code)
+
+	w := f.serve(http.MethodPost, "/files/a.jpeg/share", "alice", `{"maxDownloads":1,"password":"open sesame"}`, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	link := &business.ShareLink{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), link))
+	require.True(t, strings.HasPrefix(link.URL, "http://example.com/s/"), link.URL)
+	path := strings.TrimPrefix(link.URL, "http://example.com")
+
+	scenarios := []struct {
+		name           string
+		path           string
+		password       string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "tampered token",
+			path:           path + "0",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "missing password",
+			path:           path,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong password",
+			path:           path,
+			password:       "wrong",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "download",
+			path:           path,
+			password:       "open sesame",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "hello",
+		},
+		{
+			name:           "download limit reached",
+			path:           path,
+			password:       "open sesame",
+			expectedStatus: http.StatusGone,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := f.serve(http.MethodGet, scenario.path, "", "", http.Header{SharePasswordHeader: {scenario.password}})
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+			if scenario.expectedBody != "" {
+				assert.Equal(t, scenario.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	w = f.serve(http.MethodGet, "/files/a.jpeg/shares", "alice", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var links []business.ShareLink
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &links))
+	require.Len(t, links, 1)
+	assert.Equal(t, 1, links[0].Downloads)
+
+	assert.Equal(t, http.StatusNotFound, f.serve(http.MethodDelete, "/shares/"+link.ID, "bob", "", nil).Code)
+	assert.Equal(t, http.StatusNoContent, f.serve(http.MethodDelete, "/shares/"+link.ID, "alice", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, f.serve(http.MethodGet, path, "", "", nil).Code)
+}
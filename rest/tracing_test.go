@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	spans := tracetest.NewInMemoryExporter()
+	provider := otel.GetTracerProvider()
+	propagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	f := newFixture(t, false)
+
+	scenarios := []struct {
+		name        string
+		path        string
+		traceParent string
+		spanName    string
+		traceID     string
+	}{
+		{name: "route pattern", path: "/files/abc", spanName: "GET /files/{id}"},
+		{name: "unmatched", path: "/nowhere", spanName: "GET unmatched"},
+		{
+			name:        "continues the client trace",
+			path:        LivenessEndPoint,
+			traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			spanName:    "GET /liveness",
+			traceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			spans.Reset()
+			request := httptest.NewRequest(http.MethodGet, scenario.path, nil)
+			if scenario.traceParent != "" {
+				request.Header.Set("traceparent", scenario.traceParent)
+			}
+			f.handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			recorded := spans.GetSpans()
+			require.Len(t, recorded, 1)
+			assert.Equal(t, scenario.spanName, recorded[0].Name)
+			if scenario.traceID != "" {
+				assert.Equal(t, scenario.traceID, recorded[0].SpanContext.TraceID().String())
+			}
+		})
+	}
+}
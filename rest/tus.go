@@ -0,0 +1,244 @@
+package rest
+
+import (
+	"encoding/base64"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TusEndpoint creates resumable uploads and describes the tus server
+	TusEndpoint = "/tus"
+
+	// TusUploadEndpoint resumes, appends to and terminates a resumable upload
+	TusUploadEndpoint = "/tus/{id}"
+
+	// TusVersion is the only tus protocol version supported
+	TusVersion = "1.0.0"
+
+	// TusExtensions are the tus extensions supported
+	TusExtensions = "creation,expiration,checksum,termination"
+
+	// FileIDHeader carries the ID of the stored file once a resumable upload finished
+	FileIDHeader = "X-File-ID"
+
+	tusOffsetContentType = "application/offset+octet-stream"
+	// statusChecksumMismatch is the tus status for chunks that do not match Upload-Checksum
+	statusChecksumMismatch = 460
+)
+
+// TusHeaders are the request headers tus clients send
+var TusHeaders = []string{"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset", "Upload-Checksum"}
+
+var (
+	errInvalidTusRequest = foundation.NewError(foundation.InvalidRequest, "invalid resumable upload request")
+	errTusVersion        = foundation.NewError(foundation.PreconditionFailed, "unsupported tus version")
+	errTusContentType    = foundation.NewError(foundation.UnsupportedType, "chunks must be sent as "+tusOffsetContentType)
+	errTusUpload         = foundation.NewError(foundation.Internal, "error handling resumable upload")
+)
+
+/*
+TusHandler serves resumable uploads following the tus 1.0 protocol
+  - Upload-Metadata keys filename, filetype and checksum (hex encoded SHA-256
+    of the whole file) are used for the stored file
+  - X-File-ID is set on the response to the last chunk and on HEAD once the file is stored
+*/
+type TusHandler struct {
+	Tus    *business.Tus
+	Logger *logrus.Logger
+	auth   business.Authenticator
+}
+
+func NewTusHandler(logger *logrus.Logger, tus *business.Tus, auth business.Authenticator) *TusHandler {
+	return &TusHandler{
+		Tus:    tus,
+		Logger: logger,
+		auth:   auth,
+	}
+}
+
+// Options describes the tus server, it does not need authentication
+func (h *TusHandler) Options(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	w.Header().Set("Tus-Version", TusVersion)
+	w.Header().Set("Tus-Extension", TusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(business.MaxFileSize))
+	w.Header().Set("Tus-Checksum-Algorithm", business.TusChecksumAlgorithms)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create starts a resumable upload of Upload-Length bytes
+func (h *TusHandler) Create(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		foundation.ErrorResponse(w, r, errInvalidTusRequest)
+		return
+	}
+	if length > business.MaxFileSize {
+		foundation.ErrorResponse(w, r, errFileTooLarge)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		foundation.ErrorResponse(w, r, errInvalidTusRequest)
+		return
+	}
+	upload, err := h.Tus.Create(r.Context(), principal.UserID, length, metadata)
+	if err != nil {
+		h.tusError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/tus/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head returns the offset to resume an upload from
+func (h *TusHandler) Head(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	upload, err := h.Tus.Get(r.Context(), principal.UserID, chi.URLParam(r, "id"))
+	if err != nil {
+		h.tusError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Metadata", formatTusMetadata(upload.Metadata))
+	h.writeUpload(w, upload, http.StatusOK)
+}
+
+// Patch appends the body at Upload-Offset, the file is stored once all bytes arrived
+func (h *TusHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusOffsetContentType {
+		foundation.ErrorResponse(w, r, errTusContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		foundation.ErrorResponse(w, r, errInvalidTusRequest)
+		return
+	}
+	var (
+		algorithm string
+		sum       []byte
+	)
+	if checksum := r.Header.Get("Upload-Checksum"); checksum != "" {
+		var encoded string
+		algorithm, encoded, _ = strings.Cut(checksum, " ")
+		sum, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			foundation.ErrorResponse(w, r, errInvalidTusRequest)
+			return
+		}
+	}
+
+	upload, err := h.Tus.Append(r.Context(), principal.UserID, chi.URLParam(r, "id"), offset, r.Body, algorithm, sum)
+	if err != nil {
+		h.Logger.WithFields(logrus.Fields{
+			"upload": chi.URLParam(r, "id"),
+			"offset": offset,
+		}).WithError(err).Warn("resumable upload chunk rejected")
+		h.tusError(w, r, err)
+		return
+	}
+
+	h.writeUpload(w, upload, http.StatusNoContent)
+}
+
+// Delete terminates an upload and discards what was sent
+func (h *TusHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	principal, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Tus.Terminate(r.Context(), principal.UserID, chi.URLParam(r, "id")); err != nil {
+		h.tusError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate checks the tus version and that the user can upload
+func (h *TusHandler) authenticate(w http.ResponseWriter, r *http.Request) (*business.Principal, bool) {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	if r.Header.Get("Tus-Resumable") != TusVersion {
+		w.Header().Set("Tus-Version", TusVersion)
+		foundation.ErrorResponse(w, r, errTusVersion)
+		return nil, false
+	}
+
+	return authenticate(w, r, h.auth, h.Logger, business.PermissionUpload)
+}
+
+func (h *TusHandler) writeUpload(w http.ResponseWriter, upload *business.TusUpload, status int) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.FileID != "" {
+		w.Header().Set(FileIDHeader, upload.FileID)
+	} else {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	}
+	w.WriteHeader(status)
+}
+
+// tusError serves checksum mismatches of chunks with the status the tus checksum extension requires
+func (h *TusHandler) tusError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, business.ErrTusChecksumMismatch) {
+		foundation.ProblemResponse(w, r, statusChecksumMismatch, err)
+		return
+	}
+	writeError(w, r, h.Logger, err, errTusUpload)
+}
+
+// parseTusMetadata decodes Upload-Metadata, comma separated keys each followed
+// by an optional base64 encoded value
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errInvalidTusRequest
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+func formatTusMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTus(t *testing.T) {
+	f := newFixture(t, false, "alice", "bob")
+	serve := func(method, path, token, body string, headers map[string]string) *httptest.ResponseRecorder {
+		header := http.Header{"Tus-Resumable": {TusVersion}}
+		for k, v := range headers {
+			header.Set(k, v)
+		}
+		return f.serve(method, path, token, body, header)
+	}
+
+	w := serve(http.MethodOptions, TusEndpoint, "", "", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, TusExtensions, w.Header().Get("Tus-Extension"))
+
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("hello.pdf")) +
+		",filetype " + base64.StdEncoding.EncodeToString([]byte("application/pdf"))
+	assert.Equal(t, http.StatusPreconditionFailed,
+		serve(http.MethodPost, TusEndpoint, "alice", "", map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "11"}).Code)
+	assert.Equal(t, http.StatusUnauthorized,
+		serve(http.MethodPost, TusEndpoint, "", "", map[string]string{"Upload-Length": "11"}).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		serve(http.MethodPost, TusEndpoint, "alice", "", map[string]string{"Upload-Metadata": metadata}).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge,
+		serve(http.MethodPost, TusEndpoint, "alice", "", map[string]string{"Upload-Length": "999999999999"}).Code)
+
+	w = serve(http.MethodPost, TusEndpoint, "alice", "", map[string]string{"Upload-Length": "11", "Upload-Metadata": metadata})
+	require.Equal(t, http.StatusCreated, w.Code)
+	location := w.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, "/tus/"), location)
+	assert.NotEmpty(t, w.Header().Get("Upload-Expires"))
+
+	chunk := func(offset string, headers map[string]string) map[string]string {
+		h := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": offset}
+		for k, v := range headers {
+			h[k] = v
+		}
+		return h
+	}
+	sum := sha1.Sum([]byte("hello "))
+	scenarios := []struct {
+		name           string
+		token          string
+		body           string
+		headers        map[string]string
+		expectedStatus int
+		expectedOffset string
+	}{
+		{
+			name:           "someone else's upload",
+			token:          "bob",
+			body:           "hello ",
+			headers:        chunk("0", nil),
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "wrong content type",
+			token:          "alice",
+			body:           "hello ",
+			headers:        map[string]string{"Content-Type": "application/pdf", "Upload-Offset": "0"},
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "checksum mismatch",
+			token:          "alice",
+			body:           "jello ",
+			headers:        chunk("0", map[string]string{"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:])}),
+			expectedStatus: statusChecksumMismatch,
+		},
+		{
+			name:           "first chunk",
+			token:          "alice",
+			body:           "hello ",
+			headers:        chunk("0", map[string]string{"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:])}),
+			expectedStatus: http.StatusNoContent,
+			expectedOffset: "6",
+		},
+		{
+			name:           "wrong offset",
+			token:          "alice",
+			body:           "world",
+			headers:        chunk("0", nil),
+			expectedStatus: http.StatusConflict,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := serve(http.MethodPatch, location, scenario.token, scenario.body, scenario.headers)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+			assert.Equal(t, scenario.expectedOffset, w.Header().Get("Upload-Offset"))
+		})
+	}
+
+	w = serve(http.MethodHead, location, "alice", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", w.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = serve(http.MethodPatch, location, "alice", "world", chunk("6", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	fileID := w.Header().Get(FileIDHeader)
+	require.NotEmpty(t, fileID)
+	w = serve(http.MethodGet, "/files/"+fileID, "alice", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello world", w.Body.String())
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, location, "alice", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodHead, location, "alice", "", nil).Code)
+}
@@ -1,33 +1,33 @@
 package rest
 
 import (
-	"errors"
 	"net/http"
 	"strings"
 
-	"github.com/riyadennis/identity-server/app/proto/identity"
 	"github.com/riyadennis/ingestion-service/business"
 	"github.com/riyadennis/ingestion-service/foundation"
 	"github.com/sirupsen/logrus"
 )
 
 var (
-	errInvalidFile         = errors.New("invalid file in the request")
-	errFetchingFile        = errors.New("error fetching file")
-	errAuthenicationFailed = errors.New("failed to authenticate the user")
+	errInvalidFile         = foundation.NewError(foundation.InvalidRequest, "invalid file in the request")
+	errFetchingFile        = foundation.NewError(foundation.Internal, "error fetching file")
+	errAuthenicationFailed = foundation.NewError(foundation.Unauthenticated, "failed to authenticate the user")
 )
 
 type UploadHandler struct {
-	Uploader       *business.BucketUpload
-	Logger         *logrus.Logger
-	identityClient identity.IdentityClient
+	Uploader    *business.BucketUpload
+	Idempotency *business.IdempotentUploads
+	Logger      *logrus.Logger
+	auth        business.Authenticator
 }
 
-func NewUploader(logger *logrus.Logger, bu *business.BucketUpload, idc identity.IdentityClient) *UploadHandler {
+func NewUploader(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator) *UploadHandler {
 	return &UploadHandler{
-		Uploader:       bu,
-		Logger:         logger,
-		identityClient: idc,
+		Uploader:    bu,
+		Idempotency: business.NewEnvIdempotentUploads(bu),
+		Logger:      logger,
+		auth:        auth,
 	}
 }
 
@@ -42,10 +42,44 @@ Upload handles the file upload request
   - 2. application/octet-stream
     Content-Type: image/jpeg, image/png, application/pdf
     body: file content
+  - Retries sending the same Idempotency-Key get the original result
+    with Idempotent-Replayed set instead of storing the file again
+  - ?folder=a/b stores the file in a folder of the user, it is created when missing
+  - Responds 201 with the stored file and its download URL in Location
 */
 func (u *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, u.auth, u.Logger, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	fu, ok := readFile(w, r, u.Logger)
+	if !ok {
+		return
+	}
+	fu.UserID = principal.UserID
+	fu.Folder = r.URL.Query().Get("folder")
+
+	replayed, err := u.Idempotency.Upload(r.Context(), r.Header.Get(business.IdempotencyKeyHeader), fu)
+	if err != nil {
+		writeError(w, r, u.Logger, err, errFetchingFile)
+		return
+	}
+	info, err := u.Uploader.StatFile(r.Context(), principal.UserID, fu.ID)
+	if err != nil {
+		writeError(w, r, u.Logger, err, errFetchingFile)
+		return
+	}
+	if replayed {
+		w.Header().Set(business.IdempotentReplayedHeader, "true")
+	}
+	w.Header().Set("Location", fileLocation(fu.ID))
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// readFile reads the file from a multipart or binary request
+func readFile(w http.ResponseWriter, r *http.Request, logger *logrus.Logger) (*business.FileUpload, bool) {
 	contentType := r.Header.Get("Content-Type")
-	u.Logger.Infof("uploading file content type: %s", contentType)
+	logger.Infof("uploading file content type: %s", contentType)
 	var (
 		fu  *business.FileUpload
 		err error
@@ -53,34 +87,19 @@ func (u *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	if strings.Contains(contentType, "multipart/form-data") {
 		fu, err = business.HandleFormData(w, r)
 		if err != nil {
-			u.Logger.Errorf("failed to upload form data, got error: %v", err)
-			foundation.ErrorResponse(w, http.StatusBadRequest,
-				errInvalidFile, foundation.InvalidRequest)
-			return
+			logger.Errorf("failed to upload form data, got error: %v", err)
+			foundation.ErrorResponse(w, r, errInvalidFile)
+			return nil, false
 		}
 
 	} else {
-		fu, err = business.HandleBinaryData(r)
+		fu, err = business.HandleBinaryData(w, r)
 		if err != nil {
-			u.Logger.Errorf("failed to handle binary data, got error: %v", err)
-			foundation.ErrorResponse(w, http.StatusBadRequest,
-				errInvalidFile, foundation.InvalidRequest)
-			return
+			logger.Errorf("failed to handle binary data, got error: %v", err)
+			foundation.ErrorResponse(w, r, errInvalidFile)
+			return nil, false
 		}
 	}
-	userID, err := business.UsrIDFromToken(r.Context(), r, u.identityClient)
-	if err != nil {
-		u.Logger.Errorf("failed to fetch userID from identity server: %v", err)
-		foundation.ErrorResponse(w, http.StatusUnauthorized,
-			errAuthenicationFailed, foundation.InvalidRequest)
-	}
-	fu.UserID = userID
-
-	err = fu.Upload(r.Context(), u.Uploader.Storage, u.Uploader.BucketName)
-	if err != nil {
-		u.Logger.Errorf("failed to read file: %v", err)
-		foundation.ErrorResponse(w, http.StatusInternalServerError,
-			errFetchingFile, foundation.InvalidRequest)
-	}
 
+	return fu, true
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/riyadennis/ingestion-service/business"
 	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -24,17 +25,27 @@ func TestUpload(t *testing.T) {
 		storage          business.Storage
 		expectedStatus   int
 		expectedResponse string
+		expectedCode     string
 	}{
+		{
+			name:             "unauthenticated",
+			request:          httptest.NewRequest(http.MethodPost, UploadEndpoint, bytes.NewReader([]byte("hello"))),
+			expectedStatus:   http.StatusUnauthorized,
+			expectedResponse: errAuthenicationFailed.Error(),
+			expectedCode:     foundation.Unauthenticated,
+		},
 		{
 			name: "invalid file in form",
 			request: func() *http.Request {
 				content := bytes.NewReader([]byte("hello"))
 				request := httptest.NewRequest(http.MethodPost, UploadEndpoint, content)
 				request.Header.Set("Content-Type", "multipart/form-data")
+				request.Header.Set("Authorization", "Bearer alice")
 				return request
 			}(),
 			expectedStatus:   http.StatusBadRequest,
 			expectedResponse: errInvalidFile.Error(),
+			expectedCode:     foundation.InvalidRequest,
 		},
 		{
 			name: "unsupported content type",
@@ -42,10 +53,12 @@ func TestUpload(t *testing.T) {
 				content := bytes.NewReader([]byte("hello"))
 				request := httptest.NewRequest(http.MethodPost, UploadEndpoint, content)
 				request.Header.Set("Content-Type", "INVALID")
+				request.Header.Set("Authorization", "Bearer alice")
 				return request
 			}(),
 			expectedStatus:   http.StatusBadRequest,
 			expectedResponse: errInvalidFile.Error(),
+			expectedCode:     foundation.InvalidRequest,
 		},
 		{
 			name: "upload failed",
@@ -53,37 +66,58 @@ func TestUpload(t *testing.T) {
 				content := bytes.NewReader([]byte("hello"))
 				request := httptest.NewRequest(http.MethodPost, UploadEndpoint, content)
 				request.Header.Set("Content-Type", "image/jpeg")
+				request.Header.Set("Authorization", "Bearer alice")
 				return request
 			}(),
 			storage: &MockStorage{
 				err: errors.New("failed to upload"),
 			},
-			expectedStatus: http.StatusOK,
+			expectedStatus:   http.StatusInternalServerError,
+			expectedResponse: errFetchingFile.Error(),
+			expectedCode:     foundation.Internal,
 		},
 		{
-			name:           "success",
-			request:        requestWithFile(t),
-			storage:        &MockStorage{},
-			expectedStatus: http.StatusOK,
+			name: "success",
+			request: func() *http.Request {
+				request := requestWithFile(t)
+				request.Header.Set("Authorization", "Bearer alice")
+				return request
+			}(),
+			storage:        storagetest.NewMemory(),
+			expectedStatus: http.StatusCreated,
 		},
 	}
 	logger := logrus.New()
+	auth := newAuthenticator(&mockIdentity{users: map[string]string{"Bearer alice": "alice"}}, business.DefaultPolicy())
 	for _, scenario := range scenarios {
 		t.Run(scenario.name, func(t *testing.T) {
-			up := NewUploader(logger, business.NewBucketUpload(scenario.storage, "test"), nil)
+			up := NewUploader(logger, business.NewBucketUpload(scenario.storage, "test"), auth)
 			w := httptest.NewRecorder()
 			up.Upload(w, scenario.request)
 			data, err := io.ReadAll(w.Result().Body)
 			assert.NoError(t, err)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
 			if scenario.expectedResponse != "" {
-				res := &foundation.Response{}
+				res := &foundation.Problem{}
 				err = json.Unmarshal(data, res)
 				assert.NoError(t, err)
-				assert.Equal(t, scenario.expectedStatus, w.Code)
-				assert.Equal(t, scenario.expectedResponse, res.Message)
+				assert.Equal(t, foundation.ProblemContentType, w.Header().Get("Content-Type"))
+				assert.Equal(t, scenario.expectedResponse, res.Detail)
+				assert.Equal(t, scenario.expectedCode, res.Code)
+				return
 			}
+			info := &business.FileInfo{}
+			err = json.Unmarshal(data, info)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, info.ID)
+			assert.Equal(t, "/files/"+info.ID, w.Header().Get("Location"))
+			assert.Equal(t, "test.txt", info.Name)
+			assert.Equal(t, "alice", info.UserID)
+			assert.Equal(t, "application/octet-stream", info.ContentType)
+			assert.NotEmpty(t, info.Checksum)
+			assert.NotZero(t, info.Size)
+			assert.False(t, info.CreatedAt.IsZero())
 		})
-
 	}
 }
 
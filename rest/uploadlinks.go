@@ -0,0 +1,167 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// UploadLinksEndpoint creates upload links for guests
+	UploadLinksEndpoint = "/upload-links"
+
+	// UploadLinkEndpoint revokes an upload link
+	UploadLinkEndpoint = "/upload-links/{id}"
+
+	// GuestUploadEndpoint accepts files sent through an upload link without authentication
+	GuestUploadEndpoint = "/upload/{token}"
+)
+
+// formOverhead leaves room for the boundaries and fields of multipart bodies
+const formOverhead = 64 * 1024
+
+var (
+	errInvalidUploadLinkRequest = foundation.NewError(foundation.InvalidRequest, "invalid upload link request")
+	errGuestUpload              = foundation.NewError(foundation.Internal, "error uploading file")
+)
+
+// UploadLinksHandler serves upload links
+type UploadLinksHandler struct {
+	Links  *business.Links
+	Logger *logrus.Logger
+	auth   business.Authenticator
+}
+
+func NewUploadLinksHandler(logger *logrus.Logger, links *business.Links, auth business.Authenticator) *UploadLinksHandler {
+	return &UploadLinksHandler{
+		Links:  links,
+		Logger: logger,
+		auth:   auth,
+	}
+}
+
+// createUploadLinkRequest is the body of an upload link request, expiresIn is in seconds
+type createUploadLinkRequest struct {
+	ExpiresIn    int64    `json:"expiresIn"`
+	MaxFiles     int      `json:"maxFiles"`
+	MaxTotalSize int64    `json:"maxTotalSize"`
+	AllowedTypes []string `json:"allowedTypes"`
+	Folder       string   `json:"folder"`
+}
+
+// guestUploadResponse is returned to guests, it does not reveal who the file belongs to
+type guestUploadResponse struct {
+	ID       string `json:"id"`
+	Checksum string `json:"checksum"`
+}
+
+// Create returns a link guests can upload files to the user's bucket with
+func (h *UploadLinksHandler) Create(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	req := &createUploadLinkRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		foundation.ErrorResponse(w, r, errInvalidUploadLinkRequest)
+		return
+	}
+	link, err := h.Links.CreateUploadLink(r.Context(), principal.UserID, business.UploadLinkOptions{
+		ExpiresIn:    time.Duration(req.ExpiresIn) * time.Second,
+		MaxFiles:     req.MaxFiles,
+		MaxTotalSize: req.MaxTotalSize,
+		AllowedTypes: req.AllowedTypes,
+		Folder:       req.Folder,
+	})
+	if err != nil {
+		h.uploadLinkError(w, r, err)
+		return
+	}
+	// links are relative when no public URL is configured
+	if strings.HasPrefix(link.URL, "/") {
+		link.URL = requestOrigin(r) + link.URL
+	}
+
+	writeJSON(w, http.StatusCreated, link)
+}
+
+// Revoke stops an upload link created by the user from accepting files
+func (h *UploadLinksHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.auth, h.Logger, business.PermissionUpload)
+	if !ok {
+		return
+	}
+	if err := h.Links.RevokeUploadLink(r.Context(), principal.UserID, chi.URLParam(r, "id")); err != nil {
+		h.uploadLinkError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+Upload stores a file sent by a guest, it does not need authentication
+  - The body is the same as for /upload, it is only read once the token is verified
+    and is limited to the size left on the link
+  - The file belongs to the user who created the link
+  - Every attempt is logged
+*/
+func (h *UploadLinksHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	link, fu, err := h.Links.UploadWithLink(r.Context(), chi.URLParam(r, "token"), func(limit int64) (*business.FileUpload, error) {
+		return readGuestFile(w, r, limit)
+	})
+	entry := h.Logger.WithFields(logrus.Fields{
+		"remote_addr": r.RemoteAddr,
+		"user_agent":  r.UserAgent(),
+	})
+	if err != nil {
+		entry.WithError(err).Warn("guest upload rejected")
+		h.uploadLinkError(w, r, err)
+		return
+	}
+	entry.WithFields(logrus.Fields{
+		"upload_link": link.ID,
+		"user":        link.UserID,
+		"file":        fu.ID,
+	}).Info("guest upload accepted")
+
+	writeJSON(w, http.StatusCreated, &guestUploadResponse{ID: fu.ID, Checksum: fu.Checksum})
+}
+
+// readGuestFile reads the file from a multipart or binary body of at most limit bytes
+func readGuestFile(w http.ResponseWriter, r *http.Request, limit int64) (*business.FileUpload, error) {
+	var (
+		fu  *business.FileUpload
+		err error
+	)
+	if strings.Contains(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, limit+formOverhead)
+		fu, err = business.HandleFormData(w, r)
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		fu, err = business.HandleBinaryData(w, r)
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return nil, business.ErrUploadLinkTooLarge
+	case errors.Is(err, business.ErrUnsupportedFileType):
+		return nil, err
+	case err != nil:
+		return nil, errors.Join(errInvalidFile, err)
+	}
+
+	return fu, nil
+}
+
+func (h *UploadLinksHandler) uploadLinkError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, h.Logger, err, errGuestUpload)
+}
@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadLinks(t *testing.T) {
+	f := newFixture(t, true, "alice", "bob")
+	serve := func(method, path, token, contentType, body string) *httptest.ResponseRecorder {
+		return f.serve(method, path, token, body, http.Header{
+			"Content-Type": {contentType},
+			"X-Filename":   {"invoice.pdf"},
+		})
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, UploadLinksEndpoint, "", "application/json", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, UploadLinksEndpoint, "alice", "application/json", `{"folder":"../x"}`).Code)
+
+	w := serve(http.MethodPost, UploadLinksEndpoint, "alice", "application/json",
+		`{"maxFiles":1,"maxTotalSize":5,"allowedTypes":["application/pdf"],"folder":"acme"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	link := &business.UploadLink{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), link))
+	require.True(t, strings.HasPrefix(link.URL, "http://example.com/upload/"), link.URL)
+	path := strings.TrimPrefix(link.URL, "http://example.com")
+
+	scenarios := []struct {
+		name           string
+		path           string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "tampered token",
+			path:           path + "0",
+			contentType:    "application/pdf",
+			body:           "pdf",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "type not allowed",
+			path:           path,
+			contentType:    "image/png",
+			body:           "png",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "too large",
+			path:           path,
+			contentType:    "application/pdf",
+			body:           "too large",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "upload",
+			path:           path,
+			contentType:    "application/pdf",
+			body:           "pdf",
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "file limit reached",
+			path:           path,
+			contentType:    "application/pdf",
+			body:           "pdf",
+			expectedStatus: http.StatusGone,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := serve(http.MethodPost, scenario.path, "", scenario.contentType, scenario.body)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+		})
+	}
+
+	w = serve(http.MethodGet, FilesEndpoint, "alice", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var files []business.FileInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &files))
+	require.Len(t, files, 1)
+	assert.Equal(t, "invoice.pdf", files[0].Name)
+	assert.Equal(t, "acme", files[0].Folder)
+	assert.True(t, files[0].Guest)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/upload-links/"+link.ID, "bob", "", "").Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/upload-links/"+link.ID, "alice", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, path, "", "application/pdf", "pdf").Code)
+}
+
+// unreadBody fails the test when a handler reads it
+type unreadBody struct {
+	t *testing.T
+}
+
+func (b unreadBody) Read([]byte) (int, error) {
+	b.t.Error("body read before the upload link was verified")
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestUploadLinksRejectBeforeReading(t *testing.T) {
+	f := newFixture(t, true, "alice")
+	w := f.serve(http.MethodPost, UploadLinksEndpoint, "alice", `{"maxFiles":1}`, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	link := &business.UploadLink{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), link))
+	path := strings.TrimPrefix(link.URL, "http://example.com")
+	w = f.serve(http.MethodPost, path, "", "pdf", http.Header{"Content-Type": {"application/pdf"}})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	scenarios := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "bad token",
+			path:           "/upload/bad.token.signature",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "file limit reached",
+			path:           path,
+			expectedStatus: http.StatusGone,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, scenario.path, unreadBody{t: t})
+			request.ContentLength = business.MaxFileSize
+			request.Header.Set("Content-Type", "application/pdf")
+			w := httptest.NewRecorder()
+			f.handler.ServeHTTP(w, request)
+			assert.Equal(t, scenario.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryAuthInterceptor resolves the bearer token in the authorization
+// metadata to the caller using auth
+func UnaryAuthInterceptor(auth business.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, auth)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor is UnaryAuthInterceptor for streaming calls
+func StreamAuthInterceptor(auth business.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), auth)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, auth business.Authenticator) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = business.WithRequestInfo(ctx, requestInfo(ctx, md))
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		if !business.IsAPIKey(keys[0]) {
+			return nil, status.Error(codes.Unauthenticated, business.ErrInvalidAPIKey.Error())
+		}
+		principal, err := auth.Authenticate(ctx, keys[0])
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "failed to authenticate the api key")
+		}
+		return business.WithPrincipal(ctx, principal), nil
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+	token, err := business.BearerToken(values[0])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	principal, err := auth.Authenticate(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "failed to authenticate the user")
+	}
+
+	return business.WithPrincipal(ctx, principal), nil
+}
+
+// requestInfo takes the request ID from the x-request-id metadata and the client IP from the peer
+func requestInfo(ctx context.Context, md metadata.MD) *business.RequestInfo {
+	info := &business.RequestInfo{}
+	if ids := md.Get("x-request-id"); len(ids) > 0 {
+		info.ID = ids[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		info.ClientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(info.ClientIP); err == nil {
+			info.ClientIP = host
+		}
+	}
+
+	return info
+}
+
+// authenticatedStream carries the context holding the principal
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// userIDFromContext returns the caller once it was granted perm
+func userIDFromContext(ctx context.Context, perm business.Permission) (string, error) {
+	userID, _ := ctx.Value(business.UserIDContextKey).(string)
+	if userID == "" {
+		return "", status.Error(codes.Unauthenticated, "userID not present in context")
+	}
+	if p, ok := business.PrincipalFromContext(ctx); !ok || !p.Can(perm) {
+		return "", status.Errorf(codes.PermissionDenied, "%s permission required", perm)
+	}
+
+	return userID, nil
+}
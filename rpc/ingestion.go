@@ -0,0 +1,264 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/foundation"
+	"github.com/riyadennis/ingestion-service/proto/ingestion"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// chunkSize is the size of the chunks sent by Download
+const chunkSize = 64 * 1024
+
+var (
+	errUnexpectedMetadata = errors.New("metadata must only be sent in the first message")
+	errSizeExceeded       = errors.New("stream carries more than size bytes")
+)
+
+// IngestionService implements the gRPC ingestion API on top of the bucket
+type IngestionService struct {
+	ingestion.UnimplementedIngestionServiceServer
+	Uploader *business.BucketUpload
+	Logger   *logrus.Logger
+}
+
+func NewIngestionService(logger *logrus.Logger, bu *business.BucketUpload) *IngestionService {
+	return &IngestionService{
+		Uploader: bu,
+		Logger:   logger,
+	}
+}
+
+/*
+Upload stores a file sent as a stream
+  - First message must carry the metadata
+  - Following messages carry chunks of the file, they are read as the
+    file is written so the stream is never buffered twice
+*/
+func (s *IngestionService) Upload(stream ingestion.IngestionService_UploadServer) error {
+	ctx := stream.Context()
+	userID, err := userIDFromContext(ctx, business.PermissionUpload)
+	if err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	meta := first.GetMetadata()
+	if meta == nil {
+		return status.Error(codes.InvalidArgument, "first message must contain the metadata")
+	}
+	if meta.GetSize() <= 0 || meta.GetSize() > business.MaxFileSize {
+		return status.Errorf(codes.InvalidArgument, "size must be between 1 and %d bytes", business.MaxFileSize)
+	}
+	s.Logger.Infof("uploading file content type: %s", meta.GetContentType())
+
+	fu := &business.FileUpload{
+		RealName:    meta.GetFileName(),
+		FileName:    business.SanitizeFilename(meta.GetFileName()),
+		File:        &chunkReader{stream: stream, left: meta.GetSize()},
+		Size:        meta.GetSize(),
+		ContentType: meta.GetContentType(),
+		UserID:      userID,
+		Checksum:    meta.GetChecksum(),
+	}
+	err = s.Uploader.Upload(ctx, fu)
+	switch {
+	case invalidUpload(err),
+		errors.Is(err, errUnexpectedMetadata),
+		errors.Is(err, errSizeExceeded):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return status.Error(codes.InvalidArgument, "stream ended before size bytes were sent")
+	case err != nil:
+		s.Logger.Errorf("failed to upload file: %v", err)
+		return status.Error(codes.Internal, "failed to upload file")
+	}
+
+	info, err := s.Uploader.StatFile(ctx, userID, fu.ID)
+	if err != nil {
+		return s.fileError(err)
+	}
+
+	return stream.SendAndClose(fileInfoToProto(info))
+}
+
+// Download sends the file details followed by its content in chunks
+func (s *IngestionService) Download(req *ingestion.DownloadRequest, stream ingestion.IngestionService_DownloadServer) error {
+	ctx := stream.Context()
+	userID, err := userIDFromContext(ctx, business.PermissionReadOwn)
+	if err != nil {
+		return err
+	}
+	info, file, err := s.Uploader.GetFile(ctx, userID, req.GetId())
+	if err != nil {
+		return s.fileError(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	err = stream.Send(&ingestion.DownloadResponse{
+		Data: &ingestion.DownloadResponse_Info{Info: fileInfoToProto(info)},
+	})
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			sErr := stream.Send(&ingestion.DownloadResponse{
+				Data: &ingestion.DownloadResponse_Chunk{Chunk: buf[:n]},
+			})
+			if sErr != nil {
+				return sErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			s.Logger.Errorf("failed to read file: %v", err)
+			return status.Error(codes.Internal, "failed to read file")
+		}
+	}
+}
+
+// Stat returns the details of a file
+func (s *IngestionService) Stat(ctx context.Context, req *ingestion.StatRequest) (*ingestion.FileInfo, error) {
+	userID, err := userIDFromContext(ctx, business.PermissionReadOwn)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.Uploader.StatFile(ctx, userID, req.GetId())
+	if err != nil {
+		return nil, s.fileError(err)
+	}
+
+	return fileInfoToProto(info), nil
+}
+
+// List returns the files uploaded by the user
+func (s *IngestionService) List(ctx context.Context, _ *ingestion.ListRequest) (*ingestion.ListResponse, error) {
+	userID, err := userIDFromContext(ctx, business.PermissionReadOwn)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.Uploader.ListFiles(ctx, userID, business.FileFilter{})
+	if err != nil {
+		return nil, s.fileError(err)
+	}
+	res := &ingestion.ListResponse{Files: make([]*ingestion.FileInfo, 0, len(files))}
+	for _, f := range files {
+		res.Files = append(res.Files, fileInfoToProto(f))
+	}
+
+	return res, nil
+}
+
+// Delete removes a file
+func (s *IngestionService) Delete(ctx context.Context, req *ingestion.DeleteRequest) (*ingestion.DeleteResponse, error) {
+	userID, err := userIDFromContext(ctx, business.PermissionDeleteOwn)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Uploader.DeleteFile(ctx, userID, req.GetId()); err != nil {
+		return nil, s.fileError(err)
+	}
+
+	return &ingestion.DeleteResponse{}, nil
+}
+
+// invalidUpload reports whether the upload failed on what the client sent,
+// such as its content type, checksum, metadata or folder
+func invalidUpload(err error) bool {
+	switch foundation.Code(err) {
+	case foundation.InvalidRequest, foundation.UnsupportedType, foundation.ChecksumMismatch:
+		return true
+	}
+
+	return false
+}
+
+func (s *IngestionService) fileError(err error) error {
+	if errors.Is(err, business.ErrFileNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	s.Logger.Errorf("storage error: %v", err)
+
+	return status.Error(codes.Internal, "storage error")
+}
+
+func fileInfoToProto(f *business.FileInfo) *ingestion.FileInfo {
+	return &ingestion.FileInfo{
+		Id:          f.ID,
+		Name:        f.Name,
+		Size:        f.Size,
+		ContentType: f.ContentType,
+		UserId:      f.UserID,
+		Checksum:    f.Checksum,
+		CreatedAt:   timestamppb.New(f.CreatedAt),
+	}
+}
+
+/*
+chunkReader reads the chunks of an upload stream as one reader
+  - Chunks past the declared size fail with errSizeExceeded
+  - Once the size was received the stream must end, so extra chunks fail
+    the upload before the file is stored
+*/
+type chunkReader struct {
+	stream ingestion.IngestionService_UploadServer
+	buf    []byte
+	// left is how many bytes the client can still send
+	left int64
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		if int64(len(chunk)) > r.left {
+			return 0, errSizeExceeded
+		}
+		r.left -= int64(len(chunk))
+		if r.left == 0 && len(chunk) > 0 {
+			_, err := r.recv()
+			switch {
+			case err == nil:
+				return 0, errSizeExceeded
+			case !errors.Is(err, io.EOF):
+				return 0, err
+			}
+		}
+		r.buf = chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// recv returns the next chunk of the stream
+func (r *chunkReader) recv() ([]byte, error) {
+	req, err := r.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if req.GetMetadata() != nil {
+		return nil, errUnexpectedMetadata
+	}
+
+	return req.GetChunk(), nil
+}
@@ -0,0 +1,246 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/riyadennis/identity-server/app/proto/identity"
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/internal/storagetest"
+	"github.com/riyadennis/ingestion-service/proto/ingestion"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// mockIdentity resolves bearer tokens to user IDs
+type mockIdentity struct {
+	users map[string]string
+}
+
+func (m *mockIdentity) Login(_ context.Context, _ *identity.LoginRequest, _ ...grpc.CallOption) (*identity.LoginResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockIdentity) Me(ctx context.Context, _ *identity.UserRequest, _ ...grpc.CallOption) (*identity.UserResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for _, auth := range md.Get("Authorization") {
+		if id, ok := m.users[auth]; ok {
+			return &identity.UserResponse{ID: &id}, nil
+		}
+	}
+	return nil, errors.New("invalid token")
+}
+
+func newTestClient(t *testing.T) ingestion.IngestionServiceClient {
+	t.Helper()
+	idc := &mockIdentity{users: map[string]string{"Bearer alice": "alice"}}
+	bu := business.NewBucketUpload(storagetest.NewMemory(), "test")
+	s, err := NewServer(logrus.New(), bu,
+		business.NewPolicyAuthenticator(business.NewIdentityAuthenticator(idc), business.DefaultPolicy()), "0")
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		_ = s.grpcServer.Serve(listener)
+	}()
+	t.Cleanup(s.grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return ingestion.NewIngestionServiceClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func upload(ctx context.Context, c ingestion.IngestionServiceClient, meta *ingestion.UploadMetadata, content []byte) (*ingestion.FileInfo, error) {
+	stream, err := c.Upload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = stream.Send(&ingestion.UploadRequest{Data: &ingestion.UploadRequest_Metadata{Metadata: meta}})
+	if err != nil {
+		return nil, err
+	}
+	// send in small chunks to exercise reassembly
+	for chunk := range slices.Chunk(content, 1000) {
+		err = stream.Send(&ingestion.UploadRequest{Data: &ingestion.UploadRequest_Chunk{Chunk: chunk}})
+		if errors.Is(err, io.EOF) {
+			// the server ended the call, its status is returned by CloseAndRecv
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stream.CloseAndRecv()
+}
+
+func TestIngestionService(t *testing.T) {
+	c := newTestClient(t)
+	ctx := withToken("alice")
+	content, err := os.ReadFile("../testdata/image1.jpg")
+	require.NoError(t, err)
+
+	info, err := upload(ctx, c, &ingestion.UploadMetadata{
+		FileName:    "image1.jpg",
+		ContentType: "image/jpeg",
+		Size:        int64(len(content)),
+	}, content)
+	require.NoError(t, err)
+	assert.Equal(t, "image1.jpg", info.GetName())
+	assert.Equal(t, "alice", info.GetUserId())
+	assert.Equal(t, int64(len(content)), info.GetSize())
+
+	stat, err := c.Stat(ctx, &ingestion.StatRequest{Id: info.GetId()})
+	require.NoError(t, err)
+	assert.Equal(t, info.GetChecksum(), stat.GetChecksum())
+
+	list, err := c.List(ctx, &ingestion.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetFiles(), 1)
+
+	stream, err := c.Download(ctx, &ingestion.DownloadRequest{Id: info.GetId()})
+	require.NoError(t, err)
+	first, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, info.GetId(), first.GetInfo().GetId())
+	var downloaded bytes.Buffer
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		downloaded.Write(res.GetChunk())
+	}
+	assert.Equal(t, content, downloaded.Bytes())
+
+	_, err = c.Delete(ctx, &ingestion.DeleteRequest{Id: info.GetId()})
+	require.NoError(t, err)
+	_, err = c.Stat(ctx, &ingestion.StatRequest{Id: info.GetId()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestIngestionServiceErrors(t *testing.T) {
+	c := newTestClient(t)
+	scenarios := []struct {
+		name         string
+		ctx          context.Context
+		meta         *ingestion.UploadMetadata
+		content      []byte
+		expectedCode codes.Code
+	}{
+		{
+			name:         "missing token",
+			ctx:          context.Background(),
+			meta:         &ingestion.UploadMetadata{ContentType: "image/jpeg", Size: 5},
+			content:      []byte("hello"),
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "invalid token",
+			ctx:          withToken("mallory"),
+			meta:         &ingestion.UploadMetadata{ContentType: "image/jpeg", Size: 5},
+			content:      []byte("hello"),
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "unsupported type",
+			ctx:          withToken("alice"),
+			meta:         &ingestion.UploadMetadata{ContentType: "text/plain", Size: 5},
+			content:      []byte("hello"),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "fewer bytes than declared",
+			ctx:          withToken("alice"),
+			meta:         &ingestion.UploadMetadata{ContentType: "image/jpeg", Size: 10},
+			content:      []byte("hello"),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "more bytes than declared in one chunk",
+			ctx:          withToken("alice"),
+			meta:         &ingestion.UploadMetadata{ContentType: "image/jpeg", Size: 5},
+			content:      []byte("hello world"),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "more bytes than declared in a later chunk",
+			ctx:          withToken("alice"),
+			meta:         &ingestion.UploadMetadata{ContentType: "image/jpeg", Size: 1000},
+			content:      bytes.Repeat([]byte("a"), 1001),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "checksum mismatch",
+			ctx:          withToken("alice"),
+			meta:         &ingestion.UploadMetadata{ContentType: "image/jpeg", Size: 5, Checksum: "0000"},
+			content:      []byte("hello"),
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "missing size",
+			ctx:          withToken("alice"),
+			meta:         &ingestion.UploadMetadata{ContentType: "image/jpeg"},
+			content:      []byte("hello"),
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			_, err := upload(scenario.ctx, c, scenario.meta, scenario.content)
+			assert.Equal(t, scenario.expectedCode, status.Code(err))
+		})
+	}
+
+	list, err := c.List(withToken("alice"), &ingestion.ListRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, list.GetFiles(), "failed uploads are not stored")
+}
+
+func TestInvalidUpload(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "invalid metadata", err: business.ErrInvalidMetadata, expected: true},
+		{name: "metadata too large", err: business.ErrMetadataTooLarge, expected: true},
+		{name: "invalid folder", err: business.ErrInvalidFolder, expected: true},
+		{name: "unsupported type", err: business.ErrUnsupportedFileType, expected: true},
+		{name: "checksum mismatch", err: business.ErrChecksumMismatch, expected: true},
+		{name: "storage error", err: errors.New("connection refused")},
+		{name: "no error"},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			assert.Equal(t, scenario.expected, invalidUpload(scenario.err))
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/riyadennis/ingestion-service/business"
+	"github.com/riyadennis/ingestion-service/proto/ingestion"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// shutdownTimeout is how long in-flight streams get to finish before they are cancelled
+const shutdownTimeout = 30 * time.Second
+
+var errEmptyPort = errors.New("port number empty")
+
+// Server have all the setup needed to run and shut down the gRPC server
+type Server struct {
+	grpcServer  *grpc.Server
+	addr        string
+	Logger      *logrus.Logger
+	ServerError chan error
+	ShutDown    chan os.Signal
+}
+
+// NewServer creates a gRPC server with the ingestion service registered
+func NewServer(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator, port string) (*Server, error) {
+	if port == "" {
+		return nil, errEmptyPort
+	}
+	gs := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(UnaryAuthInterceptor(auth)),
+		grpc.ChainStreamInterceptor(StreamAuthInterceptor(auth)),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: 5 * time.Minute,
+			Time:              time.Minute,
+			Timeout:           10 * time.Second,
+		}),
+	)
+	ingestion.RegisterIngestionServiceServer(gs, NewIngestionService(logger, bu))
+
+	return &Server{
+		grpcServer:  gs,
+		addr:        ":" + port,
+		Logger:      logger,
+		ServerError: make(chan error, 1),
+		ShutDown:    make(chan os.Signal, 1),
+	}, nil
+}
+
+// Run starts the gRPC server and waits to receive from shutdown and error channels
+func (s *Server) Run() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		s.Logger.Infof("gRPC server running on %s", s.addr)
+		s.ServerError <- s.grpcServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-s.ServerError:
+		if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			return err
+		}
+	case sig := <-s.ShutDown:
+		s.Logger.Infof("gRPC server: %v: start shutdown", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		stopped := make(chan struct{})
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpcServer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
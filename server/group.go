@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Group runs several servers in one process, when one of them stops
+// or the group receives a shutdown signal every server is shut down
+type Group struct {
+	Logger   *logrus.Logger
+	ShutDown chan os.Signal
+	members  []member
+}
+
+type member struct {
+	name     string
+	run      func() error
+	shutDown chan os.Signal
+}
+
+type result struct {
+	name string
+	err  error
+}
+
+// NewGroup creates a group with an initialised shutdown channel
+func NewGroup(logger *logrus.Logger) *Group {
+	return &Group{
+		Logger:   logger,
+		ShutDown: make(chan os.Signal, 1),
+	}
+}
+
+// Add registers a server, run must block until the server stops
+// and return once a signal is sent to shutDown
+func (g *Group) Add(name string, run func() error, shutDown chan os.Signal) {
+	g.members = append(g.members, member{
+		name:     name,
+		run:      run,
+		shutDown: shutDown,
+	})
+}
+
+// Run starts all servers and waits for them to drain
+func (g *Group) Run() error {
+	if len(g.members) == 0 {
+		return errors.New("no servers to run")
+	}
+	results := make(chan result, len(g.members))
+	for _, m := range g.members {
+		go func() {
+			results <- result{name: m.name, err: m.run()}
+		}()
+	}
+
+	var errs []error
+	running := len(g.members)
+	select {
+	case sig := <-g.ShutDown:
+		g.Logger.Infof("group: %v: start shutdown", sig)
+	case res := <-results:
+		running--
+		// a server stopping on its own takes the rest down with it
+		g.Logger.Errorf("group: %s stopped, shutting down the rest", res.name)
+		errs = append(errs, g.wrap(res))
+	}
+	g.stop()
+
+	for ; running > 0; running-- {
+		errs = append(errs, g.wrap(<-results))
+	}
+
+	return errors.Join(errs...)
+}
+
+// stop sends a shutdown signal to every member
+func (g *Group) stop() {
+	for _, m := range g.members {
+		select {
+		case m.shutDown <- syscall.SIGTERM:
+		default:
+			// a signal is already pending
+		}
+	}
+}
+
+func (g *Group) wrap(res result) error {
+	if res.err == nil {
+		g.Logger.Infof("group: %s stopped", res.name)
+		return nil
+	}
+
+	return fmt.Errorf("%s: %w", res.name, res.err)
+}
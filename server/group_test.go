@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingMember returns a run function that waits for a shutdown signal
+func blockingMember(shutDown chan os.Signal, stopped *bool) func() error {
+	return func() error {
+		<-shutDown
+		*stopped = true
+		return nil
+	}
+}
+
+func TestGroupRun(t *testing.T) {
+	errFailed := errors.New("failed to listen")
+	scenarios := []struct {
+		name          string
+		failing       bool
+		expectedError error
+	}{
+		{
+			name: "shutdown signal stops every server",
+		},
+		{
+			name:          "failing server stops the others",
+			failing:       true,
+			expectedError: errFailed,
+		},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			g := NewGroup(logrus.New())
+			var firstStopped, secondStopped bool
+			first := make(chan os.Signal, 1)
+			second := make(chan os.Signal, 1)
+			g.Add("first", blockingMember(first, &firstStopped), first)
+			g.Add("second", blockingMember(second, &secondStopped), second)
+			if scenario.failing {
+				g.Add("failing", func() error { return errFailed }, make(chan os.Signal, 1))
+			} else {
+				g.ShutDown <- syscall.SIGTERM
+			}
+
+			done := make(chan error)
+			go func() {
+				done <- g.Run()
+			}()
+			select {
+			case err := <-done:
+				if scenario.expectedError != nil {
+					assert.ErrorIs(t, err, scenario.expectedError)
+				} else {
+					assert.NoError(t, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("group did not shut down")
+			}
+			assert.True(t, firstStopped)
+			assert.True(t, secondStopped)
+		})
+	}
+}
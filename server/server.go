@@ -8,14 +8,14 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/riyadennis/identity-server/app/proto/identity"
 	"github.com/riyadennis/ingestion-service/business"
 	"github.com/sirupsen/logrus"
 
 	"github.com/riyadennis/ingestion-service/rest"
 )
 
-// timeOut 30 seconds to support large file uploads upto 100MP
+// timeOut 30 seconds to support file uploads upto 100MB,
+// large uploads extend their own deadlines from the size of the file
 const timeOut = 30 * time.Second
 
 var (
@@ -61,8 +61,14 @@ func NewServer(restPort string) (*Server, error) {
 
 // Run registers routes and starts a webserver
 // and waits to receive from shutdown and error channels
-func (s *Server) Run(logger *logrus.Logger, bu *business.BucketUpload, client identity.IdentityClient) error {
-	s.restServer.Handler = rest.LoadRESTEndpoints(logger, bu, client)
+func (s *Server) Run(logger *logrus.Logger, bu *business.BucketUpload, auth business.Authenticator, links *business.Links) error {
+	return s.RunHandler(logger, rest.LoadRESTEndpoints(logger, bu, auth, links))
+}
+
+// RunHandler starts a webserver serving handler
+// and waits to receive from shutdown and error channels
+func (s *Server) RunHandler(logger *logrus.Logger, handler http.Handler) error {
+	s.restServer.Handler = handler
 	// Start the service
 	go func() {
 		logger.Printf("server running on port %s", s.restServer.Addr)
@@ -2,11 +2,13 @@ package storage
 
 import (
 	"context"
+	"io"
 	"os"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 type Config struct {
@@ -29,15 +31,47 @@ func NewEnvConfig(logger *logrus.Logger) Config {
 	}
 }
 
-func NewClient(cfg Config) (*minio.Client, error) {
+// Client is the minio client with OpenObject to stream objects
+type Client struct {
+	*minio.Client
+}
+
+func NewClient(cfg Config) (*Client, error) {
+	transport, err := minio.DefaultTransport(cfg.UseSSL)
+	if err != nil {
+		return nil, err
+	}
 	// Works with MinIO, GCS, S3, R2, etc.
-	return minio.New(cfg.Endpoint, &minio.Options{
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
 		Secure: cfg.UseSSL,
+		// every storage call gets a client span
+		Transport: otelhttp.NewTransport(transport),
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{Client: client}, nil
+}
+
+// OpenObject streams an object, GetObject only fails on the first read
+// so the object is stat'ed to report missing objects straight away
+func (c *Client) OpenObject(ctx context.Context, bucketName, objectName string,
+	opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	obj, err := c.GetObject(ctx, bucketName, objectName, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, err
+	}
+
+	return obj, nil
 }
 
-func (cfg *Config) MakeBucket(ctx context.Context, client *minio.Client) error {
+func (cfg *Config) MakeBucket(ctx context.Context, client *Client) error {
 	exists, err := client.BucketExists(ctx, cfg.BucketName)
 	if err != nil {
 		cfg.Logger.Errorf("Error checking if bucket exists: %v", err)